@@ -0,0 +1,317 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/hayeah/pls/openapi"
+)
+
+const apiRequestInstruction = `Write the HTTP request to this API that does what is asked. Use only the operations below.
+
+%s
+Asked: %s
+
+Respond with JSON: {"method": "GET", "path": "/orders/123", "query": {"limit": "5"}, "body": null},
+with the path parameters filled in, the query parameters in "query", and the JSON request body in
+"body", or null if there is none.`
+
+const apiRequestSchema = `{
+  "type": "object",
+  "required": ["method", "path"],
+  "properties": {
+    "method": {"enum": ["GET", "HEAD", "POST", "PUT", "PATCH", "DELETE"]},
+    "path": {"type": "string"},
+    "query": {"type": "object"}
+  }
+}`
+
+// APIConfig configures pls http
+type APIConfig struct {
+	// Spec is the OpenAPI spec of the API, as a file or an http(s) URL
+	Spec string `yaml:"spec"`
+	// BaseURL is the URL that paths are relative to, the first server of the spec by default
+	BaseURL string `yaml:"base_url"`
+	// Headers are sent with every request, e.g. Authorization: Bearer $API_TOKEN. Environment variables
+	// are expanded.
+	Headers map[string]string `yaml:"headers"`
+}
+
+type HTTPArgs struct {
+	Request string `arg:"positional,required" help:"what the request should do, e.g. \"get the last 5 orders\""`
+	Spec    string `arg:"--spec" help:"OpenAPI spec of the API, overrides api.spec of the config"`
+	Yes     bool   `arg:"-y,--yes" help:"send GET and HEAD requests without asking. Other requests are always confirmed."`
+	Then    string `arg:"--then" help:"template that is given the response as {{.Input}}, with {{.Data.status}} and {{.Data.request}}"`
+	Model   string `arg:"-m,--model" help:"model to use, overrides the config"`
+}
+
+// apiRequest is the request written by the model
+type apiRequest struct {
+	Method string         `json:"method"`
+	Path   string         `json:"path"`
+	Query  map[string]any `json:"query"`
+	Body   any            `json:"body"`
+}
+
+// runHTTP writes an API request from the OpenAPI spec, shows it, and sends it once confirmed
+func runHTTP(argv []string) error {
+	var args HTTPArgs
+	parseArgs("pls http", &args, argv)
+
+	r, err := NewRunner(Args{Model: args.Model})
+	if err != nil {
+		return err
+	}
+
+	config := r.config.API
+	mergeString(&config.Spec, args.Spec)
+	if config.Spec == "" {
+		return errors.New("http: no OpenAPI spec, set api.spec in the config or use --spec")
+	}
+
+	spec, err := r.loadSpec(config.Spec)
+	if err != nil {
+		return err
+	}
+
+	baseURL := config.BaseURL
+	if baseURL == "" && len(spec.Servers) > 0 {
+		baseURL = spec.Servers[0]
+	}
+	if baseURL == "" {
+		return errors.New("http: the spec has no servers, set api.base_url in the config")
+	}
+
+	var schema map[string]any
+	err = json.Unmarshal([]byte(apiRequestSchema), &schema)
+	if err != nil {
+		return err
+	}
+	fm := &TemplateFrontMatter{ResponseFormat: ResponseFormatJSON, JSONSchema: schema}
+	r.applyFlags(fm)
+	r.frontMatter = fm
+
+	response, err := r.completeJSON(fm, fmt.Sprintf(apiRequestInstruction, spec.Summary(), args.Request))
+	if err != nil {
+		return err
+	}
+
+	var generated apiRequest
+	err = json.Unmarshal([]byte(response), &generated)
+	if err != nil {
+		return err
+	}
+
+	req, err := newAPIRequest(baseURL, generated, config.Headers)
+	if err != nil {
+		return err
+	}
+
+	if !matchesOperation(spec, generated.Method, generated.Path) {
+		fmt.Fprintf(os.Stderr, "[warning: %s %s is not an operation of the spec]\n", generated.Method, generated.Path)
+	}
+	fmt.Fprintln(os.Stderr, curlCommand(req, generated.Body))
+
+	readOnly := req.Method == http.MethodGet || req.Method == http.MethodHead
+	if !args.Yes || !readOnly {
+		ok, err := confirm("send this request?")
+		if err != nil {
+			return err
+		}
+		if !ok {
+			fmt.Fprintln(os.Stderr, "[not sent]")
+			return nil
+		}
+	}
+
+	res, err := r.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "[%s]\n", res.Status)
+
+	var pretty bytes.Buffer
+	if json.Indent(&pretty, body, "", "  ") == nil {
+		body = pretty.Bytes()
+	}
+
+	if args.Then == "" {
+		fmt.Println(strings.TrimRight(string(body), "\n"))
+	} else {
+		err = r.runFollowUp(args.Then, string(body), res.StatusCode, req)
+		if err != nil {
+			return err
+		}
+	}
+
+	if res.StatusCode >= 400 {
+		return fmt.Errorf("http: the request failed with %s", res.Status)
+	}
+	return nil
+}
+
+// loadSpec reads the spec from a file, or fetches it
+func (r *Runner) loadSpec(location string) (*openapi.Spec, error) {
+	var data []byte
+	if strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://") {
+		res, err := r.httpClient.Get(location)
+		if err != nil {
+			return nil, err
+		}
+		defer res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("http: fetching %s: %s", location, res.Status)
+		}
+		data, err = io.ReadAll(res.Body)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		file, err := expandHome(location)
+		if err != nil {
+			return nil, err
+		}
+		data, err = os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return openapi.Parse(data)
+}
+
+func newAPIRequest(baseURL string, generated apiRequest, headers map[string]string) (*http.Request, error) {
+	u, err := url.Parse(strings.TrimSuffix(baseURL, "/") + "/" + strings.TrimPrefix(generated.Path, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("http: %w", err)
+	}
+
+	query := u.Query()
+	for name, value := range generated.Query {
+		query.Set(name, fmt.Sprint(value))
+	}
+	u.RawQuery = query.Encode()
+
+	var body io.Reader
+	if generated.Body != nil {
+		encoded, err := json.Marshal(generated.Body)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(encoded)
+	}
+
+	req, err := http.NewRequest(strings.ToUpper(generated.Method), u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	for name, value := range headers {
+		req.Header.Set(name, os.ExpandEnv(value))
+	}
+	return req, nil
+}
+
+// matchesOperation reports whether the path fits a path template of the spec for the method, like
+// /orders/123 fits /orders/{id}
+func matchesOperation(spec *openapi.Spec, method string, path string) bool {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for _, op := range spec.Operations {
+		if !strings.EqualFold(op.Method, method) {
+			continue
+		}
+
+		template := strings.Split(strings.Trim(op.Path, "/"), "/")
+		if len(template) != len(segments) {
+			continue
+		}
+
+		matched := true
+		for i, part := range template {
+			if part != segments[i] && !(strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}")) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+// curlCommand shows the request as a curl command. The values of the configured headers are elided,
+// since they're usually credentials.
+func curlCommand(req *http.Request, body any) string {
+	parts := []string{"curl", "-X", req.Method, shellQuote(req.URL.String())}
+
+	var names []string
+	for name := range req.Header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value := req.Header.Get(name)
+		if name != "Accept" && name != "Content-Type" {
+			value = "..."
+		}
+		parts = append(parts, "-H", shellQuote(name+": "+value))
+	}
+
+	if body != nil {
+		encoded, _ := json.Marshal(body)
+		parts = append(parts, "-d", shellQuote(string(encoded)))
+	}
+	return strings.Join(parts, " ")
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// runFollowUp renders the template with the response, and runs it
+func (r *Runner) runFollowUp(template string, response string, status int, req *http.Request) error {
+	r.args.PromptFile = template
+	text, err := r.ReadTemplate()
+	if err != nil {
+		return err
+	}
+
+	prompt, fm, err := RenderTemplate(text, TemplateData{
+		Input: response,
+		Data: map[string]any{
+			"status":  status,
+			"request": req.Method + " " + req.URL.String(),
+		},
+	})
+	if err != nil {
+		return err
+	}
+	r.applyFlags(fm)
+	r.frontMatter = fm
+
+	stream, err := r.OutputStream(prompt, fm)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	return r.WriteOutput(stream)
+}
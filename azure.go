@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// AzureConfig points pls at an Azure OpenAI resource instead of api.openai.com
+type AzureConfig struct {
+	// Endpoint is the resource URL, e.g. https://my-resource.openai.azure.com/
+	Endpoint string `yaml:"endpoint"`
+	// Deployment serves every model that is not listed in Deployments
+	Deployment string `yaml:"deployment"`
+	// Deployments maps model names to the deployments serving them
+	Deployments map[string]string `yaml:"deployments"`
+	APIVersion  string            `yaml:"api_version"`
+	APIKeyEnv   string            `yaml:"api_key_env"`
+}
+
+// Enabled reports whether an Azure endpoint is configured
+func (c *AzureConfig) Enabled() bool {
+	return c.Endpoint != ""
+}
+
+// ClientConfig returns the go-openai config for the default deployment
+func (c *AzureConfig) ClientConfig() openai.ClientConfig {
+	config := openai.DefaultAzureConfig(os.Getenv(c.APIKeyEnv), c.Endpoint, c.Deployment)
+	if c.APIVersion != "" {
+		config.APIVersion = c.APIVersion
+	}
+	return config
+}
+
+// SetDeployments routes models to their Azure deployments. Unlisted models use the default deployment.
+func SetDeployments(deployments map[string]string) ChatOptions {
+	return func(c *Chat) {
+		c.deployments = deployments
+	}
+}
+
+// chatCompletionsRequest builds a raw chat completion request for the OpenAI or Azure API, for requests
+// go-openai can't make
+func (r *Runner) chatCompletionsRequest(ctx context.Context, model string, body io.Reader) (*http.Request, error) {
+	endpoint := r.chat.clientConfig.BaseURL + "/chat/completions"
+
+	azure := r.config.Azure
+	if azure.Enabled() {
+		deployment, ok := azure.Deployments[model]
+		if !ok {
+			deployment = azure.Deployment
+		}
+		endpoint = fmt.Sprintf("%s/openai/deployments/%s/chat/completions?api-version=%s",
+			strings.TrimSuffix(azure.Endpoint, "/"), deployment, r.chat.clientConfig.APIVersion)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	if azure.Enabled() {
+		req.Header.Set("api-key", os.Getenv(azure.APIKeyEnv))
+	} else {
+		req.Header.Set("Authorization", "Bearer "+r.config.APIKey())
+	}
+
+	r.config.Request.Apply(req)
+
+	return req, nil
+}
+
+// requestBody returns the request as a JSON object, to add the parameters go-openai doesn't support
+// yet. The response isn't streamed.
+func requestBody(req openai.ChatCompletionRequest) (map[string]any, error) {
+	encoded, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var body map[string]any
+	err = json.Unmarshal(encoded, &body)
+	if err != nil {
+		return nil, err
+	}
+	body["stream"] = false
+
+	return body, nil
+}
+
+// postCompletion sends the raw request body, and decodes the completion into v
+func (r *Runner) postCompletion(model string, body map[string]any, v any) error {
+	encoded, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	var request struct {
+		Messages []struct {
+			Content json.RawMessage `json:"content"`
+		} `json:"messages"`
+		MaxTokens int `json:"max_tokens"`
+	}
+	err = json.Unmarshal(encoded, &request)
+	if err != nil {
+		return err
+	}
+	var messages []string
+	var images int
+	for _, message := range request.Messages {
+		text, n := messageText(message.Content)
+		messages = append(messages, text)
+		images += n
+	}
+
+	// tool calls aren't cached, since replaying them would call the tools again
+	cache := r.chat.cache
+	var key string
+	if _, ok := body["tools"]; cache != nil && !ok {
+		key, err = cacheKey(r.chat.clientConfig.BaseURL, body)
+		if err != nil {
+			return err
+		}
+
+		cached, ok, err := cache.get(key)
+		if err != nil {
+			return err
+		}
+		if ok {
+			r.recordUsage(completionUsage(model, messages, cached.Body, 0, true))
+			return json.Unmarshal(cached.Body, v)
+		}
+	}
+
+	promptTokens := images * imageTokens
+	for _, message := range messages {
+		promptTokens += countTokens(model, message)
+	}
+	releaseBudget, err := r.chat.budget.reserveTokens(model, promptTokens, request.MaxTokens)
+	if err != nil {
+		return err
+	}
+	defer releaseBudget()
+
+	limiter := r.chat.limiter
+	tokens := limiter.requestTokens(model, messages, request.MaxTokens)
+	if tokens > 0 {
+		tokens += images * imageTokens
+	}
+	release, err := limiter.acquire(r.chat.ctx, tokens)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	req, err := r.chatCompletionsRequest(r.chat.ctx, model, bytes.NewReader(encoded))
+	if err != nil {
+		return err
+	}
+
+	start := time.Now()
+	progress := r.startProgress(model)
+	var completion json.RawMessage
+	err = doJSONWith(r.httpClient, req, &completion)
+	progress.stop()
+	if err != nil {
+		return err
+	}
+	r.recordUsage(completionUsage(model, messages, completion, time.Since(start), false))
+
+	if key != "" {
+		err = cache.put(key, cachedResponse{Model: model, Body: completion})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "[cache: %v]\n", err)
+		}
+	}
+	return json.Unmarshal(completion, v)
+}
+
+// imageTokens is the most prompt tokens an image counts as, at high detail, for the estimates of the
+// budget and the rate limit
+const imageTokens = 1105
+
+// messageText is the text of a message's content, which is a string or a list of parts like text and
+// images. It also returns the number of images.
+func messageText(content json.RawMessage) (string, int) {
+	var text string
+	if json.Unmarshal(content, &text) == nil {
+		return text, 0
+	}
+
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	json.Unmarshal(content, &parts)
+
+	var texts []string
+	var images int
+	for _, part := range parts {
+		switch part.Type {
+		case "text":
+			texts = append(texts, part.Text)
+		case "image_url":
+			images++
+		}
+	}
+	return strings.Join(texts, "\n"), images
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMessageText(t *testing.T) {
+	testCases := []struct {
+		name    string
+		content string
+		text    string
+		images  int
+	}{
+		{name: "string", content: `"Summarize it."`, text: "Summarize it."},
+		{name: "parts", content: `[{"type": "text", "text": "Transcribe"}, {"type": "image_url", "image_url": {"url": "data:image/png;base64,AA"}}, {"type": "text", "text": "this"}]`, text: "Transcribe\nthis", images: 1},
+		{name: "empty", content: `null`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			text, images := messageText(json.RawMessage(tc.content))
+			assert.Equal(t, tc.text, text)
+			assert.Equal(t, tc.images, images)
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// BackupConfig configures the backups --replace makes of the file it rewrites
+type BackupConfig struct {
+	// Dir collects the backups. They are made next to the file if empty.
+	Dir string `yaml:"dir"`
+	// Keep is how many backups of a file are kept. 0 keeps all of them.
+	Keep int `yaml:"keep"`
+	// Disabled skips backups
+	Disabled bool `yaml:"disabled"`
+}
+
+// backupConfig returns the backup config, overridden by the CLI flags
+func (r *Runner) backupConfig() (BackupConfig, error) {
+	config := r.config.Backup
+	mergeString(&config.Dir, r.args.BackupDir)
+	if r.args.KeepBackups != 0 {
+		config.Keep = r.args.KeepBackups
+	}
+	// the snapshot of a bulk operation has the files already
+	if r.args.NoBackup || r.snapshot != "" {
+		config.Disabled = true
+	}
+
+	if config.Dir != "" {
+		dir, err := expandHome(config.Dir)
+		if err != nil {
+			return BackupConfig{}, err
+		}
+		config.Dir = dir
+	}
+
+	return config, nil
+}
+
+// backupStamp suffixes the backups. Microseconds keep two backups made in the same second apart.
+const backupStamp = "2006-01-02T15:04:05.000000Z07:00"
+
+// backupName is the name the backups of the file start with. Backups in a shared directory add a hash
+// of the file's path, so files of the same name in different directories don't share backups.
+func backupName(filename string, config BackupConfig) (string, error) {
+	name := filepath.Base(filename)
+	if config.Dir == "" {
+		return name, nil
+	}
+
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(abs))
+	return name + "-" + hex.EncodeToString(sum[:4]), nil
+}
+
+// backupFile backups by making a copy suffixed with timestamp, then removes the backups beyond the
+// retention limit. It returns the backup, or "" if backups are disabled.
+func backupFile(filename string, config BackupConfig) (string, error) {
+	if config.Disabled {
+		return "", nil
+	}
+
+	dir := config.Dir
+	if dir == "" {
+		dir = filepath.Dir(filename)
+	}
+
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return "", err
+	}
+
+	name, err := backupName(filename, config)
+	if err != nil {
+		return "", err
+	}
+
+	// an existing backup is never overwritten, the timestamp is taken again instead
+	var backupFilename string
+	for {
+		backupFilename = filepath.Join(dir, fmt.Sprintf("%s.%s", name, time.Now().Format(backupStamp)))
+		err = copyFileExcl(filename, backupFilename)
+		if !errors.Is(err, fs.ErrExist) {
+			break
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if config.Keep > 0 {
+		err = pruneBackups(dir, name, config.Keep)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return backupFilename, nil
+}
+
+// copyFileExcl copies the file to dst, failing if dst exists
+func copyFileExcl(src string, dst string) error {
+	file, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(out, file)
+	return errors.Join(err, out.Close())
+}
+
+// pruneBackups keeps the newest backups of the file, and removes the rest
+func pruneBackups(dir string, name string, keep int) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	type backup struct {
+		name string
+		time time.Time
+	}
+	var backups []backup
+	for _, entry := range entries {
+		suffix, ok := strings.CutPrefix(entry.Name(), name+".")
+		if !ok || entry.IsDir() {
+			continue
+		}
+
+		// only the timestamped copies are backups, not e.g. file.md.orig. Backups made before the
+		// stamp had microseconds are in whole seconds.
+		stamp, err := time.Parse(backupStamp, suffix)
+		if err != nil {
+			stamp, err = time.Parse(time.RFC3339, suffix)
+		}
+		if err != nil {
+			continue
+		}
+		backups = append(backups, backup{entry.Name(), stamp})
+	}
+
+	if len(backups) <= keep {
+		return nil
+	}
+
+	sort.Slice(backups, func(i, j int) bool { return backups[i].time.Before(backups[j].time) })
+	for _, backup := range backups[:len(backups)-keep] {
+		err := os.Remove(filepath.Join(dir, backup.name))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackupFile(t *testing.T) {
+	root := t.TempDir()
+	backups := filepath.Join(t.TempDir(), "backups")
+	for _, dir := range []string{"a", "b"} {
+		assert.NoError(t, os.MkdirAll(filepath.Join(root, dir), 0755))
+		assert.NoError(t, os.WriteFile(filepath.Join(root, dir, "README.md"), []byte(dir), 0644))
+	}
+	config := BackupConfig{Dir: backups, Keep: 2}
+
+	var madeA []string
+	for i := 0; i < 3; i++ {
+		backup, err := backupFile(filepath.Join(root, "a", "README.md"), config)
+		assert.NoError(t, err)
+		madeA = append(madeA, backup)
+	}
+	backupB, err := backupFile(filepath.Join(root, "b", "README.md"), config)
+	assert.NoError(t, err)
+
+	// the backups of one second don't overwrite each other, and are pruned per file
+	assert.NotEqual(t, madeA[1], madeA[2])
+	assert.NoFileExists(t, madeA[0])
+	assert.FileExists(t, madeA[1])
+	assert.FileExists(t, madeA[2])
+
+	content, err := os.ReadFile(backupB)
+	assert.NoError(t, err)
+	assert.Equal(t, "b", string(content))
+	content, err = os.ReadFile(madeA[2])
+	assert.NoError(t, err)
+	assert.Equal(t, "a", string(content))
+}
+
+func TestPruneBackups(t *testing.T) {
+	dir := t.TempDir()
+	files := []string{
+		"notes.md",
+		"notes.md.orig",
+		"notes.md.2024-01-02T10:00:00Z",
+		"notes.md.2024-01-02T10:00:00.500000Z",
+		"notes.md.2024-01-01T23:00:00-05:00",
+		"notes.md.2024-01-03T09:00:00.000001+01:00",
+		"notes.md-1a2b3c4d.2024-01-01T00:00:00Z",
+		"todo.md.2023-12-31T00:00:00Z",
+	}
+	for _, file := range files {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, file), nil, 0644))
+	}
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "notes.md.2020-01-01T00:00:00Z"), 0755))
+
+	assert.NoError(t, pruneBackups(dir, "notes.md", 2))
+
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	var left []string
+	for _, entry := range entries {
+		left = append(left, entry.Name())
+	}
+	sort.Strings(left)
+	assert.Equal(t, []string{
+		"notes.md",
+		"notes.md-1a2b3c4d.2024-01-01T00:00:00Z",
+		"notes.md.2020-01-01T00:00:00Z",
+		"notes.md.2024-01-02T10:00:00.500000Z",
+		"notes.md.2024-01-03T09:00:00.000001+01:00",
+		"notes.md.orig",
+		"todo.md.2023-12-31T00:00:00Z",
+	}, left)
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+type BatchArgs struct {
+	PromptFile  string            `arg:"positional,required" help:"prompt template to run on every file"`
+	Files       []string          `arg:"positional,required" help:"input files, or glob patterns like 'docs/**/*.md'"`
+	OutSuffix   string            `arg:"--out-suffix" help:"write the output of a.md to a<suffix>.md, e.g. --out-suffix .fr"`
+	OutDir      string            `arg:"--out-dir" help:"write the outputs into this directory, keeping the relative paths of the inputs"`
+	Jobs        int               `arg:"-j,--jobs" default:"4" help:"how many files are processed at once"`
+	RPM         int               `arg:"--rpm" help:"send at most this many requests per minute, overrides rate_limit.rpm of the config"`
+	TPM         int               `arg:"--tpm" help:"send at most this many tokens per minute, overrides rate_limit.tpm of the config"`
+	Concurrency int               `arg:"--concurrency" help:"at most this many requests in flight, overrides rate_limit.concurrency of the config"`
+	Model       string            `arg:"-m,--model" help:"model to use, overrides frontmatter and config"`
+	NoBackup    bool              `arg:"--no-backup" help:"don't back up outputs that are overwritten"`
+	Force       bool              `arg:"--force" help:"send requests even if the spend has reached the limits of budget in the config"`
+	Tags        map[string]string `arg:"--tag,separate" help:"tag recorded with the usage of the run, as name=value, e.g. project=payments. Reported by pls usage --by tag"`
+	GitBranch   string            `arg:"--git-branch" help:"write the outputs on a new branch from HEAD, leaving the working tree untouched. Named pls/<template>-<time> if bare, give a name as --git-branch=name."`
+
+	ProfileRender bool `arg:"--profile-render" help:"print on stderr how long rendering the prompts took, and each {{file}}, {{glob}} and {{sh}} in them"`
+}
+
+// batchFile is an input file and the path its output is written to
+type batchFile struct {
+	input  string
+	output string
+}
+
+// runBatch runs a prompt on many files concurrently, writing each output next to its input or into
+// --out-dir
+func runBatch(argv []string) error {
+	var args BatchArgs
+	parseArgs("pls batch", &args, withOptionalValues(argv))
+
+	if args.OutSuffix == "" && args.OutDir == "" {
+		return errors.New("batch: set --out-suffix or --out-dir, so outputs don't overwrite their inputs")
+	}
+
+	r, err := NewRunner(Args{
+		PromptFile: args.PromptFile,
+		Model:      args.Model,
+		NoBackup:   args.NoBackup,
+		Force:      args.Force,
+		Tags:       args.Tags,
+
+		RPM:         args.RPM,
+		TPM:         args.TPM,
+		Concurrency: args.Concurrency,
+
+		GitBranch:     args.GitBranch,
+		ProfileRender: args.ProfileRender,
+	})
+	if err != nil {
+		return err
+	}
+
+	// the includes are the same for every file, e.g. a style guide or the git log
+	includeCache = newRenderCache()
+
+	ctx, cancel := runContext(0)
+	defer cancel()
+	SetContext(ctx)(r.chat)
+
+	return r.onGitBranch(func() error {
+		return r.runBatchFiles(args)
+	})
+}
+
+// runBatchFiles runs the prompt on the files of the arguments. With --git-branch, the files are those
+// of the new branch.
+func (r *Runner) runBatchFiles(args BatchArgs) error {
+	var inputs []string
+	for _, pattern := range args.Files {
+		if !strings.ContainsAny(pattern, "*?[") {
+			inputs = append(inputs, pattern)
+			continue
+		}
+		matches, err := globFiles(pattern)
+		if err != nil {
+			return err
+		}
+		if len(matches) == 0 {
+			return fmt.Errorf("batch: no files match %q", pattern)
+		}
+		inputs = append(inputs, matches...)
+	}
+
+	var files []batchFile
+	for _, input := range inputs {
+		output, err := batchOutput(input, args.OutSuffix, args.OutDir)
+		if err != nil {
+			return err
+		}
+		files = append(files, batchFile{input: input, output: output})
+	}
+
+	var outputs []string
+	for _, file := range files {
+		outputs = append(outputs, file.output)
+	}
+	var err error
+	r.snapshot, err = r.takeSnapshot(outputs)
+	if err != nil {
+		return err
+	}
+
+	jobs := args.Jobs
+	if jobs < 1 {
+		jobs = 1
+	}
+
+	fmt.Fprintf(os.Stderr, "[batch: %s, %d at a time]\n", fileCount(len(files)), jobs)
+	start := time.Now()
+
+	errs := make([]error, len(files))
+	slots := make(chan struct{}, jobs)
+	var wg sync.WaitGroup
+	for i, file := range files {
+		slots <- struct{}{}
+		if r.chat.ctx.Err() != nil {
+			errs[i] = r.chat.ctx.Err()
+			<-slots
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, file batchFile) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			errs[i] = r.runBatchFile(file)
+		}(i, file)
+	}
+	wg.Wait()
+
+	var failed int
+	for i, err := range errs {
+		if err != nil {
+			failed++
+			fmt.Fprintf(os.Stderr, "[%s: %v]\n", files[i].input, err)
+		}
+	}
+	fmt.Fprintf(os.Stderr, "[batch: %d done, %d failed in %s]\n", len(files)-failed, failed, time.Since(start).Round(time.Second))
+
+	if includeProfile != nil {
+		err = includeProfile.Print()
+		if err != nil {
+			return err
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("batch: %d of %d files failed", failed, len(files))
+	}
+	return nil
+}
+
+// runBatchFile runs the prompt on the file, with a runner of its own that shares the chat client
+func (r *Runner) runBatchFile(file batchFile) error {
+	err := os.MkdirAll(filepath.Dir(file.output), 0755)
+	if err != nil {
+		return err
+	}
+
+	args := r.args
+	args.InputFile = file.input
+	args.OutputFile = file.output
+
+	runner := &Runner{
+		args:       args,
+		chat:       r.chat,
+		config:     r.config,
+		httpClient: r.httpClient,
+
+		templatePaths: r.templatePaths,
+
+		quiet:    true,
+		snapshot: r.snapshot,
+	}
+
+	start := time.Now()
+	err = runner.runRerendering()
+	runner.RunAfterHooks(err, time.Since(start))
+	return err
+}
+
+// batchOutput derives the output path of the input: docs/a.md with suffix .fr is docs/a.fr.md, and
+// with the out dir build, build/docs/a.fr.md
+func batchOutput(input string, suffix string, dir string) (string, error) {
+	output := input
+	if suffix != "" {
+		ext := filepath.Ext(input)
+		output = strings.TrimSuffix(input, ext) + suffix + ext
+	}
+
+	if dir != "" {
+		if filepath.IsAbs(output) {
+			return "", fmt.Errorf("batch: %s is an absolute path, which --out-dir can't mirror", input)
+		}
+		output = filepath.Clean(output)
+		if output == ".." || strings.HasPrefix(output, ".."+string(filepath.Separator)) {
+			return "", fmt.Errorf("batch: %s is outside the working directory, which --out-dir can't mirror", input)
+		}
+		output = filepath.Join(dir, output)
+	}
+
+	if filepath.Clean(output) == filepath.Clean(input) {
+		return "", fmt.Errorf("batch: the output of %s would overwrite it", input)
+	}
+	return output, nil
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/hayeah/pls/tokens"
+)
+
+// benchPrompt is the standard prompt of pls bench. It asks for a reply of predictable length, so the
+// models are compared on similar work.
+const benchPrompt = "Count from 1 to 50, separated by spaces. Output only the numbers."
+
+type BenchArgs struct {
+	Models    string `arg:"--models,required" help:"comma separated models to benchmark"`
+	N         int    `arg:"-n,--n" default:"5" help:"requests per model"`
+	Prompt    string `arg:"--prompt" help:"prompt to send instead of the standard one"`
+	MaxTokens int    `arg:"--max-tokens" default:"200" help:"completion token limit"`
+}
+
+// benchSample is the timing of one benchmark request
+type benchSample struct {
+	ttft            time.Duration
+	total           time.Duration
+	tokensPerSecond float64
+}
+
+// runBench sends the same prompt repeatedly to each model, and reports the latency percentiles
+func runBench(argv []string) error {
+	var args BenchArgs
+	parseArgs("pls bench", &args, argv)
+
+	if args.N < 1 {
+		return errors.New("--n must be at least 1")
+	}
+
+	prompt := args.Prompt
+	if prompt == "" {
+		prompt = benchPrompt
+	}
+
+	r, err := NewRunner(Args{})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "[%d requests per model to %s]\n", args.N, r.provider())
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "model\truns\terrors\tttft p50\tttft p90\ttokens/s p50\ttotal p50\ttotal p90\ttotal p99\t")
+
+	for _, model := range strings.Split(args.Models, ",") {
+		model = strings.TrimSpace(model)
+		if model == "" {
+			continue
+		}
+
+		var samples []benchSample
+		var failed int
+		for i := 0; i < args.N; i++ {
+			sample, err := r.benchRequest(model, prompt, args.MaxTokens)
+			if err != nil {
+				failed++
+				fmt.Fprintf(os.Stderr, "[%s: %v]\n", model, err)
+				continue
+			}
+			samples = append(samples, sample)
+		}
+
+		var ttft, total, speed []float64
+		for _, sample := range samples {
+			ttft = append(ttft, float64(sample.ttft))
+			total = append(total, float64(sample.total))
+			speed = append(speed, sample.tokensPerSecond)
+		}
+
+		fmt.Fprintf(w, "%s\t%d\t%d\t%s\t%s\t%.1f\t%s\t%s\t%s\t\n", model, len(samples), failed,
+			benchDuration(percentile(ttft, 50)), benchDuration(percentile(ttft, 90)),
+			percentile(speed, 50),
+			benchDuration(percentile(total, 50)), benchDuration(percentile(total, 90)), benchDuration(percentile(total, 99)))
+	}
+
+	return w.Flush()
+}
+
+// benchRequest streams one completion without retries, timing the first token and the whole request
+func (r *Runner) benchRequest(model string, prompt string, maxTokens int) (benchSample, error) {
+	noRetries := 0
+	fm := &TemplateFrontMatter{Model: model, MaxTokens: maxTokens, Retries: &noRetries}
+
+	start := time.Now()
+	stream, err := r.stream(prompt, fm)
+	if err != nil {
+		return benchSample{}, err
+	}
+	defer stream.Close()
+
+	var response strings.Builder
+	var ttft time.Duration
+	buf := make([]byte, 4096)
+	for {
+		n, err := stream.Read(buf)
+		if n > 0 && ttft == 0 {
+			ttft = time.Since(start)
+		}
+		response.Write(buf[:n])
+
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return benchSample{}, err
+		}
+	}
+	total := time.Since(start)
+
+	completion, err := tokens.Count(model, response.String())
+	if err != nil {
+		return benchSample{}, err
+	}
+
+	sample := benchSample{ttft: ttft, total: total}
+	if generating := total - ttft; generating > 0 {
+		sample.tokensPerSecond = float64(completion) / generating.Seconds()
+	}
+	return sample, nil
+}
+
+// provider describes where requests are sent
+func (r *Runner) provider() string {
+	if r.config.Azure.Enabled() {
+		return "azure " + r.config.Azure.Endpoint
+	}
+	if r.config.BaseURL != "" {
+		return r.config.BaseURL
+	}
+	return "openai"
+}
+
+// percentile returns the nearest-rank percentile of the values, or 0 if there are none
+func percentile(values []float64, p float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+
+	rank := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= len(sorted) {
+		rank = len(sorted) - 1
+	}
+	return sorted[rank]
+}
+
+func benchDuration(d float64) string {
+	return time.Duration(d).Round(time.Millisecond).String()
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// budgetWindow is the rolling period of the monthly limit
+const budgetWindow = 30 * 24 * time.Hour
+
+// BudgetConfig caps the spend on the API, as estimated from the token counts. Requests are refused
+// once a limit is reached, unless --force is given. 0 is no limit.
+type BudgetConfig struct {
+	// PerRun is the most dollars an invocation of pls spends, e.g. all the files of pls batch
+	PerRun float64 `yaml:"per_run"`
+	// Monthly is the most dollars spent in the last 30 days, as recorded by the usage log
+	Monthly float64 `yaml:"monthly"`
+}
+
+// SetBudget refuses the completions of the chat once the spend reaches the limits
+func SetBudget(budget *budgetGuard) ChatOptions {
+	return func(c *Chat) {
+		c.budget = budget
+	}
+}
+
+// budgetGuard tracks the spend of the run. A nil guard doesn't limit.
+type budgetGuard struct {
+	config BudgetConfig
+
+	mu sync.Mutex
+	// spent is the spend of this run
+	spent float64
+	// reserved is the estimated cost of the requests in flight
+	reserved float64
+	// previous is the spend of the last 30 days before this run
+	previous float64
+}
+
+// newBudgetGuard returns the guard of the configured limits, or nil if there are none or --force
+// lifts them. The monthly limit is totalled from the usage log, so it can't be set with no_usage_log.
+func newBudgetGuard(config BudgetConfig, force bool, noUsageLog bool) (*budgetGuard, error) {
+	if force || (config.PerRun <= 0 && config.Monthly <= 0) {
+		return nil, nil
+	}
+	if config.Monthly > 0 && noUsageLog {
+		return nil, errors.New("budget: the monthly limit is totalled from the usage log, which no_usage_log turns off. Remove one of them")
+	}
+
+	b := &budgetGuard{config: config}
+	if config.Monthly > 0 {
+		records, err := ReadUsage(time.Now().Add(-budgetWindow))
+		if err != nil {
+			return nil, fmt.Errorf("budget: %w", err)
+		}
+		for _, record := range records {
+			if record.Cost != nil {
+				b.previous += *record.Cost
+			}
+		}
+	}
+	return b, nil
+}
+
+// reserve returns an error if the estimated cost of the request takes the spend over a limit. Otherwise
+// it holds the estimate until release is called, once the response is read and its cost spent, so
+// concurrent requests count each other before any of them is spent.
+func (b *budgetGuard) reserve(model string, messages []string, maxTokens int) (release func(), err error) {
+	if b == nil {
+		return func() {}, nil
+	}
+
+	var promptTokens int
+	for _, message := range messages {
+		promptTokens += countTokens(model, message)
+	}
+	return b.reserveTokens(model, promptTokens, maxTokens)
+}
+
+// reserveTokens is reserve for a prompt of known length. Without a completion token limit, the
+// completion is guessed to be as long as the prompt.
+func (b *budgetGuard) reserveTokens(model string, promptTokens int, maxTokens int) (release func(), err error) {
+	if b == nil {
+		return func() {}, nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	completionTokens := maxTokens
+	if completionTokens <= 0 {
+		completionTokens = promptTokens
+	}
+	estimate, _ := Cost(model, promptTokens, completionTokens)
+
+	// the request counts before it's sent, so a large one can't go far over the limit
+	committed := b.spent + b.reserved
+	if b.config.PerRun > 0 && committed+estimate > b.config.PerRun {
+		return nil, fmt.Errorf("budget: this run has spent %s, and the next request is estimated at %s, going over the per_run limit of %s. Use --force to go over it", dollars(committed), dollars(estimate), dollars(b.config.PerRun))
+	}
+	if b.config.Monthly > 0 && b.previous+committed+estimate > b.config.Monthly {
+		return nil, fmt.Errorf("budget: %s was spent in the last 30 days, and the next request is estimated at %s, going over the monthly limit of %s. Use --force to go over it", dollars(b.previous+committed), dollars(estimate), dollars(b.config.Monthly))
+	}
+	b.reserved += estimate
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			b.reserved -= estimate
+		})
+	}, nil
+}
+
+// spend adds the cost of a completion to the run
+func (b *budgetGuard) spend(cost float64) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.spent += cost
+}
+
+// dollars formats an amount with cents, or with 4 decimals if it's below a dollar
+func dollars(amount float64) string {
+	if amount >= 1 {
+		return fmt.Sprintf("$%.2f", amount)
+	}
+	return fmt.Sprintf("$%.4f", amount)
+}
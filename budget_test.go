@@ -0,0 +1,100 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBudgetReserve(t *testing.T) {
+	// gpt-4 costs $30 per million prompt tokens and $60 per million completion tokens, so 1000 of
+	// each are $0.09
+	testCases := []struct {
+		name      string
+		config    BudgetConfig
+		spent     float64
+		reserved  float64
+		previous  float64
+		maxTokens int
+		err       string
+	}{
+		{name: "fits", config: BudgetConfig{PerRun: 1}, spent: 0.5, maxTokens: 1000},
+		{name: "fits exactly", config: BudgetConfig{PerRun: 0.09}, maxTokens: 1000},
+		{
+			name:      "a large request goes over",
+			config:    BudgetConfig{PerRun: 1},
+			spent:     0.95,
+			maxTokens: 1000,
+			err:       "budget: this run has spent $0.9500, and the next request is estimated at $0.0900, going over the per_run limit of $1.00. Use --force to go over it",
+		},
+		{
+			name:      "requests in flight count",
+			config:    BudgetConfig{PerRun: 1},
+			spent:     0.5,
+			reserved:  0.45,
+			maxTokens: 1000,
+			err:       "budget: this run has spent $0.9500, and the next request is estimated at $0.0900, going over the per_run limit of $1.00. Use --force to go over it",
+		},
+		{
+			name:   "completion guessed as long as the prompt",
+			config: BudgetConfig{PerRun: 0.08},
+			err:    "budget: this run has spent $0.0000, and the next request is estimated at $0.0900, going over the per_run limit of $0.0800. Use --force to go over it",
+		},
+		{
+			name:      "monthly",
+			config:    BudgetConfig{Monthly: 10},
+			previous:  9.95,
+			maxTokens: 1000,
+			err:       "budget: $9.95 was spent in the last 30 days, and the next request is estimated at $0.0900, going over the monthly limit of $10.00. Use --force to go over it",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			b := &budgetGuard{config: tc.config, spent: tc.spent, reserved: tc.reserved, previous: tc.previous}
+			release, err := b.reserveTokens("gpt-4", 1000, tc.maxTokens)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+				assert.InDelta(t, tc.reserved, b.reserved, 1e-9)
+				return
+			}
+			assert.NoError(t, err)
+			assert.InDelta(t, tc.reserved+0.09, b.reserved, 1e-9)
+			release()
+			assert.InDelta(t, tc.reserved, b.reserved, 1e-9)
+		})
+	}
+}
+
+func TestBudgetSpend(t *testing.T) {
+	b := &budgetGuard{config: BudgetConfig{PerRun: 0.25}}
+
+	first, err := b.reserveTokens("gpt-4", 1000, 1000)
+	assert.NoError(t, err)
+	second, err := b.reserveTokens("gpt-4", 1000, 1000)
+	assert.NoError(t, err)
+
+	// both in flight hold $0.18, so a third doesn't fit
+	_, err = b.reserveTokens("gpt-4", 1000, 1000)
+	assert.Error(t, err)
+
+	// the first is spent for less than its estimate, and released twice by error paths
+	b.spend(0.03)
+	first()
+	first()
+	assert.InDelta(t, 0.09, b.reserved, 1e-9)
+	assert.InDelta(t, 0.03, b.spent, 1e-9)
+
+	third, err := b.reserveTokens("gpt-4", 1000, 1000)
+	assert.NoError(t, err)
+	second()
+	third()
+	assert.InDelta(t, 0, b.reserved, 1e-9)
+
+	// a nil guard doesn't limit
+	var unlimited *budgetGuard
+	release, err := unlimited.reserve("gpt-4", []string{"hi"}, 0)
+	assert.NoError(t, err)
+	release()
+	unlimited.spend(1)
+}
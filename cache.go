@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// CacheConfig configures the response cache, which returns the saved response when the same prompt is
+// sent again with the same model and parameters
+type CacheConfig struct {
+	// Enabled caches every completion, like --cache
+	Enabled bool `yaml:"enabled"`
+	// TTL is how long cached responses are used, e.g. 24h. Empty never expires them.
+	TTL string `yaml:"ttl"`
+}
+
+// cachedResponse is a response saved in the cache directory
+type cachedResponse struct {
+	Created  time.Time       `json:"created"`
+	Model    string          `json:"model"`
+	Response string          `json:"response,omitempty"`
+	Body     json.RawMessage `json:"body,omitempty"`
+}
+
+// responseCache stores the responses of completions by the hash of their requests
+type responseCache struct {
+	dir string
+	ttl time.Duration
+}
+
+// SetCache returns the saved responses of requests that were sent before, and saves the new ones
+func SetCache(cache *responseCache) ChatOptions {
+	return func(c *Chat) {
+		c.cache = cache
+	}
+}
+
+// CacheDir returns the directory for pls caches, under $XDG_CACHE_HOME or ~/.cache
+func CacheDir() (string, error) {
+	cacheHome := os.Getenv("XDG_CACHE_HOME")
+	if cacheHome == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		cacheHome = filepath.Join(home, ".cache")
+	}
+	return filepath.Join(cacheHome, "pls"), nil
+}
+
+// newResponseCache returns the cache if it's enabled by --cache or the config, and not disabled by
+// --no-cache. It's nil otherwise.
+func newResponseCache(config CacheConfig, args Args) (*responseCache, error) {
+	if args.NoCache || !(args.Cache || config.Enabled) {
+		return nil, nil
+	}
+
+	ttl := args.CacheTTL
+	if ttl == 0 && config.TTL != "" {
+		var err error
+		ttl, err = time.ParseDuration(config.TTL)
+		if err != nil {
+			return nil, fmt.Errorf("cache: ttl: %w", err)
+		}
+	}
+
+	dir, err := CacheDir()
+	if err != nil {
+		return nil, err
+	}
+
+	return &responseCache{dir: filepath.Join(dir, "responses"), ttl: ttl}, nil
+}
+
+// cacheKey hashes everything that changes the response: the API server and the request, with its
+// model, messages and sampling parameters
+func cacheKey(baseURL string, request any) (string, error) {
+	encoded, err := json.Marshal(request)
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	h.Write([]byte(baseURL))
+	h.Write([]byte{0})
+	h.Write(encoded)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func (c *responseCache) path(key string) string {
+	return filepath.Join(c.dir, key[:2], key+".json")
+}
+
+// get returns the cached response of the key. ok is false if there is none, or it has expired.
+func (c *responseCache) get(key string) (response cachedResponse, ok bool, err error) {
+	content, err := os.ReadFile(c.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return response, false, nil
+	}
+	if err != nil {
+		return response, false, err
+	}
+
+	err = json.Unmarshal(content, &response)
+	if err != nil {
+		// a corrupt entry is a miss, and is overwritten by the new response
+		return response, false, nil
+	}
+
+	if c.ttl > 0 && time.Since(response.Created) > c.ttl {
+		return response, false, nil
+	}
+
+	age := time.Since(response.Created).Round(time.Second)
+	fmt.Fprintf(os.Stderr, "[cached response from %s ago, --no-cache to resend]\n", age)
+	return response, true, nil
+}
+
+// put saves the response. The file is renamed into place, so concurrent runs never read half of it.
+func (c *responseCache) put(key string, response cachedResponse) error {
+	response.Created = time.Now()
+	content, err := json.Marshal(response)
+	if err != nil {
+		return err
+	}
+
+	path := c.path(key)
+	err = os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(path), key+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.Write(content)
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
+
+// cachingStream saves the response once the stream is read to the end
+type cachingStream struct {
+	io.ReadCloser
+	cache *responseCache
+	key   string
+	model string
+
+	received bytes.Buffer
+}
+
+func (s *cachingStream) Read(p []byte) (int, error) {
+	n, err := s.ReadCloser.Read(p)
+	s.received.Write(p[:n])
+
+	if errors.Is(err, io.EOF) {
+		putErr := s.cache.put(s.key, cachedResponse{Model: s.model, Response: s.received.String()})
+		if putErr != nil {
+			fmt.Fprintf(os.Stderr, "[cache: %v]\n", putErr)
+		}
+	}
+	return n, err
+}
+
+// cacheHit is the stream of a cached response
+type cacheHit struct {
+	io.Reader
+}
+
+func (cacheHit) Close() error {
+	return nil
+}
+
+// cachedStream returns the cached response of the request as a stream, or a stream that caches the
+// response of the request
+func (c *Chat) cachedStream(key string, model string, open func() (io.ReadCloser, error)) (io.ReadCloser, error) {
+	cached, ok, err := c.cache.get(key)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		return cacheHit{strings.NewReader(cached.Response)}, nil
+	}
+
+	stream, err := open()
+	if err != nil {
+		return nil, err
+	}
+	return &cachingStream{ReadCloser: stream, cache: c.cache, key: key, model: model}, nil
+}
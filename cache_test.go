@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResponseCache(t *testing.T) {
+	cache := &responseCache{dir: t.TempDir(), ttl: time.Hour}
+	request := map[string]any{"model": "gpt-4", "messages": []string{"hi"}}
+	key, err := cacheKey("https://api.openai.com/v1", request)
+	assert.NoError(t, err)
+
+	other, err := cacheKey("http://localhost:8080/v1", request)
+	assert.NoError(t, err)
+	assert.NotEqual(t, key, other, "the server is part of the key")
+
+	_, ok, err := cache.get(key)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	assert.NoError(t, cache.put(key, cachedResponse{Model: "gpt-4", Response: "hello"}))
+	cached, ok, err := cache.get(key)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "hello", cached.Response)
+	assert.WithinDuration(t, time.Now(), cached.Created, time.Minute)
+
+	// an entry older than the ttl is a miss
+	expired, err := json.Marshal(cachedResponse{Created: time.Now().Add(-2 * time.Hour), Model: "gpt-4", Response: "old"})
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(cache.path(key), expired, 0600))
+	_, ok, err = cache.get(key)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	// without a ttl it's used however old it is
+	forever := &responseCache{dir: cache.dir}
+	cached, ok, err = forever.get(key)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "old", cached.Response)
+
+	// a corrupt entry is a miss
+	assert.NoError(t, os.WriteFile(cache.path(key), []byte("{"), 0600))
+	_, ok, err = cache.get(key)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	// no temp files are left behind
+	entries, err := os.ReadDir(filepath.Dir(cache.path(key)))
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func TestCachingStream(t *testing.T) {
+	chat := &Chat{cache: &responseCache{dir: t.TempDir()}}
+
+	opened := 0
+	open := func() (io.ReadCloser, error) {
+		opened++
+		return io.NopCloser(strings.NewReader("streamed response")), nil
+	}
+
+	// a stream closed before its end isn't cached
+	stream, err := chat.cachedStream("aa11", "gpt-4", open)
+	assert.NoError(t, err)
+	_, err = stream.Read(make([]byte, 4))
+	assert.NoError(t, err)
+	assert.NoError(t, stream.Close())
+
+	_, ok, err := chat.cache.get("aa11")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	for i := 0; i < 2; i++ {
+		stream, err := chat.cachedStream("aa11", "gpt-4", open)
+		assert.NoError(t, err)
+		content, err := io.ReadAll(stream)
+		assert.NoError(t, err)
+		assert.Equal(t, "streamed response", string(content))
+		assert.NoError(t, stream.Close())
+	}
+	assert.Equal(t, 2, opened, "the second read is a hit")
+
+	// an error opening the stream is returned as is
+	_, err = chat.cachedStream("bb22", "gpt-4", func() (io.ReadCloser, error) { return nil, errors.New("refused") })
+	assert.EqualError(t, err, "refused")
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/hayeah/pls/ical"
+)
+
+// calendarDays is how far ahead the ics: loader looks for events
+const calendarDays = 7
+
+// LoadCalendar reads the events of an .ics file from the start of today through the next week
+func LoadCalendar(file string) (*LoadedInput, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	events, err := ical.Parse(f)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	from := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	events = ical.Between(events, from, from.AddDate(0, 0, calendarDays))
+
+	var text strings.Builder
+	var data []map[string]any
+	for _, e := range events {
+		when := e.Start.Local().Format("Mon Jan 2 15:04")
+		if e.AllDay {
+			when = e.Start.Format("Mon Jan 2") + " (all day)"
+		} else if !e.End.IsZero() {
+			when += "-" + e.End.Local().Format("15:04")
+		}
+
+		fmt.Fprintf(&text, "- %s: %s", when, e.Summary)
+		if e.Location != "" {
+			fmt.Fprintf(&text, " @ %s", e.Location)
+		}
+		fmt.Fprintln(&text)
+
+		data = append(data, map[string]any{
+			"summary":     e.Summary,
+			"description": e.Description,
+			"location":    e.Location,
+			"start":       e.Start,
+			"end":         e.End,
+			"all_day":     e.AllDay,
+		})
+	}
+
+	return &LoadedInput{
+		Input: text.String(),
+		Data:  map[string]any{"events": data},
+	}, nil
+}
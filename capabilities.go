@@ -0,0 +1,173 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/hayeah/pls/tokens"
+)
+
+const (
+	// CapabilityVision is accepting images in the messages
+	CapabilityVision = "vision"
+	// CapabilityJSONMode is response_format json
+	CapabilityJSONMode = "json_mode"
+	// CapabilityTools is calling the functions of tools
+	CapabilityTools = "tools"
+)
+
+var knownCapabilities = []string{CapabilityVision, CapabilityJSONMode, CapabilityTools}
+
+// capabilities of the models by model name prefix. The longest matching prefix wins.
+var modelCapabilities = map[string][]string{
+	"gpt-3.5-turbo":             {CapabilityJSONMode, CapabilityTools},
+	"gpt-3.5-turbo-0301":        {},
+	"gpt-3.5-turbo-0613":        {CapabilityTools},
+	"gpt-3.5-turbo-16k":         {CapabilityTools},
+	"gpt-4":                     {CapabilityTools},
+	"gpt-4-0314":                {},
+	"gpt-4-32k-0314":            {},
+	"gpt-4-turbo":               {CapabilityVision, CapabilityJSONMode, CapabilityTools},
+	"gpt-4-1106":                {CapabilityJSONMode, CapabilityTools},
+	"gpt-4-1106-vision-preview": {CapabilityVision},
+	"gpt-4-0125":                {CapabilityJSONMode, CapabilityTools},
+	"gpt-4-vision":              {CapabilityVision},
+	"gpt-4o":                    {CapabilityVision, CapabilityJSONMode, CapabilityTools},
+	"gpt-4.1":                   {CapabilityVision, CapabilityJSONMode, CapabilityTools},
+}
+
+// Requirements are what the model of a prompt must be capable of, declared by the frontmatter as a
+// list of capabilities and min_context, e.g. requires: [vision, tools, min_context: 128000]
+type Requirements struct {
+	Capabilities []string
+	// MinContext is the smallest context window in tokens
+	MinContext int
+}
+
+func (q *Requirements) UnmarshalYAML(unmarshal func(any) error) error {
+	var items []any
+	err := unmarshal(&items)
+	if err != nil {
+		return fmt.Errorf("requires must be a list, e.g. [tools, min_context: 128000]: %w", err)
+	}
+
+	for _, item := range items {
+		switch item := item.(type) {
+		case string:
+			if !containsString(knownCapabilities, item) {
+				return fmt.Errorf("requires: unknown capability %q, expected %s or min_context", item, strings.Join(knownCapabilities, ", "))
+			}
+			q.Capabilities = append(q.Capabilities, item)
+
+		case map[any]any:
+			for key, value := range item {
+				n, ok := value.(int)
+				if key != "min_context" || !ok || n < 1 {
+					return fmt.Errorf("requires: expected min_context: <tokens>, got %v: %v", key, value)
+				}
+				q.MinContext = n
+			}
+
+		default:
+			return fmt.Errorf("requires: expected a capability or min_context, got %v", item)
+		}
+	}
+	return nil
+}
+
+// capabilitiesOf returns the capabilities of the model, from the capabilities of the config or the
+// built-in table. ok is false for models that are in neither.
+func capabilitiesOf(model string, configured map[string][]string) (capabilities []string, ok bool) {
+	matched := ""
+	for _, table := range []map[string][]string{modelCapabilities, configured} {
+		for prefix, c := range table {
+			// the config wins ties with the built-in table
+			if strings.HasPrefix(model, prefix) && len(prefix) >= len(matched) {
+				matched = prefix
+				capabilities = c
+				ok = true
+			}
+		}
+	}
+	return capabilities, ok
+}
+
+// unmet returns the requirements the model falls short of, e.g. "vision" or "min_context 128000
+// (the context is 8192)"
+func (q Requirements) unmet(model string, configured map[string][]string) []string {
+	capabilities, _ := capabilitiesOf(model, configured)
+
+	var missing []string
+	for _, capability := range q.Capabilities {
+		if !containsString(capabilities, capability) {
+			missing = append(missing, capability)
+		}
+	}
+	if window := tokens.ContextWindow(model); q.MinContext > window {
+		missing = append(missing, fmt.Sprintf("min_context %d (the context is %d)", q.MinContext, window))
+	}
+	return missing
+}
+
+// checkRequirements makes sure the model can run the prompt before it's sent. A model lacking what
+// the prompt requires is replaced by the first of capable_models in the config that has it, unless it
+// was chosen with --model.
+func (r *Runner) checkRequirements(fm *TemplateFrontMatter) error {
+	requires := fm.Requires
+	if len(requires.Capabilities) == 0 && requires.MinContext == 0 {
+		return nil
+	}
+
+	model := r.Model(fm)
+	missing := requires.unmet(model, r.config.Capabilities)
+	if len(missing) == 0 {
+		return nil
+	}
+
+	if r.args.Model == "" {
+		for _, candidate := range r.config.CapableModels {
+			if len(requires.unmet(candidate, r.config.Capabilities)) == 0 {
+				fmt.Fprintf(os.Stderr, "[%s lacks %s, using %s]\n", model, strings.Join(missing, ", "), candidate)
+				fm.Model = candidate
+				return nil
+			}
+		}
+	}
+
+	message := fmt.Sprintf("%s lacks what the prompt requires: %s.", model, strings.Join(missing, ", "))
+	if _, known := capabilitiesOf(model, r.config.Capabilities); !known {
+		message += fmt.Sprintf(" If it has them, declare them in the config, as capabilities: {%s: [...]}.", model)
+	}
+	if capable := requires.capableModels(r.config.Capabilities); len(capable) > 0 {
+		message += fmt.Sprintf(" Use --model with a model that has them, e.g. %s", strings.Join(capable, ", "))
+	}
+	return errors.New(message)
+}
+
+// capableModels returns the models of the tables that meet the requirements
+func (q Requirements) capableModels(configured map[string][]string) []string {
+	var capable []string
+	seen := map[string]bool{}
+	for _, table := range []map[string][]string{modelCapabilities, configured} {
+		for model := range table {
+			if !seen[model] && len(q.unmet(model, configured)) == 0 {
+				capable = append(capable, model)
+			}
+			seen[model] = true
+		}
+	}
+	sort.Strings(capable)
+	return capable
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
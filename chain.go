@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxChainSteps stops prompts whose next: leads back to themselves
+const maxChainSteps = 20
+
+type ChainArgs struct {
+	Prompts   []string `arg:"positional,required" help:"prompts to run in order. Each output is the input of the next prompt."`
+	InputFile string   `arg:"-f,--file" help:"input of the first prompt. Defaults to stdin."`
+	NoInput   bool     `arg:"-n,--no-input" help:"run the first prompt with no input"`
+	Model     string   `arg:"-m,--model" help:"model to use for every prompt, overrides frontmatter and config"`
+	SaveSteps string   `arg:"--save-steps" help:"save the output of each prompt in this directory"`
+
+	RPM int `arg:"--rpm" help:"send at most this many requests per minute, overrides rate_limit.rpm of the config"`
+	TPM int `arg:"--tpm" help:"send at most this many tokens per minute, overrides rate_limit.tpm of the config"`
+}
+
+// runChain pipes the output of each prompt into the next, like pls a | pls b | pls c
+func runChain(argv []string) error {
+	var args ChainArgs
+	parseArgs("pls chain", &args, argv)
+
+	r, err := NewRunner(Args{
+		PromptFile: args.Prompts[0],
+		InputFile:  args.InputFile,
+		NoInput:    args.NoInput,
+		Model:      args.Model,
+		SaveSteps:  args.SaveSteps,
+
+		RPM: args.RPM,
+		TPM: args.TPM,
+	})
+	if err != nil {
+		return err
+	}
+	r.chain = args.Prompts[1:]
+
+	return r.Run()
+}
+
+// nextPrompts returns the prompts to run after this one: the next: of the frontmatter, followed by
+// the rest of the chain
+func (r *Runner) nextPrompts(fm *TemplateFrontMatter) []string {
+	if fm.Next == "" {
+		return r.chain
+	}
+	return append([]string{fm.Next}, r.chain...)
+}
+
+// RunChain completes the prompt, and runs the next prompts with the response as their input. Only the
+// output of the last prompt is written out.
+func (r *Runner) RunChain(prompt string, fm *TemplateFrontMatter, next []string) error {
+	if r.step+1 >= maxChainSteps {
+		return fmt.Errorf("chain: more than %d steps, is there a next: cycle?", maxChainSteps)
+	}
+
+	fmt.Fprintf(os.Stderr, "[step %d: %s]\n", r.step+1, r.templatePath)
+
+	complete := r.complete
+	if fm.ResponseFormat == ResponseFormatJSON {
+		complete = r.completeJSON
+	}
+
+	response, err := complete(fm, prompt)
+	if err != nil {
+		return err
+	}
+
+	err = r.FinishCompletion(prompt, response)
+	if err != nil {
+		return err
+	}
+
+	err = r.saveStep(response)
+	if err != nil {
+		return err
+	}
+
+	step := r.forPrompt(next[0], response)
+	step.chain = next[1:]
+	return step.Run()
+}
+
+// forPrompt returns a runner for the next prompt of a chain, with the input piped from the previous
+// prompt. The flags carry over, except for how the first input is loaded.
+func (r *Runner) forPrompt(promptFile string, input string) *Runner {
+	args := r.args
+	args.PromptFile = promptFile
+	args.Input = ""
+	args.NoInput = false
+	args.OCR = false
+	args.ScriptArgs = nil
+
+	return &Runner{
+		args:       args,
+		chat:       r.chat,
+		config:     r.config,
+		httpClient: r.httpClient,
+
+		templatePaths: r.templatePaths,
+
+		pipedInput: &input,
+		step:       r.step + 1,
+	}
+}
+
+// saveStep writes the output of the step into the --save-steps directory
+func (r *Runner) saveStep(response string) error {
+	if r.args.SaveSteps == "" {
+		return nil
+	}
+
+	err := os.MkdirAll(r.args.SaveSteps, 0755)
+	if err != nil {
+		return err
+	}
+
+	name := strings.TrimSuffix(filepath.Base(r.templatePath), filepath.Ext(r.templatePath))
+	file := filepath.Join(r.args.SaveSteps, fmt.Sprintf("%02d-%s.md", r.step+1, name))
+	err = os.WriteFile(file, []byte(response), 0644)
+	if err != nil {
+		return err
+	}
+	wroteFile(file)
+
+	fmt.Fprintf(os.Stderr, "[saved step %d to %s]\n", r.step+1, fileLink(file))
+	return nil
+}
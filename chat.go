@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+type ChatArgs struct {
+	PromptFile string `arg:"positional" help:"prompt template that starts the conversation. The first message is rendered into it as {{.Input}}"`
+
+	Model       string  `arg:"-m,--model" help:"model to use, overrides frontmatter and config"`
+	Temperature float32 `arg:"-t,--temperature" help:"sampling temperature, overrides frontmatter and config"`
+	Session     string  `arg:"-s,--session" help:"continue the named conversation, and save it after every reply"`
+}
+
+// runChat is an interactive conversation. Each line read from stdin is sent as a user message, and
+// the whole conversation is sent with every request.
+func runChat(argv []string) error {
+	var args ChatArgs
+	parseArgs("pls chat", &args, argv)
+
+	r, err := NewRunner(Args{
+		PromptFile:  args.PromptFile,
+		Model:       args.Model,
+		Temperature: args.Temperature,
+		Session:     args.Session,
+	})
+	if err != nil {
+		return err
+	}
+
+	return r.Chat(os.Stdin, os.Stdout)
+}
+
+// Chat runs the conversation until EOF on in
+func (r *Runner) Chat(in io.Reader, out io.Writer) error {
+	var template string
+	var err error
+	if r.args.PromptFile != "" {
+		template, err = r.ReadTemplate()
+		if err != nil {
+			return err
+		}
+	}
+
+	fm := &TemplateFrontMatter{}
+	r.applyFlags(fm)
+
+	err = r.LoadSession(fm)
+	if err != nil {
+		return err
+	}
+
+	scanner := bufio.NewScanner(in)
+	first := true
+
+	for {
+		fmt.Fprint(os.Stderr, "> ")
+		if !scanner.Scan() {
+			break
+		}
+
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		message := line
+		if first && template != "" {
+			history := fm.Messages
+
+			var err error
+			message, fm, err = RenderTemplate(template, TemplateData{Input: line})
+			if err != nil {
+				return err
+			}
+			r.applyFlags(fm)
+			fm.Messages = append(fm.Messages, history...)
+		}
+		first = false
+
+		reply, err := r.chatTurn(message, fm, out)
+		if err != nil {
+			return err
+		}
+
+		fm.Messages = append(fm.Messages,
+			openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: message},
+			openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: reply},
+		)
+
+		err = r.SaveSession(message, reply)
+		if err != nil {
+			return err
+		}
+	}
+	fmt.Fprintln(os.Stderr)
+
+	return scanner.Err()
+}
+
+// chatTurn streams the reply to out, and returns it
+func (r *Runner) chatTurn(message string, fm *TemplateFrontMatter, out io.Writer) (string, error) {
+	stream, err := r.stream(message, fm)
+	if err != nil {
+		return "", err
+	}
+	defer stream.Close()
+
+	var reply bytes.Buffer
+	_, err = io.Copy(out, io.TeeReader(stream, &reply))
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(reply.String()), nil
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/hayeah/pls/tokens"
+)
+
+const (
+	// ChunkConcat joins the results of the chunks
+	ChunkConcat = "concat"
+	// ChunkReduce runs the prompt again on the joined results of the chunks, until it fits
+	ChunkReduce = "reduce"
+)
+
+// defaultReservedOutput is the share of the context window kept for the completion of each chunk,
+// when max_tokens isn't set
+const defaultReservedOutput = 4
+
+// promptTokens counts the tokens of the prompt, with its system message and role sections
+func promptTokens(model string, prompt string, fm *TemplateFrontMatter) (int, error) {
+	total, err := tokens.Count(model, prompt+fm.System)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, message := range fm.Messages {
+		n, err := tokens.Count(model, message.Content)
+		if err != nil {
+			return 0, err
+		}
+		total += n
+	}
+
+	return total, nil
+}
+
+// reservedOutput is the number of tokens kept for the completion
+func (r *Runner) reservedOutput(fm *TemplateFrontMatter) int {
+	if fm.MaxTokens > 0 {
+		return fm.MaxTokens
+	}
+	if maxTokens := r.chat.MaxTokens(); maxTokens > 0 {
+		return maxTokens
+	}
+	return tokens.ContextWindow(r.Model(fm)) / defaultReservedOutput
+}
+
+// fitsContext reports whether the prompt and its reserved output fit in the context window of the model
+func (r *Runner) fitsContext(prompt string, fm *TemplateFrontMatter) (bool, error) {
+	model := r.Model(fm)
+
+	n, err := promptTokens(model, prompt, fm)
+	if err != nil {
+		return false, err
+	}
+
+	return n+r.reservedOutput(fm) <= tokens.ContextWindow(model), nil
+}
+
+// RunChunked runs the prompt on chunks of the input that fit the context window, then concats the
+// results, or reduces them by running the prompt on the joined results.
+func (r *Runner) RunChunked(fm *TemplateFrontMatter) error {
+	if fm.Chunk != ChunkConcat && fm.Chunk != ChunkReduce {
+		return fmt.Errorf("chunk must be %s or %s, got %q", ChunkConcat, ChunkReduce, fm.Chunk)
+	}
+
+	input := r.templateData.Input
+	var prompt string
+	for round := 0; ; round++ {
+		var results []string
+		var last string
+		var err error
+		if r.streamedInput != nil && round == 0 {
+			// the first round reads the input that is too large for memory
+			results, last, err = r.completeChunkStream(r.streamedInput, fm)
+		} else {
+			results, last, err = r.completeChunks(input, fm)
+		}
+		if err != nil {
+			return err
+		}
+		prompt = last
+
+		reduced := strings.Join(results, "\n")
+		if fm.Chunk == ChunkConcat {
+			input = reduced
+			break
+		}
+
+		inputSize := len(input)
+		if r.streamedInput != nil && round == 0 {
+			inputSize = r.streamedInput.read
+		}
+
+		// every round has to shrink the input, or reducing never ends
+		if len(reduced) >= inputSize {
+			return fmt.Errorf("the chunk results (%d bytes) are no shorter than the input (%d bytes), so they can't be reduced", len(reduced), inputSize)
+		}
+		input = reduced
+
+		// reduce: the joined results are the input of the next round, which ends with a prompt that fits
+		prompt, fm, err = r.renderWithInput(input)
+		if err != nil {
+			return err
+		}
+
+		fits, err := r.fitsContext(prompt, fm)
+		if err != nil {
+			return err
+		}
+		if fits {
+			fmt.Fprintln(os.Stderr, "[reducing the chunk results]")
+			input, err = r.complete(fm, prompt)
+			if err != nil {
+				return err
+			}
+			break
+		}
+	}
+
+	err := r.WriteOutput(strings.NewReader(input))
+	if err != nil {
+		return err
+	}
+
+	return r.FinishCompletion(prompt, input)
+}
+
+// chunkSize returns the tokens of input that fit into each chunk, after the prompt and the output
+func (r *Runner) chunkSize(fm *TemplateFrontMatter) (int, error) {
+	model := r.Model(fm)
+
+	// the tokens of the prompt without its input are taken by every chunk
+	empty, emptyFM, err := r.renderWithInput("")
+	if err != nil {
+		return 0, err
+	}
+	overhead, err := promptTokens(model, empty, emptyFM)
+	if err != nil {
+		return 0, err
+	}
+
+	size := tokens.ContextWindow(model) - overhead - r.reservedOutput(fm)
+	if size <= r.args.ChunkOverlap {
+		return 0, fmt.Errorf("no room for the input in the context window of %s (%d tokens for the prompt, %d for the output)",
+			model, overhead, r.reservedOutput(fm))
+	}
+	return size, nil
+}
+
+// completeChunks splits the input into chunks that fit the context window, and runs the prompt on
+// each. It returns the results, and the last prompt.
+func (r *Runner) completeChunks(input string, fm *TemplateFrontMatter) ([]string, string, error) {
+	size, err := r.chunkSize(fm)
+	if err != nil {
+		return nil, "", err
+	}
+
+	chunks, err := tokens.Split(r.Model(fm), input, size, r.args.ChunkOverlap)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var results []string
+	var prompt string
+	for i, chunk := range chunks {
+		fmt.Fprintf(os.Stderr, "[chunk %d/%d]\n", i+1, len(chunks))
+
+		var result string
+		prompt, result, err = r.completeChunk(chunk)
+		if err != nil {
+			return nil, "", err
+		}
+		results = append(results, result)
+	}
+
+	return results, prompt, nil
+}
+
+// completeChunkStream is completeChunks for input read as it is split, so only the current chunk
+// and the results are in memory
+func (r *Runner) completeChunkStream(input io.Reader, fm *TemplateFrontMatter) ([]string, string, error) {
+	size, err := r.chunkSize(fm)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var results []string
+	var prompt string
+	err = tokens.SplitReader(r.Model(fm), input, size, r.args.ChunkOverlap, func(chunk string) error {
+		fmt.Fprintf(os.Stderr, "[chunk %d]\n", len(results)+1)
+
+		var result string
+		var err error
+		prompt, result, err = r.completeChunk(chunk)
+		results = append(results, result)
+		return err
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	return results, prompt, nil
+}
+
+// completeChunk runs the prompt on the chunk, returning the prompt and its trimmed result
+func (r *Runner) completeChunk(chunk string) (string, string, error) {
+	prompt, fm, err := r.renderWithInput(chunk)
+	if err != nil {
+		return "", "", err
+	}
+
+	result, err := r.complete(fm, prompt)
+	if err != nil {
+		return "", "", err
+	}
+	return prompt, strings.TrimSpace(result), nil
+}
+
+// renderWithInput renders the prompt again with another input
+func (r *Runner) renderWithInput(input string) (string, *TemplateFrontMatter, error) {
+	data := r.templateData
+	data.Input = input
+
+	prompt, fm, err := RenderTemplate(r.template, data)
+	if err != nil {
+		return "", nil, err
+	}
+	r.applyFlags(fm)
+
+	// the conversation continued with --session or --messages-in is sent with every chunk
+	fm.Messages = append(fm.Messages, r.frontMatter.Messages[len(fm.Messages):]...)
+
+	return prompt, fm, nil
+}
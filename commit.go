@@ -0,0 +1,153 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// defaultCommitTemplate writes the commit message when commit.template isn't configured
+const defaultCommitTemplate = `Write a git commit message for the staged changes below.
+
+The subject line is at most 72 characters, in the imperative mood ("Add", "Fix", not "Added"). If the
+subject isn't enough, add a blank line and a short body explaining what changed and why. Match the style
+of the recent commits. Reply with the message only, without a code fence.
+
+Recent commits:
+{{.Data.log}}
+
+Changed files:
+{{.Data.stat}}
+
+=== DIFF ===
+{{.Diff}}`
+
+// CommitConfig configures pls commit
+type CommitConfig struct {
+	// Template writes the commit message, given the staged diff as {{.Input}} and {{.Diff}}, and
+	// {{.Data.stat}}, {{.Data.log}} (recent commit subjects) and {{.Data.branch}}
+	Template string `yaml:"template"`
+}
+
+type CommitArgs struct {
+	Template   string `arg:"-t,--template" help:"template that writes the message, overrides the config"`
+	Model      string `arg:"-m,--model" help:"model to use, overrides frontmatter and config"`
+	Yes        bool   `arg:"-y,--yes" help:"commit with the message without asking"`
+	Edit       bool   `arg:"-e,--edit" help:"edit the message in git's editor before committing"`
+	RenderOnly bool   `arg:"--render-only" help:"output only the rendered prompt, without calling the API"`
+}
+
+// runCommit proposes a commit message for the staged changes, and commits with it once confirmed
+func runCommit(argv []string) error {
+	var args CommitArgs
+	parseArgs("pls commit", &args, argv)
+
+	diff, err := git("diff", "--staged")
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(diff) == "" {
+		return errors.New("no staged changes, git add the changes to commit first")
+	}
+
+	stat, err := git("diff", "--staged", "--stat")
+	if err != nil {
+		return err
+	}
+
+	// a new repository has no commits to log
+	log, _ := git("log", "-n", "10", "--format=%s")
+	branch, _ := git("branch", "--show-current")
+
+	r, err := NewRunner(Args{Model: args.Model})
+	if err != nil {
+		return err
+	}
+
+	templateName := r.config.Commit.Template
+	mergeString(&templateName, args.Template)
+
+	template := defaultCommitTemplate
+	if templateName != "" {
+		r.args.PromptFile = templateName
+		template, err = r.ReadTemplate()
+		if err != nil {
+			return err
+		}
+	}
+
+	prompt, fm, err := RenderTemplate(template, TemplateData{
+		Input: diff,
+		Diff:  diff,
+		Data: map[string]any{
+			"stat":   strings.TrimRight(stat, "\n"),
+			"log":    strings.TrimSpace(log),
+			"branch": strings.TrimSpace(branch),
+		},
+	})
+	if err != nil {
+		return err
+	}
+	r.applyFlags(fm)
+	r.frontMatter = fm
+
+	if args.RenderOnly {
+		fmt.Print(prompt)
+		return nil
+	}
+
+	fits, err := r.fitsContext(prompt, fm)
+	if err != nil {
+		return err
+	}
+	if !fits {
+		return fmt.Errorf("the staged diff is too large for %s, commit the changes in smaller parts or use a model with a longer context", r.Model(fm))
+	}
+
+	response, err := r.complete(fm, prompt)
+	if err != nil {
+		return err
+	}
+	message := strings.TrimSpace(stripCodeFence(response))
+	fmt.Println(message)
+
+	if !args.Yes {
+		ok, err := confirm("commit with this message?")
+		if err != nil {
+			return err
+		}
+		if !ok {
+			fmt.Fprintln(os.Stderr, "[not committed]")
+			return nil
+		}
+	}
+
+	commitArgs := []string{"commit", "-m", message}
+	if args.Edit {
+		commitArgs = append(commitArgs, "--edit")
+	}
+	cmd := exec.Command("git", commitArgs...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// git returns the output of a git command, with git's error message if it fails
+func git(args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		message := strings.TrimSpace(stderr.String())
+		if message == "" {
+			message = err.Error()
+		}
+		return "", fmt.Errorf("git %s: %s", args[0], message)
+	}
+	return string(out), nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const confidenceInstruction = `
+
+After your answer, on a final line by itself, state how confident you are that the answer is correct as "Confidence: N%", where N is a calibrated probability between 0 and 100.`
+
+var confidencePattern = regexp.MustCompile(`(?im)^[\s*_]*confidence[\s*_]*:[\s*_]*(\d+(?:\.\d+)?|\.\d+)\s*(%?)`)
+
+// ParseConfidence returns the last confidence stated in the response, as a percentage. It's stated as
+// a percentage like 85%, or as a probability like 0.85: numbers up to 1 without a percent sign are
+// probabilities. Values over 100% aren't confidences.
+func ParseConfidence(response string) (float64, bool) {
+	matches := confidencePattern.FindAllStringSubmatch(response, -1)
+	if len(matches) == 0 {
+		return 0, false
+	}
+	match := matches[len(matches)-1]
+
+	confidence, err := strconv.ParseFloat(match[1], 64)
+	if err != nil {
+		return 0, false
+	}
+	if match[2] == "" && confidence <= 1 {
+		confidence *= 100
+	}
+	if confidence > 100 {
+		return 0, false
+	}
+
+	return confidence, true
+}
+
+// CheckConfidence reports the stated confidence on stderr, and fails if it is below --min-confidence
+func (r *Runner) CheckConfidence(response string) error {
+	confidence, ok := ParseConfidence(response)
+	if !ok {
+		fmt.Fprintln(os.Stderr, "[confidence: not stated]")
+		if r.args.MinConfidence > 0 {
+			return fmt.Errorf("no confidence stated, required at least %g%%", r.args.MinConfidence)
+		}
+		return nil
+	}
+
+	fmt.Fprintf(os.Stderr, "[confidence: %g%%]\n", confidence)
+
+	if confidence < r.args.MinConfidence {
+		return fmt.Errorf("confidence %g%% is below the threshold of %g%%", confidence, r.args.MinConfidence)
+	}
+
+	return nil
+}
+
+// RunEscalating buffers the response, and re-runs the prompt with the escalation model if the
+// stated confidence is below the threshold.
+func (r *Runner) RunEscalating(prompt string, frontMatter *TemplateFrontMatter) error {
+	response, err := r.complete(frontMatter, prompt)
+	if err != nil {
+		return err
+	}
+
+	confidence, ok := ParseConfidence(response)
+	if !ok || confidence < r.args.MinConfidence {
+		fmt.Fprintf(os.Stderr, "[confidence too low, escalating to %s]\n", r.args.EscalateModel)
+
+		escalated := *frontMatter
+		escalated.Model = r.args.EscalateModel
+		response, err = r.complete(&escalated, prompt)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = r.WriteOutput(strings.NewReader(response))
+	if err != nil {
+		return err
+	}
+
+	return r.FinishCompletion(prompt, response)
+}
+
+func (r *Runner) complete(frontMatter *TemplateFrontMatter, prompt string) (string, error) {
+	stream, err := r.stream(prompt, frontMatter)
+	if err != nil {
+		return "", err
+	}
+	defer stream.Close()
+
+	response, err := io.ReadAll(stream)
+	if err != nil {
+		return "", err
+	}
+
+	return string(response), nil
+}
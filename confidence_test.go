@@ -0,0 +1,34 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseConfidence(t *testing.T) {
+	testCases := []struct {
+		name       string
+		response   string
+		confidence float64
+		ok         bool
+	}{
+		{name: "percent", response: "The answer is 4.\n\nConfidence: 85%", confidence: 85, ok: true},
+		{name: "decimal percent", response: "**Confidence:** 92.5 %", confidence: 92.5, ok: true},
+		{name: "probability", response: "The answer is 4.\nconfidence: 0.85", confidence: 85, ok: true},
+		{name: "percent without a percent sign", response: "Confidence: 80", confidence: 80, ok: true},
+		{name: "last of several", response: "Confidence: 40%\nOn second thought...\nConfidence: 70%", confidence: 70, ok: true},
+		{name: "missing", response: "The answer is 4."},
+		{name: "not a number", response: "Confidence: high"},
+		{name: "out of range", response: "Confidence: 150%"},
+		{name: "out of range without a percent sign", response: "Confidence: 250"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			confidence, ok := ParseConfidence(tc.response)
+			assert.Equal(t, tc.ok, ok)
+			assert.InDelta(t, tc.confidence, confidence, 1e-9)
+		})
+	}
+}
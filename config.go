@@ -0,0 +1,568 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/hayeah/pls/promptstr"
+)
+
+// Config holds defaults for every run. Values are merged in order of precedence (lowest first):
+//
+//	built-in defaults < ~/.config/pls/config.yaml < .pls.yaml < prompt frontmatter < CLI flags
+type Config struct {
+	Model       string  `yaml:"model"`
+	Temperature float32 `yaml:"temperature"`
+	MaxTokens   int     `yaml:"max_tokens"`
+	// Retries is how many times rate limits and transient errors are retried
+	Retries *int `yaml:"retries"`
+
+	BaseURL string `yaml:"base_url"`
+	// APIKeyEnv is the name of the environment variable holding the API key
+	APIKeyEnv string `yaml:"api_key_env"`
+
+	// Azure sends requests to an Azure OpenAI resource, overriding base_url
+	Azure AzureConfig `yaml:"azure"`
+
+	// Request adds headers and query parameters to API requests
+	Request RequestShaping `yaml:"request"`
+
+	// Transport tunes the HTTP connections to the API
+	Transport TransportConfig `yaml:"transport"`
+
+	// Capabilities declare what models can do, for the requires of prompts, by model name prefix. They
+	// add to the built-in table, e.g. llama3.1: [tools]
+	Capabilities map[string][]string `yaml:"capabilities"`
+	// CapableModels are used in order when the model lacks what a prompt requires
+	CapableModels []string `yaml:"capable_models"`
+
+	// RateLimit paces the requests of batches, chains and chunked inputs
+	RateLimit RateLimitConfig `yaml:"rate_limit"`
+
+	// Cache reuses the responses of prompts that were sent before
+	Cache CacheConfig `yaml:"cache"`
+
+	// Budget limits the spend per run and per month
+	Budget BudgetConfig `yaml:"budget"`
+
+	// NoRunLog stops recording the transcripts of runs, that pls feedback rates
+	NoRunLog bool `yaml:"no_run_log"`
+	// NoUsageLog stops recording the tokens and cost of requests, that pls usage reports
+	NoUsageLog bool `yaml:"no_usage_log"`
+	// UsageReport mirrors the records of the usage log to a server
+	UsageReport UsageReportConfig `yaml:"usage_report"`
+	// NoRender writes the raw markdown to terminals too, as if --no-render was always given
+	NoRender bool `yaml:"no_render"`
+
+	// Stats is the end of run summary on stderr: off, minimal or full
+	Stats string `yaml:"stats"`
+
+	// MaxMemory is the largest input loaded into memory, e.g. 256MB. Larger inputs are streamed
+	// through the chunker.
+	MaxMemory string `yaml:"max_memory"`
+
+	// MissingInput is what to do when input is given but the template never uses it: warn, error or ignore
+	MissingInput string `yaml:"missing_input"`
+
+	// OnConflict is what happens when the file a response replaces changed while it was generated:
+	// abort, merge or rerender
+	OnConflict string `yaml:"on_conflict"`
+
+	// Locale formats the numbers and weeks of templates, e.g. de_DE. LC_ALL, LC_NUMERIC or LANG by default.
+	Locale string `yaml:"locale"`
+
+	// FrontmatterDelimiters replace the default ---, +++ and <!--- ---> delimiters
+	FrontmatterDelimiters []promptstr.Delimiter `yaml:"frontmatter_delimiters"`
+
+	// Redact are regular expressions the redact output filter replaces with [REDACTED]
+	Redact []string `yaml:"redact"`
+
+	// Backup configures the backups made by --replace
+	Backup BackupConfig `yaml:"backup"`
+	// Snapshot configures the snapshots taken before pls batch and --edit
+	Snapshot SnapshotConfig `yaml:"snapshot"`
+
+	// ReplaceChecks must pass before --replace overwrites a file
+	ReplaceChecks ReplaceChecks `yaml:"replace_checks"`
+
+	// Profile is the user profile, prepended to the system message of templates with use_profile.
+	// Defaults to profile.md next to the global config.
+	Profile string `yaml:"profile"`
+
+	// Hooks run for every prompt, before the hooks declared by the template
+	Hooks Hooks `yaml:"hooks"`
+
+	// Plugins are executables providing template functions, input loaders and output sinks
+	Plugins []string `yaml:"plugins"`
+
+	Jira   JiraConfig   `yaml:"jira"`
+	Linear LinearConfig `yaml:"linear"`
+	IMAP   IMAPConfig   `yaml:"imap"`
+	SQL    SQLConfig    `yaml:"sql"`
+	K8s    K8sConfig    `yaml:"k8s"`
+	API    APIConfig    `yaml:"api"`
+
+	Note   NoteConfig   `yaml:"note"`
+	Commit CommitConfig `yaml:"commit"`
+	Review ReviewConfig `yaml:"review"`
+	OCR    OCRConfig    `yaml:"ocr"`
+
+	Proxy ProxyConfig `yaml:"proxy"`
+
+	// project are the settings of .pls.yaml held back until --allow-exec
+	project *projectSettings
+}
+
+// projectSettings are the settings of a project config that run commands, pick the hosts and
+// environment variables credentials are sent from, or read files into prompts. A .pls.yaml comes with
+// the repo it's found in, so like {{sh}} they need --allow-exec.
+type projectSettings struct {
+	file string
+	// held are the settings taken out of the project config
+	held Config
+	// names are the keys of the held settings
+	names []string
+}
+
+// holdBack takes the settings that need --allow-exec out of the project config
+func (c *Config) holdBack(file string) *projectSettings {
+	p := &projectSettings{file: file}
+	held := &p.held
+
+	holdString := func(name string, from *string, to *string) {
+		if *from != "" {
+			*to, *from = *from, ""
+			p.names = append(p.names, name)
+		}
+	}
+	holdMap := func(name string, from *map[string]string, to *map[string]string) {
+		if len(*from) > 0 {
+			*to, *from = *from, nil
+			p.names = append(p.names, name)
+		}
+	}
+
+	if !c.Hooks.Empty() {
+		held.Hooks, c.Hooks = c.Hooks, Hooks{}
+		p.names = append(p.names, "hooks")
+	}
+	if len(c.Plugins) > 0 {
+		held.Plugins, c.Plugins = c.Plugins, nil
+		p.names = append(p.names, "plugins")
+	}
+	holdString("note.record_command", &c.Note.RecordCommand, &held.Note.RecordCommand)
+	holdString("ocr.command", &c.OCR.Command, &held.OCR.Command)
+	holdString("base_url", &c.BaseURL, &held.BaseURL)
+	holdString("api_key_env", &c.APIKeyEnv, &held.APIKeyEnv)
+	holdString("azure.endpoint", &c.Azure.Endpoint, &held.Azure.Endpoint)
+	holdString("azure.api_key_env", &c.Azure.APIKeyEnv, &held.Azure.APIKeyEnv)
+	holdString("jira.url", &c.Jira.URL, &held.Jira.URL)
+	holdString("jira.token_env", &c.Jira.TokenEnv, &held.Jira.TokenEnv)
+	holdString("linear.token_env", &c.Linear.TokenEnv, &held.Linear.TokenEnv)
+	holdString("sql.url", &c.SQL.URL, &held.SQL.URL)
+	holdMap("sql.databases", &c.SQL.Databases, &held.SQL.Databases)
+	holdString("api.spec", &c.API.Spec, &held.API.Spec)
+	holdString("api.base_url", &c.API.BaseURL, &held.API.BaseURL)
+	holdMap("api.headers", &c.API.Headers, &held.API.Headers)
+	holdString("usage_report.url", &c.UsageReport.URL, &held.UsageReport.URL)
+	holdString("usage_report.token_env", &c.UsageReport.TokenEnv, &held.UsageReport.TokenEnv)
+	holdString("profile", &c.Profile, &held.Profile)
+
+	if len(p.names) == 0 {
+		return nil
+	}
+	return p
+}
+
+// AllowProject applies the held back settings of the project config with --allow-exec. They're
+// skipped otherwise, with a warning.
+func (c *Config) AllowProject(allow bool) {
+	p := c.project
+	if p == nil {
+		return
+	}
+
+	if !allow {
+		fmt.Fprintf(os.Stderr, "[%s sets %s, skipped without --allow-exec]\n", p.file, strings.Join(p.names, ", "))
+		return
+	}
+
+	c.Merge(&p.held)
+}
+
+// DefaultConfig returns the built-in defaults
+func DefaultConfig() *Config {
+	retries := 2
+	minLength := 50
+	enabled := true
+
+	return &Config{
+		Retries:      &retries,
+		APIKeyEnv:    "OPENAI_SECRET",
+		MissingInput: MissingInputWarn,
+		OnConflict:   ConflictAbort,
+		Stats:        StatsOff,
+
+		Azure: AzureConfig{APIKeyEnv: "AZURE_OPENAI_API_KEY"},
+
+		// the default of 2 idle connections per host closes most connections of concurrent requests
+		Transport: TransportConfig{MaxIdleConnsPerHost: 16},
+
+		ReplaceChecks: ReplaceChecks{
+			MinLength:  &minLength,
+			Syntax:     &enabled,
+			KeepHeader: &enabled,
+		},
+
+		UsageReport: UsageReportConfig{TokenEnv: "PLS_USAGE_TOKEN"},
+
+		Jira:   JiraConfig{TokenEnv: "JIRA_API_TOKEN"},
+		Linear: LinearConfig{TokenEnv: "LINEAR_API_KEY"},
+		IMAP:   IMAPConfig{PasswordEnv: "IMAP_PASSWORD"},
+		K8s:    K8sConfig{Since: "1h", TailLines: 500},
+
+		Snapshot: SnapshotConfig{Keep: 20},
+
+		Note: NoteConfig{
+			RecordCommand: `rec -q "$PLS_AUDIO_FILE"`,
+			File:          "~/notes.md",
+		},
+		OCR:   OCRConfig{Model: "gpt-4-vision-preview"},
+		Proxy: ProxyConfig{Listen: "127.0.0.1:8443"},
+	}
+}
+
+// Merge overrides the config with the non-zero values of other
+func (c *Config) Merge(other *Config) {
+	if other.Model != "" {
+		c.Model = other.Model
+	}
+
+	if other.Temperature != 0 {
+		c.Temperature = other.Temperature
+	}
+
+	if other.MaxTokens != 0 {
+		c.MaxTokens = other.MaxTokens
+	}
+
+	if other.Retries != nil {
+		c.Retries = other.Retries
+	}
+
+	if other.BaseURL != "" {
+		c.BaseURL = other.BaseURL
+	}
+
+	if other.APIKeyEnv != "" {
+		c.APIKeyEnv = other.APIKeyEnv
+	}
+
+	mergeString(&c.Azure.Endpoint, other.Azure.Endpoint)
+	mergeString(&c.Azure.Deployment, other.Azure.Deployment)
+	mergeString(&c.Azure.APIVersion, other.Azure.APIVersion)
+	mergeString(&c.Azure.APIKeyEnv, other.Azure.APIKeyEnv)
+	if len(other.Azure.Deployments) > 0 {
+		c.Azure.Deployments = other.Azure.Deployments
+	}
+
+	c.Request.Headers = mergeMap(c.Request.Headers, other.Request.Headers)
+	c.Request.Query = mergeMap(c.Request.Query, other.Request.Query)
+
+	if other.Transport.MaxIdleConns != 0 {
+		c.Transport.MaxIdleConns = other.Transport.MaxIdleConns
+	}
+	if other.Transport.MaxIdleConnsPerHost != 0 {
+		c.Transport.MaxIdleConnsPerHost = other.Transport.MaxIdleConnsPerHost
+	}
+	if other.Transport.IdleConnTimeout != 0 {
+		c.Transport.IdleConnTimeout = other.Transport.IdleConnTimeout
+	}
+	if other.Transport.DisableHTTP2 {
+		c.Transport.DisableHTTP2 = true
+	}
+	if other.Transport.DNSCache != 0 {
+		c.Transport.DNSCache = other.Transport.DNSCache
+	}
+
+	if other.RateLimit.RPM != 0 {
+		c.RateLimit.RPM = other.RateLimit.RPM
+	}
+	if other.RateLimit.TPM != 0 {
+		c.RateLimit.TPM = other.RateLimit.TPM
+	}
+	if other.RateLimit.Concurrency != 0 {
+		c.RateLimit.Concurrency = other.RateLimit.Concurrency
+	}
+
+	if other.Cache.Enabled {
+		c.Cache.Enabled = true
+	}
+	mergeString(&c.Cache.TTL, other.Cache.TTL)
+
+	if other.Budget.PerRun != 0 {
+		c.Budget.PerRun = other.Budget.PerRun
+	}
+	if other.Budget.Monthly != 0 {
+		c.Budget.Monthly = other.Budget.Monthly
+	}
+
+	mergeString(&c.Stats, other.Stats)
+	if other.NoRunLog {
+		c.NoRunLog = true
+	}
+	if other.NoUsageLog {
+		c.NoUsageLog = true
+	}
+	mergeString(&c.UsageReport.URL, other.UsageReport.URL)
+	mergeString(&c.UsageReport.TokenEnv, other.UsageReport.TokenEnv)
+	mergeString(&c.UsageReport.User, other.UsageReport.User)
+	if other.NoRender {
+		c.NoRender = true
+	}
+
+	for model, capabilities := range other.Capabilities {
+		if c.Capabilities == nil {
+			c.Capabilities = map[string][]string{}
+		}
+		c.Capabilities[model] = capabilities
+	}
+	if len(other.CapableModels) > 0 {
+		c.CapableModels = other.CapableModels
+	}
+
+	mergeString(&c.Locale, other.Locale)
+	mergeString(&c.MaxMemory, other.MaxMemory)
+	mergeString(&c.OnConflict, other.OnConflict)
+
+	if other.MissingInput != "" {
+		c.MissingInput = other.MissingInput
+	}
+
+	if len(other.FrontmatterDelimiters) > 0 {
+		c.FrontmatterDelimiters = other.FrontmatterDelimiters
+	}
+
+	mergeString(&c.Profile, other.Profile)
+
+	c.Redact = append(c.Redact, other.Redact...)
+
+	mergeString(&c.Backup.Dir, other.Backup.Dir)
+	if other.Backup.Keep != 0 {
+		c.Backup.Keep = other.Backup.Keep
+	}
+	if other.Backup.Disabled {
+		c.Backup.Disabled = true
+	}
+	if other.Snapshot.Disabled {
+		c.Snapshot.Disabled = true
+	}
+	if other.Snapshot.Keep != 0 {
+		c.Snapshot.Keep = other.Snapshot.Keep
+	}
+
+	if other.ReplaceChecks.MinLength != nil {
+		c.ReplaceChecks.MinLength = other.ReplaceChecks.MinLength
+	}
+	if other.ReplaceChecks.Syntax != nil {
+		c.ReplaceChecks.Syntax = other.ReplaceChecks.Syntax
+	}
+	if other.ReplaceChecks.KeepHeader != nil {
+		c.ReplaceChecks.KeepHeader = other.ReplaceChecks.KeepHeader
+	}
+
+	// hooks accumulate, so the user's global hooks still run in a project that adds its own
+	c.Hooks = c.Hooks.Append(other.Hooks)
+
+	c.Plugins = append(c.Plugins, other.Plugins...)
+
+	mergeString(&c.Jira.URL, other.Jira.URL)
+	mergeString(&c.Jira.Email, other.Jira.Email)
+	mergeString(&c.Jira.TokenEnv, other.Jira.TokenEnv)
+	mergeString(&c.Linear.TokenEnv, other.Linear.TokenEnv)
+
+	mergeString(&c.IMAP.Host, other.IMAP.Host)
+	mergeString(&c.IMAP.Username, other.IMAP.Username)
+	mergeString(&c.IMAP.PasswordEnv, other.IMAP.PasswordEnv)
+	if other.IMAP.Limit != 0 {
+		c.IMAP.Limit = other.IMAP.Limit
+	}
+
+	mergeString(&c.SQL.URL, other.SQL.URL)
+	c.SQL.Databases = mergeMap(c.SQL.Databases, other.SQL.Databases)
+	if other.SQL.Schema != nil {
+		c.SQL.Schema = other.SQL.Schema
+	}
+	if other.SQL.MaxRows != 0 {
+		c.SQL.MaxRows = other.SQL.MaxRows
+	}
+
+	mergeString(&c.K8s.Kubeconfig, other.K8s.Kubeconfig)
+	mergeString(&c.K8s.Context, other.K8s.Context)
+	mergeString(&c.K8s.Since, other.K8s.Since)
+	if other.K8s.TailLines != 0 {
+		c.K8s.TailLines = other.K8s.TailLines
+	}
+
+	mergeString(&c.Note.RecordCommand, other.Note.RecordCommand)
+	mergeString(&c.Note.Template, other.Note.Template)
+	mergeString(&c.Note.File, other.Note.File)
+	mergeString(&c.Note.Language, other.Note.Language)
+
+	mergeString(&c.API.Spec, other.API.Spec)
+	mergeString(&c.API.BaseURL, other.API.BaseURL)
+	c.API.Headers = mergeMap(c.API.Headers, other.API.Headers)
+
+	mergeString(&c.Commit.Template, other.Commit.Template)
+	mergeString(&c.Review.Template, other.Review.Template)
+
+	mergeString(&c.OCR.Command, other.OCR.Command)
+	mergeString(&c.OCR.Model, other.OCR.Model)
+
+	mergeString(&c.Proxy.Listen, other.Proxy.Listen)
+	if len(other.Proxy.Aliases) > 0 {
+		c.Proxy.Aliases = other.Proxy.Aliases
+	}
+	c.Proxy.Redact = append(c.Proxy.Redact, other.Proxy.Redact...)
+	if other.Proxy.MaxPromptTokens != 0 {
+		c.Proxy.MaxPromptTokens = other.Proxy.MaxPromptTokens
+	}
+	if other.Proxy.MaxTokens != 0 {
+		c.Proxy.MaxTokens = other.Proxy.MaxTokens
+	}
+}
+
+func mergeString(dst *string, src string) {
+	if src != "" {
+		*dst = src
+	}
+}
+
+// mergeMap overrides the entries of dst with those of src. Entries only in dst are kept.
+func mergeMap(dst map[string]string, src map[string]string) map[string]string {
+	if len(src) == 0 {
+		return dst
+	}
+
+	merged := make(map[string]string, len(dst)+len(src))
+	for k, v := range dst {
+		merged[k] = v
+	}
+	for k, v := range src {
+		merged[k] = v
+	}
+	return merged
+}
+
+// APIKey reads the API key from the configured environment variable
+func (c *Config) APIKey() string {
+	return os.Getenv(c.APIKeyEnv)
+}
+
+// ConfigDir returns the directory of the global config, ~/.config/pls unless XDG_CONFIG_HOME is set
+func ConfigDir() (string, error) {
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	if configHome == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		configHome = filepath.Join(home, ".config")
+	}
+	return filepath.Join(configHome, "pls"), nil
+}
+
+// ConfigPaths returns the config files to load, from lowest to highest precedence
+func ConfigPaths() ([]string, error) {
+	var paths []string
+
+	configDir, err := ConfigDir()
+	if err != nil {
+		return nil, err
+	}
+	paths = append(paths, filepath.Join(configDir, "config.yaml"))
+
+	projectConfig, err := findProjectConfig()
+	if err != nil {
+		return nil, err
+	}
+	if projectConfig != "" {
+		paths = append(paths, projectConfig)
+	}
+
+	return paths, nil
+}
+
+// findProjectConfig looks for .pls.yaml in the current directory and its parents
+func findProjectConfig() (string, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+
+	for {
+		configFile := filepath.Join(dir, ".pls.yaml")
+		_, err := os.Stat(configFile)
+		if err == nil {
+			return configFile, nil
+		}
+
+		if !errors.Is(err, fs.ErrNotExist) {
+			return "", err
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil
+		}
+		dir = parent
+	}
+}
+
+// LoadConfig merges the config files over the built-in defaults. Missing files are skipped. The
+// commands, endpoints and credentials of the project config are held back, see AllowProject.
+func LoadConfig() (*Config, error) {
+	config := DefaultConfig()
+
+	configDir, err := ConfigDir()
+	if err != nil {
+		return nil, err
+	}
+	config.Profile = filepath.Join(configDir, "profile.md")
+
+	paths, err := ConfigPaths()
+	if err != nil {
+		return nil, err
+	}
+
+	for i, configFile := range paths {
+		data, err := os.ReadFile(configFile)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var fileConfig Config
+		err = yaml.UnmarshalStrict(data, &fileConfig)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", configFile, err)
+		}
+
+		// the paths after the global config are the project config
+		if i > 0 {
+			config.project = fileConfig.holdBack(configFile)
+		}
+
+		config.Merge(&fileConfig)
+	}
+
+	return config, nil
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// ConflictAbort keeps the file, and sets the response aside
+	ConflictAbort = "abort"
+	// ConflictMerge merges the response with the changes made to the file, like git merge-file
+	ConflictMerge = "merge"
+	// ConflictRerender runs the prompt again with the file as it is now
+	ConflictRerender = "rerender"
+)
+
+// maxRerenders is how many times a prompt is run again because its file keeps changing
+const maxRerenders = 2
+
+// fileChangedError is the error of replacing a file that was changed after the prompt was rendered
+type fileChangedError struct {
+	path  string
+	saved string
+	// conflicts counts the conflicts of the merge, 0 if the strategy isn't merge
+	conflicts int
+}
+
+func (e *fileChangedError) Error() string {
+	if e.conflicts > 0 {
+		conflicts := fmt.Sprintf("%d conflicts", e.conflicts)
+		if e.conflicts == 1 {
+			conflicts = "a conflict"
+		}
+		return fmt.Sprintf("%s changed since the prompt was rendered, and merging the response has %s. %s is unchanged, the merge with conflict markers is in %s", e.path, conflicts, e.path, e.saved)
+	}
+	return fmt.Sprintf("%s changed since the prompt was rendered. %s is unchanged, the response is in %s. Use --on-conflict merge or rerender to apply it to the new version", e.path, e.path, e.saved)
+}
+
+// conflictStrategy returns the --on-conflict strategy, falling back to the config
+func (r *Runner) conflictStrategy() (string, error) {
+	strategy := r.config.OnConflict
+	mergeString(&strategy, r.args.OnConflict)
+
+	switch strategy {
+	case ConflictAbort, ConflictMerge, ConflictRerender:
+		return strategy, nil
+	}
+	return "", fmt.Errorf("on_conflict must be %s, %s or %s, got %q", ConflictAbort, ConflictMerge, ConflictRerender, strategy)
+}
+
+// recordBaseline remembers the content of a file the prompt was rendered from, to tell whether it
+// changed before the response replaces it
+func (r *Runner) recordBaseline(path string, content string) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return
+	}
+	if r.baselines == nil {
+		r.baselines = map[string]string{}
+	}
+	r.baselines[abs] = content
+}
+
+// checkUnchanged compares the output file with its content when the prompt was rendered. If it changed
+// meanwhile, the response in tempfile is merged with the changes, or set aside.
+func (r *Runner) checkUnchanged(tempfile string, outputfile string) error {
+	abs, err := filepath.Abs(outputfile)
+	if err != nil {
+		return err
+	}
+	base, ok := r.baselines[abs]
+	if !ok {
+		return nil
+	}
+
+	current, err := os.ReadFile(outputfile)
+	if err != nil {
+		return err
+	}
+	if string(current) == base {
+		return nil
+	}
+
+	strategy, err := r.conflictStrategy()
+	if err != nil {
+		return err
+	}
+
+	if strategy != ConflictMerge {
+		saved, err := setAside(tempfile, outputfile, ".conflict")
+		if err != nil {
+			return err
+		}
+		return &fileChangedError{path: outputfile, saved: saved}
+	}
+
+	merged, conflicts, err := mergeFile(outputfile, base, tempfile)
+	if err != nil {
+		return err
+	}
+
+	err = os.WriteFile(tempfile, merged, 0600)
+	if err != nil {
+		return err
+	}
+	if conflicts > 0 {
+		saved, err := setAside(tempfile, outputfile, ".conflict")
+		if err != nil {
+			return err
+		}
+		return &fileChangedError{path: outputfile, saved: saved, conflicts: conflicts}
+	}
+
+	fmt.Fprintf(os.Stderr, "[%s changed since the prompt was rendered, merged the response with the changes]\n", outputfile)
+	return nil
+}
+
+// mergeFile merges the changes from base to the response into the current file, with git merge-file
+func mergeFile(current string, base string, response string) ([]byte, int, error) {
+	f, err := os.CreateTemp("", "pls-base-*")
+	if err != nil {
+		return nil, 0, err
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.WriteString(base)
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+	err = f.Close()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	cmd := exec.Command("git", "merge-file", "-p", "-L", "current", "-L", "rendered", "-L", "response", current, f.Name(), response)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	// the exit code is the number of conflicts, negative on errors
+	out, err := cmd.Output()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() > 0 && exitErr.ExitCode() < 128 {
+		return out, exitErr.ExitCode(), nil
+	}
+	if err != nil {
+		message := strings.TrimSpace(stderr.String())
+		if message == "" {
+			message = err.Error()
+		}
+		return nil, 0, fmt.Errorf("git merge-file: %s", message)
+	}
+	return out, 0, nil
+}
+
+// runRerendering runs the prompt, and with --on-conflict rerender, runs it again if its file changed
+// while the response was generated
+func (r *Runner) runRerendering() error {
+	for attempt := 0; ; attempt++ {
+		err := r.Run()
+
+		var changed *fileChangedError
+		if !errors.As(err, &changed) || attempt >= maxRerenders {
+			return err
+		}
+		strategy, strategyErr := r.conflictStrategy()
+		if strategyErr != nil || strategy != ConflictRerender {
+			return err
+		}
+
+		os.Remove(changed.saved)
+		fmt.Fprintf(os.Stderr, "[%s changed while the response was generated, rendering the prompt again (%d/%d)]\n", changed.path, attempt+1, maxRerenders)
+	}
+}
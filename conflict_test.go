@@ -0,0 +1,142 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// editingReader edits the file when the response starts arriving, as an editor saving it while the
+// request is in flight would
+type editingReader struct {
+	io.Reader
+	file    string
+	content string
+	edited  bool
+}
+
+func (r *editingReader) Read(p []byte) (int, error) {
+	if !r.edited {
+		r.edited = true
+		err := os.WriteFile(r.file, []byte(r.content), 0644)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return r.Reader.Read(p)
+}
+
+func TestReplaceChangedFile(t *testing.T) {
+	_, err := exec.LookPath("git")
+	if err != nil {
+		t.Skip("git merge-file needs git")
+	}
+
+	const rendered = "# Notes\n\nfirst\n\nsecond\n\nthird\n"
+
+	testCases := []struct {
+		name      string
+		strategy  string
+		edit      string // the file as it was saved during the request, "" is unchanged
+		response  string
+		expected  string // the file afterwards
+		conflicts int
+		err       bool
+	}{
+		{
+			name:     "unchanged",
+			strategy: ConflictAbort,
+			response: "# Notes\n\nfirst\n\nsecond\n\nTHIRD\n",
+			expected: "# Notes\n\nfirst\n\nsecond\n\nTHIRD\n",
+		},
+		{
+			name:     "changed, aborted",
+			strategy: ConflictAbort,
+			edit:     "# Notes\n\nFIRST\n\nsecond\n\nthird\n",
+			response: "# Notes\n\nfirst\n\nsecond\n\nTHIRD\n",
+			expected: "# Notes\n\nFIRST\n\nsecond\n\nthird\n",
+			err:      true,
+		},
+		{
+			name:     "changed, merged",
+			strategy: ConflictMerge,
+			edit:     "# Notes\n\nFIRST\n\nsecond\n\nthird\n",
+			response: "# Notes\n\nfirst\n\nsecond\n\nTHIRD\n",
+			expected: "# Notes\n\nFIRST\n\nsecond\n\nTHIRD\n",
+		},
+		{
+			name:      "overlapping edits",
+			strategy:  ConflictMerge,
+			edit:      "# Notes\n\nfirst\n\nsecond\n\nthird, edited\n",
+			response:  "# Notes\n\nfirst\n\nsecond\n\nthird, rewritten\n",
+			expected:  "# Notes\n\nfirst\n\nsecond\n\nthird, edited\n",
+			conflicts: 1,
+			err:       true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "notes.md")
+			assert.NoError(t, os.WriteFile(file, []byte(rendered), 0644))
+
+			r := &Runner{config: DefaultConfig(), args: Args{NoBackup: true, OnConflict: tc.strategy}, quiet: true}
+			r.recordBaseline(file, rendered)
+
+			var stream io.Reader = strings.NewReader(tc.response)
+			if tc.edit != "" {
+				stream = &editingReader{Reader: stream, file: file, content: tc.edit}
+			}
+			err := r.ReplaceFile(stream, file)
+
+			content, readErr := os.ReadFile(file)
+			assert.NoError(t, readErr)
+			assert.Equal(t, tc.expected, string(content))
+
+			if !tc.err {
+				assert.NoError(t, err)
+				assert.NoFileExists(t, file+".conflict")
+				return
+			}
+
+			var changed *fileChangedError
+			assert.True(t, errors.As(err, &changed), "%v", err)
+			assert.Equal(t, tc.conflicts, changed.conflicts)
+
+			saved, readErr := os.ReadFile(file + ".conflict")
+			assert.NoError(t, readErr)
+			if tc.conflicts == 0 {
+				assert.Equal(t, tc.response, string(saved))
+			} else {
+				assert.Contains(t, string(saved), "<<<<<<< current\nthird, edited\n=======\nthird, rewritten\n>>>>>>> response\n")
+			}
+		})
+	}
+}
+
+func TestMergeFile(t *testing.T) {
+	_, err := exec.LookPath("git")
+	if err != nil {
+		t.Skip("git merge-file needs git")
+	}
+
+	dir := t.TempDir()
+	current := filepath.Join(dir, "current")
+	response := filepath.Join(dir, "response")
+	assert.NoError(t, os.WriteFile(current, []byte("a\nB\nc\n"), 0644))
+	assert.NoError(t, os.WriteFile(response, []byte("a\nb\nC\n"), 0644))
+
+	merged, conflicts, err := mergeFile(current, "a\nb\nc\n", response)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, conflicts, "adjacent lines overlap")
+	assert.Contains(t, string(merged), "<<<<<<< current")
+
+	_, _, err = mergeFile(filepath.Join(dir, "missing"), "a\n", response)
+	assert.ErrorContains(t, err, "git merge-file: ")
+}
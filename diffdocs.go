@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/hayeah/pls/docdiff"
+)
+
+type DiffDocsArgs struct {
+	OldFile    string `arg:"positional,required" help:"old version of the document"`
+	NewFile    string `arg:"positional,required" help:"new version of the document"`
+	PromptFile string `arg:"positional,required" help:"prompt template, given {{.Old}}, {{.New}} and {{.Diff}}. {{.Input}} is the diff."`
+
+	Model       string  `arg:"-m,--model" help:"model to use, overrides frontmatter and config"`
+	Temperature float32 `arg:"-t,--temperature" help:"sampling temperature, overrides frontmatter and config"`
+	RenderOnly  bool    `arg:"--render-only" help:"output only the rendered prompt, without calling the API"`
+}
+
+// runDiffDocs runs a prompt over the changes between two versions of a document
+func runDiffDocs(argv []string) error {
+	var args DiffDocsArgs
+	parseArgs("pls diffdocs", &args, argv)
+
+	oldDoc, err := os.ReadFile(args.OldFile)
+	if err != nil {
+		return err
+	}
+
+	newDoc, err := os.ReadFile(args.NewFile)
+	if err != nil {
+		return err
+	}
+
+	diff := docdiff.Diff(string(oldDoc), string(newDoc))
+	if diff == "" {
+		fmt.Fprintln(os.Stderr, "[documents are identical]")
+	}
+
+	r, err := NewRunner(Args{
+		PromptFile:  args.PromptFile,
+		Model:       args.Model,
+		Temperature: args.Temperature,
+	})
+	if err != nil {
+		return err
+	}
+
+	template, err := r.ReadTemplate()
+	if err != nil {
+		return err
+	}
+
+	prompt, fm, err := RenderTemplate(template, TemplateData{
+		Input: diff,
+		Old:   string(oldDoc),
+		New:   string(newDoc),
+		Diff:  diff,
+	})
+	if err != nil {
+		return err
+	}
+	r.applyFlags(fm)
+	r.frontMatter = fm
+
+	if args.RenderOnly {
+		fmt.Print(prompt)
+		return nil
+	}
+
+	stream, err := r.OutputStream(prompt, fm)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	return r.WriteOutput(stream)
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/hayeah/pls/feed"
+)
+
+type DigestArgs struct {
+	FeedsFile string `arg:"positional,required" help:"digest definition, listing the feeds and the template"`
+	DryRun    bool   `arg:"--dry-run" help:"print the new items without summarizing them or updating the state"`
+}
+
+// DigestConfig is the definition of a digest. Relative paths are relative to the definition file.
+type DigestConfig struct {
+	// Template summarizes the new items, given as {{.Input}} and {{.Data.items}}
+	Template string `yaml:"template"`
+	// Output is the file the digest is written to. The digest goes to stdout (or Sink) if empty.
+	Output string `yaml:"output"`
+	// Sink is a plugin output sink to send the digest to
+	Sink string `yaml:"sink"`
+	// State remembers the items already digested. Defaults to a file under the pls data dir.
+	State string `yaml:"state"`
+	// MaxItems caps the number of new items per run
+	MaxItems int `yaml:"max_items"`
+
+	Feeds []string `yaml:"feeds"`
+}
+
+// DigestItem is a new feed item, exposed to the digest template
+type DigestItem struct {
+	Feed      string    `json:"feed"`
+	Title     string    `json:"title"`
+	Link      string    `json:"link"`
+	Summary   string    `json:"summary"`
+	Published time.Time `json:"published"`
+
+	key string
+}
+
+// DigestState is the set of items already digested
+type DigestState struct {
+	Seen map[string]time.Time `json:"seen"`
+}
+
+const digestSummaryLimit = 500
+
+var htmlTagPattern = regexp.MustCompile(`<[^>]*>`)
+
+func runDigest(argv []string) error {
+	var args DigestArgs
+	parseArgs("pls digest", &args, argv)
+
+	data, err := os.ReadFile(args.FeedsFile)
+	if err != nil {
+		return err
+	}
+
+	var digest DigestConfig
+	err = yaml.UnmarshalStrict(data, &digest)
+	if err != nil {
+		return fmt.Errorf("%s: %w", args.FeedsFile, err)
+	}
+
+	if digest.Template == "" {
+		return fmt.Errorf("%s: template is required", args.FeedsFile)
+	}
+
+	dir := filepath.Dir(args.FeedsFile)
+	resolve := func(p string) string {
+		if p == "" || filepath.IsAbs(p) {
+			return p
+		}
+		return filepath.Join(dir, p)
+	}
+
+	// a bare template name is searched for in the template paths, like on the command line
+	if strings.ContainsRune(digest.Template, filepath.Separator) {
+		digest.Template = resolve(digest.Template)
+	}
+	digest.Output = resolve(digest.Output)
+
+	statePath := resolve(digest.State)
+	if statePath == "" {
+		dataDir, err := DataDir()
+		if err != nil {
+			return err
+		}
+		name := strings.TrimSuffix(filepath.Base(args.FeedsFile), filepath.Ext(args.FeedsFile))
+		statePath = filepath.Join(dataDir, "digest", name+".json")
+	}
+
+	state, err := readDigestState(statePath)
+	if err != nil {
+		return err
+	}
+
+	items := fetchNewItems(digest.Feeds, state)
+	if digest.MaxItems > 0 && len(items) > digest.MaxItems {
+		items = items[:digest.MaxItems]
+	}
+
+	if len(items) == 0 {
+		fmt.Fprintln(os.Stderr, "[no new items]")
+		return nil
+	}
+
+	input := formatDigestItems(items)
+	if args.DryRun {
+		fmt.Print(input)
+		return nil
+	}
+
+	r, err := NewRunner(Args{PromptFile: digest.Template, Sink: digest.Sink})
+	if err != nil {
+		return err
+	}
+
+	err = r.writeDigest(input, items, digest.Output)
+	if err != nil {
+		return err
+	}
+
+	// only mark items as seen once they made it into a digest
+	now := time.Now()
+	for _, item := range items {
+		state.Seen[item.key] = now
+	}
+	return state.Save(statePath)
+}
+
+func (r *Runner) writeDigest(input string, items []DigestItem, output string) error {
+	template, err := r.ReadTemplate()
+	if err != nil {
+		return err
+	}
+
+	prompt, fm, err := RenderTemplate(template, TemplateData{
+		Input: input,
+		Data:  map[string]any{"items": items},
+	})
+	if err != nil {
+		return err
+	}
+	r.applyFlags(fm)
+	r.frontMatter = fm
+
+	stream, err := r.OutputStream(prompt, fm)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	if output == "" {
+		return r.WriteOutput(stream)
+	}
+
+	f, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(f, io.TeeReader(stream, os.Stdout))
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "[written to %s]\n", fileLink(output))
+	return nil
+}
+
+// fetchNewItems fetches the feeds, and returns the items not in the state yet. Feeds that fail
+// are skipped with a warning.
+func fetchNewItems(feeds []string, state *DigestState) []DigestItem {
+	client := &http.Client{Timeout: 30 * time.Second}
+
+	var items []DigestItem
+	for _, url := range feeds {
+		title, feedItems, err := fetchFeed(client, url)
+		if err != nil {
+			log.Printf("warning: %s: %v", url, err)
+			continue
+		}
+
+		if title == "" {
+			title = url
+		}
+
+		for _, item := range feedItems {
+			key := url + "#" + item.ID
+			if _, seen := state.Seen[key]; seen {
+				continue
+			}
+
+			summary := strings.TrimSpace(htmlTagPattern.ReplaceAllString(item.Summary, ""))
+			if len(summary) > digestSummaryLimit {
+				summary = summary[:digestSummaryLimit] + "..."
+			}
+
+			items = append(items, DigestItem{
+				Feed:      title,
+				Title:     item.Title,
+				Link:      item.Link,
+				Summary:   summary,
+				Published: item.Published,
+				key:       key,
+			})
+		}
+	}
+
+	return items
+}
+
+func fetchFeed(client *http.Client, url string) (string, []feed.Item, error) {
+	res, err := client.Get(url)
+	if err != nil {
+		return "", nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return "", nil, errors.New(res.Status)
+	}
+
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return feed.Parse(data)
+}
+
+func formatDigestItems(items []DigestItem) string {
+	var buf strings.Builder
+	currentFeed := ""
+	for _, item := range items {
+		if item.Feed != currentFeed {
+			if currentFeed != "" {
+				fmt.Fprintln(&buf)
+			}
+			fmt.Fprintf(&buf, "## %s\n\n", item.Feed)
+			currentFeed = item.Feed
+		}
+
+		fmt.Fprintf(&buf, "- [%s](%s)", item.Title, item.Link)
+		if !item.Published.IsZero() {
+			fmt.Fprintf(&buf, " (%s)", item.Published.Format("2006-01-02"))
+		}
+		fmt.Fprintln(&buf)
+		if item.Summary != "" {
+			fmt.Fprintf(&buf, "  %s\n", strings.ReplaceAll(item.Summary, "\n", " "))
+		}
+	}
+	return buf.String()
+}
+
+func readDigestState(file string) (*DigestState, error) {
+	state := &DigestState{Seen: map[string]time.Time{}}
+
+	data, err := os.ReadFile(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, state)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	if state.Seen == nil {
+		state.Seen = map[string]time.Time{}
+	}
+
+	return state, nil
+}
+
+// Save writes the state file
+func (s *DigestState) Save(file string) error {
+	err := os.MkdirAll(filepath.Dir(file), 0755)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(file, data, 0644)
+}
@@ -0,0 +1,232 @@
+// Package docdiff diffs documents line by line, labelling each hunk with the markdown section it is in.
+package docdiff
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Op is the kind of a diff line: ' ', '-' or '+'
+type Op byte
+
+const (
+	Equal  Op = ' '
+	Delete Op = '-'
+	Insert Op = '+'
+)
+
+// Line is a line of the diff. OldLine and NewLine are 1-based, and 0 for lines missing from that side.
+type Line struct {
+	Op      Op
+	Text    string
+	OldLine int
+	NewLine int
+}
+
+// Hunk is a run of changes with its surrounding context
+type Hunk struct {
+	// Section is the heading path of the first change, e.g. "Terms > Payment"
+	Section string
+	Lines   []Line
+}
+
+// ContextLines is the number of unchanged lines kept around each change
+const ContextLines = 2
+
+var headingPattern = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*\s*$`)
+
+// Lines returns the shortest edit script turning old into new (Myers' algorithm)
+func Lines(old, new []string) []Line {
+	n, m := len(old), len(new)
+	max := n + m
+	offset := max + 1
+	v := make([]int, 2*max+2)
+
+	var trace [][]int
+search:
+	for d := 0; d <= max; d++ {
+		trace = append(trace, append([]int(nil), v...))
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+
+			y := x - k
+			for x < n && y < m && old[x] == new[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+
+			if x >= n && y >= m {
+				break search
+			}
+		}
+	}
+
+	// backtrack from the end, through the furthest points reached for each edit distance
+	var lines []Line
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		k := x - y
+
+		var prevK int
+		if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			lines = append(lines, Line{Op: Equal, Text: old[x-1], OldLine: x, NewLine: y})
+			x--
+			y--
+		}
+
+		if d == 0 {
+			break
+		}
+
+		if x == prevX {
+			lines = append(lines, Line{Op: Insert, Text: new[y-1], NewLine: y})
+		} else {
+			lines = append(lines, Line{Op: Delete, Text: old[x-1], OldLine: x})
+		}
+		x, y = prevX, prevY
+	}
+
+	for i, j := 0, len(lines)-1; i < j; i, j = i+1, j-1 {
+		lines[i], lines[j] = lines[j], lines[i]
+	}
+
+	return lines
+}
+
+// Hunks groups the changes between the documents, with ContextLines of context around them
+func Hunks(old, new string) []Hunk {
+	lines := Lines(splitLines(old), splitLines(new))
+	sections := sectionPaths(lines)
+
+	var hunks []Hunk
+	for i := 0; i < len(lines); {
+		if lines[i].Op == Equal {
+			i++
+			continue
+		}
+
+		start := i - ContextLines
+		if start < 0 {
+			start = 0
+		}
+
+		// extend the hunk while the next change is close enough to share its context
+		end := i
+		for end < len(lines) {
+			if lines[end].Op != Equal {
+				end++
+				continue
+			}
+
+			next := end
+			for next < len(lines) && lines[next].Op == Equal {
+				next++
+			}
+			if next == len(lines) || next-end > 2*ContextLines {
+				end += ContextLines
+				if end > len(lines) {
+					end = len(lines)
+				}
+				break
+			}
+			end = next
+		}
+
+		hunks = append(hunks, Hunk{Section: sections[i], Lines: lines[start:end]})
+		i = end
+	}
+
+	return hunks
+}
+
+// Diff formats the changes between the documents in the unified diff format. Hunk headers name the
+// section of the change, like git's function context. Identical documents give an empty diff.
+func Diff(old, new string) string {
+	var b strings.Builder
+	for _, hunk := range Hunks(old, new) {
+		oldStart, oldCount, newStart, newCount := hunkRange(hunk.Lines)
+		fmt.Fprintf(&b, "@@ -%d,%d +%d,%d @@", oldStart, oldCount, newStart, newCount)
+		if hunk.Section != "" {
+			b.WriteString(" " + hunk.Section)
+		}
+		b.WriteByte('\n')
+
+		for _, line := range hunk.Lines {
+			b.WriteByte(byte(line.Op))
+			b.WriteString(line.Text)
+			b.WriteByte('\n')
+		}
+	}
+	return b.String()
+}
+
+func hunkRange(lines []Line) (oldStart, oldCount, newStart, newCount int) {
+	for _, line := range lines {
+		if line.OldLine != 0 {
+			if oldStart == 0 {
+				oldStart = line.OldLine
+			}
+			oldCount++
+		}
+		if line.NewLine != 0 {
+			if newStart == 0 {
+				newStart = line.NewLine
+			}
+			newCount++
+		}
+	}
+	return
+}
+
+// sectionPaths returns the heading path each line is under, following the structure of the new document
+func sectionPaths(lines []Line) []string {
+	paths := make([]string, len(lines))
+
+	var headings []string
+	for i, line := range lines {
+		if line.Op != Delete {
+			match := headingPattern.FindStringSubmatch(line.Text)
+			if match != nil {
+				level := len(match[1])
+				for len(headings) < level {
+					headings = append(headings, "")
+				}
+				headings = append(headings[:level-1], match[2])
+			}
+		}
+
+		var path []string
+		for _, heading := range headings {
+			if heading != "" {
+				path = append(path, heading)
+			}
+		}
+		paths[i] = strings.Join(path, " > ")
+	}
+
+	return paths
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
@@ -0,0 +1,151 @@
+package docdiff
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiff(t *testing.T) {
+	testCases := []struct {
+		name     string
+		old      string
+		new      string
+		expected string
+	}{
+		{
+			name:     "identical",
+			old:      "a\nb\n",
+			new:      "a\nb\n",
+			expected: "",
+		},
+		{
+			name: "change",
+			old:  "a\nb\nc\n",
+			new:  "a\nB\nc\n",
+			expected: `@@ -1,3 +1,3 @@
+ a
+-b
++B
+ c
+`,
+		},
+		{
+			name: "insert into empty",
+			old:  "",
+			new:  "a\n",
+			expected: `@@ -0,0 +1,1 @@
++a
+`,
+		},
+		{
+			name:     "section",
+			old:      "# Contract\n\n## Payment\n\nNet 30.\n\nLate fees apply.\n",
+			new:      "# Contract\n\n## Payment\n\nNet 60.\n\nLate fees apply.\n",
+			expected: "@@ -3,5 +3,5 @@ Contract > Payment\n ## Payment\n \n-Net 30.\n+Net 60.\n \n Late fees apply.\n",
+		},
+		{
+			name: "separate hunks",
+			old:  "1\n2\n3\n4\n5\n6\n7\n8\n9\n",
+			new:  "one\n2\n3\n4\n5\n6\n7\n8\nnine\n",
+			expected: `@@ -1,3 +1,3 @@
+-1
++one
+ 2
+ 3
+@@ -7,3 +7,3 @@
+ 7
+ 8
+-9
++nine
+`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, Diff(tc.old, tc.new))
+		})
+	}
+}
+
+func TestLines(t *testing.T) {
+	lines := Lines([]string{"a", "b", "c"}, []string{"b", "c", "d"})
+	assert.Equal(t, []Line{
+		{Op: Delete, Text: "a", OldLine: 1},
+		{Op: Equal, Text: "b", OldLine: 2, NewLine: 1},
+		{Op: Equal, Text: "c", OldLine: 3, NewLine: 2},
+		{Op: Insert, Text: "d", NewLine: 3},
+	}, lines)
+}
+
+func TestApply(t *testing.T) {
+	doc := "a\nb\nc\nd\ne\nf\ng\n"
+
+	testCases := []struct {
+		name string
+		// doc is the document the patch is applied to, if not the default
+		doc      string
+		patch    string
+		expected string
+		err      string
+	}{
+		{
+			name:     "change",
+			patch:    "--- a/doc\n+++ b/doc\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n",
+			expected: "a\nB\nc\nd\ne\nf\ng\n",
+		},
+		{
+			name:     "wrong line number",
+			patch:    "@@ -1,3 +1,4 @@\n e\n+E\n f\n",
+			expected: "a\nb\nc\nd\ne\nE\nf\ng\n",
+		},
+		{
+			name:     "two hunks in a fence",
+			patch:    "```diff\n@@ -1,2 +1,1 @@\n-a\n b\n@@ -7,1 +6,2 @@\n g\n+h\n```\n",
+			expected: "b\nc\nd\ne\nf\ng\nh\n",
+		},
+		{
+			name:     "delete a -- comment",
+			doc:      "select 1;\n-- old comment\nselect 2;\n",
+			patch:    "--- a/query.sql\n+++ b/query.sql\n@@ -1,3 +1,2 @@\n select 1;\n--- old comment\n select 2;\n",
+			expected: "select 1;\nselect 2;\n",
+		},
+		{
+			name:     "insert a ++ line",
+			patch:    "@@ -1,2 +1,3 @@\n a\n+++ b\n b\n",
+			expected: "a\n++ b\nb\nc\nd\ne\nf\ng\n",
+		},
+		{
+			name:  "two files",
+			patch: "--- a/doc\n+++ b/doc\n@@ -1 +1 @@\n-a\n+A\n--- a/other\n+++ b/other\n@@ -1 +1 @@\n-x\n+X\n",
+			err:   "line 6: patches of more than one file are not supported",
+		},
+		{
+			name:  "conflict",
+			patch: "@@ -3,2 +3,2 @@\n c\n-x\n+y\n",
+			err:   `hunk 1 (line 3) does not apply: "x" is not in the document`,
+		},
+		{
+			name:  "no hunks",
+			patch: "I can't do that.",
+			err:   "no hunks in the patch",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			original := doc
+			if tc.doc != "" {
+				original = tc.doc
+			}
+			patched, err := Apply(original, tc.patch)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, patched)
+		})
+	}
+}
@@ -0,0 +1,171 @@
+package docdiff
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// PatchHunk is a hunk of a unified diff. OldStart is the line it claims to start at, which is only
+// a hint: hunks are applied where their context matches.
+type PatchHunk struct {
+	OldStart int
+	Lines    []Line
+}
+
+// ConflictError is a hunk whose context and deleted lines are not in the document
+type ConflictError struct {
+	// Hunk is 1-based
+	Hunk     int
+	OldStart int
+	// Missing is the first line of the hunk that isn't in the document around the best match
+	Missing string
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("hunk %d (line %d) does not apply: %q is not in the document", e.Hunk, e.OldStart, e.Missing)
+}
+
+var hunkHeaderPattern = regexp.MustCompile(`^@@ -(\d+)(?:,\d+)? \+\d+(?:,\d+)? @@`)
+
+// ParsePatch reads the hunks of a unified diff. File headers and lines before the first hunk are
+// skipped, and so is a code fence around the patch. The line counts of the hunk headers are ignored,
+// since they're often wrong in patches that weren't made by diff, and blank lines in hunks are taken
+// as blank context. After the first hunk, a --- line followed by a +++ line starts another file, while
+// other lines like "--- a rule" delete or insert text that starts with -- or ++.
+func ParsePatch(patch string) ([]PatchHunk, error) {
+	var hunks []PatchHunk
+	var hunk *PatchHunk
+
+	lines := splitLines(patch)
+	for i, text := range lines {
+		if match := hunkHeaderPattern.FindStringSubmatch(text); match != nil {
+			start, _ := strconv.Atoi(match[1])
+			hunks = append(hunks, PatchHunk{OldStart: start})
+			hunk = &hunks[len(hunks)-1]
+			continue
+		}
+
+		if hunk == nil {
+			continue
+		}
+
+		// the end of a code fence around the patch
+		if strings.HasPrefix(text, "```") {
+			break
+		}
+
+		switch {
+		case text == "":
+			hunk.Lines = append(hunk.Lines, Line{Op: Equal})
+		case strings.HasPrefix(text, `\`):
+			// "\ No newline at end of file"
+		case strings.HasPrefix(text, "diff "), isFileHeader(lines, i):
+			return nil, fmt.Errorf("line %d: patches of more than one file are not supported", i+1)
+		case text[0] == byte(Equal), text[0] == byte(Delete), text[0] == byte(Insert):
+			hunk.Lines = append(hunk.Lines, Line{Op: Op(text[0]), Text: text[1:]})
+		default:
+			return nil, fmt.Errorf("line %d: not a line of a hunk: %q", i+1, text)
+		}
+	}
+
+	if len(hunks) == 0 {
+		return nil, fmt.Errorf("no hunks in the patch")
+	}
+	return hunks, nil
+}
+
+// isFileHeader reports whether the line starts the --- and +++ header of a file
+func isFileHeader(lines []string, i int) bool {
+	return strings.HasPrefix(lines[i], "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ ")
+}
+
+// Apply applies the patch to the document. Each hunk is placed where its context and deleted lines
+// match, nearest to the line its header claims, after the previous hunk. The document is unchanged
+// when any hunk conflicts.
+func Apply(doc string, patch string) (string, error) {
+	hunks, err := ParsePatch(patch)
+	if err != nil {
+		return "", err
+	}
+
+	lines := splitLines(doc)
+	var result []string
+	next := 0 // the first line of the document not yet copied to the result
+
+	for i, hunk := range hunks {
+		var old, new []string
+		for _, line := range hunk.Lines {
+			if line.Op != Insert {
+				old = append(old, line.Text)
+			}
+			if line.Op != Delete {
+				new = append(new, line.Text)
+			}
+		}
+
+		at, ok := findLines(lines, old, next, hunk.OldStart-1)
+		if !ok {
+			return "", &ConflictError{Hunk: i + 1, OldStart: hunk.OldStart, Missing: firstMissing(lines, old, next)}
+		}
+
+		result = append(result, lines[next:at]...)
+		result = append(result, new...)
+		next = at + len(old)
+	}
+	result = append(result, lines[next:]...)
+
+	if len(result) == 0 {
+		return "", nil
+	}
+	return strings.Join(result, "\n") + "\n", nil
+}
+
+// findLines returns where the lines occur in the document at or after from, nearest to the hint.
+// Trailing whitespace is ignored.
+func findLines(doc []string, lines []string, from int, hint int) (int, bool) {
+	if hint < from {
+		hint = from
+	}
+
+	last := len(doc) - len(lines)
+	for distance := 0; hint-distance >= from || hint+distance <= last; distance++ {
+		if at := hint - distance; at >= from && at <= last && matchAt(doc, lines, at) {
+			return at, true
+		}
+		if at := hint + distance; distance > 0 && at >= from && at <= last && matchAt(doc, lines, at) {
+			return at, true
+		}
+	}
+	return 0, false
+}
+
+func matchAt(doc []string, lines []string, at int) bool {
+	for i, line := range lines {
+		if strings.TrimRight(doc[at+i], " \t\r") != strings.TrimRight(line, " \t\r") {
+			return false
+		}
+	}
+	return true
+}
+
+// firstMissing returns the first of the lines that isn't in the document after from, or else the line
+// after the longest run that matches, to point at the conflict
+func firstMissing(doc []string, lines []string, from int) string {
+	best := 0
+	for at := from; at < len(doc); at++ {
+		n := 0
+		for n < len(lines) && at+n < len(doc) && strings.TrimRight(doc[at+n], " \t\r") == strings.TrimRight(lines[n], " \t\r") {
+			n++
+		}
+		if n > best {
+			best = n
+		}
+	}
+
+	if best < len(lines) {
+		return lines[best]
+	}
+	return lines[len(lines)-1]
+}
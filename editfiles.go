@@ -0,0 +1,207 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hayeah/pls/docdiff"
+	"github.com/hayeah/pls/edits"
+)
+
+// fileChange is an edit resolved against the working tree
+type fileChange struct {
+	edits.Edit
+	old    string
+	new    string
+	exists bool
+}
+
+// RunEdits applies the file edits of the response to the working tree. Every edit is resolved before
+// any file is written, so a patch that doesn't apply leaves all the files unchanged. The files are
+// snapshotted first, or backed up one by one if snapshots are disabled.
+func (r *Runner) RunEdits(prompt string, fm *TemplateFrontMatter) error {
+	prompt += "\n\n" + edits.Instruction
+	response, err := r.complete(fm, prompt)
+	if err != nil {
+		return err
+	}
+
+	parsed, err := edits.Parse(response)
+	if err != nil {
+		return err
+	}
+
+	var changes []fileChange
+	for _, edit := range parsed {
+		change, err := resolveEdit(edit)
+		if err != nil {
+			return fmt.Errorf("%s: %w. No files were changed", edit.Path, err)
+		}
+		changes = append(changes, change)
+	}
+
+	for _, change := range changes {
+		fmt.Printf("--- a/%s\n+++ b/%s\n%s", change.Path, change.Path, docdiff.Diff(change.old, change.new))
+	}
+
+	if r.args.Preview {
+		fmt.Fprintf(os.Stderr, "[preview, %s unchanged]\n", fileCount(len(changes)))
+		return r.FinishCompletion(prompt, response)
+	}
+
+	var paths []string
+	for _, change := range changes {
+		paths = append(paths, change.Path)
+	}
+	r.snapshot, err = r.takeSnapshot(paths)
+	if err != nil {
+		return err
+	}
+
+	var summary []string
+	for _, change := range changes {
+		err := r.applyChange(change)
+		if err != nil {
+			return fmt.Errorf("%s: %w", change.Path, err)
+		}
+		summary = append(summary, changeSummary(change))
+	}
+	fmt.Fprintf(os.Stderr, "[edited %s]\n%s\n", fileCount(len(changes)), strings.Join(summary, "\n"))
+
+	return r.FinishCompletion(prompt, response)
+}
+
+// resolveEdit reads the file, and computes its new content
+func resolveEdit(edit edits.Edit) (fileChange, error) {
+	change := fileChange{Edit: edit, new: edit.Content}
+
+	err := checkInsideTree(edit.Path)
+	if err != nil {
+		return change, err
+	}
+
+	old, err := os.ReadFile(edit.Path)
+	switch {
+	case err == nil:
+		change.old = string(old)
+		change.exists = true
+	case errors.Is(err, fs.ErrNotExist):
+		if edit.Patch != "" || edit.Delete {
+			return change, errors.New("no such file")
+		}
+	default:
+		return change, err
+	}
+
+	if edit.Patch != "" {
+		change.new, err = docdiff.Apply(change.old, edit.Patch)
+		if err != nil {
+			return change, err
+		}
+	}
+	if edit.Delete {
+		change.new = ""
+	}
+	return change, nil
+}
+
+// checkInsideTree requires the path to stay inside the working directory, and outside of .git, once
+// symlinks are resolved.
+// A file that doesn't exist yet is checked by the directories it would be created in.
+func checkInsideTree(p string) error {
+	wd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	root, err := filepath.EvalSymlinks(wd)
+	if err != nil {
+		return err
+	}
+
+	target := filepath.Join(root, p)
+	rest := ""
+	for {
+		resolved, err := filepath.EvalSymlinks(target)
+		if err == nil {
+			target = filepath.Join(resolved, rest)
+			break
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		rest = filepath.Join(filepath.Base(target), rest)
+		target = filepath.Dir(target)
+	}
+
+	rel, err := filepath.Rel(root, target)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return errors.New("the path leads outside the working tree through a symlink")
+	}
+	for _, part := range strings.Split(rel, string(filepath.Separator)) {
+		if strings.EqualFold(part, ".git") {
+			return errors.New("the path leads into .git through a symlink")
+		}
+	}
+	return nil
+}
+
+func (r *Runner) applyChange(change fileChange) error {
+	switch {
+	case change.Delete:
+		backup, err := r.backupConfig()
+		if err != nil {
+			return err
+		}
+		_, err = backupFile(change.Path, backup)
+		if err != nil {
+			return err
+		}
+		wroteFile(change.Path)
+		return os.Remove(change.Path)
+
+	case change.exists:
+		return r.ReplaceFile(strings.NewReader(change.new), change.Path)
+
+	default:
+		err := os.MkdirAll(filepath.Dir(change.Path), 0755)
+		if err != nil {
+			return err
+		}
+		wroteFile(change.Path)
+		return os.WriteFile(change.Path, []byte(change.new), 0644)
+	}
+}
+
+// changeSummary is a line like "  main.go  +3 -1"
+func changeSummary(change fileChange) string {
+	switch {
+	case change.Delete:
+		return fmt.Sprintf("  %s  deleted", change.Path)
+	case !change.exists:
+		return fmt.Sprintf("  %s  new", change.Path)
+	}
+
+	var added, deleted int
+	for _, hunk := range docdiff.Hunks(change.old, change.new) {
+		for _, line := range hunk.Lines {
+			switch line.Op {
+			case docdiff.Insert:
+				added++
+			case docdiff.Delete:
+				deleted++
+			}
+		}
+	}
+	return fmt.Sprintf("  %s  +%d -%d", change.Path, added, deleted)
+}
+
+func fileCount(n int) string {
+	if n == 1 {
+		return "1 file"
+	}
+	return fmt.Sprintf("%d files", n)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckInsideTree(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(root, "pkg"), 0755))
+	assert.NoError(t, os.MkdirAll(filepath.Join(root, ".git", "hooks"), 0755))
+	assert.NoError(t, os.Symlink(outside, filepath.Join(root, "shared")))
+	assert.NoError(t, os.Symlink(filepath.Join(root, ".git", "hooks"), filepath.Join(root, "hooks")))
+	assert.NoError(t, os.Symlink("pkg", filepath.Join(root, "lib")))
+
+	wd, err := os.Getwd()
+	assert.NoError(t, err)
+	assert.NoError(t, os.Chdir(root))
+	defer os.Chdir(wd)
+
+	testCases := []struct {
+		path string
+		err  string
+	}{
+		{path: "main.go"},
+		{path: "pkg/new/util.go"},
+		{path: "lib/util.go"},
+		{path: "shared/notes.md", err: "the path leads outside the working tree through a symlink"},
+		{path: "shared/new/notes.md", err: "the path leads outside the working tree through a symlink"},
+		{path: "hooks/pre-commit", err: "the path leads into .git through a symlink"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.path, func(t *testing.T) {
+			err := checkInsideTree(tc.path)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
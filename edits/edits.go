@@ -0,0 +1,205 @@
+// Package edits parses responses that edit several files, written either as a fenced code block per file
+// or as a JSON list of edits.
+package edits
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// Edit changes a file. Exactly one of Content, Patch and Delete is set.
+type Edit struct {
+	Path string `json:"path"`
+	// Content is the whole new content of the file
+	Content string `json:"content"`
+	// Patch is a unified diff of the changes to the file
+	Patch string `json:"patch"`
+	// Delete removes the file
+	Delete bool `json:"delete"`
+}
+
+// Instruction describes the formats Parse reads, for the model
+const Instruction = `For each file you change or create, write its path on a line of its own, followed by the whole
+new content of the file in a code block:
+
+path/to/file.go
+` + "```go" + `
+package main
+` + "```" + `
+
+Or respond with a JSON list of edits instead: [{"path": "path/to/file.go", "content": "..."}], with
+"patch" holding a unified diff instead of "content" for small changes to large files, or "delete": true
+to remove the file.`
+
+// pathLinePattern takes the path out of lines like "path/to/file.go", "### `file.go`" or "File: file.go:"
+var pathLinePattern = regexp.MustCompile("^(?:#+\\s*)?(?:\\*\\*)?(?:(?i:file|path):\\s*)?`?([\\w./-]+)`?(?:\\*\\*)?:?$")
+
+// Parse returns the edits of the response. Code blocks are edits when the path of their file is in
+// their info string, e.g. ```go path=main.go or ```go:main.go, or on the line before them. Other code
+// blocks are left out.
+func Parse(response string) ([]Edit, error) {
+	trimmed := strings.TrimSpace(response)
+	if strings.HasPrefix(trimmed, "```json") {
+		trimmed = strings.TrimSuffix(strings.TrimPrefix(trimmed, "```json"), "```")
+		trimmed = strings.TrimSpace(trimmed)
+	}
+
+	var edits []Edit
+	var err error
+	if strings.HasPrefix(trimmed, "[") || strings.HasPrefix(trimmed, "{") {
+		edits, err = parseJSON(trimmed)
+	} else {
+		edits = parseBlocks(response)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(edits) == 0 {
+		return nil, errors.New("no file edits in the response")
+	}
+
+	seen := map[string]bool{}
+	for i, edit := range edits {
+		clean, err := CleanPath(edit.Path)
+		if err != nil {
+			return nil, err
+		}
+		// the edits are applied in order, so the last of several would silently win
+		if seen[clean] {
+			return nil, fmt.Errorf("%s: the response edits the file more than once", clean)
+		}
+		seen[clean] = true
+		edits[i].Path = clean
+	}
+	return edits, nil
+}
+
+// CleanPath checks that the path is relative, stays inside the working tree, and is outside of .git,
+// where a hook would run on the next commit. Symlinks are resolved against the tree by the caller.
+func CleanPath(p string) (string, error) {
+	if p == "" {
+		return "", errors.New("an edit has no path")
+	}
+	if path.IsAbs(p) {
+		return "", fmt.Errorf("%s: edits must have relative paths", p)
+	}
+
+	clean := path.Clean(p)
+	if clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", fmt.Errorf("%s: edits can't leave the working tree", p)
+	}
+	for _, part := range strings.Split(clean, "/") {
+		if strings.EqualFold(part, ".git") {
+			return "", fmt.Errorf("%s: edits can't change .git", p)
+		}
+	}
+	return clean, nil
+}
+
+// parseJSON reads a list of edits, or an object with the list under "edits"
+func parseJSON(text string) ([]Edit, error) {
+	var edits []Edit
+	if strings.HasPrefix(text, "{") {
+		var object struct {
+			Edits []Edit `json:"edits"`
+		}
+		err := json.Unmarshal([]byte(text), &object)
+		if err != nil {
+			return nil, fmt.Errorf("the JSON edits don't parse: %w", err)
+		}
+		edits = object.Edits
+	} else {
+		err := json.Unmarshal([]byte(text), &edits)
+		if err != nil {
+			return nil, fmt.Errorf("the JSON edits don't parse: %w", err)
+		}
+	}
+
+	for _, edit := range edits {
+		set := 0
+		if edit.Content != "" {
+			set++
+		}
+		if edit.Patch != "" {
+			set++
+		}
+		if edit.Delete {
+			set++
+		}
+		if set == 0 {
+			return nil, fmt.Errorf("%s: an edit needs one of content, patch or delete", edit.Path)
+		}
+		if set > 1 {
+			return nil, fmt.Errorf("%s: an edit has only one of content, patch or delete", edit.Path)
+		}
+	}
+	return edits, nil
+}
+
+func parseBlocks(response string) []Edit {
+	var edits []Edit
+	var previous string // the last line of prose before a block
+
+	lines := strings.Split(response, "\n")
+	for i := 0; i < len(lines); i++ {
+		fence := strings.TrimSpace(lines[i])
+		if !strings.HasPrefix(fence, "```") {
+			if fence != "" {
+				previous = fence
+			}
+			continue
+		}
+
+		filePath := infoPath(strings.TrimPrefix(fence, "```"))
+		if filePath == "" {
+			if match := pathLinePattern.FindStringSubmatch(previous); match != nil && looksLikePath(match[1]) {
+				filePath = match[1]
+			}
+		}
+		previous = ""
+
+		// the block ends at a bare fence at the same indentation
+		indent := lines[i][:len(lines[i])-len(strings.TrimLeft(lines[i], " \t"))]
+		var content []string
+		for i++; i < len(lines) && lines[i] != indent+"```"; i++ {
+			content = append(content, strings.TrimPrefix(lines[i], indent))
+		}
+
+		if filePath != "" {
+			edits = append(edits, Edit{Path: filePath, Content: strings.Join(content, "\n") + "\n"})
+		}
+	}
+	return edits
+}
+
+// infoPath returns the path named by the info string of a fence, like "go path=main.go", "go:main.go"
+// or "main.go"
+func infoPath(info string) string {
+	for _, field := range strings.Fields(info) {
+		if p, ok := strings.CutPrefix(field, "path="); ok {
+			return strings.Trim(p, `"'`)
+		}
+		if p, ok := strings.CutPrefix(field, "file="); ok {
+			return strings.Trim(p, `"'`)
+		}
+	}
+
+	first, _, _ := strings.Cut(strings.TrimSpace(info), " ")
+	if _, p, ok := strings.Cut(first, ":"); ok && looksLikePath(p) {
+		return p
+	}
+	if looksLikePath(first) {
+		return first
+	}
+	return ""
+}
+
+// looksLikePath is true for names with a directory or an extension, which language tags don't have
+func looksLikePath(s string) bool {
+	return strings.ContainsAny(s, "./") && !strings.HasSuffix(s, ".") && !strings.HasSuffix(s, "/")
+}
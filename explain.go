@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/hayeah/pls/tokens"
+)
+
+// ExplainContext prints how the token budget of the context window is split between the parts of the prompt
+func (r *Runner) ExplainContext(prompt string, instructions string, frontMatter *TemplateFrontMatter) error {
+	model := r.Model(frontMatter)
+
+	count := func(text string) (int, error) {
+		return tokens.Count(model, text)
+	}
+
+	total, err := count(prompt)
+	if err != nil {
+		return err
+	}
+
+	input, err := count(r.input)
+	if err != nil {
+		return err
+	}
+
+	extra, err := count(instructions)
+	if err != nil {
+		return err
+	}
+
+	system, err := count(frontMatter.System)
+	if err != nil {
+		return err
+	}
+	total += system
+
+	var examples int
+	for _, message := range frontMatter.Messages {
+		n, err := count(message.Content)
+		if err != nil {
+			return err
+		}
+		examples += n
+	}
+	total += examples
+
+	window := tokens.ContextWindow(model)
+
+	// whatever remains of the window is available to the completion unless max_tokens is set
+	reserved := window - total
+	if maxTokens := r.chat.MaxTokens(); maxTokens > 0 {
+		reserved = maxTokens
+	}
+	if frontMatter.MaxTokens > 0 {
+		reserved = frontMatter.MaxTokens
+	}
+
+	w := tabwriter.NewWriter(os.Stderr, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(w, "model\t%s\t\n", model)
+	fmt.Fprintf(w, "system\t%d\t\n", system)
+	fmt.Fprintf(w, "examples\t%d\t\n", examples)
+	fmt.Fprintf(w, "template\t%d\t\n", total-system-examples-input-extra)
+	fmt.Fprintf(w, "input\t%d\t\n", input)
+	fmt.Fprintf(w, "instructions\t%d\t\n", extra)
+	fmt.Fprintf(w, "prompt total\t%d\t\n", total)
+	fmt.Fprintf(w, "reserved output\t%d\t\n", reserved)
+	fmt.Fprintf(w, "context window\t%d\t\n", window)
+	err = w.Flush()
+	if err != nil {
+		return err
+	}
+
+	if total+reserved > window {
+		return fmt.Errorf("prompt (%d tokens) and reserved output (%d tokens) exceed the context window of %d tokens", total, reserved, window)
+	}
+
+	return nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// anyLanguage is the value of a bare --extract-code, which keeps the code blocks of every language
+const anyLanguage = "*"
+
+// optionalValues are the default values of the options that may be given without a value
+var optionalValues = map[string]string{
+	"--extract-code": anyLanguage,
+	"--git-branch":   autoBranch,
+}
+
+// withOptionalValues gives a bare --extract-code or --git-branch its default value. go-arg options
+// can't have optional values, so --extract-code=lang is the only way to name the language.
+func withOptionalValues(argv []string) []string {
+	expanded := make([]string, len(argv))
+	for i, arg := range argv {
+		if arg == "--" {
+			copy(expanded[i:], argv[i:])
+			break
+		}
+		if value, ok := optionalValues[arg]; ok {
+			arg += "=" + value
+		}
+		expanded[i] = arg
+	}
+	return expanded
+}
+
+// extractCode splits the response into the code of its fenced blocks in the language, and the prose
+// around them. Blocks of other languages are part of the prose.
+func extractCode(response string, language string) (code string, prose string) {
+	var codeLines, proseLines []string
+	var block []string
+	var inBlock, keep bool
+
+	for _, line := range strings.Split(response, "\n") {
+		fence := strings.TrimSpace(line)
+
+		if !inBlock {
+			if !strings.HasPrefix(fence, "```") {
+				proseLines = append(proseLines, line)
+				continue
+			}
+			inBlock = true
+			block = nil
+			keep = matchesLanguage(strings.TrimPrefix(fence, "```"), language)
+			if !keep {
+				proseLines = append(proseLines, line)
+			}
+			continue
+		}
+
+		if fence == "```" {
+			inBlock = false
+			if keep {
+				if len(codeLines) > 0 {
+					codeLines = append(codeLines, "")
+				}
+				codeLines = append(codeLines, block...)
+			} else {
+				proseLines = append(proseLines, line)
+			}
+			continue
+		}
+
+		if keep {
+			block = append(block, line)
+		} else {
+			proseLines = append(proseLines, line)
+		}
+	}
+
+	// a block left open at the end of the response still counts
+	if inBlock && keep && len(block) > 0 {
+		if len(codeLines) > 0 {
+			codeLines = append(codeLines, "")
+		}
+		codeLines = append(codeLines, block...)
+	}
+
+	if len(codeLines) > 0 {
+		code = strings.Join(codeLines, "\n") + "\n"
+	}
+	return code, squeezeBlankLines(strings.Join(proseLines, "\n"))
+}
+
+// squeezeBlankLines trims the text, and collapses the runs of blank lines left where code was taken out
+func squeezeBlankLines(text string) string {
+	var lines []string
+	for _, line := range strings.Split(strings.TrimSpace(text), "\n") {
+		if strings.TrimSpace(line) == "" && len(lines) > 0 && lines[len(lines)-1] == "" {
+			continue
+		}
+		if strings.TrimSpace(line) == "" {
+			line = ""
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// matchesLanguage reports whether the info string of a fence, e.g. "go" or "python title=x.py", is of
+// the language
+func matchesLanguage(info string, language string) bool {
+	if language == anyLanguage {
+		return true
+	}
+	tag, _, _ := strings.Cut(strings.TrimSpace(info), " ")
+	return strings.EqualFold(tag, language)
+}
+
+// extractResponseCode keeps the code blocks of --extract-code in the response, and echoes the prose
+// to stderr
+func (r *Runner) extractResponseCode(response string) (string, error) {
+	code, prose := extractCode(response, r.args.ExtractCode)
+	if prose != "" {
+		fmt.Fprintln(os.Stderr, prose)
+	}
+
+	if code == "" {
+		if r.args.ExtractCode == anyLanguage {
+			return "", fmt.Errorf("no code blocks in the response")
+		}
+		return "", fmt.Errorf("no %s code blocks in the response", r.args.ExtractCode)
+	}
+	return code, nil
+}
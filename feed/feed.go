@@ -0,0 +1,150 @@
+// Package feed parses RSS 2.0 and Atom feeds.
+package feed
+
+import (
+	"encoding/xml"
+	"errors"
+	"strings"
+	"time"
+)
+
+// Item is an entry of a feed
+type Item struct {
+	// ID is the guid or atom id, falling back to the link
+	ID        string
+	Title     string
+	Link      string
+	Summary   string
+	Published time.Time
+}
+
+type rss struct {
+	Channel struct {
+		Title string `xml:"title"`
+		Items []struct {
+			Title       string `xml:"title"`
+			Link        string `xml:"link"`
+			GUID        string `xml:"guid"`
+			Description string `xml:"description"`
+			PubDate     string `xml:"pubDate"`
+		} `xml:"item"`
+	} `xml:"channel"`
+}
+
+type atom struct {
+	Title   string `xml:"title"`
+	Entries []struct {
+		Title string `xml:"title"`
+		ID    string `xml:"id"`
+		Links []struct {
+			Href string `xml:"href,attr"`
+			Rel  string `xml:"rel,attr"`
+		} `xml:"link"`
+		Summary   string `xml:"summary"`
+		Content   string `xml:"content"`
+		Updated   string `xml:"updated"`
+		Published string `xml:"published"`
+	} `xml:"entry"`
+}
+
+// Parse reads the title and items of an RSS or Atom document
+func Parse(data []byte) (string, []Item, error) {
+	var root struct {
+		XMLName xml.Name
+	}
+	err := xml.Unmarshal(data, &root)
+	if err != nil {
+		return "", nil, err
+	}
+
+	switch root.XMLName.Local {
+	case "rss":
+		return parseRSS(data)
+	case "feed":
+		return parseAtom(data)
+	}
+
+	return "", nil, errors.New("unknown feed format: " + root.XMLName.Local)
+}
+
+func parseRSS(data []byte) (string, []Item, error) {
+	var doc rss
+	err := xml.Unmarshal(data, &doc)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var items []Item
+	for _, i := range doc.Channel.Items {
+		item := Item{
+			ID:        strings.TrimSpace(i.GUID),
+			Title:     strings.TrimSpace(i.Title),
+			Link:      strings.TrimSpace(i.Link),
+			Summary:   strings.TrimSpace(i.Description),
+			Published: parseTime(i.PubDate),
+		}
+		if item.ID == "" {
+			item.ID = item.Link
+		}
+		items = append(items, item)
+	}
+
+	return strings.TrimSpace(doc.Channel.Title), items, nil
+}
+
+func parseAtom(data []byte) (string, []Item, error) {
+	var doc atom
+	err := xml.Unmarshal(data, &doc)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var items []Item
+	for _, e := range doc.Entries {
+		item := Item{
+			ID:      strings.TrimSpace(e.ID),
+			Title:   strings.TrimSpace(e.Title),
+			Summary: strings.TrimSpace(e.Summary),
+		}
+		if item.Summary == "" {
+			item.Summary = strings.TrimSpace(e.Content)
+		}
+
+		for _, link := range e.Links {
+			if link.Rel == "" || link.Rel == "alternate" {
+				item.Link = link.Href
+				break
+			}
+		}
+		if item.ID == "" {
+			item.ID = item.Link
+		}
+
+		item.Published = parseTime(e.Published)
+		if item.Published.IsZero() {
+			item.Published = parseTime(e.Updated)
+		}
+
+		items = append(items, item)
+	}
+
+	return strings.TrimSpace(doc.Title), items, nil
+}
+
+var timeFormats = []string{
+	time.RFC1123Z,
+	time.RFC1123,
+	time.RFC3339,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04:05 MST",
+}
+
+func parseTime(s string) time.Time {
+	s = strings.TrimSpace(s)
+	for _, format := range timeFormats {
+		if t, err := time.Parse(format, s); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,61 @@
+package feed
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	testCases := []struct {
+		name          string
+		input         string
+		expectedTitle string
+		expectedItems []Item
+	}{
+		{
+			name: "rss",
+			input: `<?xml version="1.0"?>
+<rss version="2.0"><channel><title>Blog</title>
+<item><title>First</title><link>https://example.com/1</link><guid>1</guid>
+<description>Hello</description><pubDate>Tue, 02 Jan 2024 15:00:00 +0000</pubDate></item>
+<item><title>Second</title><link>https://example.com/2</link></item>
+</channel></rss>`,
+			expectedTitle: "Blog",
+			expectedItems: []Item{
+				{ID: "1", Title: "First", Link: "https://example.com/1", Summary: "Hello", Published: time.Date(2024, 1, 2, 15, 0, 0, 0, time.FixedZone("", 0))},
+				{ID: "https://example.com/2", Title: "Second", Link: "https://example.com/2"},
+			},
+		},
+		{
+			name: "atom",
+			input: `<?xml version="1.0"?>
+<feed xmlns="http://www.w3.org/2005/Atom"><title>News</title>
+<entry><title>Post</title><id>urn:1</id>
+<link rel="alternate" href="https://example.com/post"/>
+<content>Body</content><updated>2024-01-02T15:00:00Z</updated></entry>
+</feed>`,
+			expectedTitle: "News",
+			expectedItems: []Item{
+				{ID: "urn:1", Title: "Post", Link: "https://example.com/post", Summary: "Body", Published: time.Date(2024, 1, 2, 15, 0, 0, 0, time.UTC)},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			title, items, err := Parse([]byte(tc.input))
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedTitle, title)
+			assert.Equal(t, len(tc.expectedItems), len(items))
+			for i := range items {
+				assert.Equal(t, tc.expectedItems[i].ID, items[i].ID)
+				assert.Equal(t, tc.expectedItems[i].Title, items[i].Title)
+				assert.Equal(t, tc.expectedItems[i].Link, items[i].Link)
+				assert.Equal(t, tc.expectedItems[i].Summary, items[i].Summary)
+				assert.True(t, tc.expectedItems[i].Published.Equal(items[i].Published))
+			}
+		})
+	}
+}
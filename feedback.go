@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+type FeedbackArgs struct {
+	RunID  string `arg:"positional,required" help:"id of the run, or last for the latest run"`
+	Rating int    `arg:"-r,--rating,required" help:"rating from 1 (bad) to 5 (great)"`
+	Note   string `arg:"-n,--note" help:"what was good or bad about the response"`
+}
+
+// runFeedback rates a run. The ratings are kept with the run transcript.
+func runFeedback(argv []string) error {
+	var args FeedbackArgs
+	parseArgs("pls feedback", &args, argv)
+
+	if args.Rating < 1 || args.Rating > 5 {
+		return fmt.Errorf("rating must be from 1 to 5, got %d", args.Rating)
+	}
+
+	run, err := ReadRun(args.RunID)
+	if err != nil {
+		return err
+	}
+
+	run.Feedback = append(run.Feedback, Feedback{
+		Time:   time.Now(),
+		Rating: args.Rating,
+		Note:   args.Note,
+	})
+
+	err = run.Save()
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "[rated run %s of %s]\n", run.ID, run.Template)
+	return nil
+}
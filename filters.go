@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/hayeah/pls/streamfilter"
+)
+
+const defaultWrapWidth = 80
+
+// outputFilters returns the filters of the frontmatter followed by those of --filter:
+//
+//	strip_fence  removes a code fence around the whole response
+//	wrap[=N]     wraps lines at N columns, 80 by default
+//	redact       replaces the matches of the redact patterns of the config
+//	highlight    colors headings and code blocks, when stdout is a terminal
+func (r *Runner) outputFilters() ([]streamfilter.Filter, error) {
+	var names []string
+	if r.frontMatter != nil {
+		names = append(names, r.frontMatter.Filters...)
+	}
+	names = append(names, r.args.Filters...)
+
+	var filters []streamfilter.Filter
+	for _, name := range names {
+		name, param, _ := strings.Cut(name, "=")
+		switch name {
+		case "strip_fence":
+			filters = append(filters, streamfilter.StripFence())
+
+		case "wrap":
+			width := defaultWrapWidth
+			if param != "" {
+				var err error
+				width, err = strconv.Atoi(param)
+				if err != nil || width < 1 {
+					return nil, fmt.Errorf("filter wrap: width must be a positive number, got %q", param)
+				}
+			}
+			filters = append(filters, streamfilter.Wrap(width))
+
+		case "redact":
+			var patterns []*regexp.Regexp
+			for _, pattern := range r.config.Redact {
+				re, err := regexp.Compile(pattern)
+				if err != nil {
+					return nil, fmt.Errorf("filter redact: %q: %w", pattern, err)
+				}
+				patterns = append(patterns, re)
+			}
+			filters = append(filters, streamfilter.Redact(patterns, redacted))
+
+		case "highlight":
+			// rendering the markdown highlights them already
+			if r.OutputFile() == "" && r.args.Sink == "" && stdoutIsTerminal() && !r.renderMarkdown() {
+				filters = append(filters, streamfilter.Highlight())
+			}
+
+		default:
+			return nil, fmt.Errorf("unknown output filter: %s", name)
+		}
+	}
+
+	return filters, nil
+}
+
+func stdoutIsTerminal() bool {
+	info, err := os.Stdout.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// renderMarkdown reports whether the response written to stdout is rendered as markdown: with
+// --render, or by default when stdout is a terminal. JSON responses and extracted code are written as
+// they are.
+func (r *Runner) renderMarkdown() bool {
+	if r.args.NoRender || r.args.Sink != "" || r.OutputFile() != "" {
+		return false
+	}
+	if r.args.Render {
+		return true
+	}
+	if r.config.NoRender || r.args.ExtractCode != "" {
+		return false
+	}
+	if r.frontMatter != nil && (r.frontMatter.ResponseFormat == ResponseFormatJSON || len(r.frontMatter.Tools) > 0) {
+		return false
+	}
+	return stdoutIsTerminal()
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// includeFile returns the content of the file, for {{file "path"}}. Relative paths are relative to
+// the working directory.
+func includeFile(name string) (string, error) {
+	content, err := os.ReadFile(name)
+	if err != nil {
+		return "", err
+	}
+	return string(content), nil
+}
+
+// includeGlob returns the files matching the pattern, each under a header with its path, for
+// {{glob "src/**/*.go"}}. ** matches any number of directories.
+func includeGlob(pattern string) (string, error) {
+	names, err := globFiles(pattern)
+	if err != nil {
+		return "", err
+	}
+	if len(names) == 0 {
+		return "", fmt.Errorf("glob %q: no files match", pattern)
+	}
+
+	var b strings.Builder
+	for _, name := range names {
+		content, err := os.ReadFile(name)
+		if err != nil {
+			return "", err
+		}
+
+		fmt.Fprintf(&b, "--- %s ---\n%s", name, content)
+		if !strings.HasSuffix(string(content), "\n") {
+			b.WriteString("\n")
+		}
+	}
+	return b.String(), nil
+}
+
+// globFiles returns the regular files matching the pattern, sorted
+func globFiles(pattern string) ([]string, error) {
+	pattern = filepath.ToSlash(filepath.Clean(pattern))
+	if !strings.Contains(pattern, "**") {
+		names, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		return regularFiles(names), nil
+	}
+
+	// walk from the directory before the first wildcard
+	segments := strings.Split(pattern, "/")
+	var root []string
+	for _, segment := range segments {
+		if strings.ContainsAny(segment, "*?[") {
+			break
+		}
+		root = append(root, segment)
+	}
+	rest := segments[len(root):]
+
+	dir := "."
+	if len(root) > 0 {
+		dir = strings.Join(root, "/")
+		if dir == "" {
+			dir = "/"
+		}
+	}
+
+	var names []string
+	err := filepath.WalkDir(dir, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, name)
+		if err != nil {
+			return err
+		}
+
+		matched, err := matchSegments(rest, strings.Split(filepath.ToSlash(rel), "/"))
+		if matched {
+			names = append(names, name)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(names)
+	return names, nil
+}
+
+// matchSegments matches a path against the pattern segment by segment, where ** matches zero or more
+// segments
+func matchSegments(pattern, segments []string) (bool, error) {
+	if len(pattern) == 0 {
+		return len(segments) == 0, nil
+	}
+
+	if pattern[0] == "**" {
+		for i := 0; i <= len(segments); i++ {
+			matched, err := matchSegments(pattern[1:], segments[i:])
+			if matched || err != nil {
+				return matched, err
+			}
+		}
+		return false, nil
+	}
+
+	if len(segments) == 0 {
+		return false, nil
+	}
+
+	matched, err := path.Match(pattern[0], segments[0])
+	if !matched || err != nil {
+		return false, err
+	}
+	return matchSegments(pattern[1:], segments[1:])
+}
+
+func regularFiles(names []string) []string {
+	var files []string
+	for _, name := range names {
+		info, err := os.Stat(name)
+		if err == nil && info.Mode().IsRegular() {
+			files = append(files, name)
+		}
+	}
+	return files
+}
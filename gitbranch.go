@@ -0,0 +1,224 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// autoBranch is the value of a bare --git-branch, which names the branch after the template and the
+// time, e.g. pls/refactor-20240105-142000
+const autoBranch = "*"
+
+var unsafeBranchChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// onGitBranch runs the operation with --git-branch in a worktree of a new branch created from HEAD,
+// and commits the files it changed to the branch. The working tree and its branch are untouched, so
+// the changes are reviewed with git diff and discarded by deleting the branch.
+func (r *Runner) onGitBranch(run func() error) error {
+	branch := r.args.GitBranch
+	if branch == "" {
+		return run()
+	}
+
+	root, err := git("rev-parse", "--show-toplevel")
+	if err != nil {
+		return fmt.Errorf("--git-branch: %w", err)
+	}
+	prefix, err := git("rev-parse", "--show-prefix")
+	if err != nil {
+		return fmt.Errorf("--git-branch: %w", err)
+	}
+
+	if branch == autoBranch {
+		// with a bare --git-branch, the name meant for the branch is taken as the template
+		if !strings.ContainsRune(r.args.PromptFile, filepath.Separator) {
+			_, err := MatchNameInPaths(r.templatePaths, r.args.PromptFile)
+			if errors.Is(err, ErrNotFound) {
+				return fmt.Errorf("%w. A bare --git-branch names the branch itself, to name it use --git-branch=%s", err, r.args.PromptFile)
+			}
+		}
+
+		name := strings.TrimSuffix(filepath.Base(r.args.PromptFile), filepath.Ext(r.args.PromptFile))
+		name = strings.Trim(unsafeBranchChars.ReplaceAllString(name, "-"), "-.")
+		branch = fmt.Sprintf("pls/%s-%s", name, time.Now().Format("20060102-150405"))
+	}
+
+	// the prompts are found in the working tree, including those that aren't committed yet
+	err = r.absTemplatePaths()
+	if err != nil {
+		return err
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	root = strings.TrimSpace(root)
+
+	dir, err := os.MkdirTemp("", "pls-worktree-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	_, err = git("worktree", "add", "--quiet", "-b", branch, dir, "HEAD")
+	if err != nil {
+		return fmt.Errorf("--git-branch: %w", err)
+	}
+
+	// the worktree is removed however the run ends. git runs from the repo, since the working
+	// directory may still be in the worktree.
+	removed := false
+	removeWorktree := func() error {
+		if removed {
+			return nil
+		}
+		removed = true
+		chdirErr := os.Chdir(wd)
+		_, err := git("-C", root, "worktree", "remove", "--force", dir)
+		return errors.Join(chdirErr, err)
+	}
+	defer removeWorktree()
+
+	err = os.Chdir(filepath.Join(dir, strings.TrimSpace(prefix)))
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "[on branch %s, from %s]\n", branch, root)
+
+	// the branch is the backup
+	r.args.NoBackup = true
+	writtenFiles = &fileSet{}
+	defer func() { writtenFiles = nil }()
+	runErr := run()
+
+	// even if the run failed, what it changed is committed for review
+	stat, commitErr := commitBranch(writtenFiles.within(dir))
+
+	err = removeWorktree()
+	if err != nil {
+		return err
+	}
+
+	if commitErr != nil || stat == "" {
+		_, err = git("branch", "--delete", "--force", branch)
+		if err != nil {
+			return err
+		}
+	}
+	if commitErr != nil {
+		return fmt.Errorf("--git-branch: %w", commitErr)
+	}
+	if stat == "" {
+		fmt.Fprintf(os.Stderr, "[no changes, deleted branch %s]\n", branch)
+		return runErr
+	}
+
+	fmt.Fprintf(os.Stderr, "[committed to %s:%s. Review with git diff HEAD...%s]\n", branch, stat, branch)
+	return runErr
+}
+
+// fileSet is a set of files, safe for the concurrent runs of pls batch
+type fileSet struct {
+	mu    sync.Mutex
+	paths map[string]bool
+}
+
+// writtenFiles are the files written and deleted by the run on --git-branch, the only ones committed.
+// Files set aside, like .rejected responses, are left out. It's nil without --git-branch.
+var writtenFiles *fileSet
+
+// wroteFile records that the run wrote or deleted the file
+func wroteFile(path string) {
+	s := writtenFiles
+	if s == nil {
+		return
+	}
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		abs = path
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.paths == nil {
+		s.paths = map[string]bool{}
+	}
+	s.paths[abs] = true
+}
+
+// within returns the files in the directory, sorted
+func (s *fileSet) within(dir string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var paths []string
+	for path := range s.paths {
+		if strings.HasPrefix(path, dir+string(filepath.Separator)) {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// commitBranch commits the files in the worktree in the working directory. It returns the stat of the
+// commit, or "" if nothing changed.
+func commitBranch(files []string) (string, error) {
+	if len(files) == 0 {
+		return "", nil
+	}
+
+	_, err := git(append([]string{"add", "--all", "--"}, files...)...)
+	if err != nil {
+		return "", err
+	}
+
+	stat, err := git("diff", "--cached", "--shortstat")
+	if err != nil {
+		return "", err
+	}
+	stat = strings.TrimRight(stat, "\n")
+	if stat == "" {
+		return "", nil
+	}
+
+	_, err = git("commit", "--quiet", "--message", commandLine())
+	if err != nil {
+		return "", err
+	}
+	return stat, nil
+}
+
+// absTemplatePaths resolves the relative template paths and prompt file against the working directory
+func (r *Runner) absTemplatePaths() error {
+	for i, path := range r.templatePaths {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return err
+		}
+		r.templatePaths[i] = abs
+	}
+
+	_, err := os.Stat(r.args.PromptFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		// a template name, found in the template paths
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	r.args.PromptFile, err = filepath.Abs(r.args.PromptFile)
+	return err
+}
@@ -3,15 +3,20 @@ module github.com/hayeah/pls
 go 1.20
 
 require (
-	github.com/alexflint/go-arg v1.4.3 // indirect
+	github.com/alexflint/go-arg v1.4.3
+	github.com/atotto/clipboard v0.1.4
+	github.com/pkoukk/tiktoken-go v0.1.8
+	github.com/pkoukk/tiktoken-go-loader v0.0.2
+	github.com/sashabaranov/go-openai v1.9.3
+	github.com/stretchr/testify v1.8.2
+	gopkg.in/yaml.v2 v2.4.0
+)
+
+require (
 	github.com/alexflint/go-scalar v1.1.0 // indirect
-	github.com/atotto/clipboard v0.1.4 // indirect
 	github.com/davecgh/go-spew v1.1.1 // indirect
-	github.com/ghodss/yaml v1.0.0 // indirect
+	github.com/dlclark/regexp2 v1.10.0 // indirect
+	github.com/google/uuid v1.3.0 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
-	github.com/sashabaranov/go-openai v1.9.3 // indirect
-	github.com/stretchr/objx v0.5.0 // indirect
-	github.com/stretchr/testify v1.8.2 // indirect
-	gopkg.in/yaml.v2 v2.4.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/hayeah/pls/locale"
+)
+
+// builtinFuncs are the template functions of every prompt. The helpers follow sprig's names and
+// argument order, with the piped value last, e.g. {{.Input | trim | indent 4}}.
+func builtinFuncs() template.FuncMap {
+	return template.FuncMap{
+		"file": includeFile,
+		"glob": includeGlob,
+		"sh":   execDisabled,
+
+		// strings
+		"trim":       strings.TrimSpace,
+		"trimPrefix": func(prefix, s string) string { return strings.TrimPrefix(s, prefix) },
+		"trimSuffix": func(suffix, s string) string { return strings.TrimSuffix(s, suffix) },
+		"upper":      strings.ToUpper,
+		"lower":      strings.ToLower,
+		"replace":    func(old, new, s string) string { return strings.ReplaceAll(s, old, new) },
+		"contains":   func(substr, s string) bool { return strings.Contains(s, substr) },
+		"hasPrefix":  func(prefix, s string) bool { return strings.HasPrefix(s, prefix) },
+		"hasSuffix":  func(suffix, s string) bool { return strings.HasSuffix(s, suffix) },
+		"repeat":     func(count int, s string) string { return strings.Repeat(s, count) },
+		"trunc":      trunc,
+		"indent":     indent,
+		"nindent":    func(spaces int, s string) string { return "\n" + indent(spaces, s) },
+		"quote":      func(s string) string { return fmt.Sprintf("%q", s) },
+		"splitList":  func(sep, s string) []string { return strings.Split(s, sep) },
+		"join":       join,
+
+		// defaults
+		"default":  defaultValue,
+		"empty":    empty,
+		"coalesce": coalesce,
+		"ternary": func(whenTrue, whenFalse any, condition bool) any {
+			if condition {
+				return whenTrue
+			}
+			return whenFalse
+		},
+
+		// collections
+		"list": func(items ...any) []any { return items },
+		"dict": dict,
+
+		// encoding
+		"toJson":       toJSON,
+		"toPrettyJson": toPrettyJSON,
+
+		// dates
+		"now":        time.Now,
+		"date":       date,
+		"today":      func() time.Time { return startOfDay(time.Now()) },
+		"weekstart":  weekstart,
+		"monthstart": monthstart,
+		"addDays":    addDays,
+
+		// numbers, formatted by the locale
+		"number":     number,
+		"humanBytes": humanBytes,
+	}
+}
+
+// trunc keeps the first n characters of the string
+func trunc(n int, s string) string {
+	runes := []rune(s)
+	if n < 0 || len(runes) <= n {
+		return s
+	}
+	return string(runes[:n])
+}
+
+// indent prefixes each line with the number of spaces
+func indent(spaces int, s string) string {
+	pad := strings.Repeat(" ", spaces)
+	return pad + strings.ReplaceAll(s, "\n", "\n"+pad)
+}
+
+// join joins the elements of a list of any type
+func join(sep string, list any) string {
+	if list == nil {
+		return ""
+	}
+
+	v := reflect.ValueOf(list)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return fmt.Sprint(list)
+	}
+
+	items := make([]string, v.Len())
+	for i := range items {
+		items[i] = fmt.Sprint(v.Index(i).Interface())
+	}
+	return strings.Join(items, sep)
+}
+
+// defaultValue returns the given value, or def if it is empty, for {{.Vars.tone | default "neutral"}}
+func defaultValue(def any, given ...any) any {
+	if len(given) == 0 || empty(given[0]) {
+		return def
+	}
+	return given[0]
+}
+
+// empty reports whether the value is nil or the zero value of its type, or an empty collection
+func empty(value any) bool {
+	if value == nil {
+		return true
+	}
+
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Pointer, reflect.Interface:
+		return v.IsNil()
+	default:
+		return v.IsZero()
+	}
+}
+
+// coalesce returns the first value that isn't empty
+func coalesce(values ...any) any {
+	for _, value := range values {
+		if !empty(value) {
+			return value
+		}
+	}
+	return nil
+}
+
+// dict makes a map of alternating keys and values
+func dict(pairs ...any) (map[string]any, error) {
+	if len(pairs)%2 != 0 {
+		return nil, fmt.Errorf("dict: odd number of arguments")
+	}
+
+	m := make(map[string]any, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		m[fmt.Sprint(pairs[i])] = pairs[i+1]
+	}
+	return m, nil
+}
+
+func toJSON(value any) (string, error) {
+	b, err := json.Marshal(value)
+	return string(b), err
+}
+
+func toPrettyJSON(value any) (string, error) {
+	b, err := json.MarshalIndent(value, "", "  ")
+	return string(b), err
+}
+
+// templateLocale formats the numbers and weeks of templates. It's the locale of the environment, or
+// locale of the config, set at startup.
+var templateLocale = locale.Parse(localeEnv())
+
+// localeEnv returns the locale of the environment, as the C library picks the locale of numbers
+func localeEnv() string {
+	for _, name := range []string{"LC_ALL", "LC_NUMERIC", "LANG"} {
+		if value := os.Getenv(name); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// toTime converts the value of a template to a time: a time, Unix seconds, or an RFC 3339 or
+// 2006-01-02 string
+func toTime(t any) (time.Time, error) {
+	switch t := t.(type) {
+	case time.Time:
+		return t, nil
+	case *time.Time:
+		return *t, nil
+	case int:
+		return time.Unix(int64(t), 0), nil
+	case int64:
+		return time.Unix(t, 0), nil
+	case string:
+		for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+			parsed, err := time.ParseInLocation(layout, t, time.Local)
+			if err == nil {
+				return parsed, nil
+			}
+		}
+	}
+	return time.Time{}, fmt.Errorf("not a time: %v", t)
+}
+
+// timeOrNow is the time of the optional argument of a date helper, or now without one
+func timeOrNow(name string, t []any) (time.Time, error) {
+	switch len(t) {
+	case 0:
+		return time.Now(), nil
+	case 1:
+		parsed, err := toTime(t[0])
+		if err != nil {
+			return time.Time{}, fmt.Errorf("%s: %w", name, err)
+		}
+		return parsed, nil
+	}
+	return time.Time{}, fmt.Errorf("%s: expected at most one time, got %d arguments", name, len(t))
+}
+
+// date formats the time with a Go layout, for {{now | date "2006-01-02"}}. Without a time, it formats
+// now, as in {{date "Monday, January 2"}}.
+func date(layout string, t ...any) (string, error) {
+	parsed, err := timeOrNow("date", t)
+	if err != nil {
+		return "", err
+	}
+	return parsed.Format(layout), nil
+}
+
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// weekstart returns the midnight the week started, on Monday or on Sunday as in the locale, for
+// {{weekstart | date "Jan 2"}}. It's the week of now, or of the optional time.
+func weekstart(t ...any) (time.Time, error) {
+	parsed, err := timeOrNow("weekstart", t)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return templateLocale.StartOfWeek(parsed), nil
+}
+
+// monthstart returns the midnight of the first day of the month, of now or of the optional time
+func monthstart(t ...any) (time.Time, error) {
+	parsed, err := timeOrNow("monthstart", t)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Date(parsed.Year(), parsed.Month(), 1, 0, 0, 0, 0, parsed.Location()), nil
+}
+
+// addDays moves the time by a number of days, for ranges like {{weekstart | addDays 6 | date "Jan 2"}}.
+// Negative days go back.
+func addDays(days int, t any) (time.Time, error) {
+	parsed, err := toTime(t)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("addDays: %w", err)
+	}
+	return parsed.AddDate(0, 0, days), nil
+}
+
+// number groups the digits of the number by thousands, for {{.Data.count | number}}. Floats keep two
+// decimals.
+func number(value any) (string, error) {
+	switch v := reflect.ValueOf(value); v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return templateLocale.FormatNumber(float64(v.Int()), 0), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return templateLocale.FormatNumber(float64(v.Uint()), 0), nil
+	case reflect.Float32, reflect.Float64:
+		return templateLocale.FormatNumber(v.Float(), 2), nil
+	case reflect.String:
+		n, err := strconv.ParseFloat(strings.TrimSpace(v.String()), 64)
+		if err != nil {
+			return "", fmt.Errorf("number: not a number: %q", v.String())
+		}
+		decimals := 0
+		if strings.Contains(v.String(), ".") {
+			decimals = 2
+		}
+		return templateLocale.FormatNumber(n, decimals), nil
+	}
+	return "", fmt.Errorf("number: not a number: %v", value)
+}
+
+// humanBytes formats a size in bytes, e.g. 1.5 MB, for {{humanBytes .Data.size}}
+func humanBytes(size any) (string, error) {
+	switch v := reflect.ValueOf(size); v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return templateLocale.HumanBytes(v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return templateLocale.HumanBytes(int64(v.Uint())), nil
+	case reflect.Float32, reflect.Float64:
+		// sizes decoded from JSON are floats
+		return templateLocale.HumanBytes(int64(v.Float())), nil
+	}
+	return "", fmt.Errorf("humanBytes: not a size: %v", size)
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hayeah/pls/locale"
+)
+
+// renderHelper runs the template with the builtin helpers
+func renderHelper(text string, data any) (string, error) {
+	tmpl, err := template.New("t").Funcs(builtinFuncs()).Parse(text)
+	if err != nil {
+		return "", err
+	}
+
+	var out strings.Builder
+	err = tmpl.Execute(&out, data)
+	return out.String(), err
+}
+
+func TestStringAndDefaultHelpers(t *testing.T) {
+	data := map[string]any{
+		"Input": "line one\nline two",
+		"Vars":  map[string]any{"tone": "", "lang": "Go", "count": 0},
+		"Tags":  []string{"cli", "llm"},
+		"Nums":  []int{1, 2, 3},
+		"Empty": []string{},
+	}
+
+	testCases := []struct {
+		name     string
+		template string
+		expected string
+		err      string
+	}{
+		{name: "trunc", template: `{{"héllo wörld" | trunc 5}}`, expected: "héllo"},
+		{name: "trunc shorter than n", template: `{{"hi" | trunc 5}}`, expected: "hi"},
+		{name: "trunc negative", template: `{{"hi" | trunc -1}}`, expected: "hi"},
+		{name: "indent", template: `{{.Input | indent 2}}`, expected: "  line one\n  line two"},
+		{name: "nindent", template: `x:{{.Input | nindent 2}}`, expected: "x:\n  line one\n  line two"},
+		{name: "join strings", template: `{{.Tags | join ", "}}`, expected: "cli, llm"},
+		{name: "join numbers", template: `{{.Nums | join "+"}}`, expected: "1+2+3"},
+		{name: "join a single value", template: `{{"cli" | join ", "}}`, expected: "cli"},
+		{name: "join nil", template: `{{.Missing | join ", "}}`, expected: ""},
+		{name: "default of empty string", template: `{{.Vars.tone | default "neutral"}}`, expected: "neutral"},
+		{name: "default of missing key", template: `{{.Vars.style | default "plain"}}`, expected: "plain"},
+		{name: "default of zero", template: `{{.Vars.count | default 10}}`, expected: "10"},
+		{name: "default of a value", template: `{{.Vars.lang | default "Python"}}`, expected: "Go"},
+		{name: "empty string", template: `{{empty .Vars.tone}}`, expected: "true"},
+		{name: "empty list", template: `{{empty .Empty}}`, expected: "true"},
+		{name: "empty missing", template: `{{empty .Missing}}`, expected: "true"},
+		{name: "not empty", template: `{{empty .Tags}}`, expected: "false"},
+		{name: "coalesce", template: `{{coalesce .Vars.tone .Vars.style .Vars.lang "Rust"}}`, expected: "Go"},
+		{name: "coalesce of nothing", template: `{{coalesce .Vars.tone .Empty}}`, expected: "<no value>"},
+		{name: "dict", template: `{{$d := dict "name" "pls" "stars" 3}}{{$d.name}} {{$d.stars}}`, expected: "pls 3"},
+		{name: "dict odd", template: `{{dict "name"}}`, err: "dict: odd number of arguments"},
+		{name: "toJson", template: `{{dict "tags" .Tags "n" 1 | toJson}}`, expected: `{"n":1,"tags":["cli","llm"]}`},
+		{name: "toJson string", template: `{{"a \"quote\"" | toJson}}`, expected: `"a \"quote\""`},
+		{name: "toPrettyJson", template: `{{.Tags | toPrettyJson}}`, expected: "[\n  \"cli\",\n  \"llm\"\n]"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			out, err := renderHelper(tc.template, data)
+			if tc.err != "" {
+				assert.ErrorContains(t, err, tc.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, out)
+		})
+	}
+}
+
+func TestDateAndNumberHelpers(t *testing.T) {
+	defer func(previous locale.Locale) { templateLocale = previous }(templateLocale)
+
+	data := map[string]any{
+		// a Sunday
+		"T":         time.Date(2024, 3, 10, 15, 4, 5, 0, time.UTC),
+		"Monday":    time.Date(2024, 3, 11, 0, 0, 0, 0, time.UTC),
+		"Friday":    time.Date(2024, 3, 1, 18, 0, 0, 0, time.UTC),
+		"LeapDay":   time.Date(2024, 2, 29, 23, 59, 0, 0, time.UTC),
+		"EndOfJan":  time.Date(2024, 1, 31, 12, 0, 0, 0, time.UTC),
+		"EndOfYear": time.Date(2023, 12, 31, 12, 0, 0, 0, time.UTC),
+	}
+
+	testCases := []struct {
+		name     string
+		locale   string
+		template string
+		expected string
+		err      string
+	}{
+		{name: "date", template: `{{.T | date "Mon 2006-01-02 15:04"}}`, expected: "Sun 2024-03-10 15:04"},
+		{name: "date of a string", template: `{{"2024-03-10" | date "Jan 2"}}`, expected: "Mar 10"},
+		{name: "date of unix seconds", template: `{{1710083045 | date "2006"}}`, expected: "2024"},
+		{name: "date of a non-time", template: `{{"tomorrow" | date "Jan 2"}}`, err: "date: not a time: tomorrow"},
+		{name: "week from Monday", locale: "de_DE", template: `{{weekstart .T | date "Mon 2006-01-02 15:04"}}`, expected: "Mon 2024-03-04 00:00"},
+		{name: "week from Sunday", locale: "en_US", template: `{{weekstart .T | date "Mon 2006-01-02"}}`, expected: "Sun 2024-03-10"},
+		{name: "week starting today", locale: "de_DE", template: `{{weekstart .Monday | date "Mon 2006-01-02"}}`, expected: "Mon 2024-03-11"},
+		{name: "week starting last month", locale: "de_DE", template: `{{weekstart .Friday | date "Mon 2006-01-02"}}`, expected: "Mon 2024-02-26"},
+		{name: "end of the week", locale: "de_DE", template: `{{weekstart .Friday | addDays 6 | date "Mon 2006-01-02"}}`, expected: "Sun 2024-03-03"},
+		{name: "monthstart", template: `{{monthstart .LeapDay | date "2006-01-02 15:04"}}`, expected: "2024-02-01 00:00"},
+		{name: "day after the end of January", template: `{{.EndOfJan | addDays 1 | date "2006-01-02"}}`, expected: "2024-02-01"},
+		{name: "leap day", template: `{{"2024-02-28" | addDays 1 | date "2006-01-02"}}`, expected: "2024-02-29"},
+		{name: "back over a month end", template: `{{"2024-03-01" | addDays -1 | date "2006-01-02"}}`, expected: "2024-02-29"},
+		{name: "into the new year", template: `{{.EndOfYear | addDays 1 | date "2006-01-02"}}`, expected: "2024-01-01"},
+		{name: "addDays of a non-time", template: `{{"soon" | addDays 1}}`, err: "addDays: not a time: soon"},
+		{name: "number", template: `{{1234567 | number}}`, expected: "1,234,567"},
+		{name: "number in German", locale: "de_DE", template: `{{1234567 | number}}`, expected: "1.234.567"},
+		{name: "float", template: `{{1234.5 | number}}`, expected: "1,234.50"},
+		{name: "float in French", locale: "fr_FR", template: `{{1234.5 | number}}`, expected: "1 234,50"},
+		{name: "number of a string", template: `{{"98765" | number}}`, expected: "98,765"},
+		{name: "number of a non-number", template: `{{"many" | number}}`, err: `number: not a number: "many"`},
+		{name: "humanBytes", template: `{{humanBytes 1536}}`, expected: "1.5 KB"},
+		{name: "humanBytes of a float", template: `{{humanBytes 1572864.0}}`, expected: "1.5 MB"},
+		{name: "humanBytes in German", locale: "de_DE", template: `{{humanBytes 1536}}`, expected: "1,5 KB"},
+		{name: "humanBytes of a string", template: `{{humanBytes "1k"}}`, err: "humanBytes: not a size: 1k"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			templateLocale = locale.Parse(tc.locale)
+			out, err := renderHelper(tc.template, data)
+			if tc.err != "" {
+				assert.ErrorContains(t, err, tc.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, out)
+		})
+	}
+}
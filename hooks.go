@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// hook events
+const (
+	HookBeforeRun    = "before_run"
+	HookAfterSuccess = "after_success"
+	HookAfterFailure = "after_failure"
+)
+
+// Hooks are shell commands run around a completion. Run metadata is passed in PLS_* environment variables.
+type Hooks struct {
+	BeforeRun    []string `json:"before_run" yaml:"before_run"`
+	AfterSuccess []string `json:"after_success" yaml:"after_success"`
+	AfterFailure []string `json:"after_failure" yaml:"after_failure"`
+}
+
+// Append returns the hooks of h followed by the hooks of other
+func (h Hooks) Append(other Hooks) Hooks {
+	return Hooks{
+		BeforeRun:    append(append([]string{}, h.BeforeRun...), other.BeforeRun...),
+		AfterSuccess: append(append([]string{}, h.AfterSuccess...), other.AfterSuccess...),
+		AfterFailure: append(append([]string{}, h.AfterFailure...), other.AfterFailure...),
+	}
+}
+
+// Empty reports whether there are no hooks
+func (h Hooks) Empty() bool {
+	return len(h.BeforeRun)+len(h.AfterSuccess)+len(h.AfterFailure) == 0
+}
+
+// Commands returns the commands for the hook event
+func (h Hooks) Commands(event string) []string {
+	switch event {
+	case HookBeforeRun:
+		return h.BeforeRun
+	case HookAfterSuccess:
+		return h.AfterSuccess
+	case HookAfterFailure:
+		return h.AfterFailure
+	}
+	return nil
+}
+
+// hooks returns the config hooks followed by the template's hooks. Like {{sh}}, the hooks of a template
+// run only with --allow-exec or exec: true, since templates are shared.
+func (r *Runner) hooks() Hooks {
+	hooks := r.config.Hooks
+	if r.frontMatter == nil {
+		return hooks
+	}
+
+	if !allowExec && !r.frontMatter.Exec {
+		if !r.frontMatter.Hooks.Empty() && !r.hooksSkipped {
+			r.hooksSkipped = true
+			fmt.Fprintln(os.Stderr, "[the hooks of the template are skipped without --allow-exec or exec: true]")
+		}
+		return hooks
+	}
+	return hooks.Append(r.frontMatter.Hooks)
+}
+
+func (r *Runner) hookEnv(event string, extra map[string]string) []string {
+	env := os.Environ()
+
+	vars := map[string]string{
+		"PLS_EVENT":       event,
+		"PLS_TEMPLATE":    r.args.PromptFile,
+		"PLS_MODEL":       r.Model(r.frontMatter),
+		"PLS_INPUT_FILE":  r.args.InputFile,
+		"PLS_OUTPUT_FILE": r.OutputFile(),
+	}
+	for k, v := range extra {
+		vars[k] = v
+	}
+
+	for k, v := range vars {
+		env = append(env, k+"="+v)
+	}
+	return env
+}
+
+// RunHooks runs the commands of a hook event in order, stopping at the first failure. Hook output
+// goes to stderr, so that it doesn't mix with the completion on stdout.
+func (r *Runner) RunHooks(event string, extra map[string]string) error {
+	if event == HookBeforeRun {
+		r.completionStarted = true
+	}
+
+	for _, command := range r.hooks().Commands(event) {
+		cmd := exec.Command("sh", "-c", command)
+		cmd.Stdin = nil
+		cmd.Stdout = os.Stderr
+		cmd.Stderr = os.Stderr
+		cmd.Env = r.hookEnv(event, extra)
+
+		err := cmd.Run()
+		if err != nil {
+			return fmt.Errorf("%s hook %q: %w", event, command, err)
+		}
+	}
+
+	return nil
+}
+
+// RunAfterHooks runs after_success or after_failure depending on the outcome of the run. Hook
+// failures are logged, since the run itself is already over. Runs that only render the prompt
+// don't trigger after_success.
+func (r *Runner) RunAfterHooks(runErr error, elapsed time.Duration) {
+	if runErr == nil && !r.completionStarted {
+		return
+	}
+
+	extra := map[string]string{
+		"PLS_ELAPSED": fmt.Sprintf("%.3f", elapsed.Seconds()),
+	}
+
+	event := HookAfterSuccess
+	if runErr != nil {
+		event = HookAfterFailure
+		extra["PLS_ERROR"] = runErr.Error()
+	}
+
+	err := r.RunHooks(event, extra)
+	if err != nil {
+		log.Println(err)
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// hyperlinksEnabled reports whether stderr is a terminal that renders OSC 8 hyperlinks. PLS_HYPERLINKS=1
+// or 0 overrides the detection.
+func hyperlinksEnabled() bool {
+	switch os.Getenv("PLS_HYPERLINKS") {
+	case "1":
+		return true
+	case "0":
+		return false
+	}
+
+	info, err := os.Stderr.Stat()
+	if err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return false
+	}
+
+	// terminals don't advertise OSC 8 support, so look for the ones known to have it
+	for _, env := range []string{"VTE_VERSION", "KITTY_WINDOW_ID", "WT_SESSION", "WEZTERM_EXECUTABLE"} {
+		if os.Getenv(env) != "" {
+			return true
+		}
+	}
+
+	switch os.Getenv("TERM_PROGRAM") {
+	case "iTerm.app", "vscode", "WezTerm", "Hyper":
+		return true
+	}
+
+	term := os.Getenv("TERM")
+	return strings.Contains(term, "kitty") || strings.Contains(term, "foot") || strings.Contains(term, "alacritty")
+}
+
+// fileLink returns the path as a clickable file:// hyperlink if the terminal supports it, or else the
+// path as is
+func fileLink(path string) string {
+	if !hyperlinksEnabled() {
+		return path
+	}
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+
+	host, _ := os.Hostname()
+	target := url.URL{Scheme: "file", Host: host, Path: abs}
+	return "\x1b]8;;" + target.String() + "\x1b\\" + path + "\x1b]8;;\x1b\\"
+}
@@ -0,0 +1,52 @@
+package ical
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const calendar = `BEGIN:VCALENDAR
+VERSION:2.0
+BEGIN:VEVENT
+SUMMARY:Planning\, Q3
+DTSTART:20240102T150000Z
+DTEND:20240102T160000Z
+LOCATION:Room 1
+DESCRIPTION:Bring the
+  roadmap
+END:VEVENT
+BEGIN:VEVENT
+SUMMARY:Offsite
+DTSTART;VALUE=DATE:20240101
+END:VEVENT
+END:VCALENDAR
+`
+
+func TestParse(t *testing.T) {
+	events, err := Parse(strings.NewReader(calendar))
+	assert.NoError(t, err)
+	assert.Len(t, events, 2)
+
+	assert.Equal(t, "Offsite", events[0].Summary)
+	assert.True(t, events[0].AllDay)
+
+	assert.Equal(t, "Planning, Q3", events[1].Summary)
+	assert.Equal(t, "Room 1", events[1].Location)
+	assert.Equal(t, "Bring the roadmap", events[1].Description)
+	assert.Equal(t, time.Date(2024, 1, 2, 15, 0, 0, 0, time.UTC), events[1].Start)
+	assert.Equal(t, time.Date(2024, 1, 2, 16, 0, 0, 0, time.UTC), events[1].End)
+}
+
+func TestBetween(t *testing.T) {
+	events, err := Parse(strings.NewReader(calendar))
+	assert.NoError(t, err)
+
+	from := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	to := from.Add(24 * time.Hour)
+	found := Between(events, from, to)
+	assert.Len(t, found, 1)
+	assert.Equal(t, "Planning, Q3", found[0].Summary)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"text/template/parse"
+
+	"github.com/hayeah/pls/promptstr"
+)
+
+// policies for input that the template never uses
+const (
+	MissingInputWarn   = "warn"
+	MissingInputError  = "error"
+	MissingInputIgnore = "ignore"
+)
+
+// TemplateReferencesInput reports whether the template uses {{.Input}}, in its body or in the system
+// message of its frontmatter. Passing dot as a whole (e.g. {{template "x" .}}) counts as a reference.
+func TemplateReferencesInput(promptTemplate string) (bool, error) {
+	var fm TemplateFrontMatter
+	promptBody, err := promptstr.ParseFrontMatter(promptTemplate, &fm, frontMatterOptions...)
+	if err != nil {
+		return false, err
+	}
+
+	for _, text := range []string{promptBody, fm.System} {
+		tmpl, err := newTemplate().Parse(text)
+		if err != nil {
+			return false, err
+		}
+
+		for _, t := range tmpl.Templates() {
+			if t.Tree != nil && referencesInput(t.Tree.Root) {
+				return true, nil
+			}
+		}
+	}
+
+	return false, nil
+}
+
+func referencesInput(node parse.Node) bool {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return false
+		}
+		for _, child := range n.Nodes {
+			if referencesInput(child) {
+				return true
+			}
+		}
+	case *parse.ActionNode:
+		return referencesInput(n.Pipe)
+	case *parse.PipeNode:
+		if n == nil {
+			return false
+		}
+		for _, cmd := range n.Cmds {
+			if referencesInput(cmd) {
+				return true
+			}
+		}
+	case *parse.CommandNode:
+		for _, arg := range n.Args {
+			if referencesInput(arg) {
+				return true
+			}
+		}
+	case *parse.FieldNode:
+		return len(n.Ident) > 0 && n.Ident[0] == "Input"
+	case *parse.VariableNode:
+		return len(n.Ident) > 1 && n.Ident[0] == "$" && n.Ident[1] == "Input"
+	case *parse.ChainNode:
+		return referencesInput(n.Node)
+	case *parse.DotNode:
+		return true
+	case *parse.IfNode:
+		return referencesBranch(&n.BranchNode)
+	case *parse.RangeNode:
+		return referencesBranch(&n.BranchNode)
+	case *parse.WithNode:
+		return referencesBranch(&n.BranchNode)
+	case *parse.TemplateNode:
+		return referencesInput(n.Pipe)
+	}
+
+	return false
+}
+
+func referencesBranch(n *parse.BranchNode) bool {
+	return referencesInput(n.Pipe) || referencesInput(n.List) || referencesInput(n.ElseList)
+}
+
+// CheckInputUsed applies the missing input policy when input was given but the template ignores it
+func CheckInputUsed(promptTemplate string, input string, policy string) error {
+	if policy == MissingInputIgnore || strings.TrimSpace(input) == "" {
+		return nil
+	}
+
+	used, err := TemplateReferencesInput(promptTemplate)
+	if err != nil {
+		return err
+	}
+
+	if used {
+		return nil
+	}
+
+	switch policy {
+	case MissingInputError:
+		return fmt.Errorf("input was provided, but the template doesn't use {{.Input}}")
+	case MissingInputWarn, "":
+		log.Println("warning: input was provided, but the template doesn't use {{.Input}}")
+		return nil
+	default:
+		return fmt.Errorf("unknown missing input policy %q, expected warn, error or ignore", policy)
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTemplateReferencesInput(t *testing.T) {
+	testCases := []struct {
+		name     string
+		template string
+		expected bool
+	}{
+		{name: "body", template: "Summarize:\n{{.Input}}\n", expected: true},
+		{name: "system", template: "---\nsystem: \"Summarize: {{.Input}}\"\n---\nBe brief.\n", expected: true},
+		{name: "dot", template: "{{template \"x\" .}}{{define \"x\"}}{{.Input}}{{end}}", expected: true},
+		{name: "unused", template: "---\nsystem: Be brief.\n---\nSay hi.\n"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			used, err := TemplateReferencesInput(tc.template)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, used)
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+)
+
+// interruptContext is canceled on the first Ctrl-C, so the completion stops and the output that
+// streamed in so far is kept. A second Ctrl-C exits right away.
+func interruptContext(parent context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(parent)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt)
+
+	go func() {
+		defer signal.Stop(signals)
+
+		select {
+		case <-signals:
+			// end the line of partial output, so the shell prompt starts on its own line
+			fmt.Fprintln(os.Stderr, "\n[interrupted]")
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, cancel
+}
+
+// runContext returns the context of the completion, canceled by Ctrl-C or when the timeout expires
+func runContext(timeout time.Duration) (context.Context, context.CancelFunc) {
+	ctx, cancel := interruptContext(context.Background())
+	if timeout <= 0 {
+		return ctx, cancel
+	}
+
+	timeoutCtx, cancelTimeout := context.WithTimeout(ctx, timeout)
+	return timeoutCtx, func() {
+		cancelTimeout()
+		cancel()
+	}
+}
+
+// contextError replaces the error of a canceled completion with the reason it was canceled
+func contextError(ctx context.Context, err error, timeout time.Duration) error {
+	if err == nil {
+		return nil
+	}
+
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return fmt.Errorf("timed out after %s", timeout)
+	case errors.Is(ctx.Err(), context.Canceled):
+		return errors.New("interrupted")
+	}
+	return err
+}
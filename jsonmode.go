@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+
+	"github.com/hayeah/pls/jsonschema"
+)
+
+// ResponseFormatJSON asks for a JSON response, with the JSON mode of the API
+const ResponseFormatJSON = "json"
+
+// defaultJSONRetries is how many times a response that isn't valid JSON is retried
+const defaultJSONRetries = 2
+
+const jsonInstruction = "\n\nRespond with JSON only."
+
+// jsonSchemaInstruction describes the schema to the model, which JSON mode doesn't enforce by itself
+const jsonSchemaInstruction = "\n\nRespond with JSON only, matching this JSON Schema:\n%s"
+
+const jsonRetryInstruction = "Your response is not valid: %v. Reply with the corrected JSON only."
+
+// completeJSON returns a response that parses as JSON, and matches the schema of the frontmatter if
+// declared. Invalid responses are sent back to the model with the problem, to be corrected.
+func (r *Runner) completeJSON(fm *TemplateFrontMatter, prompt string) (string, error) {
+	var schema map[string]any
+	if fm.JSONSchema != nil {
+		var ok bool
+		schema, ok = jsonschema.Normalize(fm.JSONSchema).(map[string]any)
+		if !ok {
+			return "", errors.New("json_schema must be an object")
+		}
+	}
+
+	instruction := jsonInstruction
+	if schema != nil {
+		encoded, err := json.MarshalIndent(schema, "", "  ")
+		if err != nil {
+			return "", err
+		}
+		instruction = fmt.Sprintf(jsonSchemaInstruction, encoded)
+	}
+
+	retries := defaultJSONRetries
+	if fm.JSONRetries != nil {
+		retries = *fm.JSONRetries
+	}
+
+	req := r.chat.Request(prompt+instruction, fm)
+	for attempt := 0; ; attempt++ {
+		response, err := r.jsonCompletion(req)
+		if err != nil {
+			return "", err
+		}
+
+		problem := checkJSON(response, schema)
+		if problem == nil {
+			return response, nil
+		}
+
+		if attempt >= retries {
+			return "", fmt.Errorf("the response is not valid JSON after %d attempts: %w", attempt+1, problem)
+		}
+
+		fmt.Fprintf(os.Stderr, "[invalid JSON: %v, retrying (%d/%d)]\n", problem, attempt+1, retries)
+		req.Messages = append(req.Messages,
+			openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: response},
+			openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: fmt.Sprintf(jsonRetryInstruction, problem)},
+		)
+	}
+}
+
+// jsonCompletion sends the request in JSON mode
+func (r *Runner) jsonCompletion(req openai.ChatCompletionRequest) (string, error) {
+	body, err := requestBody(req)
+	if err != nil {
+		return "", err
+	}
+	body["response_format"] = map[string]string{"type": "json_object"}
+
+	var completion openai.ChatCompletionResponse
+	err = r.postCompletion(req.Model, body, &completion)
+	if err != nil {
+		return "", err
+	}
+
+	if len(completion.Choices) == 0 {
+		return "", errors.New("no response returned")
+	}
+
+	return completion.Choices[0].Message.Content, nil
+}
+
+// checkJSON parses the response, and validates it against the schema if there is one
+func checkJSON(response string, schema map[string]any) error {
+	var value any
+	err := json.Unmarshal([]byte(strings.TrimSpace(response)), &value)
+	if err != nil {
+		return err
+	}
+
+	if schema == nil {
+		return nil
+	}
+	return jsonschema.Validate(schema, value)
+}
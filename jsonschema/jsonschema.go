@@ -0,0 +1,218 @@
+// Package jsonschema validates decoded JSON values against the commonly used subset of JSON Schema:
+// type, enum, const, properties, required, additionalProperties, items, minItems, maxItems,
+// minLength, maxLength, minimum and maximum.
+package jsonschema
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Validate checks the value, as decoded by encoding/json, against the schema. The error lists every
+// violation, with the path of the offending value.
+func Validate(schema map[string]any, value any) error {
+	var problems []string
+	validate(schema, value, "$", &problems)
+	if len(problems) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%s", strings.Join(problems, "; "))
+}
+
+// Normalize converts the map[any]any of YAML decoders into the map[string]any of JSON, so schemas
+// can be written in YAML frontmatter
+func Normalize(value any) any {
+	switch v := value.(type) {
+	case map[any]any:
+		m := make(map[string]any, len(v))
+		for key, item := range v {
+			m[fmt.Sprint(key)] = Normalize(item)
+		}
+		return m
+	case map[string]any:
+		m := make(map[string]any, len(v))
+		for key, item := range v {
+			m[key] = Normalize(item)
+		}
+		return m
+	case []any:
+		items := make([]any, len(v))
+		for i, item := range v {
+			items[i] = Normalize(item)
+		}
+		return items
+	}
+	return value
+}
+
+func validate(schema map[string]any, value any, path string, problems *[]string) {
+	fail := func(format string, args ...any) {
+		*problems = append(*problems, path+": "+fmt.Sprintf(format, args...))
+	}
+
+	if t, ok := schema["type"]; ok && !matchesType(t, value) {
+		fail("expected %s, got %s", describeType(t), typeOf(value))
+		return
+	}
+
+	if enum, ok := schema["enum"].([]any); ok && !contains(enum, value) {
+		fail("must be one of %v", enum)
+	}
+
+	if c, ok := schema["const"]; ok && !equal(c, value) {
+		fail("must be %v", c)
+	}
+
+	switch v := value.(type) {
+	case map[string]any:
+		properties, _ := schema["properties"].(map[string]any)
+
+		if required, ok := schema["required"].([]any); ok {
+			for _, name := range required {
+				if _, ok := v[fmt.Sprint(name)]; !ok {
+					fail("missing required property %q", fmt.Sprint(name))
+				}
+			}
+		}
+
+		for _, name := range sortedKeys(v) {
+			propertySchema, ok := properties[name].(map[string]any)
+			if ok {
+				validate(propertySchema, v[name], path+"."+name, problems)
+				continue
+			}
+
+			switch additional := schema["additionalProperties"].(type) {
+			case bool:
+				if !additional {
+					fail("unexpected property %q", name)
+				}
+			case map[string]any:
+				validate(additional, v[name], path+"."+name, problems)
+			}
+		}
+
+	case []any:
+		if min, ok := number(schema["minItems"]); ok && float64(len(v)) < min {
+			fail("expected at least %g items, got %d", min, len(v))
+		}
+		if max, ok := number(schema["maxItems"]); ok && float64(len(v)) > max {
+			fail("expected at most %g items, got %d", max, len(v))
+		}
+		if items, ok := schema["items"].(map[string]any); ok {
+			for i, item := range v {
+				validate(items, item, fmt.Sprintf("%s[%d]", path, i), problems)
+			}
+		}
+
+	case string:
+		length := float64(len([]rune(v)))
+		if min, ok := number(schema["minLength"]); ok && length < min {
+			fail("expected at least %g characters", min)
+		}
+		if max, ok := number(schema["maxLength"]); ok && length > max {
+			fail("expected at most %g characters", max)
+		}
+
+	case float64:
+		if min, ok := number(schema["minimum"]); ok && v < min {
+			fail("must be at least %g", min)
+		}
+		if max, ok := number(schema["maximum"]); ok && v > max {
+			fail("must be at most %g", max)
+		}
+	}
+}
+
+// matchesType checks the value against the type, or any of a list of types
+func matchesType(t any, value any) bool {
+	if types, ok := t.([]any); ok {
+		for _, t := range types {
+			if matchesType(t, value) {
+				return true
+			}
+		}
+		return false
+	}
+
+	actual := typeOf(value)
+	switch t {
+	case "number":
+		return actual == "integer" || actual == "number"
+	default:
+		return actual == t
+	}
+}
+
+func describeType(t any) string {
+	if types, ok := t.([]any); ok {
+		names := make([]string, len(types))
+		for i, t := range types {
+			names[i] = fmt.Sprint(t)
+		}
+		return strings.Join(names, " or ")
+	}
+	return fmt.Sprint(t)
+}
+
+// typeOf returns the JSON Schema type of the decoded value
+func typeOf(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if v == float64(int64(v)) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// number returns schema keywords as float64, whether decoded from JSON or YAML
+func number(value any) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+func contains(values []any, value any) bool {
+	for _, v := range values {
+		if equal(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// equal compares schema values with decoded ones, where YAML integers are ints and JSON numbers float64
+func equal(a, b any) bool {
+	if x, ok := number(a); ok {
+		y, ok := number(b)
+		return ok && x == y
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,75 @@
+package jsonschema
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	schema := map[string]any{
+		"type":     "object",
+		"required": []any{"name", "tags"},
+		"properties": map[string]any{
+			"name":  map[string]any{"type": "string", "minLength": 1},
+			"count": map[string]any{"type": "integer", "minimum": 0},
+			"level": map[string]any{"enum": []any{"low", "high"}},
+			"tags":  map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+		},
+		"additionalProperties": false,
+	}
+
+	testCases := []struct {
+		name     string
+		value    string
+		expected string
+	}{
+		{
+			name:  "valid",
+			value: `{"name": "a", "count": 2, "level": "low", "tags": ["x"]}`,
+		},
+		{
+			name:     "wrong type",
+			value:    `[]`,
+			expected: "$: expected object, got array",
+		},
+		{
+			name:     "missing required",
+			value:    `{"name": "a"}`,
+			expected: `$: missing required property "tags"`,
+		},
+		{
+			name:     "nested problems",
+			value:    `{"name": "", "count": 1.5, "level": "mid", "tags": ["x", 1], "extra": true}`,
+			expected: `$.count: expected integer, got number; $: unexpected property "extra"; $.level: must be one of [low high]; $.name: expected at least 1 characters; $.tags[1]: expected string, got integer`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var value any
+			err := json.Unmarshal([]byte(tc.value), &value)
+			assert.NoError(t, err)
+
+			err = Validate(schema, value)
+			if tc.expected == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tc.expected)
+			}
+		})
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	yamlSchema := map[any]any{
+		"type":  "array",
+		"items": map[any]any{"type": "integer", "maximum": 3},
+	}
+
+	schema, ok := Normalize(yamlSchema).(map[string]any)
+	assert.True(t, ok)
+	assert.NoError(t, Validate(schema, []any{1.0, 3.0}))
+	assert.EqualError(t, Validate(schema, []any{4.0}), "$[0]: must be at most 3")
+}
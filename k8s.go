@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// K8sConfig configures the k8s: input loader, which reads a resource with kubectl
+type K8sConfig struct {
+	// Kubeconfig is the kubeconfig file. kubectl's default is used if empty.
+	Kubeconfig string `yaml:"kubeconfig"`
+	// Context is the kubeconfig context. The current context is used if empty.
+	Context string `yaml:"context"`
+	// Since is how far back logs are read, e.g. 1h. Overridden by --since.
+	Since string `yaml:"since"`
+	// TailLines is the number of most recent log lines read, per container
+	TailLines int `yaml:"tail_lines"`
+}
+
+// LoadK8s gathers the description, recent logs and events of a resource, referenced as
+// [namespace/]kind/name, e.g. deploy/myapp or prod/pod/myapp-7c9f. The sections are the input, and are
+// also exposed as {{.Data.describe}}, {{.Data.logs}}, {{.Data.previous_logs}} and {{.Data.events}}.
+func LoadK8s(config K8sConfig, ref string) (*LoadedInput, error) {
+	parts := strings.Split(ref, "/")
+	var namespace string
+	switch len(parts) {
+	case 2:
+	case 3:
+		namespace, parts = parts[0], parts[1:]
+	default:
+		return nil, fmt.Errorf("k8s: %q should be [namespace/]kind/name, e.g. deploy/myapp", ref)
+	}
+	resource := strings.Join(parts, "/")
+
+	kubectl := func(args ...string) (string, error) {
+		args = append([]string(nil), args...)
+		if config.Kubeconfig != "" {
+			args = append(args, "--kubeconfig", config.Kubeconfig)
+		}
+		if config.Context != "" {
+			args = append(args, "--context", config.Context)
+		}
+		if namespace != "" {
+			args = append(args, "--namespace", namespace)
+		}
+
+		cmd := exec.Command("kubectl", args...)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		out, err := cmd.Output()
+		if err != nil {
+			message := strings.TrimSpace(stderr.String())
+			if message == "" {
+				message = err.Error()
+			}
+			return "", fmt.Errorf("k8s: kubectl %s: %s", args[0], message)
+		}
+		return strings.TrimSpace(string(out)), nil
+	}
+
+	describe, err := kubectl("describe", resource)
+	if err != nil {
+		return nil, err
+	}
+
+	logArgs := []string{"logs", resource, "--all-containers", "--prefix", "--timestamps"}
+	if config.Since != "" {
+		logArgs = append(logArgs, "--since", config.Since)
+	}
+	if config.TailLines > 0 {
+		logArgs = append(logArgs, "--tail", strconv.Itoa(config.TailLines))
+	}
+
+	// not every kind of resource has logs or events, so these are reported, and left out
+	logs, err := kubectl(logArgs...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[%v]\n", err)
+	}
+
+	// the logs of the containers before they last restarted, where a crash loop shows why
+	previousLogs, err := kubectl(append(logArgs, "--previous")...)
+	if err != nil {
+		previousLogs = ""
+	}
+
+	events, err := kubectl("events", "--for", resource)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[%v]\n", err)
+	}
+
+	var text strings.Builder
+	sections := []struct{ title, content string }{
+		{"kubectl describe " + resource, describe},
+		{"Events", events},
+		{"Logs", logs},
+		{"Logs before the last restart", previousLogs},
+	}
+	for _, section := range sections {
+		if section.content != "" {
+			fmt.Fprintf(&text, "## %s\n\n%s\n\n", section.title, section.content)
+		}
+	}
+
+	data := map[string]any{
+		"resource":      ref,
+		"describe":      describe,
+		"logs":          logs,
+		"previous_logs": previousLogs,
+		"events":        events,
+	}
+	return &LoadedInput{Input: text.String(), Data: data}, nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// LoadedInput is the input produced by an input loader
+type LoadedInput struct {
+	// Input is embedded as {{.Input}}
+	Input string `json:"input"`
+	// Data is structured data exposed to the template as {{.Data}}
+	Data map[string]any `json:"data"`
+}
+
+// InputLoader loads the input for the reference given after its scheme, e.g. "PROJ-123" for
+// --input jira:PROJ-123
+type InputLoader interface {
+	Load(ref string) (*LoadedInput, error)
+}
+
+// InputLoaderFunc adapts a function to an InputLoader
+type InputLoaderFunc func(ref string) (*LoadedInput, error)
+
+func (f InputLoaderFunc) Load(ref string) (*LoadedInput, error) {
+	return f(ref)
+}
+
+// inputLoaders are registered by scheme
+var inputLoaders = map[string]InputLoader{}
+
+// RegisterInputLoader makes the loader available to --input as scheme:ref
+func RegisterInputLoader(scheme string, loader InputLoader) {
+	inputLoaders[scheme] = loader
+}
+
+// LoadInput loads the input for a scheme:ref source
+func LoadInput(source string) (*LoadedInput, error) {
+	scheme, ref, ok := strings.Cut(source, ":")
+	if !ok {
+		return nil, fmt.Errorf("input %q should be scheme:reference", source)
+	}
+
+	loader, ok := inputLoaders[scheme]
+	if !ok {
+		var schemes []string
+		for name := range inputLoaders {
+			schemes = append(schemes, name)
+		}
+		sort.Strings(schemes)
+		return nil, fmt.Errorf("unknown input loader %q, available: %s", scheme, strings.Join(schemes, ", "))
+	}
+
+	return loader.Load(ref)
+}
+
+// RegisterBuiltinLoaders registers the input loaders that ship with pls, dropping the loaders of plugins
+// registered before
+func RegisterBuiltinLoaders(config *Config) {
+	inputLoaders = map[string]InputLoader{}
+
+	RegisterInputLoader("jira", InputLoaderFunc(func(ref string) (*LoadedInput, error) {
+		ticket, err := LoadJiraTicket(config.Jira, ref)
+		if err != nil {
+			return nil, err
+		}
+		return ticketInput(ticket), nil
+	}))
+
+	RegisterInputLoader("ics", InputLoaderFunc(LoadCalendar))
+
+	RegisterInputLoader("imap", InputLoaderFunc(func(ref string) (*LoadedInput, error) {
+		headers, err := LoadUnreadMail(config.IMAP, ref)
+		if err != nil {
+			return nil, err
+		}
+		return mailInput(headers), nil
+	}))
+
+	RegisterInputLoader("sql", InputLoaderFunc(func(query string) (*LoadedInput, error) {
+		return LoadSQL(config.SQL, query)
+	}))
+
+	RegisterInputLoader("k8s", InputLoaderFunc(func(ref string) (*LoadedInput, error) {
+		return LoadK8s(config.K8s, ref)
+	}))
+
+	RegisterInputLoader("linear", InputLoaderFunc(func(ref string) (*LoadedInput, error) {
+		ticket, err := LoadLinearTicket(config.Linear, ref)
+		if err != nil {
+			return nil, err
+		}
+		return ticketInput(ticket), nil
+	}))
+}
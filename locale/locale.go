@@ -0,0 +1,139 @@
+// Package locale formats numbers and finds the start of the week by the conventions of a POSIX
+// locale, like de_DE.UTF-8. Month and day names stay in English.
+package locale
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Locale is the formatting conventions of a language and territory
+type Locale struct {
+	Language  string
+	Territory string
+
+	// Decimal separates the fraction of numbers, and Thousands groups their digits
+	Decimal   string
+	Thousands string
+	// WeekStart is the first day of the week
+	WeekStart time.Weekday
+}
+
+// Default is the conventions of the C locale, with weeks starting on Monday as in ISO 8601
+var Default = Locale{Decimal: ".", Thousands: ",", WeekStart: time.Monday}
+
+// separators of the languages that don't use those of English, as decimal and thousands
+var separators = map[string][2]string{
+	"cs": {",", " "},
+	"da": {",", "."},
+	"de": {",", "."},
+	"es": {",", "."},
+	"fi": {",", " "},
+	"fr": {",", " "},
+	"id": {",", "."},
+	"it": {",", "."},
+	"nb": {",", " "},
+	"nl": {",", "."},
+	"pl": {",", " "},
+	"pt": {",", "."},
+	"ru": {",", " "},
+	"sv": {",", " "},
+	"tr": {",", "."},
+	"uk": {",", " "},
+	"vi": {",", "."},
+}
+
+// territorySeparators override the separators of the language in some territories
+var territorySeparators = map[string][2]string{
+	"CH": {".", "'"},
+}
+
+// weekStarts are the territories where the week doesn't start on Monday
+var weekStarts = map[string]time.Weekday{
+	"US": time.Sunday, "CA": time.Sunday, "MX": time.Sunday, "BR": time.Sunday, "JP": time.Sunday,
+	"KR": time.Sunday, "TW": time.Sunday, "HK": time.Sunday, "IL": time.Sunday, "IN": time.Sunday,
+	"PH": time.Sunday, "ZA": time.Sunday, "AU": time.Sunday,
+	"EG": time.Saturday, "SA": time.Saturday, "AE": time.Saturday, "IR": time.Saturday,
+}
+
+// Parse reads a POSIX locale name, e.g. de_DE.UTF-8 or fr_CA@euro. C, POSIX and empty names are the
+// Default locale. Languages without known conventions get the separators of English.
+func Parse(name string) Locale {
+	name, _, _ = strings.Cut(name, ".")
+	name, _, _ = strings.Cut(name, "@")
+	if name == "" || name == "C" || name == "POSIX" {
+		return Default
+	}
+
+	language, territory, _ := strings.Cut(strings.ReplaceAll(name, "-", "_"), "_")
+	l := Default
+	l.Language = strings.ToLower(language)
+	l.Territory = strings.ToUpper(territory)
+
+	if s, ok := separators[l.Language]; ok {
+		l.Decimal, l.Thousands = s[0], s[1]
+	}
+	if s, ok := territorySeparators[l.Territory]; ok {
+		l.Decimal, l.Thousands = s[0], s[1]
+	}
+	if day, ok := weekStarts[l.Territory]; ok {
+		l.WeekStart = day
+	}
+	return l
+}
+
+// FormatNumber formats the number with the given number of decimals, grouping its digits by thousands
+func (l Locale) FormatNumber(n float64, decimals int) string {
+	if math.IsNaN(n) || math.IsInf(n, 0) {
+		return strconv.FormatFloat(n, 'f', -1, 64)
+	}
+
+	s := strconv.FormatFloat(math.Abs(n), 'f', decimals, 64)
+	whole, fraction, _ := strings.Cut(s, ".")
+
+	var b strings.Builder
+	if n < 0 && strings.Trim(s, "0.") != "" {
+		b.WriteString("-")
+	}
+	for i, digit := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			b.WriteString(l.Thousands)
+		}
+		b.WriteRune(digit)
+	}
+	if fraction != "" {
+		b.WriteString(l.Decimal + fraction)
+	}
+	return b.String()
+}
+
+var byteUnits = []string{"B", "KB", "MB", "GB", "TB", "PB", "EB"}
+
+// HumanBytes formats a size in bytes with a binary unit, e.g. 1.5 MB for 1572864 bytes
+func (l Locale) HumanBytes(size int64) string {
+	value := float64(size)
+	unit := 0
+	for math.Abs(value) >= 1024 && unit < len(byteUnits)-1 {
+		value /= 1024
+		unit++
+	}
+
+	if unit == 0 {
+		return l.FormatNumber(value, 0) + " B"
+	}
+	decimals := 1
+	if math.Abs(value) >= 100 {
+		decimals = 0
+	}
+	s := l.FormatNumber(value, decimals)
+	s = strings.TrimSuffix(s, l.Decimal+"0")
+	return s + " " + byteUnits[unit]
+}
+
+// StartOfWeek returns the midnight that starts the week of t
+func (l Locale) StartOfWeek(t time.Time) time.Time {
+	days := (int(t.Weekday()) - int(l.WeekStart) + 7) % 7
+	return time.Date(t.Year(), t.Month(), t.Day()-days, 0, 0, 0, 0, t.Location())
+}
@@ -0,0 +1,84 @@
+package locale
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	testCases := []struct {
+		name     string
+		expected Locale
+	}{
+		{"", Default},
+		{"C.UTF-8", Default},
+		{"en_US.UTF-8", Locale{Language: "en", Territory: "US", Decimal: ".", Thousands: ",", WeekStart: time.Sunday}},
+		{"de_DE.UTF-8", Locale{Language: "de", Territory: "DE", Decimal: ",", Thousands: ".", WeekStart: time.Monday}},
+		{"de_CH", Locale{Language: "de", Territory: "CH", Decimal: ".", Thousands: "'", WeekStart: time.Monday}},
+		{"fr_FR@euro", Locale{Language: "fr", Territory: "FR", Decimal: ",", Thousands: " ", WeekStart: time.Monday}},
+		{"pt-BR", Locale{Language: "pt", Territory: "BR", Decimal: ",", Thousands: ".", WeekStart: time.Sunday}},
+		{"ja", Locale{Language: "ja", Decimal: ".", Thousands: ",", WeekStart: time.Monday}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, Parse(tc.name))
+		})
+	}
+}
+
+func TestFormatNumber(t *testing.T) {
+	testCases := []struct {
+		locale   string
+		n        float64
+		decimals int
+		expected string
+	}{
+		{"en_US", 1234567, 0, "1,234,567"},
+		{"en_US", 1234567.891, 2, "1,234,567.89"},
+		{"en_US", 999, 0, "999"},
+		{"en_US", -1234.5, 1, "-1,234.5"},
+		{"en_US", -0.001, 2, "0.00"},
+		{"de_DE", 1234567.891, 2, "1.234.567,89"},
+		{"fr_FR", 12345, 0, "12 345"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.expected, func(t *testing.T) {
+			assert.Equal(t, tc.expected, Parse(tc.locale).FormatNumber(tc.n, tc.decimals))
+		})
+	}
+}
+
+func TestHumanBytes(t *testing.T) {
+	testCases := []struct {
+		size     int64
+		expected string
+	}{
+		{0, "0 B"},
+		{1023, "1,023 B"},
+		{1024, "1 KB"},
+		{1536, "1.5 KB"},
+		{150 * 1024 * 1024, "150 MB"},
+		{5 << 40, "5 TB"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.expected, func(t *testing.T) {
+			assert.Equal(t, tc.expected, Default.HumanBytes(tc.size))
+		})
+	}
+	assert.Equal(t, "1,5 KB", Parse("de_DE").HumanBytes(1536))
+}
+
+func TestStartOfWeek(t *testing.T) {
+	// a Wednesday
+	wednesday := time.Date(2024, 1, 3, 15, 4, 5, 0, time.UTC)
+	assert.Equal(t, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), Parse("de_DE").StartOfWeek(wednesday))
+	assert.Equal(t, time.Date(2023, 12, 31, 0, 0, 0, 0, time.UTC), Parse("en_US").StartOfWeek(wednesday))
+
+	monday := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+	assert.Equal(t, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), Default.StartOfWeek(monday))
+}
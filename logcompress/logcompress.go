@@ -0,0 +1,125 @@
+// Package logcompress shrinks logs before they are prompted, by collapsing lines that differ only in
+// timestamps, numbers and ids into patterns with counts.
+package logcompress
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// Options configure the compression
+type Options struct {
+	// KeepTimestamps keeps the leading timestamps of lines that occur once, and the time range of
+	// patterns
+	KeepTimestamps bool
+}
+
+// Pattern is a group of similar lines
+type Pattern struct {
+	// Key is the line with its variable parts replaced by placeholders like <n>
+	Key string
+	// Example is the first line of the group, without its timestamp
+	Example string
+	Count   int
+	// First and Last are the timestamps of the first and last line of the group
+	First string
+	Last  string
+}
+
+// maxLineSize is the longest line read. Longer lines are split.
+const maxLineSize = 1 << 20
+
+var timestampPattern = regexp.MustCompile(`^\[?(?:` +
+	// 2026-10-14T10:00:01.123Z, 2026/10/14 10:00:01,123 +0200
+	`\d{4}[-/]\d{2}[-/]\d{2}[T ]\d{2}:\d{2}:\d{2}(?:[.,]\d+)?(?:Z| ?[+-]\d{2}:?\d{2})?` +
+	// Oct 14 10:00:01 (syslog)
+	`|[A-Z][a-z]{2} [ \d]\d \d{2}:\d{2}:\d{2}` +
+	// 10:00:01.123
+	`|\d{2}:\d{2}:\d{2}(?:[.,]\d+)?` +
+	`)\]?\s*`)
+
+// variable parts of lines, replaced by placeholders
+var (
+	uuidPattern = regexp.MustCompile(`\b[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}\b`)
+	ipPattern   = regexp.MustCompile(`\b\d{1,3}(?:\.\d{1,3}){3}(?::\d+)?\b`)
+	// hex ids, like commit hashes and addresses. Candidates without both digits and letters are
+	// words or numbers.
+	hexPattern    = regexp.MustCompile(`\b(?:0x[0-9a-fA-F]+|[0-9a-fA-F]{6,})\b`)
+	numberPattern = regexp.MustCompile(`\d+(?:\.\d+)?`)
+)
+
+// Compress groups the lines of the log into patterns, in the order they first occur
+func Compress(r io.Reader, options Options) ([]Pattern, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+
+	var patterns []*Pattern
+	byKey := map[string]*Pattern{}
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if line == "" {
+			continue
+		}
+
+		timestamp := timestampPattern.FindString(line)
+		text := line[len(timestamp):]
+		timestamp = strings.Trim(strings.TrimSpace(timestamp), "[]")
+
+		key := Normalize(text)
+		pattern, ok := byKey[key]
+		if !ok {
+			pattern = &Pattern{Key: key, Example: text, First: timestamp}
+			byKey[key] = pattern
+			patterns = append(patterns, pattern)
+		}
+		pattern.Count++
+		pattern.Last = timestamp
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	result := make([]Pattern, len(patterns))
+	for i, pattern := range patterns {
+		result[i] = *pattern
+	}
+	return result, nil
+}
+
+// Normalize replaces the variable parts of the line with placeholders
+func Normalize(line string) string {
+	line = uuidPattern.ReplaceAllString(line, "<uuid>")
+	line = ipPattern.ReplaceAllString(line, "<ip>")
+	line = hexPattern.ReplaceAllStringFunc(line, func(id string) string {
+		if strings.HasPrefix(id, "0x") || (strings.ContainsAny(id, "0123456789") && strings.ContainsAny(strings.ToLower(id), "abcdef")) {
+			return "<hex>"
+		}
+		return id
+	})
+	return numberPattern.ReplaceAllString(line, "<n>")
+}
+
+// Format writes the patterns one per line. Lines that occur once are shown as they are, and patterns
+// with their count, e.g. "[x120] request <n> served in <n>ms".
+func Format(patterns []Pattern, options Options) string {
+	var b strings.Builder
+	for _, pattern := range patterns {
+		if pattern.Count == 1 {
+			if options.KeepTimestamps && pattern.First != "" {
+				b.WriteString(pattern.First + " ")
+			}
+			b.WriteString(pattern.Example + "\n")
+			continue
+		}
+
+		if options.KeepTimestamps && pattern.First != "" {
+			fmt.Fprintf(&b, "[x%d %s .. %s] %s\n", pattern.Count, pattern.First, pattern.Last, pattern.Key)
+		} else {
+			fmt.Fprintf(&b, "[x%d] %s\n", pattern.Count, pattern.Key)
+		}
+	}
+	return b.String()
+}
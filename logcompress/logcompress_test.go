@@ -0,0 +1,60 @@
+package logcompress
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalize(t *testing.T) {
+	testCases := []struct {
+		line     string
+		expected string
+	}{
+		{"request 123 served in 45ms", "request <n> served in <n>ms"},
+		{"user 3f2504e0-4f89-11d3-9a0c-0305e82c3301 logged in", "user <uuid> logged in"},
+		{"connect to 10.0.0.12:5432 failed", "connect to <ip> failed"},
+		{"commit deadbeef1 pushed", "commit <hex> pushed"},
+		{"cache miss for user", "cache miss for user"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.line, func(t *testing.T) {
+			assert.Equal(t, tc.expected, Normalize(tc.line))
+		})
+	}
+}
+
+func TestCompress(t *testing.T) {
+	log := `2026-10-14T10:00:01Z INFO request 1 served in 12ms
+2026-10-14T10:00:02Z INFO request 2 served in 9ms
+2026-10-14T10:00:03Z ERROR db timeout after 30s
+
+2026-10-14T10:00:04Z INFO request 3 served in 15ms
+`
+
+	patterns, err := Compress(strings.NewReader(log), Options{})
+	assert.NoError(t, err)
+	assert.Equal(t, []Pattern{
+		{Key: "INFO request <n> served in <n>ms", Example: "INFO request 1 served in 12ms", Count: 3, First: "2026-10-14T10:00:01Z", Last: "2026-10-14T10:00:04Z"},
+		{Key: "ERROR db timeout after <n>s", Example: "ERROR db timeout after 30s", Count: 1, First: "2026-10-14T10:00:03Z", Last: "2026-10-14T10:00:03Z"},
+	}, patterns)
+
+	assert.Equal(t, "[x3] INFO request <n> served in <n>ms\nERROR db timeout after 30s\n", Format(patterns, Options{}))
+	assert.Equal(t, "[x3 2026-10-14T10:00:01Z .. 2026-10-14T10:00:04Z] INFO request <n> served in <n>ms\n2026-10-14T10:00:03Z ERROR db timeout after 30s\n",
+		Format(patterns, Options{KeepTimestamps: true}))
+}
+
+func TestTimestamps(t *testing.T) {
+	for _, line := range []string{
+		"2026/10/14 10:00:01,123 +0200 boot",
+		"[2026-10-14 10:00:01.5] boot",
+		"Oct 14 10:00:01 boot",
+		"10:00:01.123 boot",
+	} {
+		patterns, err := Compress(strings.NewReader(line), Options{})
+		assert.NoError(t, err)
+		assert.Equal(t, "boot", patterns[0].Example, line)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/hayeah/pls/logcompress"
+	"github.com/hayeah/pls/tokens"
+)
+
+const logsumInstruction = `Below is a log, compressed: lines that differ only in numbers, ids and timestamps are collapsed
+into one pattern, prefixed with its count like [x120], with placeholders like <n> for what varied.
+
+%s
+
+=== LOG ===
+%s`
+
+const defaultLogQuestion = "What went wrong in this log? List the errors and anomalies, most important first, with the lines that show them."
+
+type LogSumArgs struct {
+	LogFile        string `arg:"positional" help:"log file to summarize. Defaults to stdin."`
+	Question       string `arg:"-q,--question" help:"what to ask about the log, instead of what went wrong"`
+	KeepTimestamps bool   `arg:"--keep-timestamps" help:"keep the timestamps of lines, and the time range of patterns"`
+	CompressOnly   bool   `arg:"--compress-only" help:"print the compressed log, without calling the API"`
+	Model          string `arg:"-m,--model" help:"model to use, overrides the config"`
+}
+
+// runLogSum compresses a log into patterns with counts, and asks the model about it
+func runLogSum(argv []string) error {
+	var args LogSumArgs
+	parseArgs("pls logsum", &args, argv)
+
+	var source io.Reader = os.Stdin
+	if args.LogFile != "" {
+		f, err := os.Open(args.LogFile)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		source = f
+	}
+
+	counted := &countingReader{r: source}
+	options := logcompress.Options{KeepTimestamps: args.KeepTimestamps}
+	patterns, err := logcompress.Compress(counted, options)
+	if err != nil {
+		return err
+	}
+	compressed := logcompress.Format(patterns, options)
+
+	var lines int
+	for _, pattern := range patterns {
+		lines += pattern.Count
+	}
+	fmt.Fprintf(os.Stderr, "[compressed %d lines into %d, %d bytes to %d]\n", lines, len(patterns), counted.n, len(compressed))
+
+	if args.CompressOnly {
+		_, err := fmt.Print(compressed)
+		return err
+	}
+
+	r, err := NewRunner(Args{Model: args.Model})
+	if err != nil {
+		return err
+	}
+
+	question := args.Question
+	if question == "" {
+		question = defaultLogQuestion
+	}
+	prompt := fmt.Sprintf(logsumInstruction, question, compressed)
+
+	fm := &TemplateFrontMatter{}
+	r.applyFlags(fm)
+	r.frontMatter = fm
+
+	fits, err := r.fitsContext(prompt, fm)
+	if err != nil {
+		return err
+	}
+	if !fits {
+		model := r.Model(fm)
+		n, err := tokens.Count(model, prompt)
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("the compressed log is still %d tokens, too large for %s. Try pls logsum --compress-only | pls <prompt> --chunk reduce", n, model)
+	}
+
+	stream, err := r.OutputStream(prompt, fm)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	return r.WriteOutput(stream)
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
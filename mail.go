@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/mail"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// IMAPConfig configures the imap: input loader
+type IMAPConfig struct {
+	// Host is host:port of an IMAP server with TLS, e.g. imap.gmail.com:993
+	Host     string `yaml:"host"`
+	Username string `yaml:"username"`
+	// PasswordEnv is the environment variable holding the password
+	PasswordEnv string `yaml:"password_env"`
+	// Limit is the number of most recent unread messages to read
+	Limit int `yaml:"limit"`
+}
+
+// MailHeader is the summary of an unread message
+type MailHeader struct {
+	From    string
+	Subject string
+	Date    string
+}
+
+// imapConn is a minimal read-only IMAP client, just enough to list unread messages
+type imapConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	tag  int
+}
+
+// imapResponse is an untagged response line, with its literal if it has one
+type imapResponse struct {
+	Line    string
+	Literal []byte
+}
+
+var imapLiteralPattern = regexp.MustCompile(`\{(\d+)\}$`)
+
+func (c *imapConn) readLine() (string, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// command sends a command, and collects the untagged responses until its tagged completion
+func (c *imapConn) command(format string, args ...any) ([]imapResponse, error) {
+	c.tag++
+	tag := fmt.Sprintf("a%d", c.tag)
+
+	_, err := fmt.Fprintf(c.conn, "%s %s\r\n", tag, fmt.Sprintf(format, args...))
+	if err != nil {
+		return nil, err
+	}
+
+	var responses []imapResponse
+	for {
+		line, err := c.readLine()
+		if err != nil {
+			return nil, err
+		}
+
+		if strings.HasPrefix(line, tag+" ") {
+			status := strings.TrimPrefix(line, tag+" ")
+			if !strings.HasPrefix(status, "OK") {
+				return nil, fmt.Errorf("imap: %s", status)
+			}
+			return responses, nil
+		}
+
+		res := imapResponse{Line: line}
+		if m := imapLiteralPattern.FindStringSubmatch(line); m != nil {
+			n, _ := strconv.Atoi(m[1])
+			res.Literal = make([]byte, n)
+			_, err := io.ReadFull(c.r, res.Literal)
+			if err != nil {
+				return nil, err
+			}
+
+			// rest of the response after the literal, e.g. the closing paren
+			_, err = c.readLine()
+			if err != nil {
+				return nil, err
+			}
+		}
+		responses = append(responses, res)
+	}
+}
+
+func imapQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// LoadUnreadMail lists the unread messages of a mailbox. The mailbox is opened with EXAMINE and
+// headers are fetched with BODY.PEEK, so nothing is marked as read.
+func LoadUnreadMail(config IMAPConfig, mailbox string) ([]MailHeader, error) {
+	if config.Host == "" {
+		return nil, errors.New("imap: host is not configured")
+	}
+
+	password, err := requireToken(config.PasswordEnv, "imap")
+	if err != nil {
+		return nil, err
+	}
+
+	if mailbox == "" {
+		mailbox = "INBOX"
+	}
+
+	conn, err := tls.Dial("tcp", config.Host, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	c := &imapConn{conn: conn, r: bufio.NewReader(conn)}
+
+	// server greeting
+	_, err = c.readLine()
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = c.command("LOGIN %s %s", imapQuote(config.Username), imapQuote(password))
+	if err != nil {
+		return nil, err
+	}
+	defer c.command("LOGOUT")
+
+	_, err = c.command("EXAMINE %s", imapQuote(mailbox))
+	if err != nil {
+		return nil, err
+	}
+
+	responses, err := c.command("SEARCH UNSEEN")
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	for _, res := range responses {
+		if strings.HasPrefix(res.Line, "* SEARCH") {
+			ids = append(ids, strings.Fields(strings.TrimPrefix(res.Line, "* SEARCH"))...)
+		}
+	}
+
+	limit := config.Limit
+	if limit <= 0 {
+		limit = 50
+	}
+	if len(ids) > limit {
+		ids = ids[len(ids)-limit:]
+	}
+
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	responses, err = c.command("FETCH %s (BODY.PEEK[HEADER.FIELDS (FROM SUBJECT DATE)])", strings.Join(ids, ","))
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := new(mime.WordDecoder)
+	var headers []MailHeader
+	for _, res := range responses {
+		if res.Literal == nil {
+			continue
+		}
+
+		msg, err := mail.ReadMessage(strings.NewReader(string(res.Literal) + "\r\n"))
+		if err != nil {
+			continue
+		}
+
+		decode := func(key string) string {
+			value := msg.Header.Get(key)
+			if decoded, err := decoder.DecodeHeader(value); err == nil {
+				return decoded
+			}
+			return value
+		}
+
+		headers = append(headers, MailHeader{
+			From:    decode("From"),
+			Subject: decode("Subject"),
+			Date:    msg.Header.Get("Date"),
+		})
+	}
+
+	// newest first
+	for i, j := 0, len(headers)-1; i < j; i, j = i+1, j-1 {
+		headers[i], headers[j] = headers[j], headers[i]
+	}
+
+	return headers, nil
+}
+
+func mailInput(headers []MailHeader) *LoadedInput {
+	var text strings.Builder
+	var data []map[string]any
+	for _, h := range headers {
+		fmt.Fprintf(&text, "- %s: %s\n", h.From, h.Subject)
+		data = append(data, map[string]any{
+			"from":    h.From,
+			"subject": h.Subject,
+			"date":    h.Date,
+		})
+	}
+
+	return &LoadedInput{
+		Input: text.String(),
+		Data:  map[string]any{"messages": data},
+	}
+}
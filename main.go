@@ -3,15 +3,18 @@ package main
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"io/fs"
 	"log"
+	"net/http"
 	"os"
 	"path"
 	"path/filepath"
 	"strings"
+	"sync"
 	"text/template"
 	"time"
 
@@ -19,12 +22,37 @@ import (
 	"github.com/atotto/clipboard"
 	"github.com/sashabaranov/go-openai"
 
+	"github.com/hayeah/pls/locale"
 	"github.com/hayeah/pls/promptstr"
+	"github.com/hayeah/pls/streamfilter"
+	"github.com/hayeah/pls/tokens"
 )
 
 type Chat struct {
 	client      *openai.Client
 	baseRequest openai.ChatCompletionRequest
+
+	// clientConfig is used to create clients for prompts that set their own base URL
+	clientConfig openai.ClientConfig
+	// deployments maps models to Azure deployments
+	deployments map[string]string
+	// retries is how many times transient errors are retried
+	retries int
+	// mu guards the run stats below, which concurrent completions update
+	mu sync.Mutex
+	// retried counts the retries made, for the run stats
+	retried int
+	// requested and firstToken time the first completion, for the run stats
+	requested  time.Time
+	firstToken time.Time
+	// ctx is the parent context of completions, canceled on Ctrl-C or timeout
+	ctx context.Context
+	// limiter paces the completions of the run, nil is no limit
+	limiter *rateLimiter
+	// cache saves the responses of completions, nil is off
+	cache *responseCache
+	// budget refuses completions once the spend limits are reached, nil is no limit
+	budget *budgetGuard
 }
 
 type ChatOptions func(*Chat)
@@ -40,6 +68,31 @@ func toMessages(role string, messages []string) []openai.ChatCompletionMessage {
 	return result
 }
 
+func SetClientConfig(config openai.ClientConfig) ChatOptions {
+	return func(c *Chat) {
+		c.clientConfig = config
+	}
+}
+
+// SetContext sets the context completions are canceled with
+func SetContext(ctx context.Context) ChatOptions {
+	return func(c *Chat) {
+		c.ctx = ctx
+	}
+}
+
+func SetModel(model string) ChatOptions {
+	return func(c *Chat) {
+		c.baseRequest.Model = model
+	}
+}
+
+func SetTemperature(temperature float32) ChatOptions {
+	return func(c *Chat) {
+		c.baseRequest.Temperature = temperature
+	}
+}
+
 func SetMaxTokens(maxTokens int) ChatOptions {
 	return func(c *Chat) {
 		c.baseRequest.MaxTokens = maxTokens
@@ -55,7 +108,9 @@ func AppendUserMessages(messages ...string) ChatOptions {
 
 func NewChat(client *openai.Client, opts ...ChatOptions) *Chat {
 	c := &Chat{
-		client: client,
+		client:       client,
+		clientConfig: openai.DefaultConfig(""),
+		ctx:          context.Background(),
 		baseRequest: openai.ChatCompletionRequest{
 			// Temperature: 0.5,
 			// Temperature: 1.5. seems bad
@@ -74,43 +129,165 @@ func NewChat(client *openai.Client, opts ...ChatOptions) *Chat {
 }
 
 func (c *Chat) cloneRequest() openai.ChatCompletionRequest {
-	return c.baseRequest
+	req := c.baseRequest
+	req.Messages = append([]openai.ChatCompletionMessage(nil), c.baseRequest.Messages...)
+	return req
+}
+
+// Model returns the model used for completions
+func (c *Chat) Model() string {
+	return c.baseRequest.Model
+}
+
+// MaxTokens returns the completion token limit. 0 means no limit.
+func (c *Chat) MaxTokens() int {
+	return c.baseRequest.MaxTokens
 }
 
 func (rs *ResponseStream) Close() error {
 	rs.cancel()
 	rs.stream.Close()
+	rs.release()
 	return nil
 }
 
-func (c *Chat) Stream(message string, opts *TemplateFrontMatter) (io.ReadCloser, error) {
-	ctx, cancel := context.WithCancel(context.Background())
+// clientFor returns the client for the prompt, which may point at another API server or
+// Azure deployment
+func (c *Chat) clientFor(opts *TemplateFrontMatter, model string) *openai.Client {
+	config := c.clientConfig
+	changed := false
+
+	if opts != nil && opts.BaseURL != "" && opts.BaseURL != config.BaseURL {
+		config.BaseURL = opts.BaseURL
+		changed = true
+	}
+
+	deployment, ok := c.deployments[model]
+	if ok && deployment != config.Engine {
+		config.Engine = deployment
+		changed = true
+	}
+
+	if !changed {
+		return c.client
+	}
+
+	return openai.NewClientWithConfig(config)
+}
 
+// Request returns the completion request for the message, with the options of the prompt applied
+func (c *Chat) Request(message string, opts *TemplateFrontMatter) openai.ChatCompletionRequest {
 	req := c.cloneRequest()
 	if opts != nil {
-		req.Temperature = float32(opts.Temperature)
+		if opts.Temperature != 0 {
+			req.Temperature = opts.Temperature
+		}
+
+		if opts.MaxTokens != 0 {
+			req.MaxTokens = opts.MaxTokens
+		}
+
+		if opts.Model != "" {
+			req.Model = opts.Model
+		}
+	}
+
+	if opts != nil && opts.System != "" {
+		req.Messages = append(req.Messages, openai.ChatCompletionMessage{
+			Role:    openai.ChatMessageRoleSystem,
+			Content: opts.System,
+		})
+	}
+
+	if opts != nil {
+		req.Messages = append(req.Messages, opts.Messages...)
 	}
 
 	req.Messages = append(req.Messages,
-		// openai.ChatCompletionMessage{
-		// 	Role:    openai.ChatMessageRoleSystem,
-		// 	Content: "please be as helpful as possible, and give detailed, informative response. it's good to produce long output to be extra helpful.",
-		// },
 		openai.ChatCompletionMessage{
 			Role:    openai.ChatMessageRoleUser,
 			Content: message,
 		})
+
+	return req
+}
+
+func (c *Chat) Stream(message string, opts *TemplateFrontMatter) (io.ReadCloser, error) {
+	req := c.Request(message, opts)
 	req.Stream = true
 
-	stream, err := c.client.CreateChatCompletionStream(ctx, req)
+	if c.cache == nil {
+		return c.stream(req, opts)
+	}
+
+	baseURL := c.clientConfig.BaseURL
+	if opts != nil && opts.BaseURL != "" {
+		baseURL = opts.BaseURL
+	}
+	key, err := cacheKey(baseURL, req)
 	if err != nil {
+		return nil, err
+	}
+
+	return c.cachedStream(key, req.Model, func() (io.ReadCloser, error) {
+		return c.stream(req, opts)
+	})
+}
+
+// stream sends the request, and streams its response
+func (c *Chat) stream(req openai.ChatCompletionRequest, opts *TemplateFrontMatter) (io.ReadCloser, error) {
+	ctx, cancel := context.WithCancel(c.ctx)
+
+	c.mu.Lock()
+	if c.requested.IsZero() {
+		c.requested = time.Now()
+	}
+	c.mu.Unlock()
+
+	retries := c.retries
+	if opts != nil && opts.Retries != nil {
+		retries = *opts.Retries
+	}
+
+	var messages []string
+	for _, message := range req.Messages {
+		messages = append(messages, message.Content)
+	}
+	releaseBudget, err := c.budget.reserve(req.Model, messages, req.MaxTokens)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	releaseSlot, err := c.limiter.acquire(ctx, c.limiter.requestTokens(req.Model, messages, req.MaxTokens))
+	if err != nil {
+		releaseBudget()
+		cancel()
+		return nil, err
+	}
+	release := func() {
+		releaseSlot()
+		releaseBudget()
+	}
+
+	client := c.clientFor(opts, req.Model)
+	stream, err := c.openStream(ctx, client, req, retries)
+	if err != nil {
+		release()
 		cancel()
 		return nil, err
 	}
 
 	rs := &ResponseStream{
-		stream: stream,
-		cancel: cancel,
+		stream:  stream,
+		cancel:  cancel,
+		ctx:     ctx,
+		chat:    c,
+		client:  client,
+		req:     req,
+		retries: retries,
+		resume:  opts != nil && opts.Resume,
+		release: release,
 	}
 
 	return rs, nil
@@ -119,40 +296,190 @@ func (c *Chat) Stream(message string, opts *TemplateFrontMatter) (io.ReadCloser,
 type ResponseStream struct {
 	stream *openai.ChatCompletionStream
 	cancel context.CancelFunc
+	// release frees the rate limiter's slot and the budget reservation of the request
+	release func()
+
+	// the request is resent to resume the response after a transient error
+	ctx      context.Context
+	chat     *Chat
+	client   *openai.Client
+	req      openai.ChatCompletionRequest
+	retries  int
+	attempts int
+	resume   bool
+	received strings.Builder
 
 	stopped bool
+	// pending is the part of the last delta that didn't fit into the read buffer
+	pending []byte
+}
+
+// reopen resends the request with the partial response, so the model continues where the stream failed
+func (rs *ResponseStream) reopen(streamErr error) error {
+	err := rs.chat.waitToRetry(rs.ctx, streamErr, rs.attempts, rs.retries)
+	if err != nil {
+		return err
+	}
+	rs.attempts++
+
+	stream, err := rs.chat.openStream(rs.ctx, rs.client, resumeRequest(rs.req, rs.received.String()), rs.retries-rs.attempts)
+	if err != nil {
+		return err
+	}
+
+	rs.stream.Close()
+	rs.stream = stream
+	return nil
 }
 
 // Read streams the completion stream, and append a newline at the end. Not threadsafe.
 func (rs *ResponseStream) Read(p []byte) (int, error) {
-	if rs.stopped {
-		return 0, io.EOF
-	}
+	for len(rs.pending) == 0 {
+		if rs.stopped {
+			return 0, io.EOF
+		}
 
-	// the base stream is not threadsafe...
-	response, err := rs.stream.Recv()
+		// the base stream is not threadsafe...
+		response, err := rs.stream.Recv()
 
-	if errors.Is(err, io.EOF) {
-		p[0] = '\n'
-		rs.stopped = true
-		return 1, io.EOF
-	}
+		if errors.Is(err, io.EOF) {
+			rs.stopped = true
+			rs.pending = []byte{'\n'}
+			break
+		}
 
-	if err != nil {
-		return 0, err
+		if err != nil && rs.resume && rs.attempts < rs.retries && isRetryable(err) {
+			err = rs.reopen(err)
+			if err != nil {
+				return 0, err
+			}
+			continue
+		}
+
+		if err != nil {
+			return 0, err
+		}
+
+		// OpenAI-compatible servers (e.g. Ollama, vLLM) may send chunks without choices
+		if len(response.Choices) == 0 {
+			continue
+		}
+
+		rs.pending = []byte(response.Choices[0].Delta.Content)
+		rs.chat.mu.Lock()
+		if rs.chat.firstToken.IsZero() {
+			rs.chat.firstToken = time.Now()
+		}
+		rs.chat.mu.Unlock()
+		if rs.resume {
+			rs.received.WriteString(response.Choices[0].Delta.Content)
+		}
 	}
 
-	n := copy(p, response.Choices[0].Delta.Content)
+	n := copy(p, rs.pending)
+	rs.pending = rs.pending[n:]
 	return n, nil
 }
 
 type TemplateData struct {
 	Input string
+	// Args are script arguments, bound to the names declared by the frontmatter
+	Args map[string]string
+	// Vars are the template variables set with --var name=value
+	Vars map[string]string
+	// Data is structured data from the input loader
+	Data map[string]any
+	// Memory is the store of the template, with the values captured by its previous runs
+	Memory map[string]string
+
+	// Old, New and Diff are the document versions compared by pls diffdocs
+	Old  string
+	New  string
+	Diff string
 }
 
 type TemplateFrontMatter struct {
+	// Title and Description describe the prompt in pls prompts list
+	Title       string `json:"title"`
+	Description string `json:"description"`
+
 	// note: quirk of the openai library doesn't make it possible to use 0.0 for these options floats.
 	Temperature float32 `json:"temperature"`
+	MaxTokens   int     `json:"max_tokens" yaml:"max_tokens"`
+	Model       string  `json:"model"`
+	// BaseURL points the prompt at another OpenAI-compatible server, e.g. a local Ollama
+	BaseURL string `json:"base_url" yaml:"base_url"`
+	// Retries is how many times rate limits and transient errors are retried, like --retries
+	Retries *int `json:"retries"`
+	// Resume resends the request after the stream fails midway, asking the model to continue, like --resume
+	Resume bool `json:"resume"`
+	// Chunk runs prompts too large for the model on chunks of the input, like --chunk: concat or reduce
+	Chunk string `json:"chunk"`
+	// System is sent as a system message before the prompt. It's rendered like the prompt body.
+	System string `json:"system"`
+	// UseProfile prepends the user profile to the system message
+	UseProfile bool `json:"use_profile" yaml:"use_profile"`
+	// ResponseFormat json asks for a JSON response, in the JSON mode of the API
+	ResponseFormat string `json:"response_format" yaml:"response_format"`
+	// JSONSchema validates JSON responses. Responses that don't match are retried.
+	JSONSchema any `json:"json_schema" yaml:"json_schema"`
+	// JSONRetries is how many times invalid JSON responses are retried, 2 by default
+	JSONRetries *int `json:"json_retries" yaml:"json_retries"`
+	// Requires are the capabilities the model must have, e.g. [vision, tools, min_context: 128000]
+	Requires Requirements `json:"requires"`
+	// Tools are functions the model may call
+	Tools []Tool `json:"tools"`
+	// OpenAPI adds the operations of an OpenAPI spec to the tools
+	OpenAPI *OpenAPITools `json:"openapi" yaml:"openapi"`
+	// Filters transform the response as it streams in, e.g. [strip_fence, wrap=72]
+	Filters []string `json:"filters"`
+	// Postprocess cleans up the whole response before it's written, e.g. [strip_code_fences, trim,
+	// ensure_trailing_newline]. The response is not streamed.
+	Postprocess []string `json:"postprocess"`
+	// Messages are rendered from the role sections before the final user section of the body
+	Messages []openai.ChatCompletionMessage `json:"-" yaml:"-"`
+
+	// Args names the positional arguments of a prompt script
+	Args []string `json:"args"`
+	// Vars declares the variables set with --var
+	Vars map[string]VarSpec `json:"vars"`
+	// Replace rewrites the input file in place, like --replace
+	Replace bool `json:"replace"`
+	// Output is the default output file
+	Output string `json:"output"`
+	// Capture stores parts of the completion for the next run of the template, as {{.Memory.key}}. A
+	// rule is response, input, or a regular expression whose first group is picked from the response,
+	// e.g. capture: {last_summary: response, score: 'Score: (\d+)'}
+	Capture map[string]string `json:"capture"`
+	// Next is the prompt that is given the response as its input, e.g. next: translate.md
+	Next string `json:"next"`
+	// Exec enables {{sh}}, which runs commands while rendering, and the hooks of the template, like
+	// --allow-exec
+	Exec bool `json:"exec"`
+
+	// Hooks run after the hooks of the config, with --allow-exec or exec: true
+	Hooks Hooks `json:"hooks"`
+
+	// Tags are recorded with the usage of the run, for pls usage --by tag, e.g. tags: {project: payments}.
+	// --tag overrides them.
+	Tags map[string]string `json:"tags"`
+}
+
+// frontMatterOptions configure how prompt frontmatter is parsed. Set from the config by NewRunner.
+var frontMatterOptions []promptstr.ParseOption
+
+// newTemplate creates the template that prompts are parsed into
+func newTemplate() *template.Template {
+	return template.New("template").Funcs(templateFuncs)
+}
+
+// newPromptTemplate creates the template for a prompt, with the functions its frontmatter enables
+func newPromptTemplate(fm *TemplateFrontMatter) *template.Template {
+	tmpl := newTemplate().Funcs(shellFuncs(fm))
+	if includeCache != nil || includeProfile != nil {
+		tmpl.Funcs(cachedIncludes(fm))
+	}
+	return tmpl
 }
 
 func RenderTemplate(promptTemplate string, data TemplateData) (string, *TemplateFrontMatter, error) {
@@ -161,47 +488,182 @@ func RenderTemplate(promptTemplate string, data TemplateData) (string, *Template
 	// END_OF_PROMPT. BEGIN INPUT.
 	// ---
 	// {{.Input}}`
+	if includeProfile != nil {
+		defer includeProfile.rendered(time.Now())
+	}
+
 	var fm TemplateFrontMatter
-	promptBody, err := promptstr.ParseFrontMatter(promptTemplate, &fm)
+	promptBody, err := promptstr.ParseFrontMatter(promptTemplate, &fm, frontMatterOptions...)
 	if err != nil {
 		return "", nil, err
 	}
 
-	tmpl, err := template.New("template").Parse(promptBody)
+	sections := promptstr.SplitRoleSections(promptBody)
+	last := sections[len(sections)-1]
+	if last.Role != openai.ChatMessageRoleUser {
+		return "", nil, fmt.Errorf("the last section of a prompt must be a user section, got %s", last.Role)
+	}
+
+	for _, section := range sections[:len(sections)-1] {
+		content, err := executeTemplate(section.Content, data, &fm)
+		if err != nil {
+			return "", nil, err
+		}
 
+		fm.Messages = append(fm.Messages, openai.ChatCompletionMessage{
+			Role:    section.Role,
+			Content: content,
+		})
+	}
+
+	prompt, err := executeTemplate(last.Content, data, &fm)
 	if err != nil {
 		return "", nil, err
 	}
 
+	if fm.System != "" {
+		fm.System, err = executeTemplate(fm.System, data, &fm)
+		if err != nil {
+			return "", nil, err
+		}
+	}
+
+	err = applyProfile(&fm)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return prompt, &fm, nil
+}
+
+// FormatConversation formats the rendered prompt for display. The system message and role sections
+// are included with their markers, if the template has any.
+func FormatConversation(prompt string, fm *TemplateFrontMatter) string {
+	if fm.System == "" && len(fm.Messages) == 0 {
+		return prompt
+	}
+
+	var buf strings.Builder
+	if fm.System != "" {
+		fmt.Fprintf(&buf, "--- system ---\n%s\n", fm.System)
+	}
+	for _, message := range fm.Messages {
+		fmt.Fprintf(&buf, "--- %s ---\n%s\n", message.Role, message.Content)
+	}
+	fmt.Fprintf(&buf, "--- user ---\n%s", prompt)
+
+	return buf.String()
+}
+
+func executeTemplate(text string, data TemplateData, fm *TemplateFrontMatter) (string, error) {
+	tmpl, err := newPromptTemplate(fm).Parse(text)
+	if err != nil {
+		return "", err
+	}
+
 	var buf bytes.Buffer
 	err = tmpl.Execute(&buf, data)
 	if err != nil {
-		return "", nil, err
+		return "", err
 	}
 
-	return buf.String(), &fm, nil
+	return buf.String(), nil
 }
 
 type Args struct {
 	PromptFile string `arg:"positional,required" help:"prompt template file"`
 	InputFile  string `arg:"positional" help:"input file to embed into the prompt"`
 
-	PrintPrompt bool `arg:"-p,--prompt" help:"print the rendered prompt for copy-paste"`
-
-	OutputFile       string `arg:"positional" help:"output file. Use - for stdout"`
-	ReplaceInputFile bool   `arg:"-r,--replace" help:"inplace rewrite of the input file"`
-	NoInput          bool   `arg:"-n,--no-input" help:"use the prompt directly with no input"`
+	PrintPrompt bool   `arg:"-p,--prompt" help:"print the rendered prompt for copy-paste"`
+	RenderOnly  bool   `arg:"--render-only" help:"output only the rendered prompt, without calling the API or using the clipboard"`
+	NoClipboard bool   `arg:"--no-clipboard" help:"don't copy the rendered prompt to the clipboard"`
+	Output      string `arg:"-o,--output" help:"write the rendered prompt to this file (with --prompt or --render-only)"`
+
+	OutputFile       string            `arg:"positional" help:"output file. Use - for stdout"`
+	ScriptArgs       []string          `arg:"positional" help:"arguments of a prompt script, bound to the names in its frontmatter args"`
+	ReplaceInputFile bool              `arg:"-r,--replace" help:"inplace rewrite of the input file"`
+	BackupDir        string            `arg:"--backup-dir" help:"collect the backups of replaced files in this directory"`
+	NoBackup         bool              `arg:"--no-backup" help:"don't back up replaced files"`
+	KeepBackups      int               `arg:"--keep-backups" help:"keep only the newest N backups of a replaced file"`
+	AllowRefusal     bool              `arg:"--allow-refusal" help:"replace the file even if the response looks like a refusal"`
+	SkipChecks       bool              `arg:"--skip-checks" help:"replace the file without the sanity checks of replace_checks"`
+	OnConflict       string            `arg:"--on-conflict" help:"when the file changed while the response was generated: abort, merge or rerender. Overrides on_conflict of the config"`
+	AllowExec        bool              `arg:"--allow-exec" help:"allow templates to run commands with {{sh}} and hooks, and .pls.yaml to set hooks, plugins, endpoints, credential variables and the profile"`
+	NoInput          bool              `arg:"-n,--no-input" help:"use the prompt directly with no input"`
+	Input            string            `arg:"-i,--input" help:"load the input with a loader, as scheme:reference (e.g. jira:PROJ-123)"`
+	Since            string            `arg:"--since" help:"with --input k8s:, how far back to read logs, e.g. 1h. Overrides k8s.since of the config"`
+	Vars             map[string]string `arg:"--var,separate" help:"template variable, as name=value. Used in templates as {{.Vars.name}}"`
+	Tags             map[string]string `arg:"--tag,separate" help:"tag recorded with the usage of the run, as name=value, e.g. project=payments. Reported by pls usage --by tag"`
+	OCR              bool              `arg:"--ocr" help:"the input file is an image. Its extracted text is used as the input"`
+	Sink             string            `arg:"--sink" help:"send the completion to an output sink provided by a plugin"`
+	NoStream         bool              `arg:"--no-stream" help:"write the completion once it is complete, cleaned up: code fence around files stripped, trailing whitespace removed, JSON files validated"`
+	SaveSteps        string            `arg:"--save-steps" help:"save the output of each prompt of a next: chain in this directory"`
+	Filters          []string          `arg:"--filter,separate" help:"output filter: strip_fence, wrap[=N], redact or highlight. Repeatable."`
+	Render           bool              `arg:"--render" help:"render the markdown of the response with ANSI styles and syntax highlighting, even if stdout isn't a terminal. On by default on a terminal."`
+	NoRender         bool              `arg:"--no-render" help:"write the raw markdown to the terminal"`
+	Patch            bool              `arg:"--patch" help:"ask for the changes to the input file as a unified diff, and apply it instead of rewriting the whole file"`
+	Edit             bool              `arg:"--edit" help:"apply the edits of the response to the files of the working tree, with a code block per file or a JSON list of edits"`
+	Preview          bool              `arg:"--preview" help:"with --patch or --edit, print the diff without changing the files"`
+	GitBranch        string            `arg:"--git-branch" help:"make the changes of --replace, --patch or --edit on a new branch from HEAD, leaving the working tree untouched. Named pls/<template>-<time> if bare, give a name as --git-branch=name."`
+	ExtractCode      string            `arg:"--extract-code" help:"write only the code of the fenced code blocks, and echo the prose to stderr. --extract-code=lang keeps only the blocks of lang."`
+
+	Confidence    bool    `arg:"--confidence" help:"ask the model to state its confidence and report it on stderr"`
+	MinConfidence float64 `arg:"--min-confidence" help:"fail if the stated confidence (0-100) is below this threshold. Implies --confidence."`
+	EscalateModel string  `arg:"--escalate-model" help:"re-run answers below --min-confidence with this model. Implies --confidence."`
+
+	Model       string  `arg:"-m,--model" help:"model to use, overrides frontmatter and config"`
+	Temperature float32 `arg:"-t,--temperature" help:"sampling temperature, overrides frontmatter and config"`
+	MaxTokens   int     `arg:"--max-tokens" help:"completion token limit, overrides frontmatter and config"`
+
+	Retries *int `arg:"--retries" help:"retries on rate limits and transient errors, overrides frontmatter and config"`
+	Resume  bool `arg:"--resume" help:"when the stream fails midway, resend the request and ask the model to continue"`
+
+	Chunk        string `arg:"--chunk" help:"when the prompt is too large for the model, run it on chunks of the input and concat or reduce the results"`
+	MaxMemory    string `arg:"--max-memory" help:"largest input loaded into memory, e.g. 256MB. Larger inputs are streamed through --chunk."`
+	ChunkOverlap int    `arg:"--chunk-overlap" default:"100" help:"tokens repeated between consecutive chunks"`
+
+	RPM         int `arg:"--rpm" help:"send at most this many requests per minute, overrides rate_limit.rpm of the config"`
+	TPM         int `arg:"--tpm" help:"send at most this many tokens per minute, overrides rate_limit.tpm of the config"`
+	Concurrency int `arg:"--concurrency" help:"at most this many requests in flight, overrides rate_limit.concurrency of the config"`
+
+	Cache    bool          `arg:"--cache" help:"reuse the saved response when the same prompt is sent with the same model and parameters, saved in ~/.cache/pls"`
+	NoCache  bool          `arg:"--no-cache" help:"send the request even if the cache is enabled by the config"`
+	Force    bool          `arg:"--force" help:"send requests even if the spend has reached the limits of budget in the config"`
+	CacheTTL time.Duration `arg:"--cache-ttl" help:"with --cache, ignore responses older than this, e.g. 24h. Overrides cache.ttl of the config"`
+
+	Timeout time.Duration `arg:"--timeout" help:"give up on the completion after this long, e.g. 2m"`
+	Stats   string        `arg:"--stats" help:"end of run summary on stderr: off, minimal (tokens, cost and time) or full"`
+
+	Session string `arg:"-s,--session" help:"continue the named conversation, saved in ~/.local/share/pls/sessions"`
+
+	MessagesIn  string `arg:"--messages-in" help:"JSON array of OpenAI chat messages to send before the prompt"`
+	MessagesOut string `arg:"--messages-out" help:"write the whole conversation, including the reply, as a JSON array of OpenAI chat messages"`
+
+	MissingInput string `arg:"--missing-input" help:"when input is given but the template doesn't use {{.Input}}: warn, error or ignore"`
+
+	ExplainContext bool `arg:"--explain-context" help:"print how the prompt's token budget is allocated, without calling the API"`
+	Trace          bool `arg:"--trace" help:"print the rendered prompt annotated with the template construct that produced each region"`
+	DryRun         bool `arg:"--dry-run" help:"print the chat completion request as JSON, without calling the API"`
+	Quiet          bool `arg:"-q,--quiet" help:"don't show the status line of the completion on stderr when stdout is a file or pipe"`
+	ProfileRender  bool `arg:"--profile-render" help:"print on stderr how long rendering the prompt took, and each {{file}}, {{glob}} and {{sh}} in it"`
 }
 
-// TemplatePaths returns the paths to search for templates
+// TemplatePaths returns the paths to search for templates, from highest to lowest precedence
 func TemplatePaths() ([]string, error) {
 	home, err := os.UserHomeDir()
 	if err != nil {
 		return nil, err
 	}
 
-	// default paths
+	configDir, err := ConfigDir()
+	if err != nil {
+		return nil, err
+	}
+
+	// default paths. Project prompts come first, so a project can override the user's prompts.
 	paths := []string{
+		path.Join(".pls", "prompts"),
+		path.Join(configDir, "prompts"),
 		path.Join(home, "pls"),
 		path.Join(home, ".pls"),
 	}
@@ -216,54 +678,228 @@ func TemplatePaths() ([]string, error) {
 }
 
 type Runner struct {
-	args Args
-	chat *Chat
+	args   Args
+	chat   *Chat
+	config *Config
 
 	templatePaths []string
+
+	// input is the raw input embedded into the rendered prompt
+	input string
+	// template and templateData are what the prompt was rendered from, to render it again for chunks
+	template     string
+	templateData TemplateData
+	// frontMatter of the rendered prompt, merged with CLI flags
+	frontMatter *TemplateFrontMatter
+	// completionStarted is set once the prompt is about to be sent to the API
+	completionStarted bool
+	// session is the conversation continued with --session
+	session *Session
+	// stats are printed at the end of the run with --stats
+	stats RunStats
+	// baselines are the contents of the files the prompt was rendered from, by absolute path
+	baselines map[string]string
+	// snapshot is the ID of the snapshot of the files pls batch or --edit changes, which replaces their
+	// backups
+	snapshot string
+	// templatePath is the file the template was read from
+	templatePath string
+	// runID is the id of the recorded run transcript
+	runID string
+	// httpClient sends the requests go-openai can't make, sharing its connection pool
+	httpClient *http.Client
+	// pipedInput is the output of the previous prompt of a chain, used instead of reading the input
+	pipedInput *string
+	// chunking is set if the prompt runs on chunks of its input. streamedInput is the input too large
+	// to be loaded into memory, streamed through the chunker instead.
+	chunking      bool
+	streamedInput *streamedInput
+	// chain are the prompts to run after this one, and step is the position of this one in the chain
+	chain []string
+	step  int
+	// quiet doesn't echo the files it writes to stdout, for the concurrent runs of pls batch
+	quiet bool
+	// hooksSkipped is set once the warning about the skipped hooks of the template is printed
+	hooksSkipped bool
 }
 
 func (r *Runner) RenderPrompt() (string, *TemplateFrontMatter, error) {
-	var err error
+	prompt, data, err := r.PrepareTemplate()
+	if err != nil {
+		return "", nil, err
+	}
 
-	templateName := r.args.PromptFile
+	missingInput := r.config.MissingInput
+	if r.args.MissingInput != "" {
+		missingInput = r.args.MissingInput
+	}
+
+	err = CheckInputUsed(prompt, data.Input, missingInput)
+	if err != nil {
+		return "", nil, err
+	}
+
+	r.template = prompt
+	r.templateData = data
 
-	// search for template
-	templatePath, err := MatchNameInPaths(r.templatePaths, templateName)
+	prompt, frontMatter, err := RenderTemplate(prompt, data)
 	if err != nil {
 		return "", nil, err
 	}
 
+	r.applyFlags(frontMatter)
+
+	return prompt, frontMatter, nil
+}
+
+// applyFlags overrides the frontmatter with CLI flags, which take precedence
+func (r *Runner) applyFlags(frontMatter *TemplateFrontMatter) {
+	if r.args.Model != "" {
+		frontMatter.Model = r.args.Model
+	}
+
+	if r.args.Temperature != 0 {
+		frontMatter.Temperature = r.args.Temperature
+	}
+
+	if r.args.MaxTokens != 0 {
+		frontMatter.MaxTokens = r.args.MaxTokens
+	}
+
+	if r.args.Retries != nil {
+		frontMatter.Retries = r.args.Retries
+	}
+
+	if r.args.Resume {
+		frontMatter.Resume = true
+	}
+
+	if r.args.Chunk != "" {
+		frontMatter.Chunk = r.args.Chunk
+	}
+}
+
+// PrepareTemplate reads the template and its input, binding script arguments declared in the frontmatter
+func (r *Runner) PrepareTemplate() (string, TemplateData, error) {
+	prompt, err := r.ReadTemplate()
+	if err != nil {
+		return "", TemplateData{}, err
+	}
+
+	var fm TemplateFrontMatter
+	_, err = promptstr.ParseFrontMatter(prompt, &fm, frontMatterOptions...)
+	if err != nil {
+		return "", TemplateData{}, err
+	}
+
+	scriptArgs, err := r.BindScriptArgs(&fm)
+	if err != nil {
+		return "", TemplateData{}, err
+	}
+
+	r.chunking = fm.Chunk != "" || r.args.Chunk != ""
+
+	vars, err := BindVars(fm.Vars, r.args.Vars)
+	if err != nil {
+		return "", TemplateData{}, err
+	}
+
+	memory, err := ReadTemplateMemory(r.templatePath)
+	if err != nil {
+		return "", TemplateData{}, err
+	}
+
+	data := TemplateData{
+		Args:   scriptArgs,
+		Vars:   vars,
+		Memory: memory.Values,
+	}
+
+	if r.args.Input != "" {
+		loaded, err := LoadInput(r.args.Input)
+		if err != nil {
+			return "", TemplateData{}, err
+		}
+		r.input = loaded.Input
+		data.Input = loaded.Input
+		data.Data = loaded.Data
+	} else {
+		data.Input, err = r.ReadInput()
+		if err != nil {
+			return "", TemplateData{}, err
+		}
+	}
+
+	return prompt, data, nil
+}
+
+// ReadTemplate finds the prompt template in the template paths, and reads it
+func (r *Runner) ReadTemplate() (string, error) {
+	templateName := r.args.PromptFile
+
+	// a path is used as is, e.g. when running a prompt script through its shebang
+	templatePath := templateName
+	if !strings.ContainsRune(templateName, filepath.Separator) {
+		// search for template
+		var err error
+		templatePath, err = MatchNameInPaths(r.templatePaths, templateName)
+		if err != nil {
+			return "", err
+		}
+	}
+
 	// read prompt file
 	prompt, err := os.ReadFile(templatePath)
 	if err != nil {
-		return "", nil, err
+		return "", err
 	}
+	r.templatePath = templatePath
+
+	return string(prompt), nil
+}
+
+// ReadInput reads the input from the input file, or stdin
+func (r *Runner) ReadInput() (string, error) {
+	var err error
 
-	var input []byte
+	if r.pipedInput != nil {
+		r.input = *r.pipedInput
+		return r.input, nil
+	}
 
 	if !r.args.NoInput {
-		if r.args.InputFile == "" {
-			// read from stdin as input
-			input, err = io.ReadAll(os.Stdin)
-			if err != nil {
-				return "", nil, err
-			}
-		} else {
-			input, err = os.ReadFile(r.args.InputFile)
-			if err != nil {
-				return "", nil, err
+		if r.args.OCR {
+			if r.args.InputFile == "" {
+				return "", errors.New("--ocr needs an input image file")
 			}
+
+			r.input, err = r.ExtractText(r.args.InputFile)
+			return r.input, err
+		}
+
+		r.input, err = r.readInput(r.args.InputFile)
+		if err != nil {
+			return "", err
+		}
+		if r.args.InputFile != "" && r.streamedInput == nil {
+			r.recordBaseline(r.args.InputFile, r.input)
 		}
 	}
 
-	return RenderTemplate(string(prompt), TemplateData{
-		Input: string(input),
-	})
+	return r.input, nil
+}
+
+// Model returns the model the prompt will be sent to
+func (r *Runner) Model(frontMatter *TemplateFrontMatter) string {
+	if frontMatter != nil && frontMatter.Model != "" {
+		return frontMatter.Model
+	}
+	return r.chat.Model()
 }
 
 // OutputStream produces the output stream of rendered prompt
 func (r *Runner) OutputStream(renderedPrompt string, frontMatter *TemplateFrontMatter) (io.ReadCloser, error) {
-	stream, err := r.chat.Stream(renderedPrompt, frontMatter)
+	stream, err := r.stream(renderedPrompt, frontMatter)
 	if err != nil {
 		return nil, err
 	}
@@ -271,86 +907,350 @@ func (r *Runner) OutputStream(renderedPrompt string, frontMatter *TemplateFrontM
 	return stream, nil
 }
 
-// backupFile backups by making a copy suffixed with timestamp
-func backupFile(filename string) error {
-	// Open the original file for reading
-	file, err := os.Open(filename)
+// ReplaceFile replaces the output file with the output stream, makeing a backupt of the output file first.
+// The stream is written to a temporary file that is renamed over the output file once complete, so a
+// failed or interrupted stream leaves the output file as it was. A rewrite that looks like a refusal,
+// or fails the sanity checks, is set aside instead. A missing output file is created.
+func (r *Runner) ReplaceFile(stream io.Reader, outputfile string) error {
+	perm := fs.FileMode(0644)
+	info, err := os.Stat(outputfile)
+	exists := err == nil
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if exists {
+		perm = info.Mode().Perm()
+	}
+
+	// the temp file is in the same directory, so the rename doesn't cross filesystems
+	f, err := os.CreateTemp(filepath.Dir(outputfile), "."+filepath.Base(outputfile)+".pls-*")
 	if err != nil {
 		return err
 	}
-	defer file.Close()
+	defer os.Remove(f.Name())
 
-	// Create the backup filename with the timestamp
-	backupFilename := fmt.Sprintf("%s.%s", filename, time.Now().Format(time.RFC3339))
+	// tee the output to stdout. --patch and --edit print the diff instead, and batch runs are quiet.
+	if !r.args.Patch && !r.args.Edit && !r.quiet {
+		stream = io.TeeReader(stream, os.Stdout)
+	}
 
-	// Create the backup file for writing
-	backupFile, err := os.Create(backupFilename)
+	_, err = io.Copy(f, stream)
 	if err != nil {
+		f.Close()
 		return err
 	}
-	defer backupFile.Close()
 
-	// Copy the contents of the original file to the backup file
-	_, err = io.Copy(backupFile, file)
+	err = f.Chmod(perm)
 	if err != nil {
+		f.Close()
 		return err
 	}
 
-	return nil
-}
-
-// ReplaceFile replaces the output file with the output stream, makeing a backupt of the output file first.
-func (r *Runner) ReplaceFile(stream io.Reader, outputfile string) error {
-	// read output file
-	err := backupFile(outputfile)
+	err = f.Close()
 	if err != nil {
 		return err
 	}
 
-	// open output file
-	f, err := os.OpenFile(outputfile, os.O_WRONLY|os.O_TRUNC, 0644)
+	if r.isRewrite(outputfile) {
+		err = r.checkRewrite(f.Name(), outputfile)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = r.checkUnchanged(f.Name(), outputfile)
 	if err != nil {
 		return err
 	}
-	defer f.Close()
 
-	// tee the output to stdout
-	stream = io.TeeReader(stream, os.Stdout)
+	var backupFilename string
+	if exists {
+		backup, err := r.backupConfig()
+		if err != nil {
+			return err
+		}
 
-	_, err = io.Copy(f, stream)
+		backupFilename, err = backupFile(outputfile, backup)
+		if err != nil {
+			return err
+		}
+	}
 
-	return err
+	err = os.Rename(f.Name(), outputfile)
+	if err != nil {
+		return err
+	}
+	wroteFile(outputfile)
+
+	if !exists {
+		fmt.Fprintf(os.Stderr, "[wrote %s]\n", fileLink(outputfile))
+	} else if backupFilename != "" {
+		fmt.Fprintf(os.Stderr, "[replaced %s, backup in %s]\n", fileLink(outputfile), fileLink(backupFilename))
+	} else {
+		fmt.Fprintf(os.Stderr, "[replaced %s]\n", fileLink(outputfile))
+	}
+	return nil
 }
 
 func (r *Runner) Run() error {
+	if r.args.Trace {
+		return r.TracePrompt()
+	}
+
+	start := time.Now()
 	prompt, frontMatter, err := r.RenderPrompt()
 	if err != nil {
 		return err
 	}
+	r.frontMatter = frontMatter
+	r.stats.Time("render", start)
+
+	_, err = captureRules(frontMatter)
+	if err != nil {
+		return err
+	}
+
+	err = r.LoadSession(frontMatter)
+	if err != nil {
+		return err
+	}
+
+	err = r.LoadMessages(frontMatter)
+	if err != nil {
+		return err
+	}
+
+	var instructions string
+	if r.args.Confidence {
+		instructions += confidenceInstruction
+	}
+	prompt += instructions
+
+	if r.args.ExplainContext {
+		return r.ExplainContext(prompt, instructions, frontMatter)
+	}
+
+	if r.args.RenderOnly {
+		rendered := FormatConversation(prompt, frontMatter)
+		if r.args.Output != "" {
+			return os.WriteFile(r.args.Output, []byte(rendered), 0644)
+		}
+		_, err := fmt.Fprint(os.Stdout, rendered)
+		return err
+	}
+
+	err = r.checkRequirements(frontMatter)
+	if err != nil {
+		return err
+	}
+
+	if r.args.DryRun {
+		return r.PrintRequest(prompt, frontMatter)
+	}
 
 	if r.args.PrintPrompt {
-		fmt.Println(prompt)
-		err := clipboard.WriteAll(prompt)
+		rendered := FormatConversation(prompt, frontMatter)
+		fmt.Println(rendered)
+
+		if r.args.Output != "" {
+			err := os.WriteFile(r.args.Output, []byte(rendered), 0644)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("[written to %s]\n", fileLink(r.args.Output))
+		}
+
+		if !r.args.NoClipboard {
+			err := clipboard.WriteAll(rendered)
+			if err != nil {
+				return err
+			}
+			fmt.Println("[copied to clipboard]")
+		}
+
+		model := r.Model(frontMatter)
+		n, err := tokens.Count(model, prompt)
 		if err != nil {
 			return err
 		}
-		fmt.Println("[copied to clipboard]")
+		fmt.Fprintf(os.Stderr, "[%d tokens for %s]\n", n, model)
 		return nil
 	}
 
+	// check the filters before the request is sent, rather than when the response arrives
+	_, err = r.outputFilters()
+	if err != nil {
+		return err
+	}
+	err = checkPostprocess(frontMatter)
+	if err != nil {
+		return err
+	}
+
+	start = time.Now()
+	err = r.RunHooks(HookBeforeRun, nil)
+	if err != nil {
+		return err
+	}
+	r.stats.Time("before_run hooks", start)
+
+	start = time.Now()
+	defer r.stats.Time("completion", start)
+
+	if next := r.nextPrompts(frontMatter); len(next) > 0 {
+		return r.RunChain(prompt, frontMatter, next)
+	}
+
+	if r.streamedInput != nil {
+		defer r.streamedInput.Close()
+		return r.RunChunked(frontMatter)
+	}
+
+	if frontMatter.Chunk != "" {
+		fits, err := r.fitsContext(prompt, frontMatter)
+		if err != nil {
+			return err
+		}
+		if !fits {
+			return r.RunChunked(frontMatter)
+		}
+	}
+
+	if r.args.Confidence && r.args.EscalateModel != "" {
+		return r.RunEscalating(prompt, frontMatter)
+	}
+
+	if frontMatter.ResponseFormat != "" && frontMatter.ResponseFormat != ResponseFormatJSON {
+		return fmt.Errorf("response_format must be %s, got %q", ResponseFormatJSON, frontMatter.ResponseFormat)
+	}
+
+	if frontMatter.OpenAPI != nil {
+		tools, err := r.openAPITools(frontMatter.OpenAPI)
+		if err != nil {
+			return err
+		}
+		frontMatter.Tools = append(frontMatter.Tools, tools...)
+	}
+
+	if len(frontMatter.Tools) > 0 {
+		return r.RunTools(prompt, frontMatter)
+	}
+
+	if frontMatter.ResponseFormat == ResponseFormatJSON {
+		response, err := r.completeJSON(frontMatter, prompt)
+		if err != nil {
+			return err
+		}
+
+		output := postprocess(strings.TrimSpace(response)+"\n", frontMatter)
+		err = r.WriteOutput(strings.NewReader(output))
+		if err != nil {
+			return err
+		}
+
+		return r.FinishCompletion(prompt, response)
+	}
+
+	if r.args.Patch {
+		return r.RunPatch(prompt, frontMatter)
+	}
+
+	if r.args.Edit {
+		return r.RunEdits(prompt, frontMatter)
+	}
+
+	if r.args.NoStream || len(frontMatter.Postprocess) > 0 || r.args.ExtractCode != "" {
+		return r.RunNoStream(prompt, frontMatter)
+	}
+
 	stream, err := r.OutputStream(prompt, frontMatter)
 	if err != nil {
 		return err
 	}
 	defer stream.Close()
 
+	var response bytes.Buffer
+	err = r.WriteOutput(io.TeeReader(stream, &response))
+	if err != nil {
+		return err
+	}
+
+	return r.FinishCompletion(prompt, response.String())
+}
+
+// PrintRequest prints the request that would be sent for the prompt, after the config, frontmatter and
+// flags are combined
+func (r *Runner) PrintRequest(prompt string, frontMatter *TemplateFrontMatter) error {
+	req := r.chat.Request(prompt, frontMatter)
+	req.Stream = true
+
+	data, err := json.MarshalIndent(req, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Printf("%s\n", data)
+	return err
+}
+
+// FinishCompletion runs the steps that need the whole response, after it has been written out
+func (r *Runner) FinishCompletion(prompt string, response string) error {
+	r.stats.Completed(prompt, response)
+
+	err := r.SaveSession(prompt, response)
+	if err != nil {
+		return err
+	}
+
+	err = r.RecordRun(prompt, response)
+	if err != nil {
+		return err
+	}
+
+	err = r.WriteMessages(prompt, response)
+	if err != nil {
+		return err
+	}
+
+	err = r.captureMemory(response)
+	if err != nil {
+		return err
+	}
+
+	if r.args.Confidence {
+		return r.CheckConfidence(response)
+	}
+
+	return nil
+}
+
+// OutputFile returns the file the response is written to. Empty for stdout.
+func (r *Runner) OutputFile() string {
 	outputFile := r.args.OutputFile
 	if r.args.ReplaceInputFile && outputFile == "" {
 		outputFile = r.args.InputFile
 	}
+	return outputFile
+}
+
+// WriteOutput writes the response stream to stdout, or to the output file, through the output filters
+func (r *Runner) WriteOutput(stream io.Reader) error {
+	filters, err := r.outputFilters()
+	if err != nil {
+		return err
+	}
+	stream = streamfilter.Chain(stream, filters...)
+
+	if r.args.Sink != "" {
+		return WriteToSink(r.args.Sink, stream)
+	}
 
+	outputFile := r.OutputFile()
 	if outputFile == "" {
-		_, err = io.Copy(os.Stdout, stream)
+		if r.renderMarkdown() {
+			stream = streamfilter.Markdown()(stream)
+		}
+		_, err := io.Copy(os.Stdout, stream)
 		return err
 	}
 
@@ -359,68 +1259,209 @@ func (r *Runner) Run() error {
 
 var ErrNotFound = errors.New("no template found")
 
-// MatchNameInPaths returns the first file that exactly matches "name" in the list of paths
+// MatchNameInPaths returns the first file named "name", or "name.md", in the list of paths. Missing
+// paths are skipped.
 func MatchNameInPaths(paths []string, name string) (matchedFile string, err error) {
 	if name == "" {
 		return "", errors.New("name cannot be empty")
 	}
 
 	for _, path := range paths {
-		err := filepath.WalkDir(path, func(curPath string, d fs.DirEntry, err error) error {
+		for _, candidate := range []string{name, name + ".md"} {
+			file := filepath.Join(path, candidate)
+			info, err := os.Stat(file)
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
 			if err != nil {
-				return err
+				return "", err
 			}
 
-			log.Println("match", curPath, d.Name())
-
-			if curPath == path {
-				// continue walking
-				return nil
+			if !info.IsDir() {
+				return file, nil
 			}
+		}
+	}
+	return "", fmt.Errorf("%w: %s", ErrNotFound, name)
+}
 
-			if d.IsDir() {
-				return filepath.SkipDir
-			}
+// commands are subcommands, dispatched on the first argument. Anything else runs a prompt.
+var commands = map[string]func(args []string) error{
+	"batch":            runBatch,
+	"bench":            runBench,
+	"chain":            runChain,
+	"chat":             runChat,
+	"commit":           runCommit,
+	"diffdocs":         runDiffDocs,
+	"digest":           runDigest,
+	"feedback":         runFeedback,
+	"http":             runHTTP,
+	"logsum":           runLogSum,
+	"note":             runNote,
+	"prompts":          runPrompts,
+	"proxy":            runProxy,
+	"recur":            runRecur,
+	"restore-snapshot": runRestoreSnapshot,
+	"review":           runReview,
+	"sql":              runSQL,
+	"tfplan":           runTFPlan,
+	"usage":            runUsage,
+}
 
-			if dname := d.Name(); dname == name {
-				matchedFile = curPath
-				return filepath.SkipAll
-			}
+// parseArgs parses the arguments of a subcommand. Like arg.MustParse, it exits on --help and errors.
+func parseArgs(program string, dest any, args []string) {
+	p, err := arg.NewParser(arg.Config{Program: program}, dest)
+	if err != nil {
+		log.Fatalln(err)
+	}
 
-			return nil
-		})
+	err = p.Parse(args)
+	if errors.Is(err, arg.ErrHelp) {
+		p.WriteHelp(os.Stdout)
+		os.Exit(0)
+	}
+	if err != nil {
+		p.Fail(err.Error())
+	}
+}
 
-		if err != nil {
-			return "", err
-		}
+// NewRunner sets up the chat client and template paths from the config files
+func NewRunner(args Args) (*Runner, error) {
+	config, err := LoadConfig()
+	if err != nil {
+		return nil, err
+	}
 
-		if matchedFile != "" {
-			return matchedFile, nil
-		}
+	// recur runs NewRunner once per due template, so the globals are set rather than added to
+	frontMatterOptions = nil
+	if len(config.FrontmatterDelimiters) > 0 {
+		frontMatterOptions = []promptstr.ParseOption{promptstr.WithDelimiters(config.FrontmatterDelimiters...)}
+	}
+	if config.Locale != "" {
+		templateLocale = locale.Parse(config.Locale)
+	}
+
+	config.AllowProject(args.AllowExec)
+	profilePath, err = expandHome(config.Profile)
+	if err != nil {
+		return nil, err
+	}
+
+	allowExec = args.AllowExec
+	// the thresholds act on the stated confidence, so they ask for it
+	if args.MinConfidence > 0 || args.EscalateModel != "" {
+		args.Confidence = true
+	}
+	if args.ProfileRender {
+		includeProfile = newRenderProfile()
+	}
+
+	mergeString(&config.K8s.Since, args.Since)
+	if args.RPM != 0 {
+		config.RateLimit.RPM = args.RPM
+	}
+	if args.TPM != 0 {
+		config.RateLimit.TPM = args.TPM
+	}
+	if args.Concurrency != 0 {
+		config.RateLimit.Concurrency = args.Concurrency
+	}
+
+	// plugins are registered last, so they can override builtin loaders
+	RegisterBuiltinLoaders(config)
+
+	err = RegisterPlugins(config.Plugins)
+	if err != nil {
+		return nil, err
+	}
+
+	clientConfig := openai.DefaultConfig(config.APIKey())
+	if config.BaseURL != "" {
+		clientConfig.BaseURL = config.BaseURL
+	}
+	if config.Azure.Enabled() {
+		clientConfig = config.Azure.ClientConfig()
+	}
+	// the go-openai client and the direct requests share the connection pool
+	transport := config.Transport.RoundTripper()
+	clientConfig.HTTPClient = config.Request.HTTPClient(transport)
+
+	c := openai.NewClientWithConfig(clientConfig)
+
+	chatOpts := []ChatOptions{SetClientConfig(clientConfig), SetDeployments(config.Azure.Deployments)}
+	if config.Model != "" {
+		chatOpts = append(chatOpts, SetModel(config.Model))
+	}
+	if config.Temperature != 0 {
+		chatOpts = append(chatOpts, SetTemperature(config.Temperature))
+	}
+	if config.MaxTokens != 0 {
+		chatOpts = append(chatOpts, SetMaxTokens(config.MaxTokens))
 	}
-	return "", ErrNotFound
+	chatOpts = append(chatOpts, SetRetries(*config.Retries), SetRateLimit(config.RateLimit))
+
+	cache, err := newResponseCache(config.Cache, args)
+	if err != nil {
+		return nil, err
+	}
+	chatOpts = append(chatOpts, SetCache(cache))
+
+	budget, err := newBudgetGuard(config.Budget, args.Force, config.NoUsageLog)
+	if err != nil {
+		return nil, err
+	}
+	chatOpts = append(chatOpts, SetBudget(budget))
+	chat := NewChat(c, chatOpts...)
+
+	templatePaths, err := TemplatePaths()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Runner{
+		args:       args,
+		chat:       chat,
+		config:     config,
+		httpClient: &http.Client{Transport: transport},
+
+		templatePaths: templatePaths,
+	}, nil
 }
 
 func run() error {
-	var args Args
-	arg.MustParse(&args)
+	if len(os.Args) > 1 {
+		if command, ok := commands[os.Args[1]]; ok {
+			return command(os.Args[2:])
+		}
+	}
 
-	c := openai.NewClient(os.Getenv("OPENAI_SECRET"))
-	chat := NewChat(c)
+	var args Args
+	parseArgs(filepath.Base(os.Args[0]), &args, withOptionalValues(os.Args[1:]))
 
-	templatePaths, err := TemplatePaths()
+	runner, err := NewRunner(args)
 	if err != nil {
 		return err
 	}
 
-	runner := &Runner{
-		args: args,
-		chat: chat,
+	ctx, cancel := runContext(args.Timeout)
+	defer cancel()
+	SetContext(ctx)(runner.chat)
 
-		templatePaths: templatePaths,
+	start := time.Now()
+	err = contextError(ctx, runner.onGitBranch(runner.runRerendering), args.Timeout)
+	runner.RunAfterHooks(err, time.Since(start))
+	if err != nil {
+		return err
+	}
+
+	if includeProfile != nil {
+		err = includeProfile.Print()
+		if err != nil {
+			return err
+		}
 	}
 
-	return runner.Run()
+	return runner.PrintStats(time.Since(start))
 }
 
 func main() {
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+var sizeUnits = []struct {
+	suffix string
+	bytes  int64
+}{
+	{"GB", 1 << 30},
+	{"G", 1 << 30},
+	{"MB", 1 << 20},
+	{"M", 1 << 20},
+	{"KB", 1 << 10},
+	{"K", 1 << 10},
+	{"B", 1},
+}
+
+// parseSize parses a size in bytes, like 512MB or 2G. Units are powers of 1024.
+func parseSize(size string) (int64, error) {
+	s := strings.ToUpper(strings.TrimSpace(size))
+	multiplier := int64(1)
+	for _, unit := range sizeUnits {
+		if number, ok := strings.CutSuffix(s, unit.suffix); ok {
+			s = strings.TrimSpace(number)
+			multiplier = unit.bytes
+			break
+		}
+	}
+
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n < 0 || math.IsNaN(n) {
+		return 0, fmt.Errorf("invalid size %q, expected e.g. 512MB", size)
+	}
+
+	// float64(math.MaxInt64) rounds up to 2^63, which doesn't fit
+	total := n * float64(multiplier)
+	if total >= math.MaxInt64 {
+		return 0, fmt.Errorf("size %q is too large", size)
+	}
+	return int64(total), nil
+}
+
+// maxMemory returns the most input that is loaded into memory, from --max-memory or the config. 0 is
+// no limit.
+func (r *Runner) maxMemory() (int64, error) {
+	size := r.config.MaxMemory
+	mergeString(&size, r.args.MaxMemory)
+	if size == "" {
+		return 0, nil
+	}
+	return parseSize(size)
+}
+
+// readInput reads the input from the file, or stdin if empty. Input over the memory limit is set
+// aside to be streamed through the chunker if chunking, or else is an error.
+func (r *Runner) readInput(inputFile string) (string, error) {
+	limit, err := r.maxMemory()
+	if err != nil {
+		return "", err
+	}
+
+	source := os.Stdin
+	var size int64 = -1
+	if inputFile != "" {
+		source, err = os.Open(inputFile)
+		if err != nil {
+			return "", err
+		}
+
+		info, err := source.Stat()
+		if err != nil {
+			source.Close()
+			return "", err
+		}
+		size = info.Size()
+	}
+
+	if limit == 0 || (size >= 0 && size <= limit) {
+		defer source.Close()
+
+		var input strings.Builder
+		if size > 0 {
+			// read straight into the string, without a copy of the input in a []byte
+			input.Grow(int(size))
+		}
+		_, err = io.Copy(&input, source)
+		return input.String(), err
+	}
+
+	// read one byte past the limit, to tell whether the input is within it
+	var head bytes.Buffer
+	n, err := io.CopyN(&head, source, limit+1)
+	if err != nil && err != io.EOF {
+		source.Close()
+		return "", err
+	}
+	if n <= limit {
+		source.Close()
+		return head.String(), nil
+	}
+
+	if !r.chunking {
+		source.Close()
+		return "", fmt.Errorf("the input is larger than --max-memory (%s). Use --chunk to process it in chunks", r.maxMemoryFlag())
+	}
+
+	fmt.Fprintf(os.Stderr, "[input is over %s, streaming it in chunks]\n", r.maxMemoryFlag())
+	r.streamedInput = &streamedInput{Reader: io.MultiReader(&head, source), source: source}
+	return "", nil
+}
+
+func (r *Runner) maxMemoryFlag() string {
+	if r.args.MaxMemory != "" {
+		return r.args.MaxMemory
+	}
+	return r.config.MaxMemory
+}
+
+// streamedInput is input too large for memory, read as the chunks are completed
+type streamedInput struct {
+	io.Reader
+	source io.Closer
+	// read counts the bytes read
+	read int
+}
+
+func (s *streamedInput) Read(p []byte) (int, error) {
+	n, err := s.Reader.Read(p)
+	s.read += n
+	return n, err
+}
+
+func (s *streamedInput) Close() error {
+	return s.source.Close()
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSize(t *testing.T) {
+	testCases := []struct {
+		size     string
+		expected int64
+		err      string
+	}{
+		{size: "512", expected: 512},
+		{size: "512B", expected: 512},
+		{size: "1K", expected: 1024},
+		{size: "2kb", expected: 2048},
+		{size: "512MB", expected: 512 << 20},
+		{size: " 1.5 G ", expected: 3 << 29},
+		{size: "0", expected: 0},
+		{size: "8388607TB", err: `invalid size "8388607TB", expected e.g. 512MB`},
+		{size: "10XB", err: `invalid size "10XB", expected e.g. 512MB`},
+		{size: "MB", err: `invalid size "MB", expected e.g. 512MB`},
+		{size: "", err: `invalid size "", expected e.g. 512MB`},
+		{size: "-1G", err: `invalid size "-1G", expected e.g. 512MB`},
+		{size: "NaN", err: `invalid size "NaN", expected e.g. 512MB`},
+		{size: "8589934592G", err: `size "8589934592G" is too large`},
+		{size: "1e30", err: `size "1e30" is too large`},
+		{size: "Inf", err: `size "Inf" is too large`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.size, func(t *testing.T) {
+			n, err := parseSize(tc.size)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, n)
+		})
+	}
+}
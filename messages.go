@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// ReadMessages reads a JSON array of OpenAI chat messages
+func ReadMessages(file string) ([]openai.ChatCompletionMessage, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var messages []openai.ChatCompletionMessage
+	err = json.Unmarshal(data, &messages)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+
+	for i, message := range messages {
+		switch message.Role {
+		case openai.ChatMessageRoleSystem, openai.ChatMessageRoleUser, openai.ChatMessageRoleAssistant:
+		default:
+			return nil, fmt.Errorf("%s: message %d has unknown role %q", file, i, message.Role)
+		}
+	}
+
+	return messages, nil
+}
+
+// LoadMessages adds the messages of --messages-in to the conversation
+func (r *Runner) LoadMessages(fm *TemplateFrontMatter) error {
+	if r.args.MessagesIn == "" {
+		return nil
+	}
+
+	messages, err := ReadMessages(r.args.MessagesIn)
+	if err != nil {
+		return err
+	}
+
+	fm.Messages = append(fm.Messages, messages...)
+	return nil
+}
+
+// WriteMessages writes the messages that were sent, and the reply, to --messages-out
+func (r *Runner) WriteMessages(prompt string, response string) error {
+	if r.args.MessagesOut == "" {
+		return nil
+	}
+
+	messages := append(r.chat.Request(prompt, r.frontMatter).Messages, openai.ChatCompletionMessage{
+		Role:    openai.ChatMessageRoleAssistant,
+		Content: response,
+	})
+
+	data, err := json.MarshalIndent(messages, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	wroteFile(r.args.MessagesOut)
+	return os.WriteFile(r.args.MessagesOut, append(data, '\n'), 0644)
+}
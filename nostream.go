@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// RunNoStream collects the whole completion before writing it, so it can be cleaned up as a whole: by
+// --extract-code, by --no-stream, then by the postprocess steps of the frontmatter
+func (r *Runner) RunNoStream(prompt string, fm *TemplateFrontMatter) error {
+	response, err := r.complete(fm, prompt)
+	if err != nil {
+		return err
+	}
+
+	output := response
+	if r.args.ExtractCode != "" {
+		output, err = r.extractResponseCode(output)
+		if err != nil {
+			return err
+		}
+	}
+	if r.args.NoStream {
+		output, err = r.cleanResponse(response)
+		if err != nil {
+			return err
+		}
+	}
+	output = postprocess(output, fm)
+
+	err = r.WriteOutput(strings.NewReader(output))
+	if err != nil {
+		return err
+	}
+
+	return r.FinishCompletion(prompt, response)
+}
+
+// cleanResponse removes trailing whitespace, and ends the response with a single newline. Responses
+// written to files are taken out of a code fence around them, and must parse if the file is JSON.
+func (r *Runner) cleanResponse(response string) (string, error) {
+	outputFile := r.OutputFile()
+	if outputFile != "" {
+		response = stripCodeFence(response)
+	}
+
+	response = trimTrailingWhitespace(strings.TrimSpace(response)) + "\n"
+
+	if strings.EqualFold(filepath.Ext(outputFile), ".json") && !json.Valid([]byte(response)) {
+		return "", fmt.Errorf("the response is not valid JSON, %s is unchanged", outputFile)
+	}
+
+	return response, nil
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// NoteConfig configures pls note
+type NoteConfig struct {
+	// RecordCommand records audio into $PLS_AUDIO_FILE until interrupted with Ctrl-C
+	RecordCommand string `yaml:"record_command"`
+	// Template cleans up the transcript, given as {{.Input}}. The raw transcript is kept if empty.
+	Template string `yaml:"template"`
+	// File is the notes file that notes are appended to
+	File string `yaml:"file"`
+	// Language of the audio, as an ISO-639-1 code. Detected if empty.
+	Language string `yaml:"language"`
+}
+
+type NoteArgs struct {
+	AudioFile string `arg:"positional" help:"audio file to transcribe"`
+	Record    bool   `arg:"--record" help:"record from the microphone until Ctrl-C"`
+	Template  string `arg:"-t,--template" help:"template that cleans up the transcript, overrides the config"`
+	Notes     string `arg:"--notes" help:"notes file to append to, overrides the config"`
+	Language  string `arg:"--language" help:"language of the audio, as an ISO-639-1 code"`
+}
+
+func runNote(argv []string) error {
+	var args NoteArgs
+	parseArgs("pls note", &args, argv)
+
+	if args.AudioFile == "" && !args.Record {
+		return errors.New("give an audio file, or --record")
+	}
+
+	r, err := NewRunner(Args{})
+	if err != nil {
+		return err
+	}
+
+	config := r.config.Note
+	mergeString(&config.Template, args.Template)
+	mergeString(&config.File, args.Notes)
+	mergeString(&config.Language, args.Language)
+
+	audioFile := args.AudioFile
+	if args.Record {
+		audioFile, err = RecordAudio(config.RecordCommand)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "[recorded %s]\n", fileLink(audioFile))
+	}
+
+	transcript, err := r.chat.client.CreateTranscription(context.Background(), openai.AudioRequest{
+		Model:    openai.Whisper1,
+		FilePath: audioFile,
+		Language: config.Language,
+	})
+	if err != nil {
+		return err
+	}
+
+	note := transcript.Text
+	if config.Template != "" {
+		note, err = r.transformNote(config.Template, transcript.Text)
+		if err != nil {
+			return err
+		}
+	}
+
+	notesFile, err := expandHome(config.File)
+	if err != nil {
+		return err
+	}
+
+	return AppendNote(notesFile, note)
+}
+
+// RecordAudio runs the record command into a temporary wav file. Ctrl-C stops the recording
+// rather than pls.
+func RecordAudio(command string) (string, error) {
+	f, err := os.CreateTemp("", "pls-note-*.wav")
+	if err != nil {
+		return "", err
+	}
+	f.Close()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt)
+	defer signal.Stop(signals)
+
+	fmt.Fprintln(os.Stderr, "[recording, press Ctrl-C to stop]")
+
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(), "PLS_AUDIO_FILE="+f.Name())
+
+	err = cmd.Run()
+
+	// the recorder exits with an error when interrupted, which is how recording normally ends
+	select {
+	case <-signals:
+		err = nil
+	default:
+	}
+	if err != nil {
+		return "", fmt.Errorf("record command: %w", err)
+	}
+
+	info, err := os.Stat(f.Name())
+	if err != nil {
+		return "", err
+	}
+	if info.Size() == 0 {
+		return "", errors.New("nothing was recorded")
+	}
+
+	return f.Name(), nil
+}
+
+func (r *Runner) transformNote(templateName string, transcript string) (string, error) {
+	r.args.PromptFile = templateName
+
+	template, err := r.ReadTemplate()
+	if err != nil {
+		return "", err
+	}
+
+	prompt, fm, err := RenderTemplate(template, TemplateData{Input: transcript})
+	if err != nil {
+		return "", err
+	}
+	r.frontMatter = fm
+
+	return r.complete(fm, prompt)
+}
+
+// AppendNote appends the note to the notes file under a timestamp heading
+func AppendNote(notesFile string, note string) error {
+	err := os.MkdirAll(filepath.Dir(notesFile), 0755)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(notesFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	entry := fmt.Sprintf("\n## %s\n\n%s\n", time.Now().Format("2006-01-02 15:04"), strings.TrimSpace(note))
+
+	_, err = io.WriteString(f, entry)
+	if err != nil {
+		return err
+	}
+
+	fmt.Print(entry)
+	fmt.Fprintf(os.Stderr, "[appended to %s]\n", fileLink(notesFile))
+	return nil
+}
+
+// expandHome replaces a leading ~ with the home directory
+func expandHome(p string) (string, error) {
+	if p != "~" && !strings.HasPrefix(p, "~/") {
+		return p, nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, strings.TrimPrefix(p, "~")), nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+const ocrInstruction = "Transcribe all the text in this image, preserving its layout as plain text. Output only the transcribed text."
+
+// OCRConfig configures how --ocr extracts text from images
+type OCRConfig struct {
+	// Command prints the text of $PLS_IMAGE_FILE, e.g. tesseract "$PLS_IMAGE_FILE" -. The vision model is
+	// used if empty.
+	Command string `yaml:"command"`
+	// Model is the vision model that transcribes the image
+	Model string `yaml:"model"`
+}
+
+// ExtractText returns the text of the image, with the OCR command if configured, or else the vision model
+func (r *Runner) ExtractText(imageFile string) (string, error) {
+	if r.config.OCR.Command != "" {
+		return runOCRCommand(r.config.OCR.Command, imageFile)
+	}
+
+	return r.transcribeImage(imageFile)
+}
+
+func runOCRCommand(command string, imageFile string) (string, error) {
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(), "PLS_IMAGE_FILE="+imageFile)
+
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("ocr command: %w", err)
+	}
+
+	return string(out), nil
+}
+
+// transcribeImage asks the vision model for the text of the image. go-openai can't send images yet,
+// so the request is made directly, like the other completions with the run's context and usage log.
+func (r *Runner) transcribeImage(imageFile string) (string, error) {
+	image, err := os.ReadFile(imageFile)
+	if err != nil {
+		return "", err
+	}
+
+	mimeType := http.DetectContentType(image)
+	if !strings.HasPrefix(mimeType, "image/") {
+		return "", fmt.Errorf("%s: not an image (%s)", imageFile, mimeType)
+	}
+
+	model := r.config.OCR.Model
+	body := map[string]any{
+		"model":      model,
+		"max_tokens": 4096,
+		"messages": []map[string]any{
+			{
+				"role": "user",
+				"content": []map[string]any{
+					{"type": "text", "text": ocrInstruction},
+					{"type": "image_url", "image_url": map[string]string{
+						"url": "data:" + mimeType + ";base64," + base64.StdEncoding.EncodeToString(image),
+					}},
+				},
+			},
+		},
+	}
+
+	var completion struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	err = r.postCompletion(model, body, &completion)
+	if err != nil {
+		return "", fmt.Errorf("ocr: %w", err)
+	}
+
+	if len(completion.Choices) == 0 {
+		return "", errors.New("ocr: no text returned")
+	}
+
+	return completion.Choices[0].Message.Content, nil
+}
@@ -0,0 +1,213 @@
+// Package openapi reads the operations of OpenAPI 3 specs, in JSON or YAML, with their local $refs
+// resolved.
+package openapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/hayeah/pls/jsonschema"
+)
+
+// Spec is the part of an OpenAPI spec that describes its operations
+type Spec struct {
+	Title string
+	// Servers are the base URLs of the API
+	Servers    []string
+	Operations []Operation
+}
+
+// Operation is a method on a path
+type Operation struct {
+	Method      string
+	Path        string
+	ID          string
+	Summary     string
+	Description string
+	Parameters  []Parameter
+	// Body is the JSON schema of the request body, nil if the operation takes none
+	Body map[string]any
+}
+
+// Parameter is a path, query or header parameter
+type Parameter struct {
+	Name        string
+	In          string
+	Required    bool
+	Description string
+	Schema      map[string]any
+}
+
+var methods = []string{"get", "put", "post", "delete", "options", "head", "patch", "trace"}
+
+// maxRefDepth stops the resolution of recursive schemas
+const maxRefDepth = 8
+
+// Parse reads a spec in JSON or YAML. Operations are sorted by path, then method.
+func Parse(data []byte) (*Spec, error) {
+	var raw any
+	err := yaml.Unmarshal(data, &raw)
+	if err != nil {
+		return nil, fmt.Errorf("openapi: %w", err)
+	}
+	doc, ok := jsonschema.Normalize(raw).(map[string]any)
+	if !ok {
+		return nil, errors.New("openapi: the spec is not an object")
+	}
+	if _, ok := doc["paths"]; !ok {
+		return nil, errors.New("openapi: the spec has no paths")
+	}
+
+	spec := &Spec{}
+	if info, ok := doc["info"].(map[string]any); ok {
+		spec.Title, _ = info["title"].(string)
+	}
+	for _, server := range list(doc["servers"]) {
+		if url, ok := object(server)["url"].(string); ok {
+			spec.Servers = append(spec.Servers, url)
+		}
+	}
+
+	paths := object(doc["paths"])
+	var names []string
+	for name := range paths {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, path := range names {
+		item := object(resolve(doc, paths[path], 0))
+		shared := list(item["parameters"])
+
+		for _, method := range methods {
+			op, ok := item[method].(map[string]any)
+			if !ok {
+				continue
+			}
+
+			operation := Operation{Method: strings.ToUpper(method), Path: path}
+			operation.ID, _ = op["operationId"].(string)
+			operation.Summary, _ = op["summary"].(string)
+			operation.Description, _ = op["description"].(string)
+
+			for _, p := range append(append([]any(nil), shared...), list(op["parameters"])...) {
+				p := object(resolve(doc, p, 0))
+				param := Parameter{Schema: object(resolve(doc, p["schema"], 0))}
+				param.Name, _ = p["name"].(string)
+				param.In, _ = p["in"].(string)
+				param.Required, _ = p["required"].(bool)
+				param.Description, _ = p["description"].(string)
+				operation.Parameters = append(operation.Parameters, param)
+			}
+
+			body := object(resolve(doc, op["requestBody"], 0))
+			content := object(body["content"])
+			for _, mediaType := range []string{"application/json", "application/x-www-form-urlencoded"} {
+				if media, ok := content[mediaType].(map[string]any); ok {
+					operation.Body = object(resolve(doc, media["schema"], 0))
+					break
+				}
+			}
+
+			spec.Operations = append(spec.Operations, operation)
+		}
+	}
+
+	return spec, nil
+}
+
+// resolve replaces the local $refs in the value, like #/components/schemas/Order, with what they point
+// to. Refs deeper than maxRefDepth are left as they are.
+func resolve(doc map[string]any, value any, depth int) any {
+	switch v := value.(type) {
+	case map[string]any:
+		if ref, ok := v["$ref"].(string); ok && strings.HasPrefix(ref, "#/") && depth < maxRefDepth {
+			var target any = doc
+			for _, part := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+				part = strings.ReplaceAll(strings.ReplaceAll(part, "~1", "/"), "~0", "~")
+				target = object(target)[part]
+			}
+			return resolve(doc, target, depth+1)
+		}
+
+		resolved := make(map[string]any, len(v))
+		for key, item := range v {
+			resolved[key] = resolve(doc, item, depth)
+		}
+		return resolved
+
+	case []any:
+		resolved := make([]any, len(v))
+		for i, item := range v {
+			resolved[i] = resolve(doc, item, depth)
+		}
+		return resolved
+	}
+	return value
+}
+
+func object(value any) map[string]any {
+	m, _ := value.(map[string]any)
+	return m
+}
+
+func list(value any) []any {
+	l, _ := value.([]any)
+	return l
+}
+
+// Summary lists the operations compactly, for a prompt:
+//
+//	GET /orders - List orders
+//	  query limit (integer): how many orders to return
+//	  body: {"type":"object",...}
+func (s *Spec) Summary() string {
+	var b strings.Builder
+	if s.Title != "" {
+		fmt.Fprintf(&b, "API: %s\n", s.Title)
+	}
+	for _, server := range s.Servers {
+		fmt.Fprintf(&b, "Server: %s\n", server)
+	}
+	if b.Len() > 0 {
+		b.WriteString("\n")
+	}
+
+	for _, op := range s.Operations {
+		fmt.Fprintf(&b, "%s %s", op.Method, op.Path)
+		if summary := op.Summary; summary != "" || op.Description != "" {
+			if summary == "" {
+				summary, _, _ = strings.Cut(op.Description, "\n")
+			}
+			fmt.Fprintf(&b, " - %s", summary)
+		}
+		b.WriteString("\n")
+
+		for _, p := range op.Parameters {
+			fmt.Fprintf(&b, "  %s %s", p.In, p.Name)
+			if t, ok := p.Schema["type"].(string); ok {
+				fmt.Fprintf(&b, " (%s)", t)
+			}
+			if p.Required {
+				b.WriteString(" required")
+			}
+			if p.Description != "" {
+				fmt.Fprintf(&b, ": %s", p.Description)
+			}
+			b.WriteString("\n")
+		}
+
+		if op.Body != nil {
+			schema, err := json.Marshal(op.Body)
+			if err == nil {
+				fmt.Fprintf(&b, "  body: %s\n", schema)
+			}
+		}
+	}
+	return b.String()
+}
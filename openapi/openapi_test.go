@@ -0,0 +1,100 @@
+package openapi
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testSpec = `
+openapi: 3.0.0
+info:
+  title: Shop
+servers:
+  - url: https://api.example.com/v1
+paths:
+  /orders:
+    get:
+      operationId: listOrders
+      summary: List orders
+      parameters:
+        - $ref: "#/components/parameters/Limit"
+        - name: status
+          in: query
+          schema: {type: string, enum: [open, shipped]}
+    post:
+      operationId: createOrder
+      description: |
+        Create an order.
+        It's charged right away.
+      requestBody:
+        content:
+          application/json:
+            schema: {$ref: "#/components/schemas/Order"}
+  /orders/{id}:
+    parameters:
+      - {name: id, in: path, required: true, schema: {type: string}}
+    delete:
+      operationId: deleteOrder
+components:
+  parameters:
+    Limit: {name: limit, in: query, description: how many to return, schema: {type: integer}}
+  schemas:
+    Order:
+      type: object
+      required: [item]
+      properties:
+        item: {type: string}
+`
+
+func TestParse(t *testing.T) {
+	spec, err := Parse([]byte(testSpec))
+	assert.NoError(t, err)
+
+	assert.Equal(t, "Shop", spec.Title)
+	assert.Equal(t, []string{"https://api.example.com/v1"}, spec.Servers)
+
+	assert.Len(t, spec.Operations, 3)
+	list := spec.Operations[0]
+	assert.Equal(t, "GET", list.Method)
+	assert.Equal(t, "listOrders", list.ID)
+	assert.Equal(t, []Parameter{
+		{Name: "limit", In: "query", Description: "how many to return", Schema: map[string]any{"type": "integer"}},
+		{Name: "status", In: "query", Schema: map[string]any{"type": "string", "enum": []any{"open", "shipped"}}},
+	}, list.Parameters)
+
+	create := spec.Operations[1]
+	assert.Equal(t, "POST", create.Method)
+	assert.Equal(t, map[string]any{
+		"type":       "object",
+		"required":   []any{"item"},
+		"properties": map[string]any{"item": map[string]any{"type": "string"}},
+	}, create.Body)
+
+	remove := spec.Operations[2]
+	assert.Equal(t, "DELETE /orders/{id}", remove.Method+" "+remove.Path)
+	assert.Equal(t, "id", remove.Parameters[0].Name)
+	assert.True(t, remove.Parameters[0].Required)
+}
+
+func TestSummary(t *testing.T) {
+	spec, err := Parse([]byte(testSpec))
+	assert.NoError(t, err)
+
+	assert.Equal(t, `API: Shop
+Server: https://api.example.com/v1
+
+GET /orders - List orders
+  query limit (integer): how many to return
+  query status (string)
+POST /orders - Create an order.
+  body: {"properties":{"item":{"type":"string"}},"required":["item"],"type":"object"}
+DELETE /orders/{id}
+  path id (string) required
+`, spec.Summary())
+}
+
+func TestParseNotASpec(t *testing.T) {
+	_, err := Parse([]byte(`{"hello": "world"}`))
+	assert.EqualError(t, err, "openapi: the spec has no paths")
+}
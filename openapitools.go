@@ -0,0 +1,275 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/hayeah/pls/openapi"
+)
+
+const (
+	// ConfirmWrites asks before calls that aren't GET or HEAD, the default
+	ConfirmWrites = "writes"
+	// ConfirmAlways asks before every call
+	ConfirmAlways = "always"
+	// ConfirmNever calls without asking
+	ConfirmNever = "never"
+)
+
+// maxToolResponse is the most of a response body that is sent back to the model
+const maxToolResponse = 16 << 10
+
+// OpenAPITools exposes the operations of an OpenAPI spec as tools, declared in the frontmatter:
+//
+//	---
+//	openapi:
+//	  spec: ~/specs/orders.yaml
+//	  operations: [listOrders, getOrder]
+//	---
+type OpenAPITools struct {
+	// Spec is the OpenAPI spec, as a file or an http(s) URL
+	Spec string `json:"spec"`
+	// BaseURL is the URL that paths are relative to, the first server of the spec by default
+	BaseURL string `json:"base_url" yaml:"base_url"`
+	// Operations are the operationIds exposed as tools. Every operation is exposed if empty.
+	Operations []string `json:"operations"`
+	// Confirm is when calls are confirmed on the terminal: writes (the default), always or never
+	Confirm string `json:"confirm"`
+	// Headers are sent with every call, after the api.headers of the config. Environment variables
+	// are expanded.
+	Headers map[string]string `json:"headers"`
+}
+
+// toolOperation is the operation a generated tool calls
+type toolOperation struct {
+	openapi.Operation
+	baseURL string
+	headers map[string]string
+	confirm string
+}
+
+var toolNameInvalid = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+// openAPITools returns the tools for the allowed operations of the spec of the frontmatter
+func (r *Runner) openAPITools(api *OpenAPITools) ([]Tool, error) {
+	if api.Spec == "" {
+		return nil, fmt.Errorf("openapi: spec is required")
+	}
+
+	confirm := api.Confirm
+	if confirm == "" {
+		confirm = ConfirmWrites
+	}
+	if confirm != ConfirmWrites && confirm != ConfirmAlways && confirm != ConfirmNever {
+		return nil, fmt.Errorf("openapi: confirm must be %s, %s or %s, got %q", ConfirmWrites, ConfirmAlways, ConfirmNever, confirm)
+	}
+
+	spec, err := r.loadSpec(api.Spec)
+	if err != nil {
+		return nil, err
+	}
+
+	baseURL := api.BaseURL
+	if baseURL == "" && len(spec.Servers) > 0 {
+		baseURL = spec.Servers[0]
+	}
+	if baseURL == "" {
+		return nil, fmt.Errorf("openapi: %s has no servers, set base_url", api.Spec)
+	}
+
+	allowed := map[string]bool{}
+	for _, id := range api.Operations {
+		allowed[id] = true
+	}
+
+	var tools []Tool
+	for _, op := range spec.Operations {
+		if len(allowed) > 0 && !allowed[op.ID] {
+			continue
+		}
+		delete(allowed, op.ID)
+
+		name := op.ID
+		if name == "" {
+			name = strings.ToLower(op.Method) + "_" + op.Path
+		}
+		name = strings.Trim(toolNameInvalid.ReplaceAllString(name, "_"), "_")
+		if len(name) > 64 {
+			name = name[:64]
+		}
+
+		description := op.Summary
+		if op.Description != "" {
+			description = strings.TrimSpace(description + "\n" + op.Description)
+		}
+
+		tools = append(tools, Tool{
+			Name:        name,
+			Description: strings.TrimSpace(op.Method + " " + op.Path + ". " + description),
+			Parameters:  operationParameters(op),
+			operation: &toolOperation{
+				Operation: op,
+				baseURL:   baseURL,
+				headers:   mergeMap(r.config.API.Headers, api.Headers),
+				confirm:   confirm,
+			},
+		})
+	}
+
+	for _, id := range api.Operations {
+		if allowed[id] {
+			return nil, fmt.Errorf("openapi: %s has no operation %q", api.Spec, id)
+		}
+	}
+	return tools, nil
+}
+
+// operationParameters is the JSON schema of the arguments of the operation: its parameters by name,
+// and its request body as "body"
+func operationParameters(op openapi.Operation) map[string]any {
+	properties := map[string]any{}
+	var required []any
+	for _, p := range op.Parameters {
+		schema := map[string]any{"type": "string"}
+		if p.Schema != nil {
+			schema = copySchema(p.Schema)
+		}
+		if p.Description != "" {
+			schema["description"] = p.Description
+		}
+		properties[p.Name] = schema
+		if p.Required {
+			required = append(required, p.Name)
+		}
+	}
+
+	if op.Body != nil {
+		properties["body"] = op.Body
+		required = append(required, "body")
+	}
+
+	parameters := map[string]any{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		parameters["required"] = required
+	}
+	return parameters
+}
+
+func copySchema(schema map[string]any) map[string]any {
+	c := make(map[string]any, len(schema)+1)
+	for k, v := range schema {
+		c[k] = v
+	}
+	return c
+}
+
+// callTool runs the call, with the command of the tool or by calling its API operation
+func (r *Runner) callTool(tool *Tool, arguments string) (string, error) {
+	if tool.operation == nil {
+		return runTool(tool, arguments)
+	}
+	return r.callOperation(tool, arguments)
+}
+
+// callOperation sends the request of the call, and returns the status and body of the response
+func (r *Runner) callOperation(tool *Tool, arguments string) (string, error) {
+	op := tool.operation
+
+	var args map[string]any
+	if strings.TrimSpace(arguments) != "" {
+		err := json.Unmarshal([]byte(arguments), &args)
+		if err != nil {
+			return "", fmt.Errorf("the arguments are not a JSON object: %w", err)
+		}
+	}
+
+	path := op.Path
+	query := url.Values{}
+	header := http.Header{}
+	for _, p := range op.Parameters {
+		value, ok := args[p.Name]
+		if !ok {
+			if p.Required {
+				return "", fmt.Errorf("missing required parameter %s", p.Name)
+			}
+			continue
+		}
+
+		switch p.In {
+		case "path":
+			path = strings.ReplaceAll(path, "{"+p.Name+"}", url.PathEscape(fmt.Sprint(value)))
+		case "query":
+			query.Set(p.Name, fmt.Sprint(value))
+		case "header":
+			header.Set(p.Name, fmt.Sprint(value))
+		}
+	}
+
+	u, err := url.Parse(strings.TrimSuffix(op.baseURL, "/") + path)
+	if err != nil {
+		return "", err
+	}
+	u.RawQuery = query.Encode()
+
+	var body io.Reader
+	var encoded []byte
+	if op.Body != nil && args["body"] != nil {
+		encoded, err = json.Marshal(args["body"])
+		if err != nil {
+			return "", err
+		}
+		body = bytes.NewReader(encoded)
+	}
+
+	req, err := http.NewRequest(op.Method, u.String(), body)
+	if err != nil {
+		return "", err
+	}
+	req.Header = header
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for name, value := range op.headers {
+		req.Header.Set(name, os.ExpandEnv(value))
+	}
+
+	fmt.Fprintf(os.Stderr, "[tool %s: %s %s]\n", tool.Name, req.Method, u)
+	readOnly := req.Method == http.MethodGet || req.Method == http.MethodHead
+	if op.confirm == ConfirmAlways || op.confirm == ConfirmWrites && !readOnly {
+		if encoded != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", encoded)
+		}
+		ok, err := confirm(fmt.Sprintf("call %s?", tool.Name))
+		if err != nil {
+			return "", err
+		}
+		if !ok {
+			return "the user declined this call", nil
+		}
+	}
+
+	res, err := r.httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	content, err := io.ReadAll(io.LimitReader(res.Body, maxToolResponse+1))
+	if err != nil {
+		return "", err
+	}
+
+	output := res.Status + "\n\n" + string(content)
+	if len(content) > maxToolResponse {
+		output = res.Status + "\n\n" + string(content[:maxToolResponse]) + "\n[truncated]"
+	}
+	return output, nil
+}
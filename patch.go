@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hayeah/pls/docdiff"
+)
+
+const patchInstruction = `
+
+Respond with only the changes to %s, as a unified diff: hunks with @@ headers, each with 3 lines of
+unchanged context around the changes. Don't repeat the parts of the file that don't change.`
+
+// RunPatch asks for the changes to the input file as a unified diff, and applies it to the file. The
+// diff of the changes that were applied is printed, and with --preview the file is left as it was.
+func (r *Runner) RunPatch(prompt string, fm *TemplateFrontMatter) error {
+	inputFile := r.args.InputFile
+	if inputFile == "" || inputFile == "-" {
+		return errors.New("--patch needs an input file to patch")
+	}
+
+	original, err := os.ReadFile(inputFile)
+	if err != nil {
+		return err
+	}
+
+	prompt += fmt.Sprintf(patchInstruction, filepath.Base(inputFile))
+	response, err := r.complete(fm, prompt)
+	if err != nil {
+		return err
+	}
+
+	patched, err := docdiff.Apply(string(original), response)
+	if err != nil {
+		// like patch, the rejected patch is saved as .rej
+		rejected := inputFile + ".rej"
+		writeErr := os.WriteFile(rejected, []byte(response), 0644)
+		if writeErr != nil {
+			return writeErr
+		}
+		return fmt.Errorf("%w. %s is unchanged, the patch is in %s", err, inputFile, rejected)
+	}
+
+	fmt.Print(docdiff.Diff(string(original), patched))
+
+	outputFile := r.OutputFile()
+	if outputFile == "" {
+		outputFile = inputFile
+	}
+
+	if r.args.Preview {
+		fmt.Fprintf(os.Stderr, "[preview, %s is unchanged]\n", outputFile)
+	} else {
+		err = r.ReplaceFile(strings.NewReader(patched), outputFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	return r.FinishCompletion(prompt, response)
+}
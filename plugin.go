@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Plugin is an executable that extends pls with template functions, input loaders, and output sinks.
+// pls talks to it with subcommands, exchanging JSON over stdin/stdout:
+//
+//	plugin describe                  -> {"functions": [...], "loaders": [...], "sinks": [...]}
+//	plugin function <name>           <- {"args": [...]}  -> {"result": "..."} or {"error": "..."}
+//	plugin load <scheme> <ref>       -> {"input": "...", "data": {...}} or {"error": "..."}
+//	plugin sink <name>               <- the completion as plain text
+//
+// A non-zero exit is an error, and the plugin's stderr is passed through.
+type Plugin struct {
+	Command string
+
+	Functions []string `json:"functions"`
+	Loaders   []string `json:"loaders"`
+	Sinks     []string `json:"sinks"`
+}
+
+type pluginResponse struct {
+	Result string `json:"result"`
+	Error  string `json:"error"`
+}
+
+// LoadPlugin asks the plugin what it provides
+func LoadPlugin(command string) (*Plugin, error) {
+	plugin := &Plugin{Command: command}
+
+	out, err := plugin.call(nil, "describe")
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(out, plugin)
+	if err != nil {
+		return nil, fmt.Errorf("plugin %s: invalid describe response: %w", command, err)
+	}
+
+	return plugin, nil
+}
+
+func (p *Plugin) call(stdin io.Reader, args ...string) ([]byte, error) {
+	cmd := exec.Command(p.Command, args...)
+	cmd.Stdin = stdin
+	cmd.Stderr = os.Stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("plugin %s %s: %w", p.Command, strings.Join(args, " "), err)
+	}
+
+	return out, nil
+}
+
+// Function returns a template function that calls the plugin
+func (p *Plugin) Function(name string) func(args ...any) (string, error) {
+	return func(args ...any) (string, error) {
+		req, err := json.Marshal(map[string]any{"args": args})
+		if err != nil {
+			return "", err
+		}
+
+		out, err := p.call(bytes.NewReader(req), "function", name)
+		if err != nil {
+			return "", err
+		}
+
+		var res pluginResponse
+		err = json.Unmarshal(out, &res)
+		if err != nil {
+			return "", fmt.Errorf("plugin function %s: %w", name, err)
+		}
+
+		if res.Error != "" {
+			return "", fmt.Errorf("plugin function %s: %s", name, res.Error)
+		}
+
+		return res.Result, nil
+	}
+}
+
+// Loader returns an input loader that calls the plugin
+func (p *Plugin) Loader(scheme string) InputLoader {
+	return InputLoaderFunc(func(ref string) (*LoadedInput, error) {
+		out, err := p.call(nil, "load", scheme, ref)
+		if err != nil {
+			return nil, err
+		}
+
+		var res struct {
+			LoadedInput
+			Error string `json:"error"`
+		}
+		err = json.Unmarshal(out, &res)
+		if err != nil {
+			return nil, fmt.Errorf("plugin loader %s: %w", scheme, err)
+		}
+
+		if res.Error != "" {
+			return nil, fmt.Errorf("plugin loader %s: %s", scheme, res.Error)
+		}
+
+		return &res.LoadedInput, nil
+	})
+}
+
+// Sink returns an output sink that pipes the completion to the plugin
+func (p *Plugin) Sink(name string) OutputSink {
+	return func(r io.Reader) error {
+		_, err := p.call(r, "sink", name)
+		return err
+	}
+}
+
+// OutputSink consumes the completion instead of stdout or the output file
+type OutputSink func(r io.Reader) error
+
+// outputSinks are registered by name, for --sink
+var outputSinks = map[string]OutputSink{}
+
+// templateFuncs are added to every prompt template, on top of the builtin helpers. Plugins may add more.
+var templateFuncs = builtinFuncs()
+
+// RegisterPlugins loads the plugins, and registers what they provide. It replaces the functions and
+// sinks of the plugins registered before, which may come from the config of another directory.
+func RegisterPlugins(commands []string) error {
+	templateFuncs = builtinFuncs()
+	outputSinks = map[string]OutputSink{}
+
+	for _, command := range commands {
+		plugin, err := LoadPlugin(command)
+		if err != nil {
+			return err
+		}
+
+		for _, name := range plugin.Functions {
+			templateFuncs[name] = plugin.Function(name)
+		}
+
+		for _, scheme := range plugin.Loaders {
+			RegisterInputLoader(scheme, plugin.Loader(scheme))
+		}
+
+		for _, name := range plugin.Sinks {
+			outputSinks[name] = plugin.Sink(name)
+		}
+	}
+
+	return nil
+}
+
+// WriteToSink sends the completion to a registered sink
+func WriteToSink(name string, r io.Reader) error {
+	sink, ok := outputSinks[name]
+	if !ok {
+		return errors.New("unknown output sink: " + name)
+	}
+	return sink(r)
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegisterPluginsAgain(t *testing.T) {
+	plugin := filepath.Join(t.TempDir(), "plugin")
+	script := "#!/bin/sh\necho '{\"functions\": [\"shout\"], \"sinks\": [\"slack\"]}'\n"
+	assert.NoError(t, os.WriteFile(plugin, []byte(script), 0755))
+	defer RegisterPlugins(nil)
+
+	assert.NoError(t, RegisterPlugins([]string{plugin}))
+	assert.NoError(t, RegisterPlugins([]string{plugin}))
+	assert.Contains(t, templateFuncs, "shout")
+	assert.Contains(t, outputSinks, "slack")
+	assert.Len(t, templateFuncs, len(builtinFuncs())+1)
+
+	// the next run, in a directory without the plugin
+	assert.NoError(t, RegisterPlugins(nil))
+	assert.NotContains(t, templateFuncs, "shout")
+	assert.NotContains(t, outputSinks, "slack")
+}
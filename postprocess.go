@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// postprocessors clean up the whole completion before it is written, in the order that the
+// postprocess frontmatter lists them
+var postprocessors = map[string]func(string) string{
+	"strip_code_fences":        stripCodeFence,
+	"trim":                     strings.TrimSpace,
+	"trim_trailing_whitespace": trimTrailingWhitespace,
+	"ensure_trailing_newline":  ensureTrailingNewline,
+}
+
+// checkPostprocess reports an unknown postprocess step, before the request is sent
+func checkPostprocess(fm *TemplateFrontMatter) error {
+	for _, name := range fm.Postprocess {
+		if _, ok := postprocessors[name]; !ok {
+			return fmt.Errorf("unknown postprocess step: %s", name)
+		}
+	}
+	return nil
+}
+
+// postprocess applies the postprocess steps of the frontmatter to the response
+func postprocess(response string, fm *TemplateFrontMatter) string {
+	for _, name := range fm.Postprocess {
+		response = postprocessors[name](response)
+	}
+	return response
+}
+
+func trimTrailingWhitespace(text string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t\r")
+	}
+	return strings.Join(lines, "\n")
+}
+
+func ensureTrailingNewline(text string) string {
+	if text == "" || strings.HasSuffix(text, "\n") {
+		return text
+	}
+	return text + "\n"
+}
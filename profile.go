@@ -0,0 +1,40 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+)
+
+// profilePath is the user profile that templates opt into with use_profile. Set from the config at startup.
+var profilePath string
+
+// applyProfile prepends the user profile to the system message, if the template uses it
+func applyProfile(fm *TemplateFrontMatter) error {
+	if !fm.UseProfile {
+		return nil
+	}
+
+	if profilePath == "" {
+		return errors.New("use_profile: no profile is configured")
+	}
+
+	data, err := os.ReadFile(profilePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("use_profile: %s doesn't exist", profilePath)
+	}
+	if err != nil {
+		return err
+	}
+
+	profile := strings.TrimSpace(string(data))
+	if fm.System == "" {
+		fm.System = profile
+	} else {
+		fm.System = profile + "\n\n" + fm.System
+	}
+
+	return nil
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// progressInterval is how often the status line is redrawn
+const progressInterval = 100 * time.Millisecond
+
+var spinnerFrames = []rune("⠋⠙⠹⠸⠼⠴⠦⠧⠇⠏")
+
+// progressLine is the status line of a completion on stderr, with the elapsed time, the tokens
+// received and their rate. A nil line shows nothing.
+type progressLine struct {
+	model string
+	start time.Time
+
+	mu     sync.Mutex
+	tokens int
+	// first is when the first token arrived, the start of the rate
+	first time.Time
+
+	done chan struct{}
+	once sync.Once
+	wg   sync.WaitGroup
+}
+
+// stderrIsTerminal reports whether stderr is a terminal
+func stderrIsTerminal() bool {
+	info, err := os.Stderr.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// showProgress reports whether completions show a status line: when stderr is a terminal and the
+// response isn't written to it as it arrives, because stdout is a file or pipe, or the response is
+// applied once it's complete. --quiet and the concurrent runs of pls batch don't show it.
+func (r *Runner) showProgress() bool {
+	if r.args.Quiet || r.quiet || !stderrIsTerminal() {
+		return false
+	}
+	if !stdoutIsTerminal() {
+		return true
+	}
+	return r.args.NoStream || r.args.Patch || r.args.Edit || r.args.ExtractCode != ""
+}
+
+// startProgress shows the status line of a completion of the model, until stop is called
+func (r *Runner) startProgress(model string) *progressLine {
+	if !r.showProgress() {
+		return nil
+	}
+
+	p := &progressLine{model: model, start: time.Now(), done: make(chan struct{})}
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		ticker := time.NewTicker(progressInterval)
+		defer ticker.Stop()
+		for frame := 0; ; frame++ {
+			select {
+			case <-p.done:
+				// clear the line
+				fmt.Fprint(os.Stderr, "\r\x1b[K")
+				return
+			case <-ticker.C:
+				fmt.Fprintf(os.Stderr, "\r\x1b[K%c %s", spinnerFrames[frame%len(spinnerFrames)], p.status())
+			}
+		}
+	}()
+	return p
+}
+
+func (p *progressLine) status() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	elapsed := time.Since(p.start).Round(100 * time.Millisecond)
+	if p.tokens == 0 {
+		return fmt.Sprintf("waiting for %s  %s", p.model, elapsed)
+	}
+
+	status := fmt.Sprintf("%s  %d tokens", elapsed, p.tokens)
+	if streaming := time.Since(p.first).Seconds(); streaming >= 0.5 {
+		status += fmt.Sprintf("  %.1f tokens/s", float64(p.tokens)/streaming)
+	}
+	return status
+}
+
+// received counts the tokens of a piece of the response
+func (p *progressLine) received(text string) {
+	if p == nil || text == "" {
+		return
+	}
+
+	n := countTokens(p.model, text)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.tokens == 0 {
+		p.first = time.Now()
+	}
+	p.tokens += n
+}
+
+// stop clears the status line. It's safe to call more than once.
+func (p *progressLine) stop() {
+	if p == nil {
+		return
+	}
+	p.once.Do(func() {
+		close(p.done)
+		p.wg.Wait()
+	})
+}
+
+// progressStream updates the status line as the response is read, and clears it at the end
+type progressStream struct {
+	io.ReadCloser
+	progress *progressLine
+}
+
+func (s *progressStream) Read(b []byte) (int, error) {
+	n, err := s.ReadCloser.Read(b)
+	s.progress.received(string(b[:n]))
+	if err != nil {
+		s.progress.stop()
+	}
+	return n, err
+}
+
+func (s *progressStream) Close() error {
+	s.progress.stop()
+	return s.ReadCloser.Close()
+}
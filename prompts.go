@@ -0,0 +1,425 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/hayeah/pls/docdiff"
+	"github.com/hayeah/pls/promptstr"
+)
+
+// PromptInfo is a prompt of the prompt library
+type PromptInfo struct {
+	Name        string
+	Path        string
+	Title       string
+	Description string
+}
+
+// promptsCommands are the subcommands of pls prompts
+var promptsCommands = map[string]func(args []string) error{
+	"list":    runPromptsList,
+	"new":     runPromptsNew,
+	"improve": runPromptsImprove,
+}
+
+func runPrompts(argv []string) error {
+	if len(argv) == 0 {
+		return errors.New("usage: pls prompts <command>, where command is one of: " + strings.Join(promptsCommandNames(), ", "))
+	}
+
+	command, ok := promptsCommands[argv[0]]
+	if !ok {
+		return fmt.Errorf("unknown command %q, expected one of: %s", argv[0], strings.Join(promptsCommandNames(), ", "))
+	}
+
+	return command(argv[1:])
+}
+
+func promptsCommandNames() []string {
+	var names []string
+	for name := range promptsCommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+type PromptsListArgs struct {
+	Stats bool `arg:"--stats" help:"show the number of runs and the average rating of each prompt"`
+}
+
+func runPromptsList(argv []string) error {
+	var args PromptsListArgs
+	parseArgs("pls prompts list", &args, argv)
+
+	r, err := NewRunner(Args{})
+	if err != nil {
+		return err
+	}
+
+	prompts, err := ListPrompts(r.templatePaths)
+	if err != nil {
+		return err
+	}
+
+	var ratings map[string]*PromptRatings
+	if args.Stats {
+		ratings, err = RatingsByTemplate()
+		if err != nil {
+			return err
+		}
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, prompt := range prompts {
+		about := prompt.Title
+		if prompt.Description != "" {
+			if about != "" {
+				about += ": "
+			}
+			about += prompt.Description
+		}
+
+		if args.Stats {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", prompt.Name, ratings[absPath(prompt.Path)], about, prompt.Path)
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", prompt.Name, about, prompt.Path)
+	}
+	return w.Flush()
+}
+
+// PromptRatings aggregates the runs of a prompt and their ratings
+type PromptRatings struct {
+	Runs    int
+	Ratings int
+	Total   int
+}
+
+func (p *PromptRatings) String() string {
+	if p == nil {
+		return "0 runs"
+	}
+	if p.Ratings == 0 {
+		return fmt.Sprintf("%d runs, unrated", p.Runs)
+	}
+	return fmt.Sprintf("%d runs, rated %.1f (%d)", p.Runs, float64(p.Total)/float64(p.Ratings), p.Ratings)
+}
+
+// RatingsByTemplate aggregates the recorded runs by the absolute path of their template
+func RatingsByTemplate() (map[string]*PromptRatings, error) {
+	runs, err := ListRuns()
+	if err != nil {
+		return nil, err
+	}
+
+	ratings := map[string]*PromptRatings{}
+	for _, run := range runs {
+		rating, ok := ratings[run.Template]
+		if !ok {
+			rating = &PromptRatings{}
+			ratings[run.Template] = rating
+		}
+
+		rating.Runs++
+		for _, feedback := range run.Feedback {
+			rating.Ratings++
+			rating.Total += feedback.Rating
+		}
+	}
+
+	return ratings, nil
+}
+
+func absPath(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	return abs
+}
+
+// ListPrompts returns the prompts in the template paths, sorted by name. A prompt shadowed by one of
+// the same name in an earlier path is left out, as it can't be run by name.
+func ListPrompts(paths []string) ([]PromptInfo, error) {
+	seen := map[string]bool{}
+
+	var prompts []PromptInfo
+	for _, dir := range paths {
+		entries, err := os.ReadDir(dir)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		for _, entry := range entries {
+			if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+				continue
+			}
+
+			name := strings.TrimSuffix(entry.Name(), ".md")
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+
+			file := filepath.Join(dir, entry.Name())
+			info := PromptInfo{Name: name, Path: file}
+
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return nil, err
+			}
+
+			// a prompt with broken frontmatter is still listed, just without its title
+			var fm TemplateFrontMatter
+			_, err = promptstr.ParseFrontMatter(string(data), &fm, frontMatterOptions...)
+			if err == nil {
+				info.Title = fm.Title
+				info.Description = fm.Description
+			}
+
+			prompts = append(prompts, info)
+		}
+	}
+
+	sort.Slice(prompts, func(i, j int) bool {
+		return prompts[i].Name < prompts[j].Name
+	})
+
+	return prompts, nil
+}
+
+const promptSkeleton = `---
+title: %s
+description:
+model: %s
+temperature: 0.7
+---
+{{.Input}}
+`
+
+type PromptsNewArgs struct {
+	Name    string `arg:"positional,required" help:"name of the prompt"`
+	Project bool   `arg:"--project" help:"create the prompt in the project's .pls/prompts, instead of the user's prompt library"`
+	NoEdit  bool   `arg:"--no-edit" help:"don't open the prompt in $EDITOR"`
+}
+
+// runPromptsNew scaffolds a prompt in the prompt library, and opens it in $EDITOR
+func runPromptsNew(argv []string) error {
+	var args PromptsNewArgs
+	parseArgs("pls prompts new", &args, argv)
+
+	if strings.ContainsAny(args.Name, `/\`) || strings.HasPrefix(args.Name, ".") {
+		return fmt.Errorf("invalid prompt name: %q", args.Name)
+	}
+
+	r, err := NewRunner(Args{})
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Join(".pls", "prompts")
+	if !args.Project {
+		configDir, err := ConfigDir()
+		if err != nil {
+			return err
+		}
+		dir = filepath.Join(configDir, "prompts")
+	}
+
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+
+	file := filepath.Join(dir, strings.TrimSuffix(args.Name, ".md")+".md")
+
+	// O_EXCL, so an existing prompt is never overwritten
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if errors.Is(err, fs.ErrExist) {
+		return fmt.Errorf("%s already exists", file)
+	}
+	if err != nil {
+		return err
+	}
+
+	title := strings.ReplaceAll(strings.TrimSuffix(args.Name, ".md"), "-", " ")
+	_, err = fmt.Fprintf(f, promptSkeleton, title, r.chat.Model())
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "[created %s]\n", fileLink(file))
+
+	editor := os.Getenv("EDITOR")
+	if args.NoEdit || editor == "" {
+		return nil
+	}
+
+	cmd := exec.Command("sh", "-c", editor+` "$1"`, "sh", file)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+const improveInstruction = `You are improving a prompt template. The template is rendered with Go's text/template, so keep its
+frontmatter and its {{...}} actions working. Below are the template and recent runs of it that users
+rated poorly, with their notes. Revise the template so it avoids these problems.
+
+Reply with the complete revised template only, without explanations or code fences.
+
+=== TEMPLATE ===
+%s
+=== LOW-RATED RUNS ===
+%s`
+
+type PromptsImproveArgs struct {
+	Name      string `arg:"positional,required" help:"name of the prompt to improve"`
+	Model     string `arg:"-m,--model" default:"gpt-4" help:"model that revises the prompt"`
+	MaxRating int    `arg:"--max-rating" default:"3" help:"runs rated at most this are low-rated"`
+	Runs      int    `arg:"--runs" default:"5" help:"how many of the most recent low-rated runs to include"`
+	Yes       bool   `arg:"-y,--yes" help:"accept the revision without asking"`
+}
+
+// runPromptsImprove asks a model to revise a prompt based on its low-rated runs, and shows the diff for
+// the author to accept
+func runPromptsImprove(argv []string) error {
+	var args PromptsImproveArgs
+	parseArgs("pls prompts improve", &args, argv)
+
+	r, err := NewRunner(Args{PromptFile: args.Name})
+	if err != nil {
+		return err
+	}
+
+	template, err := r.ReadTemplate()
+	if err != nil {
+		return err
+	}
+
+	runs, err := lowRatedRuns(absPath(r.templatePath), args.MaxRating, args.Runs)
+	if err != nil {
+		return err
+	}
+	if len(runs) == 0 {
+		return fmt.Errorf("%s has no runs rated %d or lower. Rate runs with pls feedback.", args.Name, args.MaxRating)
+	}
+
+	fmt.Fprintf(os.Stderr, "[revising %s with %d low-rated runs]\n", r.templatePath, len(runs))
+
+	revised, err := r.complete(&TemplateFrontMatter{Model: args.Model}, fmt.Sprintf(improveInstruction, template, formatRuns(runs)))
+	if err != nil {
+		return err
+	}
+	revised = strings.TrimSpace(stripCodeFence(revised)) + "\n"
+
+	diff := docdiff.Diff(template, revised)
+	if diff == "" {
+		fmt.Fprintln(os.Stderr, "[no changes proposed]")
+		return nil
+	}
+	fmt.Print(diff)
+
+	if !args.Yes {
+		ok, err := confirm(fmt.Sprintf("accept the revision of %s?", r.templatePath))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			fmt.Fprintln(os.Stderr, "[kept the original]")
+			return nil
+		}
+	}
+
+	return r.ReplaceFile(strings.NewReader(revised), r.templatePath)
+}
+
+// confirm asks the question on stderr, and reads a yes or no from stdin. No is the default.
+func confirm(question string) (bool, error) {
+	fmt.Fprintf(os.Stderr, "%s [y/N] ", question)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return false, err
+	}
+	a := strings.ToLower(strings.TrimSpace(answer))
+	return a == "y" || a == "yes", nil
+}
+
+// lowRatedRuns returns the most recent runs of the template with an average rating of at most maxRating
+func lowRatedRuns(template string, maxRating int, limit int) ([]*RunRecord, error) {
+	runs, err := ListRuns()
+	if err != nil {
+		return nil, err
+	}
+
+	var low []*RunRecord
+	for i := len(runs) - 1; i >= 0 && len(low) < limit; i-- {
+		run := runs[i]
+		if run.Template != template || len(run.Feedback) == 0 {
+			continue
+		}
+
+		var total int
+		for _, feedback := range run.Feedback {
+			total += feedback.Rating
+		}
+		if float64(total)/float64(len(run.Feedback)) <= float64(maxRating) {
+			low = append(low, run)
+		}
+	}
+
+	return low, nil
+}
+
+func formatRuns(runs []*RunRecord) string {
+	var b strings.Builder
+	for i, run := range runs {
+		fmt.Fprintf(&b, "--- run %d ---\nPROMPT:\n%s\n\nRESPONSE:\n%s\n\nFEEDBACK:\n", i+1, run.Prompt, run.Response)
+		for _, feedback := range run.Feedback {
+			fmt.Fprintf(&b, "- rated %d/5", feedback.Rating)
+			if feedback.Note != "" {
+				fmt.Fprintf(&b, ": %s", feedback.Note)
+			}
+			b.WriteString("\n")
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// stripCodeFence removes a markdown code fence around the whole text, which models add despite
+// being asked not to
+func stripCodeFence(text string) string {
+	trimmed := strings.TrimSpace(text)
+	if !strings.HasPrefix(trimmed, "```") || !strings.HasSuffix(trimmed, "```") {
+		return text
+	}
+
+	trimmed = strings.TrimSuffix(trimmed, "```")
+	// drop the opening fence line, with its optional language
+	_, body, found := strings.Cut(trimmed, "\n")
+	if !found {
+		return text
+	}
+	return body
+}
@@ -12,19 +12,64 @@ import (
 
 var ErrorClosingDelimiterNotFound = errors.New("closing delimiter not found")
 
-func ParseFrontMatter(input string, v any) (string, error) {
+// Delimiter is the pair of lines that open and close the frontmatter
+type Delimiter struct {
+	Open  string `yaml:"open"`
+	Close string `yaml:"close"`
+}
+
+// DefaultDelimiters are YAML (---), TOML-style (+++), and an HTML comment so that Markdown templates
+// still preview cleanly.
+var DefaultDelimiters = []Delimiter{
+	{Open: "---", Close: "---"},
+	{Open: "+++", Close: "+++"},
+	{Open: "<!---", Close: "--->"},
+}
+
+type parseOptions struct {
+	delimiters []Delimiter
+}
+
+type ParseOption func(*parseOptions)
+
+// WithDelimiters replaces the default frontmatter delimiters
+func WithDelimiters(delimiters ...Delimiter) ParseOption {
+	return func(o *parseOptions) {
+		o.delimiters = delimiters
+	}
+}
+
+// ParseFrontMatter unmarshals the frontmatter into v, and returns the body. A shebang line at the
+// top of the input is skipped, so that prompt files can be executable scripts.
+func ParseFrontMatter(input string, v any, opts ...ParseOption) (string, error) {
+	options := parseOptions{
+		delimiters: DefaultDelimiters,
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
 	scanner := bufio.NewScanner(strings.NewReader(input))
 
 	var frontmatter bytes.Buffer
 	var foundFrontmatter bool
 	var processingFrontmatter bool
 	var processingBody bool
-	var delimiter string
+	var delimiter Delimiter
+	var firstLine = true
 
 	var body bytes.Buffer
 
 	for scanner.Scan() {
 		line := scanner.Text()
+
+		if firstLine {
+			firstLine = false
+			if strings.HasPrefix(line, "#!") {
+				continue
+			}
+		}
+
 		if processingBody {
 			// copy the rest of the file into body
 			fmt.Fprintln(&body, line)
@@ -39,23 +84,19 @@ func ParseFrontMatter(input string, v any) (string, error) {
 		}
 
 		// consider it a frontmatter delimiter if no other line has been read yet
-		if trimmedLine == "---" || trimmedLine == "+++" {
-			if !foundFrontmatter {
-				// open delimiter
-				delimiter = trimmedLine
+		if !foundFrontmatter {
+			if open, ok := matchDelimiter(options.delimiters, trimmedLine, true); ok {
+				delimiter = open
 				foundFrontmatter = true
 				processingFrontmatter = true
-			} else {
-				// closing delimiter
-				if trimmedLine != delimiter {
-					return "", errors.New("different closing delimiter found")
-				}
-
-				processingBody = true
-				processingFrontmatter = false
+				continue
 			}
-
+		} else if trimmedLine == delimiter.Close {
+			processingBody = true
+			processingFrontmatter = false
 			continue
+		} else if _, ok := matchDelimiter(options.delimiters, trimmedLine, false); ok {
+			return "", errors.New("different closing delimiter found")
 		}
 
 		if foundFrontmatter {
@@ -85,3 +126,12 @@ func ParseFrontMatter(input string, v any) (string, error) {
 
 	return body.String(), nil
 }
+
+func matchDelimiter(delimiters []Delimiter, line string, open bool) (Delimiter, bool) {
+	for _, d := range delimiters {
+		if (open && line == d.Open) || (!open && line == d.Close) {
+			return d, true
+		}
+	}
+	return Delimiter{}, false
+}
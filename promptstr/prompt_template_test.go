@@ -45,6 +45,31 @@ This is the body text.`,
 			expectedBody:  "",
 			expectedError: ErrorClosingDelimiterNotFound,
 		},
+		{
+			name: "html comment frontmatter",
+			input: `<!---
+title: Test Title
+--->
+This is the body text.`,
+			expectedTitle: "Test Title",
+			expectedBody:  "This is the body text.\n",
+		},
+		{
+			name: "frontmatter after shebang",
+			input: `#!/usr/bin/env pls
+---
+title: Test Title
+---
+This is the body text.`,
+			expectedTitle: "Test Title",
+			expectedBody:  "This is the body text.\n",
+		},
+		{
+			name: "shebang without frontmatter",
+			input: `#!/usr/bin/env pls
+This is the body text.`,
+			expectedBody: "This is the body text.\n",
+		},
 		{
 			name:  "no frontmatter",
 			input: "This is the body text.",
@@ -68,3 +93,17 @@ This is the body text.`,
 		})
 	}
 }
+
+func TestParseFrontMatterWithDelimiters(t *testing.T) {
+	input := `%%%
+title: Test Title
+%%%
+---
+This is the body text.`
+
+	var fm FrontMatter
+	body, err := ParseFrontMatter(input, &fm, WithDelimiters(Delimiter{Open: "%%%", Close: "%%%"}))
+	assert.NoError(t, err)
+	assert.Equal(t, "Test Title", fm.Title)
+	assert.Equal(t, "---\nThis is the body text.\n", body)
+}
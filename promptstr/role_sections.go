@@ -0,0 +1,50 @@
+package promptstr
+
+import (
+	"regexp"
+	"strings"
+)
+
+// RoleSection is a part of a prompt body sent as a message with the given role
+type RoleSection struct {
+	Role    string
+	Content string
+}
+
+var roleMarkerPattern = regexp.MustCompile(`^---\s*(system|user|assistant)\s*---$`)
+
+// SplitRoleSections splits a prompt body at marker lines like "--- assistant ---". Text before the
+// first marker belongs to a user section. A body without markers is a single user section.
+func SplitRoleSections(body string) []RoleSection {
+	sections := []RoleSection{{Role: "user"}}
+	contents := []string{""}
+
+	for _, line := range strings.SplitAfter(body, "\n") {
+		m := roleMarkerPattern.FindStringSubmatch(strings.TrimSpace(line))
+		if m == nil {
+			contents[len(contents)-1] += line
+			continue
+		}
+
+		sections = append(sections, RoleSection{Role: m[1]})
+		contents = append(contents, "")
+	}
+
+	if len(sections) == 1 {
+		return []RoleSection{{Role: "user", Content: body}}
+	}
+
+	var result []RoleSection
+	for i, section := range sections {
+		section.Content = strings.Trim(contents[i], "\n")
+
+		// drop the implicit leading section if there's nothing before the first marker
+		if i == 0 && strings.TrimSpace(section.Content) == "" {
+			continue
+		}
+
+		result = append(result, section)
+	}
+
+	return result
+}
@@ -0,0 +1,70 @@
+package promptstr
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitRoleSections(t *testing.T) {
+	testCases := []struct {
+		name     string
+		input    string
+		expected []RoleSection
+	}{
+		{
+			name:  "no markers",
+			input: "This is the body text.\n",
+			expected: []RoleSection{
+				{Role: "user", Content: "This is the body text.\n"},
+			},
+		},
+		{
+			name: "few-shot",
+			input: `--- system ---
+You translate to French.
+
+--- user ---
+hello
+--- assistant ---
+bonjour
+--- user ---
+goodbye
+`,
+			expected: []RoleSection{
+				{Role: "system", Content: "You translate to French."},
+				{Role: "user", Content: "hello"},
+				{Role: "assistant", Content: "bonjour"},
+				{Role: "user", Content: "goodbye"},
+			},
+		},
+		{
+			name: "text before the first marker is a user section",
+			input: `hello
+--- assistant ---
+bonjour
+`,
+			expected: []RoleSection{
+				{Role: "user", Content: "hello"},
+				{Role: "assistant", Content: "bonjour"},
+			},
+		},
+		{
+			name: "blank lines before the first marker are dropped",
+			input: `
+
+--- user ---
+hello
+`,
+			expected: []RoleSection{
+				{Role: "user", Content: "hello"},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, SplitRoleSections(tc.input))
+		})
+	}
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/hayeah/pls/tokens"
+)
+
+const redacted = "[REDACTED]"
+
+// ProxyConfig configures the policies pls proxy applies to the requests it forwards
+type ProxyConfig struct {
+	Listen string `yaml:"listen"`
+	// Aliases map the models clients ask for to the models that are used, e.g. fast: gpt-3.5-turbo
+	Aliases map[string]string `yaml:"aliases"`
+	// Redact are regular expressions. Their matches in messages are replaced with [REDACTED].
+	Redact []string `yaml:"redact"`
+	// MaxPromptTokens rejects requests with longer prompts. 0 is no limit.
+	MaxPromptTokens int `yaml:"max_prompt_tokens"`
+	// MaxTokens caps the completion tokens of every request. 0 is no limit.
+	MaxTokens int `yaml:"max_tokens"`
+}
+
+type ProxyArgs struct {
+	Listen string `arg:"--listen" help:"address to listen on, overrides the config (default 127.0.0.1:8443)"`
+}
+
+type proxy struct {
+	runner *Runner
+	config ProxyConfig
+	redact []*regexp.Regexp
+}
+
+// runProxy serves an OpenAI-compatible chat completions endpoint, forwarding requests to the configured
+// API after applying the proxy policies. The requests are recorded in the usage log, and refused
+// once the spend reaches the budget.
+func runProxy(argv []string) error {
+	var args ProxyArgs
+	parseArgs("pls proxy", &args, argv)
+
+	r, err := NewRunner(Args{})
+	if err != nil {
+		return err
+	}
+
+	config := r.config.Proxy
+	mergeString(&config.Listen, args.Listen)
+
+	p := &proxy{runner: r, config: config}
+	for _, pattern := range config.Redact {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("proxy: redact %q: %w", pattern, err)
+		}
+		p.redact = append(p.redact, re)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/v1/chat/completions", p)
+	mux.Handle("/chat/completions", p)
+
+	log.Printf("proxy listening on http://%s/v1", config.Listen)
+	return http.ListenAndServe(config.Listen, mux)
+}
+
+func (p *proxy) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	start := time.Now()
+
+	if req.Method != http.MethodPost {
+		proxyError(w, http.StatusMethodNotAllowed, "only POST is supported")
+		return
+	}
+
+	var request map[string]any
+	err := json.NewDecoder(req.Body).Decode(&request)
+	if err != nil {
+		proxyError(w, http.StatusBadRequest, "invalid request: "+err.Error())
+		return
+	}
+
+	requested, _ := request["model"].(string)
+	model := requested
+	if alias, ok := p.config.Aliases[requested]; ok {
+		model = alias
+		request["model"] = model
+	}
+
+	promptTokens, err := p.applyMessagePolicies(request, model)
+	if err != nil {
+		proxyError(w, http.StatusBadRequest, err.Error())
+		log.Printf("%s -> %s: rejected: %v", requested, model, err)
+		return
+	}
+
+	// max_tokens is a JSON number, or the cap of the policy
+	var maxTokens int
+	switch n := request["max_tokens"].(type) {
+	case float64:
+		maxTokens = int(n)
+	case int:
+		maxTokens = n
+	}
+	releaseBudget, err := p.runner.chat.budget.reserveTokens(model, promptTokens, maxTokens)
+	if err != nil {
+		proxyError(w, http.StatusTooManyRequests, err.Error())
+		log.Printf("%s -> %s: rejected: %v", requested, model, err)
+		return
+	}
+	defer releaseBudget()
+
+	body, err := json.Marshal(request)
+	if err != nil {
+		proxyError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	upstream, err := p.runner.chatCompletionsRequest(req.Context(), model, bytes.NewReader(body))
+	if err != nil {
+		proxyError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	res, err := p.runner.httpClient.Do(upstream)
+	if err != nil {
+		proxyError(w, http.StatusBadGateway, err.Error())
+		log.Printf("%s -> %s: %v", requested, model, err)
+		return
+	}
+	defer res.Body.Close()
+
+	w.Header().Set("Content-Type", res.Header.Get("Content-Type"))
+	w.WriteHeader(res.StatusCode)
+	var received bytes.Buffer
+	_, err = io.Copy(flushWriter{w}, io.TeeReader(res.Body, &received))
+
+	// what was received is billed, even if the client went away before the end
+	if res.StatusCode == http.StatusOK {
+		streamed, _ := request["stream"].(bool)
+		p.runner.recordUsage(proxyUsage(model, promptTokens, received.Bytes(), streamed, time.Since(start)))
+	}
+
+	log.Printf("%s -> %s: %s, %d prompt tokens, %s", requested, model, res.Status, promptTokens, time.Since(start).Round(time.Millisecond))
+	if err != nil {
+		log.Printf("%s -> %s: %v", requested, model, err)
+	}
+}
+
+// proxyUsage is the usage of a forwarded completion, as reported by the API, or else counted from the
+// prompt tokens and the content of the response. Streamed responses are read from their events.
+func proxyUsage(model string, promptTokens int, body []byte, streamed bool, latency time.Duration) UsageRecord {
+	if !streamed {
+		record := completionUsage(model, nil, body, latency, false)
+		if record.PromptTokens == 0 {
+			record.PromptTokens = promptTokens
+		}
+		return record
+	}
+
+	record := UsageRecord{Model: model, LatencyMS: latency.Milliseconds()}
+	var content strings.Builder
+	for _, line := range strings.Split(string(body), "\n") {
+		data, ok := strings.CutPrefix(strings.TrimSpace(line), "data: ")
+		if !ok || data == "[DONE]" {
+			continue
+		}
+
+		var event struct {
+			Choices []struct {
+				Delta struct {
+					Content string `json:"content"`
+				} `json:"delta"`
+			} `json:"choices"`
+			Usage *struct {
+				PromptTokens     int `json:"prompt_tokens"`
+				CompletionTokens int `json:"completion_tokens"`
+			} `json:"usage"`
+		}
+		if json.Unmarshal([]byte(data), &event) != nil {
+			continue
+		}
+		for _, choice := range event.Choices {
+			content.WriteString(choice.Delta.Content)
+		}
+		if event.Usage != nil && event.Usage.PromptTokens > 0 {
+			record.PromptTokens = event.Usage.PromptTokens
+			record.CompletionTokens = event.Usage.CompletionTokens
+		}
+	}
+
+	if record.PromptTokens == 0 {
+		record.PromptTokens = promptTokens
+		record.CompletionTokens = countTokens(model, content.String())
+	}
+	return record
+}
+
+// applyMessagePolicies redacts the messages and enforces the token caps. It returns the number of
+// prompt tokens.
+func (p *proxy) applyMessagePolicies(request map[string]any, model string) (int, error) {
+	messages, _ := request["messages"].([]any)
+
+	var promptTokens int
+	for _, m := range messages {
+		message, ok := m.(map[string]any)
+		if !ok {
+			continue
+		}
+
+		switch content := message["content"].(type) {
+		case string:
+			content = p.redactText(content)
+			message["content"] = content
+			n, err := tokens.Count(model, content)
+			if err != nil {
+				return 0, err
+			}
+			promptTokens += n
+
+		case []any:
+			// content parts, e.g. text with images
+			for _, part := range content {
+				part, ok := part.(map[string]any)
+				if !ok {
+					continue
+				}
+
+				text, ok := part["text"].(string)
+				if !ok {
+					continue
+				}
+				text = p.redactText(text)
+				part["text"] = text
+				n, err := tokens.Count(model, text)
+				if err != nil {
+					return 0, err
+				}
+				promptTokens += n
+			}
+		}
+	}
+
+	if p.config.MaxPromptTokens > 0 && promptTokens > p.config.MaxPromptTokens {
+		return 0, fmt.Errorf("prompt has %d tokens, over the limit of %d", promptTokens, p.config.MaxPromptTokens)
+	}
+
+	if p.config.MaxTokens > 0 {
+		maxTokens, ok := request["max_tokens"].(float64)
+		if !ok || maxTokens > float64(p.config.MaxTokens) {
+			request["max_tokens"] = p.config.MaxTokens
+		}
+	}
+
+	return promptTokens, nil
+}
+
+func (p *proxy) redactText(text string) string {
+	for _, re := range p.redact {
+		text = re.ReplaceAllString(text, redacted)
+	}
+	return text
+}
+
+// proxyError responds with an error in the format of the OpenAI API, so clients report it
+func proxyError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]any{
+		"error": map[string]any{
+			"message": message,
+			"type":    "pls_proxy_error",
+		},
+	})
+}
+
+// flushWriter flushes after every write, so streamed completions reach the client as they arrive
+type flushWriter struct {
+	w http.ResponseWriter
+}
+
+func (f flushWriter) Write(p []byte) (int, error) {
+	n, err := f.w.Write(p)
+	if flusher, ok := f.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return n, err
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// RateLimitConfig keeps the requests of a run under the API's rate limits, so batches, chains and
+// chunked inputs don't run into 429s. 0 is no limit.
+type RateLimitConfig struct {
+	// RPM is the most requests sent per minute
+	RPM int `yaml:"rpm"`
+	// TPM is the most tokens sent per minute, counting the prompt and the completion token limit
+	TPM int `yaml:"tpm"`
+	// Concurrency is the most requests in flight at once
+	Concurrency int `yaml:"concurrency"`
+}
+
+func (c RateLimitConfig) Enabled() bool {
+	return c.RPM > 0 || c.TPM > 0 || c.Concurrency > 0
+}
+
+// SetRateLimit shares a rate limiter between all the completions of the chat
+func SetRateLimit(config RateLimitConfig) ChatOptions {
+	return func(c *Chat) {
+		if config.Enabled() {
+			c.limiter = newRateLimiter(config)
+		}
+	}
+}
+
+// rateLimiter holds requests back until they fit into the limits of the last minute. A nil limiter
+// doesn't limit.
+type rateLimiter struct {
+	config RateLimitConfig
+	// slots are the requests in flight, nil is no limit
+	slots chan struct{}
+
+	// now is the clock of the window, time.Now but for tests
+	now func() time.Time
+
+	mu sync.Mutex
+	// sent are the requests of the last minute
+	sent []sentRequest
+}
+
+type sentRequest struct {
+	at     time.Time
+	tokens int
+}
+
+func newRateLimiter(config RateLimitConfig) *rateLimiter {
+	l := &rateLimiter{config: config, now: time.Now}
+	if config.Concurrency > 0 {
+		l.slots = make(chan struct{}, config.Concurrency)
+	}
+	return l
+}
+
+// acquire waits for an in-flight slot and for the request to fit into the per minute limits. release
+// frees the slot once the response is read.
+func (l *rateLimiter) acquire(ctx context.Context, tokens int) (release func(), err error) {
+	if l == nil {
+		return func() {}, nil
+	}
+
+	if l.slots != nil {
+		select {
+		case l.slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	var once sync.Once
+	release = func() {
+		once.Do(func() {
+			if l.slots != nil {
+				<-l.slots
+			}
+		})
+	}
+
+	waited := false
+	for {
+		delay := l.reserve(tokens)
+		if delay == 0 {
+			return release, nil
+		}
+
+		if !waited {
+			fmt.Fprintf(os.Stderr, "[rate limit, waiting %s]\n", delay.Round(time.Second))
+			waited = true
+		}
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			release()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// reserve records the request if it fits into the limits now. Otherwise it returns how long until the
+// oldest request of the window expires.
+func (l *rateLimiter) reserve(tokens int) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	for len(l.sent) > 0 && now.Sub(l.sent[0].at) >= time.Minute {
+		l.sent = l.sent[1:]
+	}
+
+	var used int
+	for _, request := range l.sent {
+		used += request.tokens
+	}
+
+	fits := l.config.RPM <= 0 || len(l.sent) < l.config.RPM
+	// a request larger than the whole budget is sent once the window is empty, not held forever
+	if l.config.TPM > 0 && used+tokens > l.config.TPM && len(l.sent) > 0 {
+		fits = false
+	}
+
+	if fits {
+		l.sent = append(l.sent, sentRequest{at: now, tokens: tokens})
+		return 0
+	}
+
+	return l.sent[0].at.Add(time.Minute).Sub(now)
+}
+
+// requestTokens estimates the tokens a request counts against the TPM limit: its messages and its
+// completion token limit. They are only counted with a TPM limit.
+func (l *rateLimiter) requestTokens(model string, messages []string, maxTokens int) int {
+	if l == nil || l.config.TPM <= 0 {
+		return 0
+	}
+
+	n := maxTokens
+	for _, message := range messages {
+		n += countTokens(model, message)
+	}
+	return n
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiterReserve(t *testing.T) {
+	type request struct {
+		at     time.Duration // since the start
+		tokens int
+		delay  time.Duration // 0 is sent
+	}
+
+	testCases := []struct {
+		name     string
+		config   RateLimitConfig
+		requests []request
+	}{
+		{
+			name:   "rpm",
+			config: RateLimitConfig{RPM: 2},
+			requests: []request{
+				{at: 0},
+				{at: 10 * time.Second},
+				{at: 20 * time.Second, delay: 40 * time.Second},
+				{at: time.Minute - time.Millisecond, delay: time.Millisecond},
+				// the first request leaves the window a minute after it was sent
+				{at: time.Minute},
+				{at: time.Minute + time.Second, delay: 9 * time.Second},
+				{at: 70 * time.Second},
+			},
+		},
+		{
+			name:   "tpm",
+			config: RateLimitConfig{TPM: 100},
+			requests: []request{
+				{at: 0, tokens: 60},
+				{at: time.Second, tokens: 40},
+				{at: 2 * time.Second, tokens: 1, delay: 58 * time.Second},
+				{at: time.Minute, tokens: 60},
+				{at: time.Minute, tokens: 1, delay: time.Second},
+			},
+		},
+		{
+			name:   "a request over the tpm waits for an empty window",
+			config: RateLimitConfig{TPM: 100},
+			requests: []request{
+				{at: 0, tokens: 10},
+				{at: time.Second, tokens: 500, delay: 59 * time.Second},
+				{at: time.Minute, tokens: 500},
+				{at: time.Minute + time.Second, tokens: 10, delay: 59 * time.Second},
+			},
+		},
+		{
+			name:   "rpm and tpm",
+			config: RateLimitConfig{RPM: 3, TPM: 100},
+			requests: []request{
+				{at: 0, tokens: 10},
+				{at: 0, tokens: 10},
+				{at: 30 * time.Second, tokens: 90, delay: 30 * time.Second},
+				{at: 30 * time.Second, tokens: 10},
+				{at: 40 * time.Second, tokens: 1, delay: 20 * time.Second},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			start := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+			var now time.Time
+			l := newRateLimiter(tc.config)
+			l.now = func() time.Time { return now }
+
+			for i, r := range tc.requests {
+				now = start.Add(r.at)
+				assert.Equal(t, r.delay, l.reserve(r.tokens), "request %d at %s", i, r.at)
+			}
+		})
+	}
+}
+
+func TestRateLimiterAcquire(t *testing.T) {
+	l := newRateLimiter(RateLimitConfig{Concurrency: 1})
+
+	release, err := l.acquire(context.Background(), 0)
+	assert.NoError(t, err)
+
+	// the slot is taken until released
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = l.acquire(ctx, 0)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	release()
+	release()
+	again, err := l.acquire(context.Background(), 0)
+	assert.NoError(t, err)
+	again()
+
+	// a nil limiter doesn't limit
+	var unlimited *rateLimiter
+	release, err = unlimited.acquire(context.Background(), 100)
+	assert.NoError(t, err)
+	release()
+}
@@ -0,0 +1,623 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+	"time"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/hayeah/pls/cron"
+)
+
+// Recurring is a prompt run on a cron schedule by pls recur run-due
+type Recurring struct {
+	Cron     string `yaml:"cron"`
+	Template string `yaml:"template"`
+	// InputCmd is a shell command whose output is the input of the prompt. Without it, the prompt runs
+	// with no input.
+	InputCmd string `yaml:"input_cmd,omitempty"`
+	// Dir is the working directory of the run, where the command was added
+	Dir string `yaml:"dir"`
+	// Output is the file the response is written to, relative to Dir. It's a template, e.g.
+	// reports/{{date "2006-01-02"}}.md. The response goes to stdout if empty.
+	Output string `yaml:"output,omitempty"`
+	// Created is when the prompt was added. The first run is when the schedule is next due after it.
+	Created time.Time `yaml:"created"`
+}
+
+// RecurState is the last run of each recurring prompt
+type RecurState struct {
+	Runs map[string]*RecurRun `json:"runs"`
+}
+
+type RecurRun struct {
+	// Time is the last run that succeeded, which the runs due are counted from
+	Time time.Time `json:"time"`
+	// Attempt is the last run, which failed with Error if it's set. A failed run stays due.
+	Attempt time.Time `json:"attempt"`
+	Error   string    `json:"error,omitempty"`
+}
+
+type RecurAddArgs struct {
+	Name     string `arg:"positional,required" help:"name of the recurring prompt"`
+	Cron     string `arg:"--cron,required" help:"schedule, as a crontab expression, e.g. \"0 9 * * MON\" or @daily"`
+	Template string `arg:"--template,required" help:"template to run"`
+	InputCmd string `arg:"--input-cmd" help:"shell command whose output is the input, run in the working directory. $PLS_LAST_RUN is the time of the last run, in RFC 3339."`
+	Output   string `arg:"-o,--output" help:"write the response to this file, a template like reports/{{date \"2006-01-02\"}}.md. Printed to stdout if omitted."`
+	Force    bool   `arg:"-f,--force" help:"replace the recurring prompt of the same name"`
+}
+
+type RecurNameArgs struct {
+	Name string `arg:"positional,required" help:"name of the recurring prompt"`
+}
+
+type RecurRunDueArgs struct {
+	DryRun bool `arg:"--dry-run" help:"print the prompts that are due, without running them"`
+}
+
+// recurCommands are the subcommands of pls recur
+var recurCommands = map[string]func(args []string) error{
+	"add":     runRecurAdd,
+	"list":    runRecurList,
+	"remove":  runRecurRemove,
+	"run":     runRecurRun,
+	"run-due": runRecurDue,
+}
+
+var recurNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// runRecur manages the prompts that run on a schedule. pls recur run-due is meant to be run by cron,
+// e.g. every 15 minutes. It runs the prompts that are due, and catches up on the runs missed while
+// the machine was off.
+func runRecur(argv []string) error {
+	if len(argv) == 0 {
+		return errors.New("usage: pls recur <command>, where command is one of: " + strings.Join(recurCommandNames(), ", "))
+	}
+
+	command, ok := recurCommands[argv[0]]
+	if !ok {
+		return fmt.Errorf("unknown command %q, expected one of: %s", argv[0], strings.Join(recurCommandNames(), ", "))
+	}
+
+	return command(argv[1:])
+}
+
+func recurCommandNames() []string {
+	var names []string
+	for name := range recurCommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// recurFile is where the recurring prompts are defined, next to the config
+func recurFile() (string, error) {
+	dir, err := ConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "recur.yaml"), nil
+}
+
+func recurStateFile() (string, error) {
+	dir, err := DataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "recur", "state.json"), nil
+}
+
+// ReadRecurring returns the recurring prompts by name
+func ReadRecurring() (map[string]*Recurring, error) {
+	file, err := recurFile()
+	if err != nil {
+		return nil, err
+	}
+
+	recurring := map[string]*Recurring{}
+	data, err := os.ReadFile(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return recurring, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = yaml.UnmarshalStrict(data, &recurring)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	return recurring, nil
+}
+
+func saveRecurring(recurring map[string]*Recurring) error {
+	file, err := recurFile()
+	if err != nil {
+		return err
+	}
+
+	data, err := yaml.Marshal(recurring)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(file), 0755)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, data, 0644)
+}
+
+func readRecurState() (*RecurState, error) {
+	file, err := recurStateFile()
+	if err != nil {
+		return nil, err
+	}
+
+	state := &RecurState{Runs: map[string]*RecurRun{}}
+	data, err := os.ReadFile(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, state)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	if state.Runs == nil {
+		state.Runs = map[string]*RecurRun{}
+	}
+	return state, nil
+}
+
+// Save writes the state file
+func (s *RecurState) Save() error {
+	file, err := recurStateFile()
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(file), 0755)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, data, 0644)
+}
+
+// lastRun is the time of the last run that succeeded, or when the prompt was added if none did. It's
+// local time, which the schedules are in.
+func (s *RecurState) lastRun(name string, rec *Recurring) time.Time {
+	if run, ok := s.Runs[name]; ok && !run.Time.IsZero() {
+		return run.Time.Local()
+	}
+	return rec.Created.Local()
+}
+
+// recurLockStale is how old a lock is taken over, from a run-due that was killed
+const recurLockStale = 6 * time.Hour
+
+// lockRecurState takes the lock of the state file around reading it, running the prompts and saving
+// it, so overlapping invocations of run-due don't run a prompt twice or lose each other's runs. ok is
+// false if another process holds the lock.
+func lockRecurState() (unlock func(), ok bool, err error) {
+	file, err := recurStateFile()
+	if err != nil {
+		return nil, false, err
+	}
+	lock := file + ".lock"
+
+	err = os.MkdirAll(filepath.Dir(lock), 0755)
+	if err != nil {
+		return nil, false, err
+	}
+
+	for attempt := 0; attempt < 2; attempt++ {
+		f, err := os.OpenFile(lock, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			fmt.Fprintf(f, "%d\n", os.Getpid())
+			f.Close()
+			return func() { os.Remove(lock) }, true, nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return nil, false, err
+		}
+
+		info, err := os.Stat(lock)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		if time.Since(info.ModTime()) < recurLockStale {
+			return nil, false, nil
+		}
+		fmt.Fprintf(os.Stderr, "[recur: taking over the lock %s, left %s ago]\n", lock, time.Since(info.ModTime()).Round(time.Minute))
+		err = os.Remove(lock)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, false, err
+		}
+	}
+	return nil, false, nil
+}
+
+// errRecurLocked is returned by the commands that change the state while run-due holds the lock
+var errRecurLocked = errors.New("recur: pls recur run-due is running, try again once it's done")
+
+// due returns when the prompt was due, and how many runs were missed since the last run. It's not due
+// if the next run is in the future.
+func (rec *Recurring) due(last time.Time, now time.Time) (due time.Time, missed int, err error) {
+	schedule, err := cron.Parse(rec.Cron)
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+
+	for next := schedule.Next(last); !next.IsZero() && !next.After(now); next = schedule.Next(next) {
+		due = next
+		missed++
+	}
+	return due, missed, nil
+}
+
+func runRecurAdd(argv []string) error {
+	var args RecurAddArgs
+	parseArgs("pls recur add", &args, argv)
+
+	if !recurNamePattern.MatchString(args.Name) {
+		return fmt.Errorf("recur: invalid name %q, use letters, digits, ., _ and -", args.Name)
+	}
+
+	_, err := cron.Parse(args.Cron)
+	if err != nil {
+		return err
+	}
+
+	dir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+
+	// a file is found from any directory, while a name is looked up in the template paths of dir
+	templateFile := args.Template
+	if _, err := os.Stat(templateFile); err == nil {
+		templateFile, err = filepath.Abs(templateFile)
+		if err != nil {
+			return err
+		}
+	} else {
+		paths, err := TemplatePaths()
+		if err != nil {
+			return err
+		}
+		_, err = MatchNameInPaths(paths, templateFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	recurring, err := ReadRecurring()
+	if err != nil {
+		return err
+	}
+	if _, exists := recurring[args.Name]; exists && !args.Force {
+		return fmt.Errorf("recur: %s already exists, use --force to replace it", args.Name)
+	}
+
+	rec := &Recurring{
+		Cron:     args.Cron,
+		Template: templateFile,
+		InputCmd: args.InputCmd,
+		Dir:      dir,
+		Output:   args.Output,
+		Created:  time.Now().Truncate(time.Second),
+	}
+	recurring[args.Name] = rec
+
+	err = saveRecurring(recurring)
+	if err != nil {
+		return err
+	}
+
+	schedule, _ := cron.Parse(rec.Cron)
+	fmt.Fprintf(os.Stderr, "[added %s, next run %s. Run pls recur run-due from cron, e.g. */15 * * * * pls recur run-due]\n", args.Name, schedule.Next(time.Now()).Format("Mon Jan 2 15:04"))
+	return nil
+}
+
+func runRecurList(argv []string) error {
+	parseArgs("pls recur list", &struct{}{}, argv)
+
+	recurring, err := ReadRecurring()
+	if err != nil {
+		return err
+	}
+	if len(recurring) == 0 {
+		fmt.Fprintln(os.Stderr, "no recurring prompts, add one with pls recur add")
+		return nil
+	}
+
+	state, err := readRecurState()
+	if err != nil {
+		return err
+	}
+
+	var names []string
+	for name := range recurring {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "name\tcron\ttemplate\tlast run\tnext run")
+	for _, name := range names {
+		rec := recurring[name]
+
+		lastRun := "never"
+		if run, ok := state.Runs[name]; ok {
+			if !run.Time.IsZero() {
+				lastRun = run.Time.Format("2006-01-02 15:04")
+			}
+			if run.Error != "" {
+				lastRun = run.Attempt.Format("2006-01-02 15:04") + " (failed)"
+			}
+		}
+
+		nextRun := "invalid cron"
+		if schedule, err := cron.Parse(rec.Cron); err == nil {
+			due, missed, _ := rec.due(state.lastRun(name, rec), time.Now())
+			if missed > 0 {
+				nextRun = "due since " + due.Format("2006-01-02 15:04")
+			} else {
+				nextRun = schedule.Next(time.Now()).Format("2006-01-02 15:04")
+			}
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", name, rec.Cron, rec.Template, lastRun, nextRun)
+	}
+	return w.Flush()
+}
+
+func runRecurRemove(argv []string) error {
+	var args RecurNameArgs
+	parseArgs("pls recur remove", &args, argv)
+
+	unlock, ok, err := lockRecurState()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errRecurLocked
+	}
+	defer unlock()
+
+	recurring, err := ReadRecurring()
+	if err != nil {
+		return err
+	}
+	if _, ok := recurring[args.Name]; !ok {
+		return fmt.Errorf("recur: no recurring prompt %s", args.Name)
+	}
+	delete(recurring, args.Name)
+
+	err = saveRecurring(recurring)
+	if err != nil {
+		return err
+	}
+
+	state, err := readRecurState()
+	if err != nil {
+		return err
+	}
+	delete(state.Runs, args.Name)
+	return state.Save()
+}
+
+// runRecurRun runs a recurring prompt now, whether it's due or not
+func runRecurRun(argv []string) error {
+	var args RecurNameArgs
+	parseArgs("pls recur run", &args, argv)
+
+	recurring, err := ReadRecurring()
+	if err != nil {
+		return err
+	}
+	rec, ok := recurring[args.Name]
+	if !ok {
+		return fmt.Errorf("recur: no recurring prompt %s", args.Name)
+	}
+
+	unlock, ok, err := lockRecurState()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errRecurLocked
+	}
+	defer unlock()
+
+	state, err := readRecurState()
+	if err != nil {
+		return err
+	}
+	return runRecurring(state, args.Name, rec)
+}
+
+// runRecurDue runs the prompts that are due. A prompt that missed several runs, e.g. while the machine
+// was off, runs once to catch up.
+func runRecurDue(argv []string) error {
+	var args RecurRunDueArgs
+	parseArgs("pls recur run-due", &args, argv)
+
+	// an invocation that overlaps a slow run leaves the prompts to it
+	unlock, ok, err := lockRecurState()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		fmt.Fprintln(os.Stderr, "[recur: another run-due is running, skipped]")
+		return nil
+	}
+	defer unlock()
+
+	recurring, err := ReadRecurring()
+	if err != nil {
+		return err
+	}
+	state, err := readRecurState()
+	if err != nil {
+		return err
+	}
+
+	var names []string
+	for name := range recurring {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var errs []error
+	for _, name := range names {
+		rec := recurring[name]
+		due, missed, err := rec.due(state.lastRun(name, rec), time.Now())
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			continue
+		}
+		if missed == 0 {
+			continue
+		}
+
+		if missed > 1 {
+			fmt.Fprintf(os.Stderr, "[%s: catching up on %d missed runs, the last due %s]\n", name, missed, due.Format("Mon Jan 2 15:04"))
+		}
+		if args.DryRun {
+			fmt.Printf("%s\tdue %s\n", name, due.Format("2006-01-02 15:04"))
+			continue
+		}
+
+		err = runRecurring(state, name, rec)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// runRecurring runs the prompt in its directory, and records the run in the state. Only a run that
+// succeeds moves the last run on, so a run that fails, e.g. while offline, is still due next time.
+func runRecurring(state *RecurState, name string, rec *Recurring) error {
+	last := state.lastRun(name, rec)
+	run, ok := state.Runs[name]
+	if !ok {
+		run = &RecurRun{}
+		state.Runs[name] = run
+	}
+	run.Attempt = time.Now()
+
+	fmt.Fprintf(os.Stderr, "[running %s]\n", name)
+	runErr := rec.run(last)
+	if runErr != nil {
+		run.Error = runErr.Error()
+	} else {
+		run.Time = run.Attempt
+		run.Error = ""
+	}
+
+	err := state.Save()
+	if err != nil {
+		return errors.Join(runErr, err)
+	}
+	return runErr
+}
+
+func (rec *Recurring) run(last time.Time) error {
+	wd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	err = os.Chdir(rec.Dir)
+	if err != nil {
+		return err
+	}
+	defer os.Chdir(wd)
+
+	args := Args{PromptFile: rec.Template, NoInput: rec.InputCmd == ""}
+	if rec.Output != "" {
+		args.OutputFile, err = renderRecurOutput(rec.Output)
+		if err != nil {
+			return err
+		}
+		err = os.MkdirAll(filepath.Dir(args.OutputFile), 0755)
+		if err != nil {
+			return err
+		}
+	}
+
+	runner, err := NewRunner(args)
+	if err != nil {
+		return err
+	}
+
+	if rec.InputCmd != "" {
+		input, err := recurInput(rec.InputCmd, last)
+		if err != nil {
+			return err
+		}
+		runner.pipedInput = &input
+	}
+
+	ctx, cancel := runContext(0)
+	defer cancel()
+	SetContext(ctx)(runner.chat)
+
+	start := time.Now()
+	err = contextError(ctx, runner.Run(), 0)
+	runner.RunAfterHooks(err, time.Since(start))
+	return err
+}
+
+// renderRecurOutput renders the template of the output file name
+func renderRecurOutput(output string) (string, error) {
+	tmpl, err := template.New("output").Funcs(templateFuncs).Parse(output)
+	if err != nil {
+		return "", fmt.Errorf("output: %w", err)
+	}
+
+	var b strings.Builder
+	err = tmpl.Execute(&b, nil)
+	if err != nil {
+		return "", fmt.Errorf("output: %w", err)
+	}
+	return b.String(), nil
+}
+
+// recurInput runs the input command, with the time of the last run in $PLS_LAST_RUN
+func recurInput(command string, last time.Time) (string, error) {
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Env = append(os.Environ(), "PLS_LAST_RUN="+last.Format(time.RFC3339))
+	cmd.Stderr = os.Stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("input command %q: %w", command, err)
+	}
+	return string(out), nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecurDueAfterFailure(t *testing.T) {
+	created := time.Date(2024, 3, 1, 12, 0, 0, 0, time.Local)
+	rec := &Recurring{Cron: "0 9 * * *", Created: created}
+	now := time.Date(2024, 3, 5, 10, 0, 0, 0, time.Local)
+
+	testCases := []struct {
+		name   string
+		run    *RecurRun
+		due    time.Time
+		missed int
+	}{
+		{name: "never ran", due: time.Date(2024, 3, 5, 9, 0, 0, 0, time.Local), missed: 4},
+		{name: "ran today", run: &RecurRun{Time: time.Date(2024, 3, 5, 9, 1, 0, 0, time.Local)}},
+		{
+			name:   "failed today, after a success",
+			run:    &RecurRun{Time: time.Date(2024, 3, 3, 9, 1, 0, 0, time.Local), Attempt: time.Date(2024, 3, 5, 9, 1, 0, 0, time.Local), Error: "dial tcp: network is unreachable"},
+			due:    time.Date(2024, 3, 5, 9, 0, 0, 0, time.Local),
+			missed: 2,
+		},
+		{
+			name:   "never succeeded",
+			run:    &RecurRun{Attempt: time.Date(2024, 3, 5, 9, 1, 0, 0, time.Local), Error: "dial tcp: network is unreachable"},
+			due:    time.Date(2024, 3, 5, 9, 0, 0, 0, time.Local),
+			missed: 4,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			state := &RecurState{Runs: map[string]*RecurRun{}}
+			if tc.run != nil {
+				state.Runs["standup"] = tc.run
+			}
+			due, missed, err := rec.due(state.lastRun("standup", rec), now)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.missed, missed)
+			assert.True(t, tc.due.Equal(due), "due %s", due)
+		})
+	}
+}
+
+func TestLockRecurState(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+
+	unlock, ok, err := lockRecurState()
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	_, ok, err = lockRecurState()
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	unlock()
+	unlock, ok, err = lockRecurState()
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	// the lock of a killed run-due is taken over once stale
+	file, err := recurStateFile()
+	assert.NoError(t, err)
+	old := time.Now().Add(-recurLockStale - time.Minute)
+	assert.NoError(t, os.Chtimes(file+".lock", old, old))
+
+	unlockStale, ok, err := lockRecurState()
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	unlockStale()
+	unlock()
+	assert.NoFileExists(t, file+".lock")
+}
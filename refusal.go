@@ -0,0 +1,40 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// refusalStart is how far into a response a refusal is looked for. Refusals lead with the apology,
+// while rewritten files that mention one further in are fine.
+const refusalStart = 300
+
+// refusalPattern matches the apostrophes models write, ' as well as ’
+var refusalPattern = regexp.MustCompile(`(?i)^\W*(?:` + strings.Join([]string{
+	`i['’]?m sorry`,
+	`i am sorry`,
+	`sorry, (?:but )?i`,
+	`i apologi[sz]e`,
+	`my apologies`,
+	`i (?:can ?not|can['’]?t|won['’]?t|am unable to|['’]?m unable to|am not able to|['’]?m not able to)`,
+	`unfortunately,? i`,
+	`as an ai`,
+}, "|") + `)`)
+
+// LooksLikeRefusal reports whether the response reads as a refusal or an apology rather than the
+// requested content. A response that starts the same way as the original is not a refusal.
+func LooksLikeRefusal(response string, original string) bool {
+	if !refusalPattern.MatchString(head(response, refusalStart)) {
+		return false
+	}
+	return !refusalPattern.MatchString(head(original, refusalStart))
+}
+
+// head returns the text up to n bytes, with surrounding whitespace and quotes removed
+func head(text string, n int) string {
+	text = strings.TrimSpace(text)
+	if len(text) > n {
+		text = text[:n]
+	}
+	return strings.Trim(text, "\"'`")
+}
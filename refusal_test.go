@@ -0,0 +1,38 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLooksLikeRefusal(t *testing.T) {
+	original := "# Deploy\n\nRun make deploy from the repository root.\n"
+
+	testCases := []struct {
+		name     string
+		response string
+		original string
+		expected bool
+	}{
+		{name: "apology", response: "I'm sorry, but I can't rewrite this file.", original: original, expected: true},
+		{name: "typographic apostrophe", response: "I’m sorry, but I can’t help with that.", original: original, expected: true},
+		{name: "typographic can’t", response: "I can’t rewrite a file that contains credentials.", original: original, expected: true},
+		{name: "typographic won’t", response: "“I won’t do that.”", original: original, expected: true},
+		{name: "inability", response: "I am unable to help with that request.", original: original, expected: true},
+		{name: "quoted, after markup", response: "\n\n> \"Unfortunately, I cannot edit credentials.\"", original: original, expected: true},
+		{name: "rewrite", response: "# Deploy\n\nRun `make deploy` from the root of the repository.\n", original: original},
+		{name: "the original starts the same way", response: "I'm sorry for the outage on Monday. Here is what happened.", original: "I'm sorry for the outage. Here is what happened."},
+		{name: "the original starts the same way, typographic", response: "I’m sorry for the outage on Monday.", original: "I'm sorry for the outage."},
+		{name: "apology later in the rewrite", response: "# Support replies\n\nWhen a customer reports a bug, answer with: I'm sorry, I can't reproduce this yet.\n", original: original},
+		{name: "apology past the first 300 characters", response: strings.Repeat("Run make deploy. ", 20) + "I'm sorry, I can't.", original: original},
+		{name: "empty", response: "", original: original},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, LooksLikeRefusal(tc.response, tc.original))
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"text/template"
+	"time"
+)
+
+// includeFuncs are the template functions that read files or run commands. They are the slow part of
+// rendering, so they are cached and profiled.
+var includeFuncs = []string{"file", "glob", "sh"}
+
+// includeCache memoizes the includes for the rest of the run, so pls batch reads the shared files and
+// runs the git commands of the template once instead of for every input. Set at startup, nil is off.
+var includeCache *renderCache
+
+// includeProfile times the renders and includes, for --profile-render. Set at startup, nil is off.
+var includeProfile *renderProfile
+
+type renderCache struct {
+	mu      sync.Mutex
+	entries map[string]*cachedInclude
+}
+
+// cachedInclude is the result of an include. once makes concurrent renders wait for the first one,
+// instead of all running it.
+type cachedInclude struct {
+	once    sync.Once
+	content string
+	err     error
+}
+
+func newRenderCache() *renderCache {
+	return &renderCache{entries: map[string]*cachedInclude{}}
+}
+
+// get returns the cached result of the include, computing it the first time. cached is false for the
+// call that computed it.
+func (c *renderCache) get(key string, compute func() (string, error)) (content string, cached bool, err error) {
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	if !ok {
+		entry = &cachedInclude{}
+		c.entries[key] = entry
+	}
+	c.mu.Unlock()
+
+	cached = true
+	entry.once.Do(func() {
+		cached = false
+		entry.content, entry.err = compute()
+	})
+	return entry.content, cached, entry.err
+}
+
+type renderProfile struct {
+	mu      sync.Mutex
+	renders int
+	render  time.Duration
+	calls   map[string]*profiledCall
+}
+
+// profiledCall is the timing of the calls of an include with the same argument
+type profiledCall struct {
+	name     string
+	calls    int
+	cached   int
+	duration time.Duration
+}
+
+func newRenderProfile() *renderProfile {
+	return &renderProfile{calls: map[string]*profiledCall{}}
+}
+
+// rendered records a render of a prompt that started at start
+func (p *renderProfile) rendered(start time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.renders++
+	p.render += time.Since(start)
+}
+
+func (p *renderProfile) called(key string, cached bool, duration time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	call, ok := p.calls[key]
+	if !ok {
+		call = &profiledCall{name: key}
+		p.calls[key] = call
+	}
+	call.calls++
+	if cached {
+		call.cached++
+	}
+	call.duration += duration
+}
+
+// Print writes the render times and the includes on stderr, slowest first
+func (p *renderProfile) Print() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	calls := make([]*profiledCall, 0, len(p.calls))
+	for _, call := range p.calls {
+		calls = append(calls, call)
+	}
+	sort.Slice(calls, func(i, j int) bool {
+		if calls[i].duration != calls[j].duration {
+			return calls[i].duration > calls[j].duration
+		}
+		return calls[i].name < calls[j].name
+	})
+
+	w := tabwriter.NewWriter(os.Stderr, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "\tcalls\tcached\ttime")
+	fmt.Fprintf(w, "render\t%d\t-\t%s\n", p.renders, p.render.Round(time.Microsecond))
+	for _, call := range calls {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%s\n", call.name, call.calls, call.cached, call.duration.Round(time.Microsecond))
+	}
+	return w.Flush()
+}
+
+// cachedIncludes returns the include functions of the prompt, wrapped with the cache and the profile
+func cachedIncludes(fm *TemplateFrontMatter) template.FuncMap {
+	available := template.FuncMap{
+		"file": templateFuncs["file"],
+		"glob": templateFuncs["glob"],
+	}
+	// the error of a disabled {{sh}} isn't cached, or it would fail the prompts that enable it
+	if allowExec || fm.Exec {
+		available["sh"] = runShell
+	}
+
+	funcs := template.FuncMap{}
+	for _, name := range includeFuncs {
+		// plugins may replace an include with a function of another signature, which is left as is
+		include, ok := available[name].(func(string) (string, error))
+		if ok {
+			funcs[name] = cachedIncludeFunc(name, include)
+		}
+	}
+	return funcs
+}
+
+func cachedIncludeFunc(name string, include func(string) (string, error)) func(string) (string, error) {
+	return func(arg string) (string, error) {
+		key := fmt.Sprintf("%s %q", name, arg)
+		start := time.Now()
+
+		var content string
+		var cached bool
+		var err error
+		if includeCache != nil {
+			content, cached, err = includeCache.get(key, func() (string, error) { return include(arg) })
+		} else {
+			content, err = include(arg)
+		}
+
+		if includeProfile != nil {
+			includeProfile.called(key, cached, time.Since(start))
+		}
+		return content, err
+	}
+}
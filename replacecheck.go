@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// ReplaceChecks are the sanity checks a rewrite must pass before --replace overwrites the file
+type ReplaceChecks struct {
+	// MinLength is the least length of the rewrite, as a percentage of the length of the original.
+	// 0 disables the check.
+	MinLength *int `yaml:"min_length"`
+	// Syntax requires Go, JSON and YAML files to still parse, going by their extension
+	Syntax *bool `yaml:"syntax"`
+	// KeepHeader requires the rewrite to keep the package clause of Go files, and a shebang or comment
+	// on the first line of other files, going by the comment syntax of their extension
+	KeepHeader *bool `yaml:"keep_header"`
+}
+
+// Check returns an error describing the first check the rewrite of the file fails
+func (c ReplaceChecks) Check(filename string, original, rewrite []byte) error {
+	if c.MinLength != nil && *c.MinLength > 0 && len(original) > 0 {
+		percent := len(rewrite) * 100 / len(original)
+		if percent < *c.MinLength {
+			return fmt.Errorf("the rewrite is %d%% of the length of the original, less than the minimum of %d%%", percent, *c.MinLength)
+		}
+	}
+
+	if c.Syntax != nil && *c.Syntax {
+		err := checkSyntax(filename, rewrite)
+		if err != nil {
+			return fmt.Errorf("the rewrite doesn't parse: %w", err)
+		}
+	}
+
+	if c.KeepHeader != nil && *c.KeepHeader {
+		err := checkHeader(filename, original, rewrite)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// isRewrite reports whether the output file is rewritten from its own content: the input file of
+// --replace, or a file changed by --patch or --edit. Other outputs, like a summary regenerated into
+// an existing file, aren't derived from the original, so the checks don't compare them with it.
+func (r *Runner) isRewrite(outputfile string) bool {
+	if r.args.Patch || r.args.Edit {
+		return true
+	}
+	return r.args.ReplaceInputFile && r.args.InputFile != "" && sameFile(outputfile, r.args.InputFile)
+}
+
+// sameFile reports whether the paths are the same file, comparing the paths of files that don't
+// exist yet
+func sameFile(a, b string) bool {
+	infoA, errA := os.Stat(a)
+	infoB, errB := os.Stat(b)
+	if errA == nil && errB == nil {
+		return os.SameFile(infoA, infoB)
+	}
+	return filepath.Clean(a) == filepath.Clean(b)
+}
+
+// checkRewrite keeps the original file if the response written to tempfile looks like a refusal, or
+// fails the sanity checks. The response is then saved aside as <file>.refused or <file>.rejected.
+func (r *Runner) checkRewrite(tempfile string, outputfile string) error {
+	response, err := os.ReadFile(tempfile)
+	if err != nil {
+		return err
+	}
+
+	// a new file has no original to compare with
+	original, err := os.ReadFile(outputfile)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	if !r.args.AllowRefusal && LooksLikeRefusal(string(response), string(original)) {
+		saved, err := setAside(tempfile, outputfile, ".refused")
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("the response looks like a refusal, %s is unchanged. The response is in %s, use --allow-refusal to replace anyway", outputfile, saved)
+	}
+
+	if !r.args.SkipChecks {
+		err = r.config.ReplaceChecks.Check(outputfile, original, response)
+		if err != nil {
+			saved, saveErr := setAside(tempfile, outputfile, ".rejected")
+			if saveErr != nil {
+				return saveErr
+			}
+			return fmt.Errorf("%w. %s is unchanged. The response is in %s, use --skip-checks to replace anyway", err, outputfile, saved)
+		}
+	}
+
+	return nil
+}
+
+func setAside(tempfile string, outputfile string, suffix string) (string, error) {
+	saved := outputfile + suffix
+	return saved, os.Rename(tempfile, saved)
+}
+
+// checkSyntax parses Go, JSON and YAML files. Files of other types pass.
+func checkSyntax(filename string, content []byte) error {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".go":
+		_, err := parser.ParseFile(token.NewFileSet(), filename, content, parser.SkipObjectResolution)
+		return err
+
+	case ".json":
+		var v any
+		return json.Unmarshal(content, &v)
+
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(content))
+		for {
+			var v any
+			err := decoder.Decode(&v)
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// commentPrefixes are the line and block comment starts of each file type, going by the extension or,
+// for files without one, the name. The first line of a file is a header if it is a shebang or one of
+// its comments, like a license. Markdown headings don't count, a rewrite may retitle the document.
+var commentPrefixes = map[string][]string{
+	".sh": {"#"}, ".bash": {"#"}, ".zsh": {"#"}, ".fish": {"#"}, ".ps1": {"#"},
+	".py": {"#"}, ".rb": {"#"}, ".pl": {"#"}, ".r": {"#"},
+	".yaml": {"#"}, ".yml": {"#"}, ".toml": {"#"}, ".conf": {"#"}, ".mk": {"#"},
+	".tf": {"#", "//", "/*"}, ".php": {"#", "//", "/*"},
+	".c": {"//", "/*"}, ".h": {"//", "/*"}, ".cc": {"//", "/*"}, ".cpp": {"//", "/*"}, ".hpp": {"//", "/*"},
+	".js": {"//", "/*"}, ".jsx": {"//", "/*"}, ".ts": {"//", "/*"}, ".tsx": {"//", "/*"},
+	".java": {"//", "/*"}, ".kt": {"//", "/*"}, ".scala": {"//", "/*"}, ".swift": {"//", "/*"},
+	".rs": {"//", "/*"}, ".cs": {"//", "/*"}, ".proto": {"//", "/*"},
+	".css": {"/*"}, ".scss": {"//", "/*"}, ".less": {"//", "/*"},
+	".html": {"<!--"}, ".htm": {"<!--"}, ".xml": {"<!--"}, ".svg": {"<!--"}, ".vue": {"<!--"},
+	".md": {"<!--"}, ".markdown": {"<!--"},
+	".sql": {"--"}, ".lua": {"--"}, ".hs": {"--"},
+	".ini": {";", "#"}, ".el": {";"}, ".lisp": {";"}, ".clj": {";"},
+	"makefile": {"#"}, "dockerfile": {"#"},
+}
+
+// checkHeader requires the rewrite to keep the package of Go files, or else the first line of the
+// original if it is a header
+func checkHeader(filename string, original, rewrite []byte) error {
+	if strings.ToLower(filepath.Ext(filename)) == ".go" {
+		before, err := parser.ParseFile(token.NewFileSet(), filename, original, parser.PackageClauseOnly)
+		if err != nil {
+			// nothing to compare against
+			return nil
+		}
+
+		after, err := parser.ParseFile(token.NewFileSet(), filename, rewrite, parser.PackageClauseOnly)
+		if err != nil || after.Name.Name != before.Name.Name {
+			return fmt.Errorf("the rewrite doesn't keep package %s", before.Name.Name)
+		}
+		return nil
+	}
+
+	header := firstLine(original)
+	if !isHeader(filename, header) {
+		return nil
+	}
+
+	for _, line := range strings.Split(string(rewrite), "\n") {
+		if strings.TrimSpace(line) == header {
+			return nil
+		}
+	}
+	return fmt.Errorf("the rewrite doesn't keep the first line of the original: %s", header)
+}
+
+func isHeader(filename string, line string) bool {
+	if strings.HasPrefix(line, "#!") {
+		return true
+	}
+
+	kind := strings.ToLower(filepath.Ext(filename))
+	if kind == "" {
+		kind = strings.ToLower(filepath.Base(filename))
+	}
+	for _, prefix := range commentPrefixes[kind] {
+		if strings.HasPrefix(line, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func firstLine(content []byte) string {
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" {
+			return line
+		}
+	}
+	return ""
+}
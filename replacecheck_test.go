@@ -0,0 +1,168 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplaceChecks(t *testing.T) {
+	minLength := 50
+	enabled := true
+	checks := ReplaceChecks{MinLength: &minLength, Syntax: &enabled, KeepHeader: &enabled}
+
+	testCases := []struct {
+		name     string
+		filename string
+		original string
+		rewrite  string
+		err      string
+	}{
+		{
+			name:     "passes",
+			filename: "notes.md",
+			original: "# Notes\n\nSome notes.\n",
+			rewrite:  "# Notes\n\nSome better notes.\n",
+		},
+		{
+			name:     "below the minimum length",
+			filename: "notes.md",
+			original: "A long paragraph of notes that the rewrite mostly drops.\n",
+			rewrite:  "Notes.\n",
+			err:      "the rewrite is 12% of the length of the original, less than the minimum of 50%",
+		},
+		{
+			name:     "doesn't parse",
+			filename: "config.json",
+			original: `{"name": "pls", "version": 1}`,
+			rewrite:  `{"name": "pls", "version": 1`,
+			err:      "the rewrite doesn't parse: unexpected end of JSON input",
+		},
+		{
+			name:     "drops the header",
+			filename: "run.sh",
+			original: "#!/bin/sh\necho hello\n",
+			rewrite:  "echo hello world\n",
+			err:      "the rewrite doesn't keep the first line of the original: #!/bin/sh",
+		},
+		{
+			name:     "keeps the license comment",
+			filename: "main.c",
+			original: "// SPDX-License-Identifier: MIT\nint main() {}\n",
+			rewrite:  "int main() { return 0; }\n",
+			err:      "the rewrite doesn't keep the first line of the original: // SPDX-License-Identifier: MIT",
+		},
+		{
+			name:     "changes the markdown heading",
+			filename: "README.md",
+			original: "# Notes\n\nSome notes.\n",
+			rewrite:  "# Notizen\n\nEinige Notizen.\n",
+		},
+		{
+			name:     "a comment of another language",
+			filename: "notes.txt",
+			original: "-- draft --\nSome notes.\n",
+			rewrite:  "Some notes.\n",
+		},
+		{
+			name:     "changes the go package",
+			filename: "main.go",
+			original: "package main\n\nfunc main() {}\n",
+			rewrite:  "package other\n\nfunc main() {}\n",
+			err:      "the rewrite doesn't keep package main",
+		},
+		{
+			name:     "new file",
+			filename: "main.go",
+			original: "",
+			rewrite:  "package main\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := checks.Check(tc.filename, []byte(tc.original), []byte(tc.rewrite))
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestCheckRewrite(t *testing.T) {
+	minLength := 50
+
+	testCases := []struct {
+		name       string
+		skipChecks bool
+		rewrite    string
+		err        bool
+		kept       string
+	}{
+		{
+			name:    "rejected",
+			rewrite: "Short.\n",
+			err:     true,
+			kept:    ".rejected",
+		},
+		{
+			name:       "skip checks",
+			skipChecks: true,
+			rewrite:    "Short.\n",
+		},
+		{
+			name:    "refused",
+			rewrite: "I'm sorry, but I can't help with rewriting this file.\n",
+			err:     true,
+			kept:    ".refused",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			outputFile := filepath.Join(dir, "notes.md")
+			tempFile := filepath.Join(dir, ".notes.md.pls-1")
+			assert.NoError(t, os.WriteFile(outputFile, []byte("Some notes that are long enough to be shortened by the rewrite.\n"), 0644))
+			assert.NoError(t, os.WriteFile(tempFile, []byte(tc.rewrite), 0644))
+
+			r := &Runner{
+				args:   Args{SkipChecks: tc.skipChecks},
+				config: &Config{ReplaceChecks: ReplaceChecks{MinLength: &minLength}},
+			}
+			err := r.checkRewrite(tempFile, outputFile)
+			if !tc.err {
+				assert.NoError(t, err)
+				return
+			}
+			assert.Error(t, err)
+			assert.FileExists(t, outputFile+tc.kept)
+		})
+	}
+}
+
+func TestIsRewrite(t *testing.T) {
+	testCases := []struct {
+		name     string
+		args     Args
+		output   string
+		expected bool
+	}{
+		{name: "replace of the input", args: Args{InputFile: "notes.md", ReplaceInputFile: true}, output: "./notes.md", expected: true},
+		{name: "output argument", args: Args{InputFile: "notes.md", OutputFile: "summary.md"}, output: "summary.md"},
+		{name: "replace into another file", args: Args{InputFile: "notes.md", OutputFile: "summary.md", ReplaceInputFile: true}, output: "summary.md"},
+		{name: "patch", args: Args{InputFile: "notes.md", Patch: true}, output: "notes.md", expected: true},
+		{name: "edit", args: Args{Edit: true}, output: "main.go", expected: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := &Runner{args: tc.args}
+			assert.Equal(t, tc.expected, r.isRewrite(tc.output))
+		})
+	}
+}
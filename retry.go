@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+const (
+	retryBaseDelay = time.Second
+	retryMaxDelay  = 30 * time.Second
+)
+
+// resumeInstruction asks the model to continue a response that was cut off mid-stream
+const resumeInstruction = "Your response was cut off. Continue exactly where it stopped, without repeating anything."
+
+func SetRetries(retries int) ChatOptions {
+	return func(c *Chat) {
+		c.retries = retries
+	}
+}
+
+// isRetryable reports whether the error is a rate limit, a server error or a network error
+func isRetryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var apiErr *openai.APIError
+	if errors.As(err, &apiErr) {
+		return retryableStatus(apiErr.HTTPStatusCode)
+	}
+
+	var reqErr *openai.RequestError
+	if errors.As(err, &reqErr) {
+		return retryableStatus(reqErr.HTTPStatusCode)
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	return errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+func retryableStatus(status int) bool {
+	return status == http.StatusTooManyRequests || status >= http.StatusInternalServerError
+}
+
+// backoff returns a random delay up to an exponentially growing limit ("full jitter")
+func backoff(attempt int) time.Duration {
+	limit := retryBaseDelay << attempt
+	if limit <= 0 || limit > retryMaxDelay {
+		limit = retryMaxDelay
+	}
+	return time.Duration(rand.Int63n(int64(limit)))
+}
+
+// openStream creates the completion stream, retrying transient errors
+func (c *Chat) openStream(ctx context.Context, client *openai.Client, req openai.ChatCompletionRequest, retries int) (*openai.ChatCompletionStream, error) {
+	for attempt := 0; ; attempt++ {
+		stream, err := client.CreateChatCompletionStream(ctx, req)
+		if err == nil || attempt >= retries || !isRetryable(err) {
+			return stream, err
+		}
+
+		err = c.waitToRetry(ctx, err, attempt, retries)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// waitToRetry reports the error on stderr, and sleeps before the next attempt
+func (c *Chat) waitToRetry(ctx context.Context, err error, attempt int, retries int) error {
+	c.mu.Lock()
+	c.retried++
+	c.mu.Unlock()
+
+	delay := backoff(attempt)
+	fmt.Fprintf(os.Stderr, "[%v, retrying in %s (%d/%d)]\n", err, delay.Round(time.Millisecond), attempt+1, retries)
+
+	select {
+	case <-time.After(delay):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// resumeRequest continues the request from the partial response that was already received
+func resumeRequest(req openai.ChatCompletionRequest, partial string) openai.ChatCompletionRequest {
+	messages := make([]openai.ChatCompletionMessage, len(req.Messages), len(req.Messages)+2)
+	copy(messages, req.Messages)
+
+	req.Messages = append(messages,
+		openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: partial},
+		openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: resumeInstruction},
+	)
+	return req
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/hayeah/pls/tokens"
+)
+
+// defaultReviewTemplate reviews a chunk of the diff when review.template isn't configured
+const defaultReviewTemplate = `Review these changes to {{.Data.path}} like a careful senior engineer. Look for bugs, security
+problems, race conditions, missing error handling and edge cases. Skip style nits and praise.
+
+Each line of the diff starts with its line number in the new version of the file, blank for deleted
+lines. Reply with one finding per line, as "LINE: finding", where LINE is that line number. Reply NONE
+if there is nothing worth raising.
+
+{{.Diff}}`
+
+// ReviewConfig configures pls review
+type ReviewConfig struct {
+	// Template reviews a chunk of the diff of a file, given as {{.Input}} and {{.Diff}}, with the path
+	// of the file as {{.Data.path}}. Findings are replied one per line, as "LINE: finding".
+	Template string `yaml:"template"`
+}
+
+type ReviewArgs struct {
+	Ref      string `arg:"positional" help:"review the changes since this ref, e.g. main. Defaults to the staged changes."`
+	Template string `arg:"-t,--template" help:"template that reviews a chunk of the diff, overrides the config"`
+	Model    string `arg:"-m,--model" help:"model to use, overrides frontmatter and config"`
+	Jobs     int    `arg:"-j,--jobs" default:"4" help:"how many chunks are reviewed at once"`
+}
+
+// fileDiff is the diff of one file
+type fileDiff struct {
+	path string
+	diff string
+}
+
+// reviewFinding is a finding of the review. Line is 0 for findings about the whole change.
+type reviewFinding struct {
+	line int
+	text string
+}
+
+var (
+	diffFilePattern      = regexp.MustCompile(`^diff --git a/.* b/(.*)$`)
+	diffHunkPattern      = regexp.MustCompile(`^@@ -\d+(?:,\d+)? \+(\d+)(?:,\d+)? @@`)
+	reviewFindingPattern = regexp.MustCompile(`^\s*[-*]?\s*(?:(?i:line)\s*|L)?(\d+)\s*[:.)-]\s*(.+)$`)
+)
+
+// runReview reviews the diff file by file, in chunks that fit the context window, and prints the
+// findings of each file with their lines
+func runReview(argv []string) error {
+	var args ReviewArgs
+	parseArgs("pls review", &args, argv)
+
+	diffArgs := []string{"diff", "--staged"}
+	if args.Ref != "" {
+		diffArgs = []string{"diff", args.Ref}
+	}
+	diff, err := git(diffArgs...)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(diff) == "" {
+		if args.Ref == "" {
+			return errors.New("no staged changes to review. Stage them with git add, or name a ref to review the changes since")
+		}
+		return fmt.Errorf("no changes since %s", args.Ref)
+	}
+
+	r, err := NewRunner(Args{Model: args.Model})
+	if err != nil {
+		return err
+	}
+
+	templateName := r.config.Review.Template
+	mergeString(&templateName, args.Template)
+
+	template := defaultReviewTemplate
+	if templateName != "" {
+		r.args.PromptFile = templateName
+		template, err = r.ReadTemplate()
+		if err != nil {
+			return err
+		}
+	}
+
+	render := func(path string, diff string) (string, *TemplateFrontMatter, error) {
+		prompt, fm, err := RenderTemplate(template, TemplateData{
+			Input: diff,
+			Diff:  diff,
+			Data:  map[string]any{"path": path},
+		})
+		if err != nil {
+			return "", nil, err
+		}
+		r.applyFlags(fm)
+		return prompt, fm, nil
+	}
+
+	// the diff of each file gets what's left of the context window after the prompt and the response
+	empty, fm, err := render("", "")
+	if err != nil {
+		return err
+	}
+	r.frontMatter = fm
+	model := r.Model(fm)
+	overhead, err := promptTokens(model, empty, fm)
+	if err != nil {
+		return err
+	}
+	size := tokens.ContextWindow(model) - r.reservedOutput(fm) - overhead
+
+	type reviewChunk struct {
+		file   int
+		prompt string
+	}
+	files := splitFileDiffs(diff)
+	var chunks []reviewChunk
+	for i, file := range files {
+		parts, err := tokens.Split(model, numberDiffLines(file.diff), size, 0)
+		if err != nil {
+			return err
+		}
+		for _, part := range parts {
+			prompt, _, err := render(file.path, part)
+			if err != nil {
+				return err
+			}
+			chunks = append(chunks, reviewChunk{file: i, prompt: prompt})
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "[reviewing %d files in %d chunks]\n", len(files), len(chunks))
+
+	jobs := args.Jobs
+	if jobs < 1 {
+		jobs = 1
+	}
+	responses := make([]string, len(chunks))
+	errs := make([]error, len(chunks))
+	slots := make(chan struct{}, jobs)
+	var wg sync.WaitGroup
+	for i, chunk := range chunks {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(i int, prompt string) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			responses[i], errs[i] = r.complete(fm, prompt)
+		}(i, chunk.prompt)
+	}
+	wg.Wait()
+
+	findings := make([][]reviewFinding, len(files))
+	for i, chunk := range chunks {
+		if errs[i] != nil {
+			return fmt.Errorf("%s: %w", files[chunk.file].path, errs[i])
+		}
+		findings[chunk.file] = append(findings[chunk.file], parseFindings(responses[i])...)
+	}
+
+	var total int
+	for i, file := range files {
+		if len(findings[i]) == 0 {
+			continue
+		}
+		if total > 0 {
+			fmt.Println()
+		}
+		total += len(findings[i])
+
+		sort.SliceStable(findings[i], func(a, b int) bool { return findings[i][a].line < findings[i][b].line })
+		for _, finding := range findings[i] {
+			if finding.line == 0 {
+				fmt.Printf("%s: %s\n", file.path, finding.text)
+			} else {
+				fmt.Printf("%s:%d: %s\n", file.path, finding.line, finding.text)
+			}
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "[%d findings]\n", total)
+	return nil
+}
+
+// splitFileDiffs cuts a git diff into the diffs of its files
+func splitFileDiffs(diff string) []fileDiff {
+	var files []fileDiff
+	for _, line := range strings.SplitAfter(diff, "\n") {
+		if match := diffFilePattern.FindStringSubmatch(strings.TrimSuffix(line, "\n")); match != nil {
+			files = append(files, fileDiff{path: match[1]})
+		}
+		if len(files) == 0 {
+			continue
+		}
+		files[len(files)-1].diff += line
+	}
+	return files
+}
+
+// numberDiffLines prefixes the lines of the hunks with their line number in the new version of the
+// file, so findings can name their lines. The file header is left out.
+func numberDiffLines(diff string) string {
+	var b strings.Builder
+	line := 0
+	inHunk := false
+	for _, text := range strings.Split(strings.TrimSuffix(diff, "\n"), "\n") {
+		if match := diffHunkPattern.FindStringSubmatch(text); match != nil {
+			line, _ = strconv.Atoi(match[1])
+			inHunk = true
+			b.WriteString(text + "\n")
+			continue
+		}
+		if !inHunk {
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(text, "-"):
+			fmt.Fprintf(&b, "%6s %s\n", "", text)
+		case strings.HasPrefix(text, "+"), strings.HasPrefix(text, " "):
+			fmt.Fprintf(&b, "%6d %s\n", line, text)
+			line++
+		default:
+			// "\ No newline at end of file"
+			b.WriteString(text + "\n")
+		}
+	}
+	return b.String()
+}
+
+// parseFindings reads the "LINE: finding" lines of a review. Other lines are findings about the whole
+// change.
+func parseFindings(response string) []reviewFinding {
+	var findings []reviewFinding
+	for _, text := range strings.Split(response, "\n") {
+		text = strings.TrimSpace(text)
+		if text == "" || strings.EqualFold(strings.Trim(text, "."), "none") {
+			continue
+		}
+
+		if match := reviewFindingPattern.FindStringSubmatch(text); match != nil {
+			line, _ := strconv.Atoi(match[1])
+			findings = append(findings, reviewFinding{line: line, text: match[2]})
+			continue
+		}
+		findings = append(findings, reviewFinding{text: text})
+	}
+	return findings
+}
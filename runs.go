@@ -0,0 +1,180 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// RunRecord is the transcript of a completion, kept so runs can be rated with pls feedback
+type RunRecord struct {
+	ID       string     `json:"id"`
+	Time     time.Time  `json:"time"`
+	Template string     `json:"template"`
+	Model    string     `json:"model"`
+	Prompt   string     `json:"prompt"`
+	Response string     `json:"response"`
+	Feedback []Feedback `json:"feedback,omitempty"`
+}
+
+// Feedback is a rating of a run, from 1 to 5
+type Feedback struct {
+	Time   time.Time `json:"time"`
+	Rating int       `json:"rating"`
+	Note   string    `json:"note,omitempty"`
+}
+
+// RunsDir returns the directory of the run transcripts
+func RunsDir() (string, error) {
+	dir, err := DataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "runs"), nil
+}
+
+// newRunID returns an ID that sorts by time, e.g. 20240102-150405-3f2a
+func newRunID(t time.Time) string {
+	suffix := make([]byte, 2)
+	_, err := rand.Read(suffix)
+	if err != nil {
+		panic(err)
+	}
+	return t.Format("20060102-150405") + "-" + hex.EncodeToString(suffix)
+}
+
+func runPath(id string) (string, error) {
+	if id == "" || strings.ContainsAny(id, `/\`) || strings.HasPrefix(id, ".") {
+		return "", fmt.Errorf("invalid run id: %q", id)
+	}
+
+	dir, err := RunsDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, id+".json"), nil
+}
+
+// ReadRun loads a run transcript. The id "last" is the latest run.
+func ReadRun(id string) (*RunRecord, error) {
+	if id == "last" {
+		runs, err := ListRuns()
+		if err != nil {
+			return nil, err
+		}
+		if len(runs) == 0 {
+			return nil, errors.New("no runs are recorded yet")
+		}
+		return runs[len(runs)-1], nil
+	}
+
+	file, err := runPath(id)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("no run %s", id)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var run RunRecord
+	err = json.Unmarshal(data, &run)
+	if err != nil {
+		return nil, fmt.Errorf("run %s: %w", id, err)
+	}
+
+	return &run, nil
+}
+
+// ListRuns returns the recorded runs, oldest first
+func ListRuns() ([]*RunRecord, error) {
+	dir, err := RunsDir()
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var runs []*RunRecord
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok || entry.IsDir() {
+			continue
+		}
+
+		run, err := ReadRun(id)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+
+	sort.Slice(runs, func(i, j int) bool {
+		return runs[i].Time.Before(runs[j].Time)
+	})
+
+	return runs, nil
+}
+
+// Save writes the run transcript to disk
+func (run *RunRecord) Save() error {
+	file, err := runPath(run.ID)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(file), 0755)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(run, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(file, data, 0644)
+}
+
+// RecordRun saves the transcript of the completion, unless disabled with no_run_log
+func (r *Runner) RecordRun(prompt string, response string) error {
+	if r.config.NoRunLog {
+		return nil
+	}
+
+	now := time.Now()
+	run := &RunRecord{
+		ID:       newRunID(now),
+		Time:     now,
+		Template: absPath(r.templatePath),
+		Model:    r.Model(r.frontMatter),
+		Prompt:   prompt,
+		Response: strings.TrimSpace(response),
+	}
+
+	err := run.Save()
+	if err != nil {
+		return err
+	}
+
+	r.runID = run.ID
+	return nil
+}
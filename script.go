@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// positionalArgs returns the positional arguments given after the prompt file
+func (r *Runner) positionalArgs() []string {
+	var args []string
+	for _, arg := range []string{r.args.InputFile, r.args.OutputFile} {
+		if arg != "" {
+			args = append(args, arg)
+		}
+	}
+	return append(args, r.args.ScriptArgs...)
+}
+
+// BindScriptArgs binds positional arguments to the names declared by the frontmatter's args, so a
+// prompt file can be run as a script:
+//
+//	#!/usr/bin/env pls
+//	---
+//	args: [input, language]
+//	---
+//	Translate into {{.Args.language}}: {{.Input}}
+//
+// The names "input" and "output" set the input and output files. The input is read from stdin
+// when no input argument is declared. Frontmatter replace and output are applied as defaults.
+func (r *Runner) BindScriptArgs(fm *TemplateFrontMatter) (map[string]string, error) {
+	if fm.Output != "" && r.args.OutputFile == "" && len(fm.Args) == 0 {
+		r.args.OutputFile = fm.Output
+	}
+
+	if fm.Replace {
+		r.args.ReplaceInputFile = true
+	}
+
+	if len(fm.Args) == 0 {
+		if len(r.args.ScriptArgs) > 0 {
+			return nil, fmt.Errorf("unexpected arguments: %s", strings.Join(r.args.ScriptArgs, " "))
+		}
+		return nil, nil
+	}
+
+	positional := r.positionalArgs()
+	if len(positional) > len(fm.Args) {
+		return nil, fmt.Errorf("too many arguments, usage: %s", scriptUsage(r.args.PromptFile, fm.Args))
+	}
+
+	if len(positional) < len(fm.Args) {
+		return nil, fmt.Errorf("missing arguments, usage: %s", scriptUsage(r.args.PromptFile, fm.Args))
+	}
+
+	r.args.InputFile = ""
+	r.args.OutputFile = fm.Output
+
+	bound := map[string]string{}
+	for i, name := range fm.Args {
+		value := positional[i]
+		bound[name] = value
+
+		switch name {
+		case "input":
+			r.args.InputFile = value
+		case "output":
+			r.args.OutputFile = value
+		}
+	}
+
+	return bound, nil
+}
+
+func scriptUsage(script string, names []string) string {
+	usage := script
+	for _, name := range names {
+		usage += " <" + name + ">"
+	}
+	return usage
+}
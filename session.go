@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// Session is a conversation saved across invocations with --session
+type Session struct {
+	Name     string                         `json:"name"`
+	Updated  time.Time                      `json:"updated"`
+	Messages []openai.ChatCompletionMessage `json:"messages"`
+}
+
+// DataDir returns the directory for pls data, under $XDG_DATA_HOME or ~/.local/share
+func DataDir() (string, error) {
+	dataHome := os.Getenv("XDG_DATA_HOME")
+	if dataHome == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dataHome = filepath.Join(home, ".local", "share")
+	}
+	return filepath.Join(dataHome, "pls"), nil
+}
+
+// SessionPath returns the file of a named session
+func SessionPath(name string) (string, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) || name == "." || name == ".." {
+		return "", fmt.Errorf("invalid session name: %q", name)
+	}
+
+	dir, err := DataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "sessions", name+".json"), nil
+}
+
+// ReadSession loads a saved session. A session that doesn't exist yet is empty.
+func ReadSession(name string) (*Session, error) {
+	file, err := SessionPath(name)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &Session{Name: name}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var session Session
+	err = json.Unmarshal(data, &session)
+	if err != nil {
+		return nil, fmt.Errorf("session %s: %w", name, err)
+	}
+
+	return &session, nil
+}
+
+// Save writes the session to disk
+func (s *Session) Save() error {
+	file, err := SessionPath(s.Name)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(file), 0755)
+	if err != nil {
+		return err
+	}
+
+	s.Updated = time.Now()
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(file, data, 0644)
+}
+
+// Append adds a turn of the conversation
+func (s *Session) Append(prompt string, response string) {
+	s.Messages = append(s.Messages,
+		openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: prompt},
+		openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: strings.TrimSpace(response)},
+	)
+}
+
+// LoadSession adds the history of --session to the messages sent before the prompt
+func (r *Runner) LoadSession(fm *TemplateFrontMatter) error {
+	if r.args.Session == "" {
+		return nil
+	}
+
+	session, err := ReadSession(r.args.Session)
+	if err != nil {
+		return err
+	}
+
+	r.session = session
+	fm.Messages = append(fm.Messages, session.Messages...)
+	return nil
+}
+
+// SaveSession records the prompt and response in --session
+func (r *Runner) SaveSession(prompt string, response string) error {
+	if r.session == nil {
+		return nil
+	}
+
+	r.session.Append(prompt, response)
+	err := r.session.Save()
+	if err != nil {
+		return err
+	}
+
+	sessionPath, err := SessionPath(r.session.Name)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "[saved to session %s]\n", fileLink(sessionPath))
+	return nil
+}
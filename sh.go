@@ -0,0 +1,39 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"text/template"
+)
+
+// allowExec enables {{sh}} in every template, for --allow-exec. Set at startup.
+var allowExec bool
+
+// shellFuncs returns the template functions that run commands, enabled if allowed by --allow-exec or
+// the frontmatter
+func shellFuncs(fm *TemplateFrontMatter) template.FuncMap {
+	if !allowExec && !fm.Exec {
+		return template.FuncMap{"sh": execDisabled}
+	}
+	return template.FuncMap{"sh": runShell}
+}
+
+func execDisabled(command string) (string, error) {
+	return "", errors.New("running commands requires --allow-exec or exec: true in the frontmatter")
+}
+
+// runShell returns the output of the command, for {{sh "git diff --staged"}}. The command's stderr
+// goes to stderr.
+func runShell(command string) (string, error) {
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Stderr = os.Stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("%q: %w", command, err)
+	}
+
+	return string(out), nil
+}
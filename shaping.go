@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net/http"
+	"os"
+)
+
+// RequestShaping adds headers and query parameters to every request sent to the model API, for
+// gateways and proxies in front of it. Values may reference environment variables, e.g. $TENANT_TOKEN.
+type RequestShaping struct {
+	Headers map[string]string `yaml:"headers"`
+	Query   map[string]string `yaml:"query"`
+}
+
+// Empty reports whether there is nothing to add
+func (s RequestShaping) Empty() bool {
+	return len(s.Headers) == 0 && len(s.Query) == 0
+}
+
+// Apply adds the headers and query parameters to the request
+func (s RequestShaping) Apply(req *http.Request) {
+	for name, value := range s.Headers {
+		req.Header.Set(name, os.ExpandEnv(value))
+	}
+
+	if len(s.Query) == 0 {
+		return
+	}
+
+	query := req.URL.Query()
+	for name, value := range s.Query {
+		query.Set(name, os.ExpandEnv(value))
+	}
+	req.URL.RawQuery = query.Encode()
+}
+
+// shapingTransport applies the request shaping to the requests of the go-openai client
+type shapingTransport struct {
+	shaping RequestShaping
+	base    http.RoundTripper
+}
+
+func (t *shapingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// a RoundTripper must not modify the request it is given
+	req = req.Clone(req.Context())
+	t.shaping.Apply(req)
+	return t.base.RoundTrip(req)
+}
+
+// HTTPClient returns a client that shapes its requests, sent with the base transport
+func (s RequestShaping) HTTPClient(base http.RoundTripper) *http.Client {
+	if s.Empty() {
+		return &http.Client{Transport: base}
+	}
+	return &http.Client{Transport: &shapingTransport{shaping: s, base: base}}
+}
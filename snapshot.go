@@ -0,0 +1,398 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const snapshotManifest = "manifest.json"
+
+// SnapshotConfig configures the snapshots taken before pls batch and --edit change many files. A
+// snapshot replaces the backups of the individual files.
+type SnapshotConfig struct {
+	// Disabled backs up the files one by one instead
+	Disabled bool `yaml:"disabled"`
+	// Keep is how many snapshots are kept. 0 keeps all of them.
+	Keep int `yaml:"keep"`
+}
+
+// Snapshot is the state of the files before a bulk operation changed them
+type Snapshot struct {
+	ID      string         `json:"id"`
+	Created time.Time      `json:"created"`
+	Command string         `json:"command"`
+	Files   []SnapshotFile `json:"files"`
+}
+
+// SnapshotFile is a file of a snapshot. Files that didn't exist are removed on restore.
+type SnapshotFile struct {
+	// Path is absolute, so the snapshot restores from any working directory
+	Path    string      `json:"path"`
+	Existed bool        `json:"existed"`
+	Mode    fs.FileMode `json:"mode,omitempty"`
+}
+
+type RestoreSnapshotArgs struct {
+	ID  string `arg:"positional" help:"snapshot to restore. Lists the snapshots if omitted."`
+	Yes bool   `arg:"-y,--yes" help:"restore without asking for confirmation"`
+}
+
+// commandLine is the command pls was run with, to describe what a snapshot or commit was made by
+func commandLine() string {
+	return strings.Join(append([]string{"pls"}, os.Args[1:]...), " ")
+}
+
+func snapshotDir() (string, error) {
+	dir, err := DataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "snapshots"), nil
+}
+
+// takeSnapshot saves the files that the command is about to change, and returns the snapshot's ID.
+// It returns "" if snapshots are disabled, so the files are backed up one by one.
+func (r *Runner) takeSnapshot(paths []string) (string, error) {
+	config := r.config.Snapshot
+	if config.Disabled || r.args.NoBackup || len(paths) == 0 {
+		return "", nil
+	}
+
+	dir, err := snapshotDir()
+	if err != nil {
+		return "", err
+	}
+	err = os.MkdirAll(dir, 0700)
+	if err != nil {
+		return "", err
+	}
+
+	snapshot := Snapshot{Created: time.Now(), Command: commandLine()}
+	seen := map[string]bool{}
+	for _, path := range paths {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return "", err
+		}
+		if seen[abs] {
+			continue
+		}
+		seen[abs] = true
+
+		file := SnapshotFile{Path: abs}
+		info, err := os.Stat(abs)
+		switch {
+		case err == nil:
+			file.Existed = true
+			file.Mode = info.Mode().Perm()
+		case !errors.Is(err, fs.ErrNotExist):
+			return "", err
+		}
+		snapshot.Files = append(snapshot.Files, file)
+	}
+
+	// IDs sort in time order. A second snapshot in the same second gets a suffix.
+	id := snapshot.Created.Format("20060102-150405")
+	for n := 2; ; n++ {
+		_, err := os.Stat(filepath.Join(dir, id+".tar.gz"))
+		if errors.Is(err, fs.ErrNotExist) {
+			break
+		}
+		id = fmt.Sprintf("%s-%d", snapshot.Created.Format("20060102-150405"), n)
+	}
+	snapshot.ID = id
+
+	err = writeSnapshot(filepath.Join(dir, id+".tar.gz"), snapshot)
+	if err != nil {
+		return "", fmt.Errorf("snapshot: %w", err)
+	}
+
+	if config.Keep > 0 {
+		err = pruneSnapshots(dir, config.Keep)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "[snapshot %s of %s, pls restore-snapshot %s reverts them]\n", id, fileCount(len(snapshot.Files)), id)
+	return id, nil
+}
+
+// writeSnapshot archives the manifest, followed by the files that exist. The manifest comes first, so
+// listing the snapshots doesn't read the files.
+func writeSnapshot(path string, snapshot Snapshot) (err error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			os.Remove(path)
+		}
+	}()
+	defer f.Close()
+
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+
+	manifest, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = writeTarFile(tw, snapshotManifest, manifest, 0600)
+	if err != nil {
+		return err
+	}
+
+	for i, file := range snapshot.Files {
+		if !file.Existed {
+			continue
+		}
+		content, err := os.ReadFile(file.Path)
+		if err != nil {
+			return err
+		}
+		err = writeTarFile(tw, snapshotEntry(i), content, file.Mode)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = tw.Close()
+	if err != nil {
+		return err
+	}
+	err = gz.Close()
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// snapshotEntry names the archive entry of the ith file of the manifest
+func snapshotEntry(i int) string {
+	return fmt.Sprintf("files/%d", i)
+}
+
+func writeTarFile(tw *tar.Writer, name string, content []byte, mode fs.FileMode) error {
+	err := tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    int64(mode),
+		Size:    int64(len(content)),
+		ModTime: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = tw.Write(content)
+	return err
+}
+
+// readSnapshot reads the manifest of the snapshot, and with files, the content of its files by entry
+// name
+func readSnapshot(path string, files bool) (*Snapshot, map[string][]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, nil, err
+	}
+	tr := tar.NewReader(gz)
+
+	header, err := tr.Next()
+	if err != nil {
+		return nil, nil, err
+	}
+	if header.Name != snapshotManifest {
+		return nil, nil, fmt.Errorf("%s: no manifest", path)
+	}
+
+	var snapshot Snapshot
+	err = json.NewDecoder(tr).Decode(&snapshot)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if !files {
+		return &snapshot, nil, nil
+	}
+
+	contents := map[string][]byte{}
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, nil, err
+		}
+		contents[header.Name] = content
+	}
+	return &snapshot, contents, nil
+}
+
+// snapshotFiles returns the snapshot archives, oldest first
+func snapshotFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	modified := map[string]time.Time{}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".tar.gz") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, entry.Name())
+		modified[entry.Name()] = info.ModTime()
+	}
+
+	// by time rather than name, which sorts a suffixed ID before the ID of the same second
+	sort.SliceStable(files, func(i, j int) bool {
+		return modified[files[i]].Before(modified[files[j]])
+	})
+	return files, nil
+}
+
+// pruneSnapshots keeps the newest snapshots, and removes the rest
+func pruneSnapshots(dir string, keep int) error {
+	files, err := snapshotFiles(dir)
+	if err != nil {
+		return err
+	}
+	if len(files) <= keep {
+		return nil
+	}
+
+	for _, file := range files[:len(files)-keep] {
+		err := os.Remove(filepath.Join(dir, file))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runRestoreSnapshot puts the files of a snapshot back as they were, or lists the snapshots
+func runRestoreSnapshot(argv []string) error {
+	var args RestoreSnapshotArgs
+	parseArgs("pls restore-snapshot", &args, argv)
+
+	dir, err := snapshotDir()
+	if err != nil {
+		return err
+	}
+
+	if args.ID == "" {
+		return listSnapshots(dir)
+	}
+
+	if strings.ContainsAny(args.ID, `/\`) {
+		return fmt.Errorf("invalid snapshot: %q", args.ID)
+	}
+
+	snapshot, contents, err := readSnapshot(filepath.Join(dir, args.ID+".tar.gz"), true)
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("no snapshot %s, see pls restore-snapshot for the list", args.ID)
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "[snapshot %s, taken %s by %s]\n", snapshot.ID, snapshot.Created.Format(time.RFC1123), snapshot.Command)
+	for _, file := range snapshot.Files {
+		action := "restore"
+		if !file.Existed {
+			action = "remove"
+		}
+		fmt.Fprintf(os.Stderr, "  %-7s  %s\n", action, file.Path)
+	}
+
+	if !args.Yes {
+		ok, err := confirm(fmt.Sprintf("Restore %s?", fileCount(len(snapshot.Files))))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errors.New("restore-snapshot: canceled")
+		}
+	}
+
+	for i, file := range snapshot.Files {
+		err := restoreSnapshotFile(file, contents[snapshotEntry(i)])
+		if err != nil {
+			return fmt.Errorf("%s: %w", file.Path, err)
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "[restored %s]\n", fileCount(len(snapshot.Files)))
+	return nil
+}
+
+func restoreSnapshotFile(file SnapshotFile, content []byte) error {
+	if !file.Existed {
+		err := os.Remove(file.Path)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	err := os.MkdirAll(filepath.Dir(file.Path), 0755)
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(file.Path, content, file.Mode)
+	if err != nil {
+		return err
+	}
+	// WriteFile keeps the mode of a file that exists
+	return os.Chmod(file.Path, file.Mode)
+}
+
+func listSnapshots(dir string) error {
+	files, err := snapshotFiles(dir)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		fmt.Fprintln(os.Stderr, "no snapshots")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for i := len(files) - 1; i >= 0; i-- {
+		snapshot, _, err := readSnapshot(filepath.Join(dir, files[i]), false)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", snapshot.ID, snapshot.Created.Format("2006-01-02 15:04"), fileCount(len(snapshot.Files)), snapshot.Command)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	root := t.TempDir()
+	notes := filepath.Join(root, "notes.md")
+	script := filepath.Join(root, "bin", "run.sh")
+	created := filepath.Join(root, "new", "todo.md")
+	assert.NoError(t, os.WriteFile(notes, []byte("notes\n"), 0600))
+	assert.NoError(t, os.MkdirAll(filepath.Dir(script), 0755))
+	assert.NoError(t, os.WriteFile(script, []byte("#!/bin/sh\n"), 0755))
+
+	r := &Runner{config: &Config{}}
+	id, err := r.takeSnapshot([]string{notes, script, created, notes})
+	assert.NoError(t, err)
+	assert.NotEmpty(t, id)
+
+	dir, err := snapshotDir()
+	assert.NoError(t, err)
+	snapshot, _, err := readSnapshot(filepath.Join(dir, id+".tar.gz"), false)
+	assert.NoError(t, err)
+	assert.Equal(t, []SnapshotFile{
+		{Path: notes, Existed: true, Mode: 0600},
+		{Path: script, Existed: true, Mode: 0755},
+		{Path: created},
+	}, snapshot.Files)
+
+	// a second snapshot of the same second gets its own ID
+	second, err := r.takeSnapshot([]string{notes})
+	assert.NoError(t, err)
+	assert.NotEqual(t, id, second)
+
+	// the bulk operation changes the files
+	assert.NoError(t, os.WriteFile(notes, []byte("rewritten\n"), 0644))
+	assert.NoError(t, os.Chmod(notes, 0644))
+	assert.NoError(t, os.Remove(script))
+	assert.NoError(t, os.MkdirAll(filepath.Dir(created), 0755))
+	assert.NoError(t, os.WriteFile(created, []byte("todo\n"), 0644))
+
+	assert.NoError(t, runRestoreSnapshot([]string{id, "--yes"}))
+
+	content, err := os.ReadFile(notes)
+	assert.NoError(t, err)
+	assert.Equal(t, "notes\n", string(content))
+	info, err := os.Stat(notes)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	content, err = os.ReadFile(script)
+	assert.NoError(t, err)
+	assert.Equal(t, "#!/bin/sh\n", string(content))
+	info, err = os.Stat(script)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0755), info.Mode().Perm())
+
+	assert.NoFileExists(t, created)
+
+	// disabled snapshots leave the backups to the files
+	r = &Runner{config: &Config{Snapshot: SnapshotConfig{Disabled: true}}}
+	id, err = r.takeSnapshot([]string{notes})
+	assert.NoError(t, err)
+	assert.Empty(t, id)
+}
+
+func TestPruneSnapshots(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+
+	// a suffixed ID sorts before its second by name, but is newer
+	files := []string{"20240301-090000.tar.gz", "20240301-090001.tar.gz", "20240301-090001-2.tar.gz", "20240301-090002.tar.gz"}
+	for i, file := range files {
+		path := filepath.Join(dir, file)
+		assert.NoError(t, os.WriteFile(path, nil, 0600))
+		modified := start.Add(time.Duration(i) * time.Second)
+		assert.NoError(t, os.Chtimes(path, modified, modified))
+	}
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "notes.txt"), nil, 0600))
+
+	assert.NoError(t, pruneSnapshots(dir, 2))
+
+	left, err := snapshotFiles(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"20240301-090001-2.tar.gz", "20240301-090002.tar.gz"}, left)
+	assert.FileExists(t, filepath.Join(dir, "notes.txt"))
+
+	// keeping more than there are removes nothing
+	assert.NoError(t, pruneSnapshots(dir, 5))
+	left, err = snapshotFiles(dir)
+	assert.NoError(t, err)
+	assert.Len(t, left, 2)
+}
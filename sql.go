@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+const (
+	defaultSQLMaxRows = 100
+	sqlMaxCellLength  = 80
+)
+
+// SQLConfig configures the sql: input loader. pls links no database drivers, the queries run through the
+// sqlite3 and psql command line clients.
+type SQLConfig struct {
+	// URL is the connection string, e.g. postgres://user@localhost/app or sqlite:app.db
+	URL string `yaml:"url"`
+	// Databases are named connection strings, for pls sql --db
+	Databases map[string]string `yaml:"databases"`
+	// Schema adds the schemas of the tables that the query reads to the input, true by default
+	Schema *bool `yaml:"schema"`
+	// MaxRows is the number of rows rendered for the prompt, 100 by default
+	MaxRows int `yaml:"max_rows"`
+}
+
+// readOnlyStatement matches the statements the sql: loader runs. The clients are read-only as well.
+var readOnlyStatement = regexp.MustCompile(`(?i)^\s*(select|with|explain|values|show|table)\b`)
+
+// sqlTableReference captures the table names after FROM and JOIN
+var sqlTableReference = regexp.MustCompile(`(?i)\b(?:from|join)\s+((?:\w+\.)?\w+)`)
+
+// sqlClient runs queries with the command line client of a database
+type sqlClient interface {
+	// Query returns the result as CSV, with a header row
+	Query(query string) ([]byte, error)
+	// Schema describes the tables
+	Schema(tables []string) (string, error)
+	// Tables lists the tables of the database
+	Tables() ([]string, error)
+	// Dialect names the SQL dialect, for the model
+	Dialect() string
+}
+
+// LoadSQL runs a read-only query, and renders its result as a table
+func LoadSQL(config SQLConfig, query string) (*LoadedInput, error) {
+	if !readOnlyStatement.MatchString(query) {
+		return nil, errors.New("sql: only read-only queries (SELECT, WITH, EXPLAIN...) are allowed")
+	}
+
+	client, err := newSQLClient(config.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := client.Query(query)
+	if err != nil {
+		return nil, err
+	}
+
+	records, err := csv.NewReader(bytes.NewReader(out)).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("sql: reading the result: %w", err)
+	}
+
+	var columns []string
+	var rows [][]string
+	if len(records) > 0 {
+		columns, rows = records[0], records[1:]
+	}
+
+	maxRows := config.MaxRows
+	if maxRows <= 0 {
+		maxRows = defaultSQLMaxRows
+	}
+
+	var text strings.Builder
+	if config.Schema == nil || *config.Schema {
+		tables := queryTables(query)
+		if len(tables) > 0 {
+			schema, err := client.Schema(tables)
+			if err != nil {
+				return nil, err
+			}
+			fmt.Fprintf(&text, "Schema:\n\n%s\n\n", strings.TrimSpace(schema))
+		}
+	}
+
+	fmt.Fprintf(&text, "Query:\n\n%s\n\n", strings.TrimSpace(query))
+	fmt.Fprintf(&text, "Result (%d rows):\n\n", len(rows))
+	writeTable(&text, columns, rows, maxRows)
+
+	data := map[string]any{
+		"query":   query,
+		"columns": columns,
+		"rows":    rows,
+	}
+	return &LoadedInput{Input: text.String(), Data: data}, nil
+}
+
+// writeTable renders the rows as a compact pipe-separated table, with long cells truncated
+func writeTable(w *strings.Builder, columns []string, rows [][]string, maxRows int) {
+	w.WriteString(strings.Join(columns, " | "))
+	w.WriteString("\n")
+
+	for i, row := range rows {
+		if i == maxRows {
+			fmt.Fprintf(w, "[%d more rows]\n", len(rows)-maxRows)
+			break
+		}
+
+		cells := make([]string, len(row))
+		for j, cell := range row {
+			cell = strings.Join(strings.Fields(cell), " ")
+			if len(cell) > sqlMaxCellLength {
+				cell = cell[:sqlMaxCellLength] + "..."
+			}
+			cells[j] = cell
+		}
+		w.WriteString(strings.Join(cells, " | "))
+		w.WriteString("\n")
+	}
+}
+
+// queryTables returns the tables after FROM and JOIN in the query, in order of appearance
+func queryTables(query string) []string {
+	seen := map[string]bool{}
+	var tables []string
+	for _, match := range sqlTableReference.FindAllStringSubmatch(query, -1) {
+		table := match[1]
+		if !seen[table] {
+			seen[table] = true
+			tables = append(tables, table)
+		}
+	}
+	return tables
+}
+
+func newSQLClient(url string) (sqlClient, error) {
+	switch {
+	case url == "":
+		return nil, errors.New("sql: url is not configured")
+
+	case strings.HasPrefix(url, "sqlite:"):
+		return sqliteClient{file: strings.TrimPrefix(strings.TrimPrefix(url, "sqlite:"), "//")}, nil
+
+	case strings.HasPrefix(url, "postgres://"), strings.HasPrefix(url, "postgresql://"):
+		return postgresClient{url: url}, nil
+
+	default:
+		return nil, fmt.Errorf("sql: unsupported url %q, expected postgres:// or sqlite:", url)
+	}
+}
+
+type sqliteClient struct {
+	file string
+}
+
+func (c sqliteClient) Query(query string) ([]byte, error) {
+	return runSQLClient(exec.Command("sqlite3", "-readonly", "-bail", "-header", "-csv", c.file, query))
+}
+
+func (c sqliteClient) Schema(tables []string) (string, error) {
+	var schema strings.Builder
+	for _, table := range tables {
+		out, err := runSQLClient(exec.Command("sqlite3", "-readonly", c.file, ".schema "+table))
+		if err != nil {
+			return "", err
+		}
+		schema.Write(out)
+	}
+	return schema.String(), nil
+}
+
+func (c sqliteClient) Tables() ([]string, error) {
+	out, err := c.Query("SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	return csvColumn(out)
+}
+
+func (c sqliteClient) Dialect() string {
+	return "SQLite"
+}
+
+type postgresClient struct {
+	url string
+}
+
+func (c postgresClient) Query(query string) ([]byte, error) {
+	cmd := exec.Command("psql", c.url, "--no-psqlrc", "--csv", "-v", "ON_ERROR_STOP=1", "-c", query)
+	cmd.Env = append(os.Environ(), "PGOPTIONS=-c default_transaction_read_only=on")
+	return runSQLClient(cmd)
+}
+
+func (c postgresClient) Schema(tables []string) (string, error) {
+	var names []string
+	for _, table := range tables {
+		if _, name, ok := strings.Cut(table, "."); ok {
+			table = name
+		}
+		// the names are \w+, so they can be quoted as they are
+		names = append(names, "'"+table+"'")
+	}
+
+	out, err := c.Query(`SELECT table_name, column_name, data_type FROM information_schema.columns
+WHERE table_name IN (` + strings.Join(names, ", ") + `) ORDER BY table_name, ordinal_position`)
+	if err != nil {
+		return "", err
+	}
+
+	records, err := csv.NewReader(bytes.NewReader(out)).ReadAll()
+	if err != nil {
+		return "", fmt.Errorf("sql: reading the schema: %w", err)
+	}
+
+	// one line per table: errors(id integer, message text, ...)
+	var schema strings.Builder
+	var current string
+	for _, record := range records[1:] {
+		table, column, dataType := record[0], record[1], record[2]
+		if table != current {
+			if current != "" {
+				schema.WriteString(")\n")
+			}
+			current = table
+			fmt.Fprintf(&schema, "%s(%s %s", table, column, dataType)
+			continue
+		}
+		fmt.Fprintf(&schema, ", %s %s", column, dataType)
+	}
+	if current != "" {
+		schema.WriteString(")\n")
+	}
+	return schema.String(), nil
+}
+
+func (c postgresClient) Tables() ([]string, error) {
+	out, err := c.Query(`SELECT table_name FROM information_schema.tables
+WHERE table_schema NOT IN ('pg_catalog', 'information_schema') ORDER BY table_name`)
+	if err != nil {
+		return nil, err
+	}
+	return csvColumn(out)
+}
+
+func (c postgresClient) Dialect() string {
+	return "PostgreSQL"
+}
+
+// csvColumn returns the first column of a CSV result, without its header
+func csvColumn(out []byte) ([]string, error) {
+	records, err := csv.NewReader(bytes.NewReader(out)).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("sql: reading the result: %w", err)
+	}
+
+	var values []string
+	for i, record := range records {
+		if i > 0 {
+			values = append(values, record[0])
+		}
+	}
+	return values, nil
+}
+
+// runSQLClient returns the output of the client, with its error message if it fails
+func runSQLClient(cmd *exec.Cmd) ([]byte, error) {
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		message := strings.TrimSpace(stderr.String())
+		if message == "" {
+			message = err.Error()
+		}
+		return nil, fmt.Errorf("sql: %s: %s", cmd.Args[0], message)
+	}
+	return out, nil
+}
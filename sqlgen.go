@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+const sqlGenerateInstruction = `Write a %s query that answers the question, for the database with this schema:
+
+%s
+
+Question: %s
+
+Respond with only the query, in a sql code block.`
+
+const sqlFixInstruction = `
+
+This query:
+
+%s
+
+failed with: %v
+
+Fix it.`
+
+// sqlFixRetries is how many times a query that fails EXPLAIN is sent back to be fixed
+const sqlFixRetries = 2
+
+type SQLArgs struct {
+	Question string `arg:"positional,required" help:"what the query should answer, e.g. \"top customers by revenue last month\""`
+	DB       string `arg:"--db" help:"database of sql.databases in the config. Defaults to sql.url"`
+	Validate bool   `arg:"--validate" help:"check the query with EXPLAIN, asking the model to fix it if it fails"`
+	Model    string `arg:"-m,--model" help:"model to use, overrides the config"`
+}
+
+// runSQL writes a query for a question, from the schema of the database. The query is printed and
+// never run, EXPLAIN is as far as --validate goes.
+func runSQL(argv []string) error {
+	var args SQLArgs
+	parseArgs("pls sql", &args, argv)
+
+	r, err := NewRunner(Args{Model: args.Model})
+	if err != nil {
+		return err
+	}
+
+	url := r.config.SQL.URL
+	if args.DB != "" {
+		var ok bool
+		url, ok = r.config.SQL.Databases[args.DB]
+		if !ok {
+			return fmt.Errorf("sql: no database %q in sql.databases", args.DB)
+		}
+	}
+
+	client, err := newSQLClient(url)
+	if err != nil {
+		return err
+	}
+
+	tables, err := client.Tables()
+	if err != nil {
+		return err
+	}
+	if len(tables) == 0 {
+		return fmt.Errorf("sql: the database has no tables")
+	}
+
+	schema, err := client.Schema(tables)
+	if err != nil {
+		return err
+	}
+
+	fm := &TemplateFrontMatter{}
+	r.applyFlags(fm)
+	r.frontMatter = fm
+
+	prompt := fmt.Sprintf(sqlGenerateInstruction, client.Dialect(), strings.TrimSpace(schema), args.Question)
+	for attempt := 0; ; attempt++ {
+		response, err := r.complete(fm, prompt)
+		if err != nil {
+			return err
+		}
+		query := generatedQuery(response)
+
+		if !readOnlyStatement.MatchString(query) {
+			fmt.Fprintln(os.Stderr, "[warning: this query is not read-only]")
+		}
+
+		if args.Validate {
+			_, err = client.Query("EXPLAIN " + query)
+			if err != nil && attempt < sqlFixRetries {
+				fmt.Fprintf(os.Stderr, "[EXPLAIN failed: %v, retrying (%d/%d)]\n", err, attempt+1, sqlFixRetries)
+				prompt += fmt.Sprintf(sqlFixInstruction, query, err)
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("the query still fails EXPLAIN after %d attempts: %w\n%s", attempt+1, err, query)
+			}
+			fmt.Fprintln(os.Stderr, "[validated with EXPLAIN]")
+		}
+
+		fmt.Println(query)
+		return nil
+	}
+}
+
+// generatedQuery takes the query out of the sql code block of the response, without a trailing semicolon
+func generatedQuery(response string) string {
+	query, _ := extractCode(response, "sql")
+	if query == "" {
+		query = stripCodeFence(response)
+	}
+	return strings.TrimSuffix(strings.TrimSpace(query), ";")
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	StatsOff     = "off"
+	StatsMinimal = "minimal"
+	StatsFull    = "full"
+)
+
+// price in dollars per million tokens, by model name prefix. The longest matching prefix wins.
+type price struct {
+	input  float64
+	output float64
+}
+
+var prices = map[string]price{
+	"gpt-3.5-turbo":     {0.5, 1.5},
+	"gpt-3.5-turbo-16k": {3, 4},
+	"gpt-4":             {30, 60},
+	"gpt-4-32k":         {60, 120},
+	"gpt-4-turbo":       {10, 30},
+	"gpt-4-1106":        {10, 30},
+	"gpt-4-0125":        {10, 30},
+	"gpt-4o":            {2.5, 10},
+	"gpt-4o-mini":       {0.15, 0.6},
+	"gpt-4.1":           {2, 8},
+}
+
+// Cost estimates the dollar cost of a completion. ok is false for models without a known price.
+func Cost(model string, promptTokens int, completionTokens int) (cost float64, ok bool) {
+	var p price
+	matched := ""
+	for prefix, pp := range prices {
+		if strings.HasPrefix(model, prefix) && len(prefix) > len(matched) {
+			matched = prefix
+			p = pp
+		}
+	}
+	if matched == "" {
+		return 0, false
+	}
+
+	return (float64(promptTokens)*p.input + float64(completionTokens)*p.output) / 1e6, true
+}
+
+type statsPhase struct {
+	name     string
+	duration time.Duration
+}
+
+// RunStats collects the timing of a run, for the summary printed with --stats
+type RunStats struct {
+	phases []statsPhase
+
+	// prompt and response of the completion, counted when the summary is printed
+	completed bool
+	prompt    string
+	response  string
+}
+
+// Time records the duration of a phase that started at start
+func (s *RunStats) Time(name string, start time.Time) {
+	s.phases = append(s.phases, statsPhase{name, time.Since(start)})
+}
+
+// Completed records the prompt and response of the completion
+func (s *RunStats) Completed(prompt string, response string) {
+	s.completed = true
+	s.prompt = prompt
+	s.response = response
+}
+
+// statsMode returns the --stats mode, falling back to the config
+func (r *Runner) statsMode() string {
+	if r.args.Stats != "" {
+		return r.args.Stats
+	}
+	return r.config.Stats
+}
+
+// PrintStats prints the end of run summary on stderr: nothing, one line, or a table
+func (r *Runner) PrintStats(elapsed time.Duration) error {
+	mode := r.statsMode()
+	switch mode {
+	case "", StatsOff:
+		return nil
+	case StatsMinimal, StatsFull:
+	default:
+		return fmt.Errorf("stats must be %s, %s or %s, got %q", StatsOff, StatsMinimal, StatsFull, mode)
+	}
+
+	if !r.stats.completed {
+		return nil
+	}
+
+	fm := r.frontMatter
+	if fm == nil {
+		fm = &TemplateFrontMatter{}
+	}
+	model := r.Model(fm)
+
+	input, err := promptTokens(model, r.stats.prompt, fm)
+	if err != nil {
+		return err
+	}
+
+	output, err := promptTokens(model, r.stats.response, &TemplateFrontMatter{})
+	if err != nil {
+		return err
+	}
+
+	cost := "unknown cost"
+	if dollars, ok := Cost(model, input, output); ok {
+		cost = fmt.Sprintf("$%.4f", dollars)
+	}
+
+	if mode == StatsMinimal {
+		fmt.Fprintf(os.Stderr, "[%d prompt + %d completion tokens, %s, %s", input, output, cost, elapsed.Round(time.Millisecond))
+		if r.runID != "" {
+			fmt.Fprintf(os.Stderr, ", run %s", r.runID)
+		}
+		fmt.Fprintln(os.Stderr, "]")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stderr, 0, 0, 2, ' ', tabwriter.AlignRight)
+	if r.runID != "" {
+		fmt.Fprintf(w, "run\t%s\t\n", r.runID)
+	}
+	fmt.Fprintf(w, "model\t%s\t\n", model)
+	fmt.Fprintf(w, "prompt tokens\t%d\t\n", input)
+	fmt.Fprintf(w, "completion tokens\t%d\t\n", output)
+	fmt.Fprintf(w, "cost\t%s\t\n", cost)
+	for _, phase := range r.stats.phases {
+		fmt.Fprintf(w, "%s\t%s\t\n", phase.name, phase.duration.Round(time.Millisecond))
+	}
+	if !r.chat.firstToken.IsZero() {
+		fmt.Fprintf(w, "time to first token\t%s\t\n", r.chat.firstToken.Sub(r.chat.requested).Round(time.Millisecond))
+	}
+	fmt.Fprintf(w, "retries\t%d\t\n", r.chat.retried)
+	fmt.Fprintf(w, "total\t%s\t\n", elapsed.Round(time.Millisecond))
+	return w.Flush()
+}
@@ -0,0 +1,256 @@
+package streamfilter
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ANSI escapes of the markdown renderer. Each style is turned off with its own escape rather than a
+// reset, so styles nest, e.g. code in a bold heading.
+const (
+	styleBold       = "\x1b[1m"
+	styleBoldOff    = "\x1b[22m"
+	styleDim        = "\x1b[2m"
+	styleDimOff     = "\x1b[22m"
+	styleItalic     = "\x1b[3m"
+	styleItalicOff  = "\x1b[23m"
+	styleUnderline  = "\x1b[4m"
+	styleUnderOff   = "\x1b[24m"
+	colorCode       = "\x1b[36m"
+	colorKeyword    = "\x1b[35m"
+	colorString     = "\x1b[32m"
+	colorNumber     = "\x1b[33m"
+	colorComment    = "\x1b[90m"
+	colorDefaultOff = "\x1b[39m"
+)
+
+var (
+	headingLine   = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*\s*$`)
+	bulletLine    = regexp.MustCompile(`^(\s*)[-*+]\s+(.*)$`)
+	numberedLine  = regexp.MustCompile(`^(\s*)(\d+[.)])\s+(.*)$`)
+	quoteLine     = regexp.MustCompile(`^(\s*)>\s?(.*)$`)
+	ruleLine      = regexp.MustCompile(`^\s*(?:(?:-\s*){3,}|(?:\*\s*){3,}|(?:_\s*){3,})$`)
+	codeSpan      = regexp.MustCompile("`[^`]+`")
+	boldSpan      = regexp.MustCompile(`\*\*([^*]+)\*\*|__([^_]+)__`)
+	italicStar    = regexp.MustCompile(`\*([^*\s](?:[^*]*[^*\s])?)\*`)
+	italicScore   = regexp.MustCompile(`(^|[^\pL\pN_])_([^_\s](?:[^_]*[^_\s])?)_($|[^\pL\pN_])`)
+	linkSpan      = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+	fenceLanguage = regexp.MustCompile("^\\s*```+\\s*([\\w+#-]*)")
+)
+
+// Markdown renders markdown for terminals: headings, bold and italics, inline code, links, lists,
+// quotes and rules are styled with ANSI escapes, and code blocks are syntax highlighted. Like the
+// other filters it works a line at a time, so a line is shown once it's complete.
+func Markdown() Filter {
+	var code *codeHighlighter
+	return Lines(func(line string) string {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") {
+			if code == nil {
+				code = newCodeHighlighter(fenceLanguage.FindStringSubmatch(line)[1])
+			} else {
+				code = nil
+			}
+			return styleDim + line + styleDimOff
+		}
+		if code != nil {
+			return code.line(line)
+		}
+		return renderLine(line)
+	})
+}
+
+// renderLine renders a line of markdown outside of code blocks
+func renderLine(line string) string {
+	if m := headingLine.FindStringSubmatch(line); m != nil {
+		text := renderInline(m[2])
+		if len(m[1]) == 1 {
+			return styleBold + styleUnderline + text + styleUnderOff + styleBoldOff
+		}
+		return styleBold + text + styleBoldOff
+	}
+	if ruleLine.MatchString(line) {
+		return styleDim + strings.Repeat("─", 40) + styleDimOff
+	}
+	if m := bulletLine.FindStringSubmatch(line); m != nil {
+		return m[1] + "• " + renderInline(m[2])
+	}
+	if m := numberedLine.FindStringSubmatch(line); m != nil {
+		return m[1] + styleBold + m[2] + styleBoldOff + " " + renderInline(m[3])
+	}
+	if m := quoteLine.FindStringSubmatch(line); m != nil {
+		return m[1] + styleDim + "│ " + styleDimOff + styleItalic + renderInline(m[2]) + styleItalicOff
+	}
+	return renderInline(line)
+}
+
+// renderInline styles the spans of a line. The text of code spans is kept as is.
+func renderInline(text string) string {
+	var b strings.Builder
+	last := 0
+	for _, span := range codeSpan.FindAllStringIndex(text, -1) {
+		b.WriteString(renderEmphasis(text[last:span[0]]))
+		b.WriteString(colorCode + text[span[0]+1:span[1]-1] + colorDefaultOff)
+		last = span[1]
+	}
+	b.WriteString(renderEmphasis(text[last:]))
+	return b.String()
+}
+
+func renderEmphasis(text string) string {
+	text = linkSpan.ReplaceAllString(text, styleUnderline+"$1"+styleUnderOff+styleDim+" ($2)"+styleDimOff)
+	text = boldSpan.ReplaceAllString(text, styleBold+"$1$2"+styleBoldOff)
+	text = italicStar.ReplaceAllString(text, styleItalic+"$1"+styleItalicOff)
+	return italicScore.ReplaceAllString(text, "$1"+styleItalic+"$2"+styleItalicOff+"$3")
+}
+
+// commentStyles are the comment markers by language. Languages that aren't listed have none.
+var commentStyles = []struct {
+	languages string
+	line      []string
+	// block is set for /* */ comments
+	block bool
+}{
+	{"python py sh bash zsh shell console ruby rb yaml yml toml perl r make makefile dockerfile elixir nix", []string{"#"}, false},
+	{"go c cpp c++ h java js javascript ts typescript jsx tsx rust rs swift kotlin kt scala cs csharp dart proto zig", []string{"//"}, true},
+	{"php tf hcl", []string{"//", "#"}, true},
+	{"css", nil, true},
+	{"sql lua haskell hs", []string{"--"}, false},
+}
+
+// keywords are highlighted in the code of any language
+var keywords = map[string]bool{}
+
+func init() {
+	for _, word := range strings.Fields(`
+		as async await break case catch class const continue def default defer del do elif else enum
+		except export extends fallthrough false finally fn for from func function go goto if impl import
+		in interface is lambda let loop match mod module mut new nil none None not null or package pass
+		pub raise return select self static struct super switch then this throw true True False try type
+		typeof undefined use var void where while with yield and begin end elsif unless until fi done esac
+		SELECT FROM WHERE JOIN LEFT RIGHT INNER OUTER ON GROUP BY ORDER HAVING LIMIT INSERT INTO VALUES
+		UPDATE SET DELETE CREATE TABLE AND OR NOT NULL AS`) {
+		keywords[word] = true
+	}
+}
+
+// codeHighlighter colors the lines of a code block: keywords, strings, numbers and comments. It's a
+// tokenizer that's the same for all languages, except for the comment markers. Code blocks without a
+// language are colored as a whole.
+type codeHighlighter struct {
+	language string
+	comments []string
+	block    bool
+	// inComment is set while in a /* */ comment that spans lines
+	inComment bool
+}
+
+func newCodeHighlighter(language string) *codeHighlighter {
+	h := &codeHighlighter{language: strings.ToLower(language)}
+	for _, style := range commentStyles {
+		for _, name := range strings.Fields(style.languages) {
+			if name == h.language {
+				h.comments = style.line
+				h.block = style.block
+			}
+		}
+	}
+	return h
+}
+
+func (h *codeHighlighter) line(line string) string {
+	if h.language == "" {
+		return colorCode + line + colorDefaultOff
+	}
+
+	var b strings.Builder
+	rest := line
+	for rest != "" {
+		// the comment starts after the /* that opens it
+		start := 0
+		if !h.inComment && h.block && strings.HasPrefix(rest, "/*") {
+			h.inComment = true
+			start = 2
+		}
+		if h.inComment {
+			end := strings.Index(rest[start:], "*/")
+			if end < 0 {
+				b.WriteString(colorComment + rest + colorDefaultOff)
+				break
+			}
+			end += start + 2
+			b.WriteString(colorComment + rest[:end] + colorDefaultOff)
+			rest = rest[end:]
+			h.inComment = false
+			continue
+		}
+
+		if h.isComment(rest) {
+			b.WriteString(colorComment + rest + colorDefaultOff)
+			break
+		}
+
+		c, size := utf8.DecodeRuneInString(rest)
+		switch {
+		case c == '"' || c == '\'' || c == '`':
+			n := quoted(rest)
+			b.WriteString(colorString + rest[:n] + colorDefaultOff)
+			rest = rest[n:]
+
+		case c == '_' || unicode.IsLetter(c):
+			n := strings.IndexFunc(rest, func(r rune) bool {
+				return r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r)
+			})
+			if n < 0 {
+				n = len(rest)
+			}
+			word := rest[:n]
+			if keywords[word] {
+				word = colorKeyword + word + colorDefaultOff
+			}
+			b.WriteString(word)
+			rest = rest[n:]
+
+		case unicode.IsDigit(c):
+			n := strings.IndexFunc(rest, func(r rune) bool {
+				return r != '.' && r != '_' && r != 'x' && r != 'X' && !unicode.In(r, unicode.ASCII_Hex_Digit)
+			})
+			if n < 0 {
+				n = len(rest)
+			}
+			b.WriteString(colorNumber + rest[:n] + colorDefaultOff)
+			rest = rest[n:]
+
+		default:
+			b.WriteString(rest[:size])
+			rest = rest[size:]
+		}
+	}
+	return b.String()
+}
+
+func (h *codeHighlighter) isComment(text string) bool {
+	for _, marker := range h.comments {
+		if strings.HasPrefix(text, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// quoted returns the length of the string literal at the start of text, up to the closing quote or
+// the end of the line
+func quoted(text string) int {
+	quote := text[0]
+	for i := 1; i < len(text); i++ {
+		switch text[i] {
+		case '\\':
+			i++
+		case quote:
+			return i + 1
+		}
+	}
+	return len(text)
+}
@@ -0,0 +1,185 @@
+// Package streamfilter transforms completion streams as they arrive. Filters work a line at a time,
+// so memory is bounded by the longest line rather than the whole response.
+package streamfilter
+
+import (
+	"bufio"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// Filter is a stage of the output pipeline
+type Filter func(r io.Reader) io.Reader
+
+// Chain pipes the stream through the filters, in order
+func Chain(r io.Reader, filters ...Filter) io.Reader {
+	for _, filter := range filters {
+		r = filter(r)
+	}
+	return r
+}
+
+// lineReader emits the lines of the source as transformed by next. next is given each line with its
+// newline, if it has one, and "" with eof set once the source is done, to flush what it held back.
+type lineReader struct {
+	source  *bufio.Reader
+	next    func(line string, eof bool) string
+	pending string
+	done    bool
+}
+
+func newLineReader(r io.Reader, next func(line string, eof bool) string) io.Reader {
+	return &lineReader{source: bufio.NewReader(r), next: next}
+}
+
+func (l *lineReader) Read(p []byte) (int, error) {
+	for l.pending == "" {
+		if l.done {
+			return 0, io.EOF
+		}
+
+		line, err := l.source.ReadString('\n')
+		if err == io.EOF {
+			l.done = true
+			l.pending = l.next(line, false) + l.next("", true)
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		l.pending = l.next(line, false)
+	}
+
+	n := copy(p, l.pending)
+	l.pending = l.pending[n:]
+	return n, nil
+}
+
+// Lines applies fn to each line, without its newline
+func Lines(fn func(line string) string) Filter {
+	return func(r io.Reader) io.Reader {
+		return newLineReader(r, func(line string, eof bool) string {
+			if eof || line == "" {
+				return ""
+			}
+			text, newline := strings.CutSuffix(line, "\n")
+			if newline {
+				return fn(text) + "\n"
+			}
+			return fn(text)
+		})
+	}
+}
+
+// StripFence removes a markdown code fence around the whole response, which models add to code
+// they were asked to output as is. Fences inside the response are kept.
+func StripFence() Filter {
+	return func(r io.Reader) io.Reader {
+		var started, fenced bool
+		// held is a closing fence, and the blank lines after it, that is dropped if the stream ends
+		var held strings.Builder
+
+		return newLineReader(r, func(line string, eof bool) string {
+			if eof {
+				return ""
+			}
+
+			trimmed := strings.TrimSpace(line)
+			if !started {
+				if trimmed == "" {
+					return ""
+				}
+				started = true
+				if strings.HasPrefix(trimmed, "```") {
+					fenced = true
+					return ""
+				}
+				return line
+			}
+
+			if !fenced {
+				return line
+			}
+
+			if trimmed == "```" || (held.Len() > 0 && trimmed == "") {
+				held.WriteString(line)
+				return ""
+			}
+
+			out := held.String() + line
+			held.Reset()
+			return out
+		})
+	}
+}
+
+// Wrap breaks lines longer than width at spaces. Lines inside code fences are kept as they are.
+func Wrap(width int) Filter {
+	var code bool
+	return Lines(func(line string) string {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			code = !code
+			return line
+		}
+		if code {
+			return line
+		}
+		return wrapLine(line, width)
+	})
+}
+
+func wrapLine(line string, width int) string {
+	var b strings.Builder
+	var length int
+	for i, word := range strings.Split(line, " ") {
+		n := len([]rune(word))
+		if i > 0 {
+			if length > 0 && length+1+n > width {
+				b.WriteString("\n")
+				length = 0
+			} else {
+				b.WriteString(" ")
+				length++
+			}
+		}
+		b.WriteString(word)
+		length += n
+	}
+	return b.String()
+}
+
+// Redact replaces the matches of the patterns with the replacement. Matches can't span lines.
+func Redact(patterns []*regexp.Regexp, replacement string) Filter {
+	return Lines(func(line string) string {
+		for _, re := range patterns {
+			line = re.ReplaceAllString(line, replacement)
+		}
+		return line
+	})
+}
+
+const (
+	ansiBold  = "\x1b[1m"
+	ansiCode  = "\x1b[36m"
+	ansiReset = "\x1b[0m"
+)
+
+// Highlight colors markdown headings and code blocks with ANSI escapes, for terminals
+func Highlight() Filter {
+	var code bool
+	return Lines(func(line string) string {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, "```"):
+			code = !code
+			return ansiCode + line + ansiReset
+		case code:
+			return ansiCode + line + ansiReset
+		case strings.HasPrefix(trimmed, "#"):
+			return ansiBold + line + ansiReset
+		}
+		return line
+	})
+}
@@ -0,0 +1,134 @@
+package streamfilter
+
+import (
+	"io"
+	"regexp"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func filter(t *testing.T, input string, filters ...Filter) string {
+	// one byte at a time, like a slow token stream
+	out, err := io.ReadAll(Chain(iotest.OneByteReader(strings.NewReader(input)), filters...))
+	assert.NoError(t, err)
+	return string(out)
+}
+
+func TestStripFence(t *testing.T) {
+	testCases := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "fenced",
+			input:    "```go\npackage x\n```\n",
+			expected: "package x\n",
+		},
+		{
+			name:     "fenced with blank lines",
+			input:    "\n```\na\n\nb\n```\n\n",
+			expected: "a\n\nb\n",
+		},
+		{
+			name:     "not fenced",
+			input:    "a\n```\nb\n```\n",
+			expected: "a\n```\nb\n```\n",
+		},
+		{
+			name:     "inner fence",
+			input:    "```md\ntext\n```\ncode\n```\nmore\n```",
+			expected: "text\n```\ncode\n```\nmore\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, filter(t, tc.input, StripFence()))
+		})
+	}
+}
+
+func TestWrap(t *testing.T) {
+	assert.Equal(t, "one two\nthree\nfour\n```\nkeep this long line\n```\n",
+		filter(t, "one two three four\n```\nkeep this long line\n```\n", Wrap(8)))
+}
+
+func TestRedact(t *testing.T) {
+	patterns := []*regexp.Regexp{regexp.MustCompile(`sk-\w+`)}
+	assert.Equal(t, "key [REDACTED] and\nno newline",
+		filter(t, "key sk-abc123 and\nno newline", Redact(patterns, "[REDACTED]")))
+}
+
+func TestChain(t *testing.T) {
+	patterns := []*regexp.Regexp{regexp.MustCompile(`secret`)}
+	assert.Equal(t, "a ***\n",
+		filter(t, "```\na secret\n```\n", StripFence(), Redact(patterns, "***")))
+}
+
+func TestMarkdown(t *testing.T) {
+	testCases := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "headings",
+			input:    "# Title\n## Section ##\n#hashtag\n",
+			expected: "\x1b[1m\x1b[4mTitle\x1b[24m\x1b[22m\n\x1b[1mSection\x1b[22m\n#hashtag\n",
+		},
+		{
+			name:     "emphasis",
+			input:    "**bold**, *italic*, _also_ and snake_case_name, 2 * 3 * 4\n",
+			expected: "\x1b[1mbold\x1b[22m, \x1b[3mitalic\x1b[23m, \x1b[3malso\x1b[23m and snake_case_name, 2 * 3 * 4\n",
+		},
+		{
+			name:     "code spans are kept as is",
+			input:    "run `go test **/*`\n",
+			expected: "run \x1b[36mgo test **/*\x1b[39m\n",
+		},
+		{
+			name:     "link",
+			input:    "see [the docs](https://example.com)\n",
+			expected: "see \x1b[4mthe docs\x1b[24m\x1b[2m (https://example.com)\x1b[22m\n",
+		},
+		{
+			name:     "lists",
+			input:    "- one\n  * two\n1. first\n",
+			expected: "• one\n  • two\n\x1b[1m1.\x1b[22m first\n",
+		},
+		{
+			name:     "quote and rule",
+			input:    "> quoted\n---\n",
+			expected: "\x1b[2m│ \x1b[22m\x1b[3mquoted\x1b[23m\n\x1b[2m" + strings.Repeat("─", 40) + "\x1b[22m\n",
+		},
+		{
+			name:  "code block",
+			input: "```go\nreturn \"x\" // done\n```\n**after**",
+			expected: "\x1b[2m```go\x1b[22m\n" +
+				"\x1b[35mreturn\x1b[39m \x1b[32m\"x\"\x1b[39m \x1b[90m// done\x1b[39m\n" +
+				"\x1b[2m```\x1b[22m\n\x1b[1mafter\x1b[22m",
+		},
+		{
+			name:     "code block without language",
+			input:    "```\n# not a heading\n```\n",
+			expected: "\x1b[2m```\x1b[22m\n\x1b[36m# not a heading\x1b[39m\n\x1b[2m```\x1b[22m\n",
+		},
+		{
+			name:  "block comment",
+			input: "```c\nx = 1; /* a\nb */ y\n```\n",
+			expected: "\x1b[2m```c\x1b[22m\n" +
+				"x = \x1b[33m1\x1b[39m; \x1b[90m/* a\x1b[39m\n" +
+				"\x1b[90mb */\x1b[39m y\n\x1b[2m```\x1b[22m\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, filter(t, tc.input, Markdown()))
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// CaptureResponse stores the whole response
+	CaptureResponse = "response"
+	// CaptureInput stores the input of the prompt
+	CaptureInput = "input"
+)
+
+// TemplateMemory is the key-value store of a template, given to it as {{.Memory.key}} and written by
+// the capture rules of its frontmatter after each completion
+type TemplateMemory struct {
+	Template string            `json:"template"`
+	Updated  time.Time         `json:"updated"`
+	Values   map[string]string `json:"values"`
+}
+
+// memoryMu serializes the updates of the concurrent runs of pls batch
+var memoryMu sync.Mutex
+
+// captureRule stores the response, the input, or the first group of a regular expression matching the
+// response (the whole match without groups)
+type captureRule struct {
+	key     string
+	source  string
+	pattern *regexp.Regexp
+}
+
+// captureRules returns the capture rules of the frontmatter, sorted by key
+func captureRules(fm *TemplateFrontMatter) ([]captureRule, error) {
+	var rules []captureRule
+	for key, rule := range fm.Capture {
+		switch rule {
+		case CaptureResponse, CaptureInput:
+			rules = append(rules, captureRule{key: key, source: rule})
+		default:
+			re, err := regexp.Compile(rule)
+			if err != nil {
+				return nil, fmt.Errorf("capture %s: %w", key, err)
+			}
+			rules = append(rules, captureRule{key: key, source: CaptureResponse, pattern: re})
+		}
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].key < rules[j].key })
+	return rules, nil
+}
+
+// memoryFile is the store of the template, named after it. The hash of its path tells apart templates
+// of the same name in different directories.
+func memoryFile(templatePath string) (string, error) {
+	dir, err := DataDir()
+	if err != nil {
+		return "", err
+	}
+
+	abs, err := filepath.Abs(templatePath)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(abs))
+	name := strings.TrimSuffix(filepath.Base(abs), filepath.Ext(abs))
+	return filepath.Join(dir, "state", name+"-"+hex.EncodeToString(sum[:4])+".json"), nil
+}
+
+// ReadTemplateMemory returns the store of the template. It's empty until something is captured.
+func ReadTemplateMemory(templatePath string) (*TemplateMemory, error) {
+	if templatePath == "" {
+		return &TemplateMemory{Values: map[string]string{}}, nil
+	}
+
+	abs, err := filepath.Abs(templatePath)
+	if err != nil {
+		return nil, err
+	}
+	memory := &TemplateMemory{Template: abs, Values: map[string]string{}}
+
+	file, err := memoryFile(abs)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return memory, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, memory)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	if memory.Values == nil {
+		memory.Values = map[string]string{}
+	}
+	return memory, nil
+}
+
+// Save writes the store of the template
+func (m *TemplateMemory) Save() error {
+	file, err := memoryFile(m.Template)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(file), 0755)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, data, 0644)
+}
+
+// captureMemory stores what the capture rules of the frontmatter pick from the completion, for the
+// next run of the template. A pattern that doesn't match keeps the value of the key.
+func (r *Runner) captureMemory(response string) error {
+	if r.frontMatter == nil || len(r.frontMatter.Capture) == 0 || r.templatePath == "" {
+		return nil
+	}
+
+	rules, err := captureRules(r.frontMatter)
+	if err != nil {
+		return err
+	}
+
+	memoryMu.Lock()
+	defer memoryMu.Unlock()
+
+	// read again, since a run of pls batch may have captured meanwhile
+	memory, err := ReadTemplateMemory(r.templatePath)
+	if err != nil {
+		return err
+	}
+
+	for _, rule := range rules {
+		value := response
+		if rule.source == CaptureInput {
+			value = r.input
+		}
+
+		if rule.pattern != nil {
+			match := rule.pattern.FindStringSubmatch(value)
+			if match == nil {
+				fmt.Fprintf(os.Stderr, "[capture %s: no match for %s, keeping the previous value]\n", rule.key, rule.pattern)
+				continue
+			}
+			value = match[0]
+			if len(match) > 1 {
+				value = match[1]
+			}
+		}
+		memory.Values[rule.key] = value
+	}
+
+	memory.Updated = time.Now()
+	return memory.Save()
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCaptureRules(t *testing.T) {
+	testCases := []struct {
+		name     string
+		capture  map[string]string
+		expected []string // key, source and pattern of each rule
+		err      string
+	}{
+		{
+			name:     "sources and patterns, sorted by key",
+			capture:  map[string]string{"summary": "response", "notes": "input", "score": `Score: (\d+)`},
+			expected: []string{"notes", "input", "", "score", "response", `Score: (\d+)`, "summary", "response", ""},
+		},
+		{
+			name:    "invalid pattern",
+			capture: map[string]string{"score": `Score: (\d+`},
+			err:     "capture score: error parsing regexp: missing closing ): `Score: (\\d+`",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rules, err := captureRules(&TemplateFrontMatter{Capture: tc.capture})
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+				return
+			}
+			assert.NoError(t, err)
+
+			var got []string
+			for _, rule := range rules {
+				pattern := ""
+				if rule.pattern != nil {
+					pattern = rule.pattern.String()
+				}
+				got = append(got, rule.key, rule.source, pattern)
+			}
+			assert.Equal(t, tc.expected, got)
+		})
+	}
+}
+
+func TestCaptureMemory(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	templateFile := filepath.Join(t.TempDir(), "standup.md")
+	assert.NoError(t, os.WriteFile(templateFile, []byte("{{.Input}}"), 0644))
+
+	r := &Runner{
+		frontMatter: &TemplateFrontMatter{Capture: map[string]string{
+			"summary": "response",
+			"notes":   "input",
+			"score":   `Score: (\d+)`,
+			"mood":    `Mood: \w+`,
+		}},
+		templatePath: templateFile,
+		input:        "shipped the parser",
+	}
+
+	assert.NoError(t, r.captureMemory("All good.\nScore: 7\nMood: calm\n"))
+
+	memory, err := ReadTemplateMemory(templateFile)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"summary": "All good.\nScore: 7\nMood: calm\n",
+		"notes":   "shipped the parser",
+		"score":   "7",
+		"mood":    "Mood: calm",
+	}, memory.Values)
+
+	rendered, _, err := RenderTemplate("yesterday: {{.Memory.notes}}, score {{.Memory.score}}", TemplateData{Memory: memory.Values})
+	assert.NoError(t, err)
+	assert.Equal(t, "yesterday: shipped the parser, score 7\n", rendered)
+
+	// a pattern that matches nothing keeps the value of the previous run
+	r.input = "fixed the tests"
+	assert.NoError(t, r.captureMemory("No score today."))
+
+	memory, err = ReadTemplateMemory(templateFile)
+	assert.NoError(t, err)
+	assert.Equal(t, "7", memory.Values["score"])
+	assert.Equal(t, "Mood: calm", memory.Values["mood"])
+	assert.Equal(t, "fixed the tests", memory.Values["notes"])
+	assert.Equal(t, "No score today.", memory.Values["summary"])
+}
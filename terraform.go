@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/hayeah/pls/tfplan"
+)
+
+const tfplanInstruction = `You are reviewing a Terraform plan before it's applied. Below are its resource changes, grouped by
+action, with the attributes that change. Summarize the plan for the reviewer, focused on risk: data
+loss from deletes and replacements, downtime, security (IAM, network exposure, encryption), and cost.
+Name the riskiest changes first, and say what to double-check before applying. Be brief about routine
+changes.
+
+=== CHANGES ===
+%s`
+
+const tfplanJSONInstruction = `
+
+Respond with the resources that deserve a reviewer's attention in "flagged", each with its risk and
+the reason, and the summary in "summary". Leave routine changes out.`
+
+// tfplanSchema is the JSON output of pls tfplan --json
+const tfplanSchema = `{
+  "type": "object",
+  "required": ["summary", "flagged"],
+  "properties": {
+    "summary": {"type": "string"},
+    "flagged": {
+      "type": "array",
+      "items": {
+        "type": "object",
+        "required": ["address", "action", "risk", "reason"],
+        "properties": {
+          "address": {"type": "string"},
+          "action": {"enum": ["create", "update", "replace", "delete"]},
+          "risk": {"enum": ["high", "medium", "low"]},
+          "reason": {"type": "string"}
+        }
+      }
+    }
+  }
+}`
+
+type TFPlanArgs struct {
+	PlanFile   string `arg:"positional,required" help:"plan as JSON, from terraform show -json plan.out"`
+	JSON       bool   `arg:"--json" help:"output the flagged resources as JSON, with their risk and reason"`
+	Model      string `arg:"-m,--model" help:"model to use, overrides the config"`
+	RenderOnly bool   `arg:"--render-only" help:"output only the rendered prompt, without calling the API"`
+}
+
+// runTFPlan reviews the resource changes of a Terraform plan for risk
+func runTFPlan(argv []string) error {
+	var args TFPlanArgs
+	parseArgs("pls tfplan", &args, argv)
+
+	f, err := os.Open(args.PlanFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	changes, err := tfplan.Parse(f)
+	if err != nil {
+		return err
+	}
+	if len(changes) == 0 {
+		fmt.Fprintln(os.Stderr, "[the plan has no changes]")
+		return nil
+	}
+
+	var counts []string
+	groups := tfplan.Group(changes)
+	for _, action := range tfplan.Actions {
+		if n := len(groups[action]); n > 0 {
+			counts = append(counts, fmt.Sprintf("%d to %s", n, action))
+		}
+	}
+	fmt.Fprintf(os.Stderr, "[%s]\n", strings.Join(counts, ", "))
+
+	r, err := NewRunner(Args{Model: args.Model})
+	if err != nil {
+		return err
+	}
+
+	fm := &TemplateFrontMatter{}
+	r.applyFlags(fm)
+	r.frontMatter = fm
+
+	prompt := fmt.Sprintf(tfplanInstruction, tfplan.Format(changes))
+	if args.RenderOnly {
+		fmt.Print(prompt)
+		return nil
+	}
+
+	if !args.JSON {
+		stream, err := r.OutputStream(prompt, fm)
+		if err != nil {
+			return err
+		}
+		defer stream.Close()
+
+		return r.WriteOutput(stream)
+	}
+
+	var schema map[string]any
+	err = json.Unmarshal([]byte(tfplanSchema), &schema)
+	if err != nil {
+		return err
+	}
+	fm.ResponseFormat = ResponseFormatJSON
+	fm.JSONSchema = schema
+
+	response, err := r.completeJSON(fm, prompt+tfplanJSONInstruction)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Println(strings.TrimSpace(response))
+	return err
+}
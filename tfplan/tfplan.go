@@ -0,0 +1,173 @@
+// Package tfplan reads the JSON of Terraform plans (terraform show -json), and summarizes their resource
+// changes for review.
+package tfplan
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Action is what a plan does to a resource
+type Action string
+
+const (
+	Create  Action = "create"
+	Update  Action = "update"
+	Replace Action = "replace"
+	Delete  Action = "delete"
+)
+
+// Actions are in the order that changes are listed, most destructive first
+var Actions = []Action{Delete, Replace, Update, Create}
+
+// Change is a planned change of a resource
+type Change struct {
+	Address string
+	Type    string
+	Action  Action
+	// Attributes are the top-level attributes that change, for updates and replacements
+	Attributes []string
+	// ReplacePaths are the attributes that force the replacement
+	ReplacePaths []string
+}
+
+type plan struct {
+	FormatVersion   string `json:"format_version"`
+	ResourceChanges []struct {
+		Address string `json:"address"`
+		Type    string `json:"type"`
+		Mode    string `json:"mode"`
+		Change  struct {
+			Actions      []string       `json:"actions"`
+			Before       map[string]any `json:"before"`
+			After        map[string]any `json:"after"`
+			AfterUnknown map[string]any `json:"after_unknown"`
+			ReplacePaths [][]any        `json:"replace_paths"`
+		} `json:"change"`
+	} `json:"resource_changes"`
+}
+
+// Parse returns the changes of a plan. Reads and no-ops are left out.
+func Parse(r io.Reader) ([]Change, error) {
+	var p plan
+	err := json.NewDecoder(r).Decode(&p)
+	if err != nil {
+		return nil, fmt.Errorf("tfplan: %w", err)
+	}
+	if p.FormatVersion == "" {
+		return nil, errors.New("tfplan: not a plan in JSON, convert it with terraform show -json")
+	}
+
+	var changes []Change
+	for _, rc := range p.ResourceChanges {
+		if rc.Mode == "data" {
+			continue
+		}
+
+		action, ok := parseActions(rc.Change.Actions)
+		if !ok {
+			continue
+		}
+
+		change := Change{Address: rc.Address, Type: rc.Type, Action: action}
+		if action == Update || action == Replace {
+			change.Attributes = changedAttributes(rc.Change.Before, rc.Change.After, rc.Change.AfterUnknown)
+		}
+		for _, path := range rc.Change.ReplacePaths {
+			var parts []string
+			for _, part := range path {
+				parts = append(parts, fmt.Sprint(part))
+			}
+			change.ReplacePaths = append(change.ReplacePaths, strings.Join(parts, "."))
+		}
+		changes = append(changes, change)
+	}
+	return changes, nil
+}
+
+func parseActions(actions []string) (Action, bool) {
+	switch strings.Join(actions, ",") {
+	case "create":
+		return Create, true
+	case "update":
+		return Update, true
+	case "delete":
+		return Delete, true
+	case "delete,create", "create,delete":
+		return Replace, true
+	}
+	return "", false
+}
+
+// changedAttributes returns the sorted names of the attributes that differ, or become known only after
+// the apply
+func changedAttributes(before, after, unknown map[string]any) []string {
+	changed := map[string]bool{}
+	for key, value := range after {
+		if !reflect.DeepEqual(before[key], value) {
+			changed[key] = true
+		}
+	}
+	for key := range before {
+		if _, ok := after[key]; !ok {
+			changed[key] = true
+		}
+	}
+	for key, value := range unknown {
+		if value == true {
+			changed[key] = true
+		}
+	}
+
+	var names []string
+	for name := range changed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Group returns the changes by action
+func Group(changes []Change) map[Action][]Change {
+	groups := map[Action][]Change{}
+	for _, change := range changes {
+		groups[change.Action] = append(groups[change.Action], change)
+	}
+	return groups
+}
+
+// Format lists the changes grouped by action, most destructive first:
+//
+//	## Replace (1)
+//	- aws_db_instance.main: engine_version, instance_class (forced by engine_version)
+func Format(changes []Change) string {
+	groups := Group(changes)
+
+	var b strings.Builder
+	for _, action := range Actions {
+		group := groups[action]
+		if len(group) == 0 {
+			continue
+		}
+
+		title := strings.ToUpper(string(action[:1])) + string(action[1:])
+		fmt.Fprintf(&b, "## %s (%d)\n", title, len(group))
+		for _, change := range group {
+			b.WriteString("- " + change.Address)
+			if len(change.Attributes) > 0 {
+				b.WriteString(": " + strings.Join(change.Attributes, ", "))
+			}
+			if len(change.ReplacePaths) > 0 {
+				fmt.Fprintf(&b, " (forced by %s)", strings.Join(change.ReplacePaths, ", "))
+			}
+			b.WriteString("\n")
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,94 @@
+package tfplan
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testPlan = `{
+  "format_version": "1.2",
+  "resource_changes": [
+    {
+      "address": "aws_instance.web",
+      "type": "aws_instance",
+      "mode": "managed",
+      "change": {
+        "actions": ["update"],
+        "before": {"instance_type": "t3.small", "tags": {"env": "prod"}, "ami": "ami-1"},
+        "after": {"instance_type": "t3.large", "tags": {"env": "prod"}, "ami": "ami-1"},
+        "after_unknown": {"public_ip": true}
+      }
+    },
+    {
+      "address": "aws_db_instance.main",
+      "type": "aws_db_instance",
+      "mode": "managed",
+      "change": {
+        "actions": ["delete", "create"],
+        "before": {"engine_version": "13"},
+        "after": {"engine_version": "15"},
+        "replace_paths": [["engine_version"]]
+      }
+    },
+    {
+      "address": "aws_s3_bucket.logs",
+      "type": "aws_s3_bucket",
+      "mode": "managed",
+      "change": {"actions": ["create"], "before": null, "after": {"bucket": "logs"}}
+    },
+    {
+      "address": "aws_iam_role.old",
+      "type": "aws_iam_role",
+      "mode": "managed",
+      "change": {"actions": ["delete"], "before": {"name": "old"}, "after": null}
+    },
+    {
+      "address": "aws_vpc.main",
+      "type": "aws_vpc",
+      "mode": "managed",
+      "change": {"actions": ["no-op"]}
+    },
+    {
+      "address": "data.aws_ami.ubuntu",
+      "type": "aws_ami",
+      "mode": "data",
+      "change": {"actions": ["read"]}
+    }
+  ]
+}`
+
+func TestParse(t *testing.T) {
+	changes, err := Parse(strings.NewReader(testPlan))
+	assert.NoError(t, err)
+
+	assert.Equal(t, []Change{
+		{Address: "aws_instance.web", Type: "aws_instance", Action: Update, Attributes: []string{"instance_type", "public_ip"}},
+		{Address: "aws_db_instance.main", Type: "aws_db_instance", Action: Replace, Attributes: []string{"engine_version"}, ReplacePaths: []string{"engine_version"}},
+		{Address: "aws_s3_bucket.logs", Type: "aws_s3_bucket", Action: Create},
+		{Address: "aws_iam_role.old", Type: "aws_iam_role", Action: Delete},
+	}, changes)
+
+	_, err = Parse(strings.NewReader(`{"resources": []}`))
+	assert.EqualError(t, err, "tfplan: not a plan in JSON, convert it with terraform show -json")
+}
+
+func TestFormat(t *testing.T) {
+	changes, err := Parse(strings.NewReader(testPlan))
+	assert.NoError(t, err)
+
+	assert.Equal(t, `## Delete (1)
+- aws_iam_role.old
+
+## Replace (1)
+- aws_db_instance.main: engine_version (forced by engine_version)
+
+## Update (1)
+- aws_instance.web: instance_type, public_ip
+
+## Create (1)
+- aws_s3_bucket.logs
+
+`, Format(changes))
+}
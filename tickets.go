@@ -0,0 +1,277 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// JiraConfig configures the jira: input loader
+type JiraConfig struct {
+	// URL of the Jira site, e.g. https://example.atlassian.net
+	URL   string `yaml:"url"`
+	Email string `yaml:"email"`
+	// TokenEnv is the environment variable holding the API token
+	TokenEnv string `yaml:"token_env"`
+}
+
+// LinearConfig configures the linear: input loader
+type LinearConfig struct {
+	// TokenEnv is the environment variable holding the API key
+	TokenEnv string `yaml:"token_env"`
+}
+
+// Ticket is the template data of an issue tracker ticket
+type Ticket struct {
+	Key         string          `json:"key"`
+	Title       string          `json:"title"`
+	Description string          `json:"description"`
+	Status      string          `json:"status"`
+	Assignee    string          `json:"assignee"`
+	URL         string          `json:"url"`
+	Comments    []TicketComment `json:"comments"`
+}
+
+type TicketComment struct {
+	Author string `json:"author"`
+	Body   string `json:"body"`
+}
+
+// Text formats the ticket as the prompt input
+func (t *Ticket) Text() string {
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "%s: %s\n", t.Key, t.Title)
+	if t.Status != "" {
+		fmt.Fprintf(&buf, "Status: %s\n", t.Status)
+	}
+	if t.Assignee != "" {
+		fmt.Fprintf(&buf, "Assignee: %s\n", t.Assignee)
+	}
+	if t.Description != "" {
+		fmt.Fprintf(&buf, "\n%s\n", strings.TrimSpace(t.Description))
+	}
+	if len(t.Comments) > 0 {
+		fmt.Fprintf(&buf, "\nComments:\n")
+		for _, c := range t.Comments {
+			fmt.Fprintf(&buf, "\n%s:\n%s\n", c.Author, strings.TrimSpace(c.Body))
+		}
+	}
+	return buf.String()
+}
+
+// Data returns the ticket as template data, e.g. {{.Data.title}}
+func (t *Ticket) Data() map[string]any {
+	comments := make([]map[string]any, len(t.Comments))
+	for i, c := range t.Comments {
+		comments[i] = map[string]any{"author": c.Author, "body": c.Body}
+	}
+
+	return map[string]any{
+		"key":         t.Key,
+		"title":       t.Title,
+		"description": t.Description,
+		"status":      t.Status,
+		"assignee":    t.Assignee,
+		"url":         t.URL,
+		"comments":    comments,
+	}
+}
+
+func ticketInput(t *Ticket) *LoadedInput {
+	return &LoadedInput{Input: t.Text(), Data: t.Data()}
+}
+
+func requireToken(env string, name string) (string, error) {
+	if env == "" {
+		return "", fmt.Errorf("%s: token_env is not configured", name)
+	}
+
+	token := os.Getenv(env)
+	if token == "" {
+		return "", fmt.Errorf("%s: %s is not set", name, env)
+	}
+	return token, nil
+}
+
+func doJSON(req *http.Request, v any) error {
+	return doJSONWith(http.DefaultClient, req, v)
+}
+
+// doJSONWith sends the request with the client, and decodes the JSON response
+func doJSONWith(client *http.Client, req *http.Request, v any) error {
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s %s: %s", req.Method, req.URL, res.Status)
+	}
+
+	return json.NewDecoder(res.Body).Decode(v)
+}
+
+// LoadJiraTicket fetches an issue with the Jira REST API
+func LoadJiraTicket(config JiraConfig, key string) (*Ticket, error) {
+	if config.URL == "" {
+		return nil, errors.New("jira: url is not configured")
+	}
+
+	token, err := requireToken(config.TokenEnv, "jira")
+	if err != nil {
+		return nil, err
+	}
+
+	base := strings.TrimSuffix(config.URL, "/")
+	endpoint := fmt.Sprintf("%s/rest/api/2/issue/%s?fields=%s", base, url.PathEscape(key), "summary,description,status,assignee,comment")
+
+	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(config.Email, token)
+	req.Header.Set("Accept", "application/json")
+
+	var issue struct {
+		Key    string `json:"key"`
+		Fields struct {
+			Summary     string `json:"summary"`
+			Description string `json:"description"`
+			Status      struct {
+				Name string `json:"name"`
+			} `json:"status"`
+			Assignee *struct {
+				DisplayName string `json:"displayName"`
+			} `json:"assignee"`
+			Comment struct {
+				Comments []struct {
+					Author struct {
+						DisplayName string `json:"displayName"`
+					} `json:"author"`
+					Body string `json:"body"`
+				} `json:"comments"`
+			} `json:"comment"`
+		} `json:"fields"`
+	}
+
+	err = doJSON(req, &issue)
+	if err != nil {
+		return nil, err
+	}
+
+	ticket := &Ticket{
+		Key:         issue.Key,
+		Title:       issue.Fields.Summary,
+		Description: issue.Fields.Description,
+		Status:      issue.Fields.Status.Name,
+		URL:         base + "/browse/" + issue.Key,
+	}
+	if issue.Fields.Assignee != nil {
+		ticket.Assignee = issue.Fields.Assignee.DisplayName
+	}
+	for _, c := range issue.Fields.Comment.Comments {
+		ticket.Comments = append(ticket.Comments, TicketComment{Author: c.Author.DisplayName, Body: c.Body})
+	}
+
+	return ticket, nil
+}
+
+const linearIssueQuery = `query($id: String!) {
+  issue(id: $id) {
+    identifier title description url
+    state { name }
+    assignee { name }
+    comments { nodes { body user { name } } }
+  }
+}`
+
+// LoadLinearTicket fetches an issue with the Linear GraphQL API
+func LoadLinearTicket(config LinearConfig, id string) (*Ticket, error) {
+	token, err := requireToken(config.TokenEnv, "linear")
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := json.Marshal(map[string]any{
+		"query":     linearIssueQuery,
+		"variables": map[string]string{"id": id},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, "https://api.linear.app/graphql", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", token)
+	req.Header.Set("Content-Type", "application/json")
+
+	var res struct {
+		Data struct {
+			Issue *struct {
+				Identifier  string `json:"identifier"`
+				Title       string `json:"title"`
+				Description string `json:"description"`
+				URL         string `json:"url"`
+				State       struct {
+					Name string `json:"name"`
+				} `json:"state"`
+				Assignee *struct {
+					Name string `json:"name"`
+				} `json:"assignee"`
+				Comments struct {
+					Nodes []struct {
+						Body string `json:"body"`
+						User *struct {
+							Name string `json:"name"`
+						} `json:"user"`
+					} `json:"nodes"`
+				} `json:"comments"`
+			} `json:"issue"`
+		} `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+
+	err = doJSON(req, &res)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(res.Errors) > 0 {
+		return nil, fmt.Errorf("linear: %s", res.Errors[0].Message)
+	}
+
+	issue := res.Data.Issue
+	if issue == nil {
+		return nil, fmt.Errorf("linear: issue %s not found", id)
+	}
+
+	ticket := &Ticket{
+		Key:         issue.Identifier,
+		Title:       issue.Title,
+		Description: issue.Description,
+		Status:      issue.State.Name,
+		URL:         issue.URL,
+	}
+	if issue.Assignee != nil {
+		ticket.Assignee = issue.Assignee.Name
+	}
+	for _, c := range issue.Comments.Nodes {
+		author := ""
+		if c.User != nil {
+			author = c.User.Name
+		}
+		ticket.Comments = append(ticket.Comments, TicketComment{Author: author, Body: c.Body})
+	}
+
+	return ticket, nil
+}
@@ -0,0 +1,199 @@
+// Package tokens counts and splits text in model tokens, using BPE files bundled into the binary.
+package tokens
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/pkoukk/tiktoken-go"
+	tiktoken_loader "github.com/pkoukk/tiktoken-go-loader"
+)
+
+// DefaultEncoding is used for models that tiktoken doesn't know about (e.g. local Llama-family
+// models). Counts for those models are an approximation.
+const DefaultEncoding = tiktoken.MODEL_CL100K_BASE
+
+func init() {
+	// load the embedded BPE ranks instead of downloading them on first use
+	tiktoken.SetBpeLoader(tiktoken_loader.NewOfflineLoader())
+}
+
+var (
+	mu        sync.Mutex
+	encodings = map[string]*tiktoken.Tiktoken{}
+)
+
+// Encoding returns the tokenizer for the model
+func Encoding(model string) (*tiktoken.Tiktoken, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if enc, ok := encodings[model]; ok {
+		return enc, nil
+	}
+
+	enc, err := tiktoken.EncodingForModel(model)
+	if err != nil {
+		enc, err = tiktoken.GetEncoding(DefaultEncoding)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	encodings[model] = enc
+	return enc, nil
+}
+
+// Encode returns the tokens of text. Special tokens are encoded as ordinary text.
+func Encode(model, text string) ([]int, error) {
+	enc, err := Encoding(model)
+	if err != nil {
+		return nil, err
+	}
+
+	return enc.EncodeOrdinary(text), nil
+}
+
+// Count returns the number of tokens in text
+func Count(model, text string) (int, error) {
+	toks, err := Encode(model, text)
+	if err != nil {
+		return 0, err
+	}
+
+	return len(toks), nil
+}
+
+// Split cuts text into chunks of at most size tokens. Each chunk starts by repeating up to overlap
+// tokens from the end of the previous one. Chunks break between lines, unless a line alone is longer
+// than size.
+func Split(model, text string, size, overlap int) ([]string, error) {
+	var chunks []string
+	err := SplitReader(model, strings.NewReader(text), size, overlap, func(chunk string) error {
+		chunks = append(chunks, chunk)
+		return nil
+	})
+	return chunks, err
+}
+
+// SplitReader splits the text read from r like Split, passing each chunk to emit as soon as it is
+// complete. Only the current chunk is kept in memory, so inputs larger than memory can be split.
+func SplitReader(model string, r io.Reader, size, overlap int, emit func(chunk string) error) error {
+	if size <= 0 {
+		return fmt.Errorf("chunk size must be positive, got %d", size)
+	}
+
+	enc, err := Encoding(model)
+	if err != nil {
+		return err
+	}
+
+	type piece struct {
+		text   string
+		tokens int
+	}
+
+	var window []piece
+	var total int
+
+	flush := func() error {
+		var chunk strings.Builder
+		for _, p := range window {
+			chunk.WriteString(p.text)
+		}
+		return emit(chunk.String())
+	}
+
+	add := func(p piece) error {
+		for len(window) > 0 && total+p.tokens > size {
+			err := flush()
+			if err != nil {
+				return err
+			}
+
+			// back up into the chunk for the overlap, but always move forward
+			next := len(window)
+			overlapped := 0
+			for next-1 > 0 && overlapped+window[next-1].tokens <= overlap {
+				next--
+				overlapped += window[next].tokens
+			}
+			window = append([]piece(nil), window[next:]...)
+			total = overlapped
+		}
+
+		window = append(window, p)
+		total += p.tokens
+		return nil
+	}
+
+	reader := bufio.NewReader(r)
+	for {
+		line, readErr := reader.ReadString('\n')
+		if readErr != nil && readErr != io.EOF {
+			return readErr
+		}
+
+		if line != "" {
+			toks := enc.EncodeOrdinary(line)
+			for len(toks) > size {
+				err = add(piece{enc.Decode(toks[:size]), size})
+				if err != nil {
+					return err
+				}
+				toks = toks[size:]
+			}
+			err = add(piece{enc.Decode(toks), len(toks)})
+			if err != nil {
+				return err
+			}
+		}
+
+		if readErr == io.EOF {
+			break
+		}
+	}
+
+	if len(window) == 0 {
+		return nil
+	}
+	return flush()
+}
+
+// context window sizes by model name prefix. The longest matching prefix wins.
+var contextWindows = map[string]int{
+	// gpt-3.5-turbo points at the latest snapshot, of 16k since 0125
+	"gpt-3.5-turbo":          16385,
+	"gpt-3.5-turbo-0301":     4096,
+	"gpt-3.5-turbo-0613":     4096,
+	"gpt-3.5-turbo-instruct": 4096,
+	"gpt-3.5-turbo-16k":      16384,
+	"gpt-3.5-turbo-1106":     16385,
+	"gpt-3.5-turbo-0125":     16385,
+	"gpt-4":                  8192,
+	"gpt-4-32k":              32768,
+	"gpt-4-turbo":            128000,
+	"gpt-4-1106":             128000,
+	"gpt-4-0125":             128000,
+	"gpt-4o":                 128000,
+	"gpt-4.1":                1047576,
+}
+
+// DefaultContextWindow is assumed for models missing from the table
+const DefaultContextWindow = 4096
+
+// ContextWindow returns the context size of the model in tokens
+func ContextWindow(model string) int {
+	window := DefaultContextWindow
+	matched := ""
+	for prefix, size := range contextWindows {
+		if strings.HasPrefix(model, prefix) && len(prefix) > len(matched) {
+			matched = prefix
+			window = size
+		}
+	}
+	return window
+}
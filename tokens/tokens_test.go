@@ -0,0 +1,122 @@
+package tokens
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCount(t *testing.T) {
+	testCases := []struct {
+		name     string
+		model    string
+		input    string
+		expected int
+	}{
+		{
+			name:     "empty",
+			model:    "gpt-3.5-turbo",
+			input:    "",
+			expected: 0,
+		},
+		{
+			name:     "gpt-3.5",
+			model:    "gpt-3.5-turbo-0301",
+			input:    "hello world",
+			expected: 2,
+		},
+		{
+			name:     "unknown model falls back to cl100k",
+			model:    "llama3",
+			input:    "hello world",
+			expected: 2,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			n, err := Count(tc.model, tc.input)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, n)
+		})
+	}
+}
+
+func TestSplit(t *testing.T) {
+	testCases := []struct {
+		name     string
+		input    string
+		size     int
+		overlap  int
+		expected []string
+	}{
+		{
+			name:     "fits",
+			input:    "a\nb\n",
+			size:     10,
+			expected: []string{"a\nb\n"},
+		},
+		{
+			name:     "lines",
+			input:    "a\nb\nc\nd\n",
+			size:     4,
+			expected: []string{"a\nb\n", "c\nd\n"},
+		},
+		{
+			name:     "overlap",
+			input:    "a\nb\nc\nd\n",
+			size:     4,
+			overlap:  2,
+			expected: []string{"a\nb\n", "b\nc\n", "c\nd\n"},
+		},
+		{
+			name:     "long line",
+			input:    "one two three four",
+			size:     2,
+			expected: []string{"one two", " three four"},
+		},
+		{
+			name:  "empty",
+			input: "",
+			size:  2,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			chunks, err := Split("gpt-4", tc.input, tc.size, tc.overlap)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, chunks)
+		})
+	}
+}
+
+func TestSplitReader(t *testing.T) {
+	var chunks []string
+	err := SplitReader("gpt-4", iotest.OneByteReader(strings.NewReader("a\nb\nc\nd\n")), 4, 2, func(chunk string) error {
+		chunks = append(chunks, chunk)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a\nb\n", "b\nc\n", "c\nd\n"}, chunks)
+
+	stop := errors.New("stop")
+	err = SplitReader("gpt-4", strings.NewReader("a\nb\nc\nd\n"), 2, 0, func(chunk string) error {
+		return stop
+	})
+	assert.Equal(t, stop, err)
+}
+
+func TestContextWindow(t *testing.T) {
+	assert.Equal(t, 4096, ContextWindow("gpt-3.5-turbo-0301"))
+	assert.Equal(t, 16384, ContextWindow("gpt-3.5-turbo-16k-0613"))
+	assert.Equal(t, 16385, ContextWindow("gpt-3.5-turbo-1106"))
+	assert.Equal(t, 16385, ContextWindow("gpt-3.5-turbo-0125"))
+	assert.Equal(t, 16385, ContextWindow("gpt-3.5-turbo"))
+	assert.Equal(t, 32768, ContextWindow("gpt-4-32k"))
+	assert.Equal(t, 8192, ContextWindow("gpt-4-0613"))
+	assert.Equal(t, DefaultContextWindow, ContextWindow("llama3"))
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/hayeah/pls/jsonschema"
+)
+
+// maxToolRounds stops models that keep calling tools without answering
+const maxToolRounds = 10
+
+// Tool is a function the model may call, declared in the frontmatter:
+//
+//	---
+//	tools:
+//	  - name: get_weather
+//	    description: current weather of a city
+//	    parameters:
+//	      type: object
+//	      properties: {city: {type: string}}
+//	      required: [city]
+//	    command: weather "$(jq -r .city)"
+//	---
+type Tool struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// Parameters is the JSON Schema of the arguments
+	Parameters any `json:"parameters"`
+	// Command runs the call locally, given the arguments as JSON on stdin. Its output is sent back to
+	// the model. Without a command, the calls are printed as JSON instead.
+	Command string `json:"command"`
+
+	// operation is called instead of a command, by the tools generated from the openapi frontmatter
+	operation *toolOperation
+}
+
+// ToolCall is a call of a tool by the model, as printed on stdout
+type ToolCall struct {
+	ID        string          `json:"id"`
+	Name      string          `json:"name"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+// toolRole is the role of tool results, which go-openai doesn't define yet
+const toolRole = "tool"
+
+// toolMessage is a chat message with the tool fields go-openai doesn't support yet
+type toolMessage struct {
+	Role       string         `json:"role"`
+	Content    string         `json:"content"`
+	ToolCalls  []toolCallJSON `json:"tool_calls,omitempty"`
+	ToolCallID string         `json:"tool_call_id,omitempty"`
+}
+
+type toolCallJSON struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+type toolCompletion struct {
+	Choices []struct {
+		Message toolMessage `json:"message"`
+	} `json:"choices"`
+}
+
+// RunTools completes a prompt that declares tools. Calls of tools with a command are run, and their
+// output sent back, until the model answers. Otherwise the calls are the output, as a JSON array.
+func (r *Runner) RunTools(prompt string, fm *TemplateFrontMatter) error {
+	req := r.chat.Request(prompt, fm)
+
+	body, err := requestBody(req)
+	if err != nil {
+		return err
+	}
+	body["tools"] = toolDefinitions(fm.Tools)
+
+	var messages []toolMessage
+	for _, message := range req.Messages {
+		messages = append(messages, toolMessage{Role: message.Role, Content: message.Content})
+	}
+
+	for round := 0; round < maxToolRounds; round++ {
+		body["messages"] = messages
+
+		var completion toolCompletion
+		err = r.postCompletion(req.Model, body, &completion)
+		if err != nil {
+			return err
+		}
+		if len(completion.Choices) == 0 {
+			return errors.New("no response returned")
+		}
+
+		reply := completion.Choices[0].Message
+		if len(reply.ToolCalls) == 0 {
+			err = r.WriteOutput(strings.NewReader(strings.TrimSpace(reply.Content) + "\n"))
+			if err != nil {
+				return err
+			}
+			return r.FinishCompletion(prompt, reply.Content)
+		}
+
+		if !dispatchable(fm.Tools, reply.ToolCalls) {
+			return r.printToolCalls(prompt, reply.ToolCalls)
+		}
+
+		messages = append(messages, reply)
+		for _, call := range reply.ToolCalls {
+			output, err := r.callTool(findTool(fm.Tools, call.Function.Name), call.Function.Arguments)
+			if err != nil {
+				// the model is told about the failure, so it can recover
+				output = "error: " + err.Error()
+			}
+			messages = append(messages, toolMessage{
+				Role:       toolRole,
+				Content:    output,
+				ToolCallID: call.ID,
+			})
+		}
+	}
+
+	return fmt.Errorf("the model was still calling tools after %d rounds", maxToolRounds)
+}
+
+// toolDefinitions returns the tools in the format of the API
+func toolDefinitions(tools []Tool) []map[string]any {
+	var definitions []map[string]any
+	for _, tool := range tools {
+		parameters := jsonschema.Normalize(tool.Parameters)
+		if parameters == nil {
+			parameters = map[string]any{"type": "object", "properties": map[string]any{}}
+		}
+
+		definitions = append(definitions, map[string]any{
+			"type": "function",
+			"function": map[string]any{
+				"name":        tool.Name,
+				"description": tool.Description,
+				"parameters":  parameters,
+			},
+		})
+	}
+	return definitions
+}
+
+func findTool(tools []Tool, name string) *Tool {
+	for i := range tools {
+		if tools[i].Name == name {
+			return &tools[i]
+		}
+	}
+	return nil
+}
+
+// dispatchable reports whether every call is of a known tool with a command or an API operation
+func dispatchable(tools []Tool, calls []toolCallJSON) bool {
+	for _, call := range calls {
+		tool := findTool(tools, call.Function.Name)
+		if tool == nil || (tool.Command == "" && tool.operation == nil) {
+			return false
+		}
+	}
+	return true
+}
+
+// printToolCalls outputs the calls as a JSON array, for scripts to dispatch
+func (r *Runner) printToolCalls(prompt string, calls []toolCallJSON) error {
+	var toolCalls []ToolCall
+	for _, call := range calls {
+		arguments := json.RawMessage(call.Function.Arguments)
+		if !json.Valid(arguments) {
+			// keep the output valid JSON, even if the model's arguments aren't
+			encoded, err := json.Marshal(call.Function.Arguments)
+			if err != nil {
+				return err
+			}
+			arguments = encoded
+		}
+		toolCalls = append(toolCalls, ToolCall{ID: call.ID, Name: call.Function.Name, Arguments: arguments})
+	}
+
+	output, err := json.MarshalIndent(toolCalls, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = r.WriteOutput(strings.NewReader(string(output) + "\n"))
+	if err != nil {
+		return err
+	}
+	return r.FinishCompletion(prompt, string(output))
+}
+
+// runTool runs the command of the tool with the arguments on stdin, and returns its output
+func runTool(tool *Tool, arguments string) (string, error) {
+	fmt.Fprintf(os.Stderr, "[tool %s %s]\n", tool.Name, arguments)
+
+	cmd := exec.Command("sh", "-c", tool.Command)
+	cmd.Stdin = strings.NewReader(arguments)
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(), "PLS_TOOL_NAME="+tool.Name)
+
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("tool %s: %w", tool.Name, err)
+	}
+	return string(out), nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"text/template/parse"
+
+	"github.com/hayeah/pls/promptstr"
+)
+
+// TraceRegion is a piece of the rendered prompt, and the template construct that produced it
+type TraceRegion struct {
+	Construct string
+	Location  string
+	Output    string
+}
+
+// TraceTemplate renders the template like RenderTemplate, but splits the output into the regions
+// produced by each top-level node of the template.
+func TraceTemplate(promptTemplate string, data TemplateData) ([]TraceRegion, error) {
+	var fm TemplateFrontMatter
+	promptBody, err := promptstr.ParseFrontMatter(promptTemplate, &fm, frontMatterOptions...)
+	if err != nil {
+		return nil, err
+	}
+
+	tmpl, err := newPromptTemplate(&fm).Parse(promptBody)
+	if err != nil {
+		return nil, err
+	}
+
+	if tmpl.Tree == nil {
+		return nil, nil
+	}
+
+	// interleave a marker before each node, so the output can be split up after a single
+	// execution. Executing nodes one by one would lose variables declared in the template.
+	var regions []TraceRegion
+	var markers []string
+	var nodes []parse.Node
+	root := tmpl.Tree.Root
+	for i, node := range root.Nodes {
+		marker := fmt.Sprintf("\x00trace:%d\x00", i)
+		markers = append(markers, marker)
+		nodes = append(nodes, &parse.TextNode{NodeType: parse.NodeText, Pos: node.Position(), Text: []byte(marker)}, node)
+
+		location, _ := tmpl.Tree.ErrorContext(node)
+		regions = append(regions, TraceRegion{
+			Construct: describeNode(node),
+			Location:  location,
+		})
+	}
+	root.Nodes = nodes
+
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, data)
+	if err != nil {
+		return nil, err
+	}
+
+	output := buf.String()
+	for i := range regions {
+		start := strings.Index(output, markers[i]) + len(markers[i])
+		end := len(output)
+		if i+1 < len(markers) {
+			end = strings.Index(output, markers[i+1])
+		}
+		regions[i].Output = output[start:end]
+	}
+
+	return regions, nil
+}
+
+func describeNode(node parse.Node) string {
+	if node.Type() == parse.NodeText {
+		return "text"
+	}
+
+	construct := node.String()
+	if i := strings.Index(construct, "}}"); i >= 0 && i+2 < len(construct) {
+		// control structures print their whole body, only show the opening action
+		construct = construct[:i+2] + "..."
+	}
+	return construct
+}
+
+// TracePrompt prints the rendered prompt, with a header before each region naming the template construct
+func (r *Runner) TracePrompt() error {
+	prompt, data, err := r.PrepareTemplate()
+	if err != nil {
+		return err
+	}
+
+	regions, err := TraceTemplate(prompt, data)
+	if err != nil {
+		return err
+	}
+
+	for _, region := range regions {
+		fmt.Fprintf(os.Stdout, "----- %s @ %s -----\n", region.Construct, region.Location)
+		fmt.Fprint(os.Stdout, region.Output)
+		if !strings.HasSuffix(region.Output, "\n") {
+			fmt.Fprintln(os.Stdout)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// TransportConfig tunes the HTTP connections to the model API. All requests of a run, and of the
+// proxy, share one connection pool, so keeping idle connections avoids a TLS handshake per request.
+type TransportConfig struct {
+	// MaxIdleConns limits the idle connections kept across hosts, 100 by default
+	MaxIdleConns int `yaml:"max_idle_conns"`
+	// MaxIdleConnsPerHost limits the idle connections kept to each host
+	MaxIdleConnsPerHost int `yaml:"max_idle_conns_per_host"`
+	// IdleConnTimeout closes connections idle for longer, e.g. 90s
+	IdleConnTimeout time.Duration `yaml:"idle_conn_timeout"`
+	// DisableHTTP2 uses HTTP/1.1, for gateways with broken HTTP/2 support
+	DisableHTTP2 bool `yaml:"disable_http2"`
+	// DNSCache keeps resolved addresses for this long, e.g. 5m. 0 resolves every new connection.
+	DNSCache time.Duration `yaml:"dns_cache"`
+}
+
+// RoundTripper returns the transport the model API clients share
+func (c TransportConfig) RoundTripper() http.RoundTripper {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if c.MaxIdleConns != 0 {
+		transport.MaxIdleConns = c.MaxIdleConns
+	}
+	if c.MaxIdleConnsPerHost != 0 {
+		transport.MaxIdleConnsPerHost = c.MaxIdleConnsPerHost
+	}
+	if c.IdleConnTimeout != 0 {
+		transport.IdleConnTimeout = c.IdleConnTimeout
+	}
+
+	if c.DisableHTTP2 {
+		// a non-nil empty map turns off the HTTP/2 upgrade
+		transport.ForceAttemptHTTP2 = false
+		transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+
+	if c.DNSCache > 0 {
+		dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+		cache := &dnsCache{ttl: c.DNSCache, entries: map[string]dnsEntry{}}
+		transport.DialContext = cache.dialer(dialer)
+	}
+
+	return transport
+}
+
+type dnsEntry struct {
+	addrs   []string
+	expires time.Time
+}
+
+// dnsCache resolves hosts once per ttl
+type dnsCache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[string]dnsEntry
+}
+
+func (c *dnsCache) lookup(ctx context.Context, host string) ([]string, error) {
+	c.mu.Lock()
+	entry, ok := c.entries[host]
+	c.mu.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.addrs, nil
+	}
+
+	addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.entries[host] = dnsEntry{addrs: addrs, expires: time.Now().Add(c.ttl)}
+	c.mu.Unlock()
+	return addrs, nil
+}
+
+// dialer dials the cached addresses of the host in turn, until one connects
+func (c *dnsCache) dialer(dialer *net.Dialer) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+
+		if net.ParseIP(host) != nil {
+			return dialer.DialContext(ctx, network, addr)
+		}
+
+		addrs, err := c.lookup(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, ip := range addrs {
+			var conn net.Conn
+			conn, err = dialer.DialContext(ctx, network, net.JoinHostPort(ip, port))
+			if err == nil {
+				return conn, nil
+			}
+		}
+		return nil, err
+	}
+}
@@ -0,0 +1,570 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/hayeah/pls/tokens"
+)
+
+const (
+	UsageByDay    = "day"
+	UsageByPrompt = "prompt"
+	UsageByModel  = "model"
+	UsageByTag    = "tag"
+)
+
+// untagged is the group of the requests without the tag, in pls usage --by tag
+const untagged = "(untagged)"
+
+// UsageRecord is a request to the API, appended to the usage log
+type UsageRecord struct {
+	Time   time.Time `json:"time"`
+	Prompt string    `json:"prompt"`
+	Model  string    `json:"model"`
+
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	// Latency is how long the request took, until the end of the response
+	LatencyMS int64 `json:"latency_ms"`
+	// Cost is the estimated cost in dollars, nil for models without a known price
+	Cost *float64 `json:"cost"`
+	// Cached responses didn't cost anything
+	Cached bool `json:"cached,omitempty"`
+	// Tags attribute the cost to a project, team or client, from --tag and the tags of the frontmatter
+	Tags map[string]string `json:"tags,omitempty"`
+}
+
+// UsageExportFormats are the formats of pls usage export
+var UsageExportFormats = []string{"csv", "json"}
+
+type UsageArgs struct {
+	By   string `arg:"--by" default:"day" help:"group the spend by day, prompt, model or tag. --by tag=name groups by the values of the tag name. A request with many tags is counted in each of their groups."`
+	Days int    `arg:"--days" default:"30" help:"report the last N days. 0 is everything."`
+}
+
+type UsageExportArgs struct {
+	From   string `arg:"--from" help:"export the requests since this month or day, e.g. 2024-01 or 2024-01-15. Everything by default."`
+	To     string `arg:"--to" help:"export the requests until the end of this month or day"`
+	Format string `arg:"--format" default:"csv" help:"csv, with a column per tag, or json"`
+}
+
+// usageMu serializes the appends of concurrent completions to the log
+var usageMu sync.Mutex
+
+// UsageLogPath returns the file of the usage log
+func UsageLogPath() (string, error) {
+	dir, err := DataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "usage.jsonl"), nil
+}
+
+// promptName is the name the usage of the run is reported under: the template, or the subcommand
+func (r *Runner) promptName() string {
+	name := r.templatePath
+	if name == "" {
+		name = r.args.PromptFile
+	}
+	if name == "" && len(os.Args) > 1 {
+		return os.Args[1]
+	}
+	return strings.TrimSuffix(filepath.Base(name), filepath.Ext(name))
+}
+
+// recordUsage adds the cost of the request to the budget of the run, and appends it to the usage log
+// unless disabled with no_usage_log. It's mirrored to the server of usage_report if configured.
+// Failing to record is reported, but doesn't fail the run.
+func (r *Runner) recordUsage(record UsageRecord) {
+	if record.Cached {
+		free := 0.0
+		record.Cost = &free
+	} else if cost, ok := Cost(record.Model, record.PromptTokens, record.CompletionTokens); ok {
+		record.Cost = &cost
+		r.chat.budget.spend(cost)
+	}
+
+	report := r.config.UsageReport.URL != ""
+	if r.config.NoUsageLog && !report {
+		return
+	}
+
+	record.Time = time.Now()
+	record.Prompt = r.promptName()
+	record.Tags = r.usageTags()
+
+	if !r.config.NoUsageLog {
+		err := appendUsage(record)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "[usage log: %v]\n", err)
+		}
+	}
+
+	if report {
+		err := r.reportUsage(record)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "[%v]\n", err)
+		}
+	}
+}
+
+// usageTags are the tags of the frontmatter, overridden by --tag
+func (r *Runner) usageTags() map[string]string {
+	tags := map[string]string{}
+	if r.frontMatter != nil {
+		for name, value := range r.frontMatter.Tags {
+			tags[name] = value
+		}
+	}
+	for name, value := range r.args.Tags {
+		tags[name] = value
+	}
+	if len(tags) == 0 {
+		return nil
+	}
+	return tags
+}
+
+func appendUsage(record UsageRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	path, err := UsageLogPath()
+	if err != nil {
+		return err
+	}
+
+	usageMu.Lock()
+	defer usageMu.Unlock()
+
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(line, '\n'))
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// usageStream records the usage of a streamed completion once it ends: when it's read to the end, fails
+// or is closed early, since the tokens received until then are billed. Streamed responses don't
+// report their usage, so the tokens are counted.
+type usageStream struct {
+	io.ReadCloser
+	runner   *Runner
+	model    string
+	messages []string
+	start    time.Time
+	cached   bool
+
+	received strings.Builder
+	recorded bool
+}
+
+func (s *usageStream) Read(p []byte) (int, error) {
+	n, err := s.ReadCloser.Read(p)
+	s.received.Write(p[:n])
+
+	if err != nil {
+		s.record()
+	}
+	return n, err
+}
+
+func (s *usageStream) Close() error {
+	s.record()
+	return s.ReadCloser.Close()
+}
+
+// record records the usage of what was received, once
+func (s *usageStream) record() {
+	if s.recorded {
+		return
+	}
+	s.recorded = true
+
+	var promptTokens int
+	for _, message := range s.messages {
+		promptTokens += countTokens(s.model, message)
+	}
+	s.runner.recordUsage(UsageRecord{
+		Model:            s.model,
+		PromptTokens:     promptTokens,
+		CompletionTokens: countTokens(s.model, s.received.String()),
+		LatencyMS:        time.Since(s.start).Milliseconds(),
+		Cached:           s.cached,
+	})
+}
+
+// countTokens counts the tokens of the text, or estimates them if the tokenizer isn't available
+func countTokens(model string, text string) int {
+	n, err := tokens.Count(model, text)
+	if err != nil {
+		return len(text) / 4
+	}
+	return n
+}
+
+// stream sends the prompt, and records the usage of the streamed completion
+func (r *Runner) stream(prompt string, fm *TemplateFrontMatter) (io.ReadCloser, error) {
+	req := r.chat.Request(prompt, fm)
+	var messages []string
+	for _, message := range req.Messages {
+		messages = append(messages, message.Content)
+	}
+
+	start := time.Now()
+	progress := r.startProgress(req.Model)
+	stream, err := r.chat.Stream(prompt, fm)
+	if err != nil {
+		progress.stop()
+		return nil, err
+	}
+
+	_, cached := stream.(cacheHit)
+	if cached {
+		progress.stop()
+	} else if progress != nil {
+		stream = &progressStream{ReadCloser: stream, progress: progress}
+	}
+
+	return &usageStream{
+		ReadCloser: stream,
+		runner:     r,
+		model:      req.Model,
+		messages:   messages,
+		start:      start,
+		cached:     cached,
+	}, nil
+}
+
+// completionUsage is the usage of a completion that isn't streamed, as reported by the API. It's
+// counted if the API doesn't report it.
+func completionUsage(model string, messages []string, completion json.RawMessage, latency time.Duration, cached bool) UsageRecord {
+	var response struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+		Usage struct {
+			PromptTokens     int `json:"prompt_tokens"`
+			CompletionTokens int `json:"completion_tokens"`
+		} `json:"usage"`
+	}
+	// the caller reports a completion that does not decode
+	json.Unmarshal(completion, &response)
+
+	record := UsageRecord{
+		Model:            model,
+		PromptTokens:     response.Usage.PromptTokens,
+		CompletionTokens: response.Usage.CompletionTokens,
+		LatencyMS:        latency.Milliseconds(),
+		Cached:           cached,
+	}
+	if record.PromptTokens == 0 {
+		for _, message := range messages {
+			record.PromptTokens += countTokens(model, message)
+		}
+		for _, choice := range response.Choices {
+			record.CompletionTokens += countTokens(model, choice.Message.Content)
+		}
+	}
+	return record
+}
+
+// ReadUsage returns the records of the usage log since the time
+func ReadUsage(since time.Time) ([]UsageRecord, error) {
+	path, err := UsageLogPath()
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var records []UsageRecord
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		var record UsageRecord
+		err := json.Unmarshal(scanner.Bytes(), &record)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		if !record.Time.Before(since) {
+			records = append(records, record)
+		}
+	}
+	return records, scanner.Err()
+}
+
+// usageGroup is the spend of the requests with the same day, prompt, model or tag
+type usageGroup struct {
+	key              string
+	requests         int
+	promptTokens     int
+	completionTokens int
+	cost             float64
+	// unpriced counts the requests to models without a known price, which the cost doesn't include
+	unpriced int
+}
+
+func (g *usageGroup) add(record UsageRecord) {
+	g.requests++
+	g.promptTokens += record.PromptTokens
+	g.completionTokens += record.CompletionTokens
+	if record.Cost == nil {
+		g.unpriced++
+		return
+	}
+	g.cost += *record.Cost
+}
+
+// groupUsage totals the records by the day, prompt, model or tag. Days are in order, the others are
+// sorted by cost.
+func groupUsage(records []UsageRecord, by string) ([]*usageGroup, error) {
+	var keysOf func(UsageRecord) []string
+	tagName, byTagValue := strings.CutPrefix(by, UsageByTag+"=")
+	switch {
+	case by == UsageByDay:
+		keysOf = func(record UsageRecord) []string { return []string{record.Time.Local().Format("2006-01-02")} }
+	case by == UsageByPrompt:
+		keysOf = func(record UsageRecord) []string { return []string{record.Prompt} }
+	case by == UsageByModel:
+		keysOf = func(record UsageRecord) []string { return []string{record.Model} }
+	case by == UsageByTag:
+		keysOf = tagKeys
+	case byTagValue && tagName != "":
+		keysOf = func(record UsageRecord) []string {
+			value, ok := record.Tags[tagName]
+			if !ok {
+				return []string{untagged}
+			}
+			return []string{value}
+		}
+	default:
+		return nil, fmt.Errorf("usage: --by must be %s, %s, %s, %s or %s=name, got %q", UsageByDay, UsageByPrompt, UsageByModel, UsageByTag, UsageByTag, by)
+	}
+
+	groups := map[string]*usageGroup{}
+	var ordered []*usageGroup
+	for _, record := range records {
+		for _, key := range keysOf(record) {
+			group, ok := groups[key]
+			if !ok {
+				group = &usageGroup{key: key}
+				groups[key] = group
+				ordered = append(ordered, group)
+			}
+			group.add(record)
+		}
+	}
+
+	sort.SliceStable(ordered, func(i, j int) bool {
+		if by == UsageByDay {
+			return ordered[i].key < ordered[j].key
+		}
+		return ordered[i].cost > ordered[j].cost
+	})
+	return ordered, nil
+}
+
+// tagKeys are the tags of the record as name=value, in order
+func tagKeys(record UsageRecord) []string {
+	if len(record.Tags) == 0 {
+		return []string{untagged}
+	}
+	var keys []string
+	for name, value := range record.Tags {
+		keys = append(keys, name+"="+value)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// runUsage reports the spend of the recorded requests, or exports them with pls usage export
+func runUsage(argv []string) error {
+	if len(argv) > 0 && argv[0] == "export" {
+		return runUsageExport(argv[1:])
+	}
+
+	var args UsageArgs
+	parseArgs("pls usage", &args, argv)
+
+	var since time.Time
+	if args.Days > 0 {
+		now := time.Now()
+		since = time.Date(now.Year(), now.Month(), now.Day()-args.Days+1, 0, 0, 0, 0, now.Location())
+	}
+
+	records, err := ReadUsage(since)
+	if err != nil {
+		return err
+	}
+
+	groups, err := groupUsage(records, args.By)
+	if err != nil {
+		return err
+	}
+	if len(groups) == 0 {
+		fmt.Fprintln(os.Stderr, "no usage is recorded yet")
+		return nil
+	}
+
+	total := &usageGroup{key: "total"}
+	for _, record := range records {
+		total.add(record)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(w, "%s\trequests\tprompt tokens\tcompletion tokens\tcost\t\n", args.By)
+	for _, group := range append(groups, total) {
+		cost := fmt.Sprintf("$%.4f", group.cost)
+		if group.unpriced > 0 {
+			cost += fmt.Sprintf(" (+%d unpriced)", group.unpriced)
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%s\t\n", group.key, group.requests, group.promptTokens, group.completionTokens, cost)
+	}
+	return w.Flush()
+}
+
+// runUsageExport writes the recorded requests between --from and --to to stdout, a row per request
+func runUsageExport(argv []string) error {
+	var args UsageExportArgs
+	parseArgs("pls usage export", &args, argv)
+
+	if !containsString(UsageExportFormats, args.Format) {
+		return fmt.Errorf("usage export: --format must be one of %s, got %q", strings.Join(UsageExportFormats, ", "), args.Format)
+	}
+
+	var since, until time.Time
+	var err error
+	if args.From != "" {
+		since, _, err = parseUsagePeriod("--from", args.From)
+		if err != nil {
+			return err
+		}
+	}
+	if args.To != "" {
+		_, until, err = parseUsagePeriod("--to", args.To)
+		if err != nil {
+			return err
+		}
+	}
+
+	records, err := ReadUsage(since)
+	if err != nil {
+		return err
+	}
+	if !until.IsZero() {
+		var before []UsageRecord
+		for _, record := range records {
+			if record.Time.Before(until) {
+				before = append(before, record)
+			}
+		}
+		records = before
+	}
+
+	if args.Format == "json" {
+		if records == nil {
+			records = []UsageRecord{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(records)
+	}
+	return writeUsageCSV(os.Stdout, records)
+}
+
+// parseUsagePeriod parses a month as 2024-01 or a day as 2024-01-15, in local time, and returns its
+// start and end
+func parseUsagePeriod(flag string, value string) (time.Time, time.Time, error) {
+	if t, err := time.ParseInLocation("2006-01", value, time.Local); err == nil {
+		return t, t.AddDate(0, 1, 0), nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, t.AddDate(0, 0, 1), nil
+	}
+	return time.Time{}, time.Time{}, fmt.Errorf("usage export: %s must be a month or day, as 2024-01 or 2024-01-15, got %q", flag, value)
+}
+
+// writeUsageCSV writes the records as CSV, with a tag.name column for each tag of the records. The
+// cost of unpriced models is empty.
+func writeUsageCSV(w io.Writer, records []UsageRecord) error {
+	var tagNames []string
+	for _, record := range records {
+		for name := range record.Tags {
+			if !containsString(tagNames, name) {
+				tagNames = append(tagNames, name)
+			}
+		}
+	}
+	sort.Strings(tagNames)
+
+	out := csv.NewWriter(w)
+	header := []string{"time", "prompt", "model", "prompt_tokens", "completion_tokens", "cost", "cached"}
+	for _, name := range tagNames {
+		header = append(header, "tag."+name)
+	}
+	err := out.Write(header)
+	if err != nil {
+		return err
+	}
+
+	for _, record := range records {
+		var cost string
+		if record.Cost != nil {
+			cost = strconv.FormatFloat(*record.Cost, 'f', -1, 64)
+		}
+		row := []string{
+			record.Time.Local().Format(time.RFC3339),
+			record.Prompt,
+			record.Model,
+			strconv.Itoa(record.PromptTokens),
+			strconv.Itoa(record.CompletionTokens),
+			cost,
+			strconv.FormatBool(record.Cached),
+		}
+		for _, name := range tagNames {
+			row = append(row, record.Tags[name])
+		}
+		err := out.Write(row)
+		if err != nil {
+			return err
+		}
+	}
+
+	out.Flush()
+	return out.Error()
+}
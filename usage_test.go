@@ -0,0 +1,132 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGroupUsageByTag(t *testing.T) {
+	cost := func(dollars float64) *float64 { return &dollars }
+	records := []UsageRecord{
+		{Prompt: "review", Cost: cost(0.5), Tags: map[string]string{"project": "payments", "team": "core"}},
+		{Prompt: "review", Cost: cost(0.25), Tags: map[string]string{"project": "search"}},
+		{Prompt: "summarize", Cost: cost(1)},
+		{Prompt: "summarize", Tags: map[string]string{"project": "payments"}},
+	}
+
+	testCases := []struct {
+		by   string
+		want map[string]int
+		err  string
+	}{
+		{
+			by:   "tag",
+			want: map[string]int{untagged: 1, "project=payments": 2, "project=search": 1, "team=core": 1},
+		},
+		{
+			by:   "tag=project",
+			want: map[string]int{untagged: 1, "payments": 2, "search": 1},
+		},
+		{
+			by:   "tag=team",
+			want: map[string]int{untagged: 3, "core": 1},
+		},
+		{
+			by:  "tag=",
+			err: `usage: --by must be day, prompt, model, tag or tag=name, got "tag="`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.by, func(t *testing.T) {
+			groups, err := groupUsage(records, tc.by)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+				return
+			}
+			assert.NoError(t, err)
+
+			requests := map[string]int{}
+			for _, group := range groups {
+				requests[group.key] = group.requests
+			}
+			assert.Equal(t, tc.want, requests)
+		})
+	}
+
+	groups, err := groupUsage(records, "tag=project")
+	assert.NoError(t, err)
+	assert.Equal(t, untagged, groups[0].key, "sorted by cost")
+	assert.Equal(t, 1, groups[1].unpriced)
+}
+
+func TestUsageTags(t *testing.T) {
+	r := &Runner{
+		args:        Args{Tags: map[string]string{"client": "acme"}},
+		frontMatter: &TemplateFrontMatter{Tags: map[string]string{"project": "payments", "client": "internal"}},
+	}
+	assert.Equal(t, map[string]string{"project": "payments", "client": "acme"}, r.usageTags())
+
+	r = &Runner{frontMatter: &TemplateFrontMatter{}}
+	assert.Nil(t, r.usageTags())
+}
+
+func TestParseUsagePeriod(t *testing.T) {
+	testCases := []struct {
+		value string
+		start string
+		end   string
+		err   string
+	}{
+		{value: "2024-01", start: "2024-01-01", end: "2024-02-01"},
+		{value: "2024-12", start: "2024-12-01", end: "2025-01-01"},
+		{value: "2024-02-29", start: "2024-02-29", end: "2024-03-01"},
+		{value: "2024", err: `usage export: --from must be a month or day, as 2024-01 or 2024-01-15, got "2024"`},
+		{value: "2024-13", err: `usage export: --from must be a month or day, as 2024-01 or 2024-01-15, got "2024-13"`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.value, func(t *testing.T) {
+			start, end, err := parseUsagePeriod("--from", tc.value)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.start, start.Format("2006-01-02"))
+			assert.Equal(t, tc.end, end.Format("2006-01-02"))
+			assert.Equal(t, time.Local, start.Location())
+		})
+	}
+}
+
+func TestWriteUsageCSV(t *testing.T) {
+	at := time.Date(2024, 1, 15, 9, 30, 0, 0, time.Local)
+	cost := 0.0123
+	records := []UsageRecord{
+		{Time: at, Prompt: "review", Model: "gpt-4", PromptTokens: 100, CompletionTokens: 20, Cost: &cost, Tags: map[string]string{"project": "payments", "team": "core"}},
+		{Time: at, Prompt: "notes, weekly", Model: "llama3", PromptTokens: 5, CompletionTokens: 7, Tags: map[string]string{"project": "search"}},
+		{Time: at, Prompt: "review", Model: "gpt-4", Cost: &cost, Cached: true},
+	}
+
+	var out strings.Builder
+	err := writeUsageCSV(&out, records)
+	assert.NoError(t, err)
+
+	stamp := at.Format(time.RFC3339)
+	assert.Equal(t, strings.Join([]string{
+		"time,prompt,model,prompt_tokens,completion_tokens,cost,cached,tag.project,tag.team",
+		stamp + ",review,gpt-4,100,20,0.0123,false,payments,core",
+		stamp + `,"notes, weekly",llama3,5,7,,false,search,`,
+		stamp + ",review,gpt-4,0,0,0.0123,true,,",
+		"",
+	}, "\n"), out.String())
+
+	out.Reset()
+	err = writeUsageCSV(&out, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "time,prompt,model,prompt_tokens,completion_tokens,cost,cached\n", out.String())
+}
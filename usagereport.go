@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os/user"
+	"time"
+)
+
+// usageReportTimeout is how long a run waits for the usage report server
+const usageReportTimeout = 10 * time.Second
+
+// UsageReportConfig mirrors the usage records to a server, where an org totals the spend of its
+// developers
+type UsageReportConfig struct {
+	// URL is sent each usage record as a JSON POST, e.g. https://usage.example.com/pls
+	URL string `yaml:"url"`
+	// TokenEnv is the environment variable holding the bearer token of the server
+	TokenEnv string `yaml:"token_env"`
+	// User names the developer in the reports, the login name by default
+	User string `yaml:"user"`
+}
+
+// usageReport is the body POSTed to usage_report.url
+type usageReport struct {
+	UsageRecord
+	User string `json:"user"`
+}
+
+// reportUsage POSTs the usage record to the server of usage_report
+func (r *Runner) reportUsage(record UsageRecord) error {
+	config := r.config.UsageReport
+
+	token, err := requireToken(config.TokenEnv, "usage_report")
+	if err != nil {
+		return err
+	}
+
+	name := config.User
+	if name == "" {
+		current, err := user.Current()
+		if err != nil {
+			return fmt.Errorf("usage_report: %w", err)
+		}
+		name = current.Username
+	}
+
+	body, err := json.Marshal(usageReport{UsageRecord: record, User: name})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), usageReportTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, config.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("usage_report: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	client := r.httpClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("usage_report: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("usage_report: %s %s: %s", req.Method, req.URL, res.Status)
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecordUsageReport(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	t.Setenv("PLS_USAGE_TOKEN", "secret")
+
+	var reports []map[string]any
+	var auth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		auth = req.Header.Get("Authorization")
+		var report map[string]any
+		assert.NoError(t, json.NewDecoder(req.Body).Decode(&report))
+		reports = append(reports, report)
+	}))
+	defer server.Close()
+
+	config := DefaultConfig()
+	config.NoUsageLog = true
+	config.UsageReport.URL = server.URL
+	config.UsageReport.User = "ada"
+	r := &Runner{
+		config: config,
+		args:   Args{PromptFile: "review.md", Tags: map[string]string{"project": "payments"}},
+	}
+
+	r.recordUsage(UsageRecord{Model: "llama3", PromptTokens: 10, CompletionTokens: 5})
+
+	assert.Equal(t, "Bearer secret", auth)
+	if assert.Len(t, reports, 1) {
+		report := reports[0]
+		assert.Equal(t, "ada", report["user"])
+		assert.Equal(t, "review", report["prompt"])
+		assert.Equal(t, "llama3", report["model"])
+		assert.Equal(t, 10.0, report["prompt_tokens"])
+		assert.Equal(t, map[string]any{"project": "payments"}, report["tags"])
+		assert.NotEmpty(t, report["time"])
+	}
+
+	// no_usage_log still keeps the record off the disk
+	path, err := UsageLogPath()
+	assert.NoError(t, err)
+	_, err = os.Stat(path)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestReportUsageErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	config := DefaultConfig()
+	config.UsageReport.URL = server.URL
+	config.UsageReport.User = "ada"
+	r := &Runner{config: config}
+
+	t.Setenv("PLS_USAGE_TOKEN", "")
+	assert.EqualError(t, r.reportUsage(UsageRecord{}), "usage_report: PLS_USAGE_TOKEN is not set")
+
+	t.Setenv("PLS_USAGE_TOKEN", "wrong")
+	assert.EqualError(t, r.reportUsage(UsageRecord{}), "usage_report: POST "+server.URL+": 403 Forbidden")
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// VarSpec declares a template variable in the frontmatter:
+//
+//	---
+//	vars:
+//	  language: {default: go}
+//	  style: {required: true, description: "e.g. terse or friendly"}
+//	  lines: {type: int, default: 10}
+//	---
+type VarSpec struct {
+	// Type is string (the default), int, number or bool
+	Type        string `json:"type"`
+	Default     string `json:"default"`
+	Required    bool   `json:"required"`
+	Description string `json:"description"`
+}
+
+// BindVars checks the --var values against the variables declared by the frontmatter, and fills in
+// the defaults. Without declared variables, the values are used as they are.
+func BindVars(specs map[string]VarSpec, values map[string]string) (map[string]string, error) {
+	if len(specs) == 0 {
+		return values, nil
+	}
+
+	var unknown []string
+	for name := range values {
+		if _, ok := specs[name]; !ok {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, fmt.Errorf("unknown variables: %s (declared: %s)", strings.Join(unknown, ", "), strings.Join(varNames(specs), ", "))
+	}
+
+	bound := map[string]string{}
+	var missing []string
+	for _, name := range varNames(specs) {
+		spec := specs[name]
+
+		value, ok := values[name]
+		if !ok {
+			if spec.Required {
+				missing = append(missing, varUsage(name, spec))
+				continue
+			}
+			value = spec.Default
+		}
+
+		if ok {
+			err := checkVarType(spec.Type, value)
+			if err != nil {
+				return nil, fmt.Errorf("variable %s: %w", name, err)
+			}
+		}
+
+		bound[name] = value
+	}
+
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("missing variables, set them with --var:\n  %s", strings.Join(missing, "\n  "))
+	}
+
+	return bound, nil
+}
+
+func checkVarType(typ string, value string) error {
+	var err error
+	switch typ {
+	case "", "string":
+	case "int":
+		_, err = strconv.Atoi(value)
+	case "number":
+		_, err = strconv.ParseFloat(value, 64)
+	case "bool":
+		_, err = strconv.ParseBool(value)
+	default:
+		return fmt.Errorf("unknown type %q, expected string, int, number or bool", typ)
+	}
+
+	if err != nil {
+		return fmt.Errorf("%q is not a valid %s", value, typ)
+	}
+	return nil
+}
+
+func varUsage(name string, spec VarSpec) string {
+	usage := "--var " + name + "=..."
+	if spec.Description != "" {
+		usage += "  " + spec.Description
+	}
+	return usage
+}
+
+func varNames(specs map[string]VarSpec) []string {
+	var names []string
+	for name := range specs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}